@@ -3,6 +3,7 @@ package main
 import (
 	"fmt"
 	"log"
+	"os"
 	"runtime"
 
 	"github.com/gin-gonic/gin"
@@ -12,17 +13,24 @@ import (
 	"github.com/windoze95/saltybytes-api/internal/router"
 )
 
-// init is called before the main function.
-func init() {
-	// Configure the logger
+// Entry point for the API.
+func main() {
+	// Prompt authors render templates without starting the API
+	if len(os.Args) > 1 && os.Args[1] == "render-prompt" {
+		os.Exit(renderPrompt(os.Args[2:]))
+	}
+
+	// Operators promote the first admin by user ID without starting the API
+	if len(os.Args) > 1 && os.Args[1] == "promote-admin" {
+		os.Exit(promoteAdmin(os.Args[2:]))
+	}
+
+	// Configure the logger, only once the API is starting since the subcommands above write to stdout
 	ConfigureLogger()
 
 	// Configure the runtime
 	ConfigureRuntime()
-}
 
-// Entry point for the API.
-func main() {
 	// Load the config
 	var cfg *config.Config
 	if c, err := config.LoadConfig("configs/config.json"); err != nil {
@@ -46,6 +54,11 @@ func main() {
 		log.Fatalf("Error loading OpenAI prompts: %v", err)
 	}
 
+	// Check that every OpenAI prompt template renders
+	if err := cfg.OpenaiPrompts.Validate(); err != nil {
+		log.Fatalf("Error validating OpenAI prompts: %v", err)
+	}
+
 	// Connect to the database
 	database, err := db.New(cfg)
 	if err != nil {
@@ -54,7 +67,10 @@ func main() {
 	defer database.Close()
 
 	// Create a new gin router
-	r := router.SetupRouter(cfg, database)
+	r, err := router.SetupRouter(cfg, database)
+	if err != nil {
+		log.Fatalf("Error setting up the router: %v", err)
+	}
 
 	// Run the server
 	r.Run(":" + cfg.Env.Port.Value())
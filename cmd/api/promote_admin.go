@@ -0,0 +1,65 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+
+	"github.com/windoze95/saltybytes-api/internal/config"
+	"github.com/windoze95/saltybytes-api/internal/db"
+	"github.com/windoze95/saltybytes-api/internal/models"
+	"github.com/windoze95/saltybytes-api/internal/repository"
+)
+
+// promoteAdmin gives the admin role to a user by their ID, so there is an admin to grant roles
+// through the admin API:
+//
+//	api promote-admin <user id>
+//
+// Users are promoted by ID rather than username, because usernames can be changed by their users.
+// Returns the exit code.
+func promoteAdmin(args []string) int {
+	flags := flag.NewFlagSet("promote-admin", flag.ContinueOnError)
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if flags.NArg() != 1 {
+		fmt.Fprintln(os.Stderr, "Usage: api promote-admin <user id>")
+		return 2
+	}
+
+	userID, err := strconv.ParseUint(flags.Arg(0), 10, 64)
+	if err != nil || userID == 0 {
+		fmt.Fprintf(os.Stderr, "Invalid user ID: %s\n", flags.Arg(0))
+		return 2
+	}
+
+	cfg, err := config.LoadConfig("configs/config.json")
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error loading config: %v\n", err)
+		return 1
+	}
+
+	database, err := db.New(cfg)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error connecting to the database: %v\n", err)
+		return 1
+	}
+	defer database.Close()
+
+	adminRepo := repository.NewAdminRepository(database)
+	user, err := adminRepo.GetUser(uint(userID))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error retrieving user %d: %v\n", userID, err)
+		return 1
+	}
+
+	if err := adminRepo.UpdateUserRole(user.ID, models.RoleAdmin); err != nil {
+		fmt.Fprintf(os.Stderr, "Error promoting user %d: %v\n", userID, err)
+		return 1
+	}
+
+	fmt.Printf("Promoted user %d (%s) to admin\n", user.ID, user.Username)
+	return 0
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/windoze95/saltybytes-api/internal/config"
+	"github.com/windoze95/saltybytes-api/internal/prompts"
+)
+
+// renderPrompt renders a prompt template the way the API does, with sample data, so prompt authors
+// can check a template before uploading it:
+//
+//	api render-prompt [-kind sys|user] [-data sample.json] [template file]
+//
+// The template is read from stdin without a file. The sample data is a JSON object with the fields
+// of prompts.Context, any left out keep their defaults. Returns the exit code.
+func renderPrompt(args []string) int {
+	flags := flag.NewFlagSet("render-prompt", flag.ContinueOnError)
+	kind := flags.String("kind", "sys", "kind of prompt template, sys or user")
+	dataPath := flags.String("data", "", "JSON file with sample data overriding the defaults")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if k := prompts.Kind(*kind); k != prompts.KindSys && k != prompts.KindUser {
+		fmt.Fprintf(os.Stderr, "Unknown kind of prompt template: %s\n", *kind)
+		return 2
+	}
+
+	name := "stdin"
+	var text []byte
+	var err error
+	if flags.NArg() > 0 {
+		name = flags.Arg(0)
+		text, err = os.ReadFile(name)
+	} else {
+		text, err = io.ReadAll(os.Stdin)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error reading prompt template: %v\n", err)
+		return 1
+	}
+
+	data := prompts.SampleContext()
+	if *dataPath != "" {
+		file, err := os.ReadFile(*dataPath)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error reading sample data: %v\n", err)
+			return 1
+		}
+
+		decoder := json.NewDecoder(bytes.NewReader(file))
+		decoder.DisallowUnknownFields()
+		if err := decoder.Decode(&data); err != nil {
+			fmt.Fprintf(os.Stderr, "Error parsing sample data: %v\n", err)
+			return 1
+		}
+	}
+
+	// The template is checked the way the API checks it at startup
+	if err := prompts.Validate(name, string(text), prompts.Kind(*kind)); err != nil {
+		fmt.Fprintf(os.Stderr, "Error validating prompt template: %v\n", err)
+		return 1
+	}
+
+	var openaiPrompts config.OpenaiPrompts
+	var prompt string
+	switch prompts.Kind(*kind) {
+	case prompts.KindSys:
+		prompt, err = openaiPrompts.FillSysPrompt(config.OpenaiPromptTemplate(text), data.UnitSystem, data.Requirements, data.DietaryRestrictions)
+	case prompts.KindUser:
+		prompt, err = openaiPrompts.FillUserPrompt(config.OpenaiPromptTemplate(text), data.UserPrompt)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error rendering prompt template: %v\n", err)
+		return 1
+	}
+
+	fmt.Println(prompt)
+	return 0
+}
@@ -3,13 +3,13 @@ module github.com/windoze95/saltybytes-api
 go 1.20
 
 require (
+	github.com/aws/aws-sdk-go-v2/credentials v1.16.16
 	github.com/jinzhu/gorm v1.9.16
 	github.com/sashabaranov/go-openai v1.17.10
 	golang.org/x/crypto v0.13.0
 )
 
 require (
-	github.com/aws/aws-sdk-go-v2/credentials v1.16.16 // indirect
 	github.com/aws/aws-sdk-go-v2/feature/ec2/imds v1.14.11 // indirect
 	github.com/aws/aws-sdk-go-v2/internal/configsources v1.2.10 // indirect
 	github.com/aws/aws-sdk-go-v2/internal/endpoints/v2 v2.5.10 // indirect
@@ -60,7 +60,7 @@ require (
 	github.com/gin-gonic/gin v1.9.1
 	github.com/google/uuid v1.3.1
 	github.com/heroku/x v0.0.59
-	github.com/jinzhu/inflection v1.0.0 // indirect
+	github.com/jinzhu/inflection v1.0.0
 	github.com/lib/pq v1.10.9
 	golang.org/x/oauth2 v0.12.0
 	golang.org/x/time v0.3.0
@@ -7,6 +7,9 @@ import (
 	"reflect"
 	"strings"
 	"sync"
+
+	"github.com/windoze95/saltybytes-api/internal/promptguard"
+	"github.com/windoze95/saltybytes-api/internal/prompts"
 )
 
 // Config struct to hold the configuration.
@@ -22,19 +25,37 @@ type Config struct {
 
 // Env struct to hold the environment variables.
 type Env struct {
-	Port               EnvVar `json:"port"`
-	DatabaseUrl        EnvVar `json:"database_url"`
-	JwtSecretKey       EnvVar `json:"jwt_secret_key"`
-	AWSRegion          EnvVar `json:"aws_region"`
-	AWSAccessKeyID     EnvVar `json:"aws_access_key_id"`
-	AWSSecretAccessKey EnvVar `json:"aws_secret_access_key"`
-	S3Bucket           EnvVar `json:"s3_bucket"`
-	IdHeader           EnvVar `json:"id_header"`
-	OpenaiPromptsPath  EnvVar `json:"openai_prompts_path"`
-	OpenaiKeysPath     EnvVar `json:"openai_keys_path"`
+	Port                EnvVar `json:"port"`
+	DatabaseUrl         EnvVar `json:"database_url"`
+	JwtSecretKey        EnvVar `json:"jwt_secret_key"`
+	AWSRegion           EnvVar `json:"aws_region"`
+	AWSAccessKeyID      EnvVar `json:"aws_access_key_id"`
+	AWSSecretAccessKey  EnvVar `json:"aws_secret_access_key"`
+	S3Bucket            EnvVar `json:"s3_bucket"`
+	IdHeader            EnvVar `json:"id_header"`
+	OpenaiPromptsPath   EnvVar `json:"openai_prompts_path"`
+	OpenaiKeysPath      EnvVar `json:"openai_keys_path"`
+	EmbeddingProvider   EnvVar `json:"embedding_provider" optional:"true" values:"openai,local"`
+	Mailer              EnvVar `json:"mailer" values:"smtp,log,memory"`
+	SMTPHost            EnvVar `json:"smtp_host" optional:"true"`
+	SMTPPort            EnvVar `json:"smtp_port" optional:"true"`
+	SMTPUsername        EnvVar `json:"smtp_username" optional:"true"`
+	SMTPPassword        EnvVar `json:"smtp_password" optional:"true"`
+	MailFrom            EnvVar `json:"mail_from" optional:"true"`
+	AppURL              EnvVar `json:"app_url" optional:"true"`
+	OIDCGoogleClientIDs EnvVar `json:"oidc_google_client_ids" optional:"true"`
+	OIDCGoogleIssuers   EnvVar `json:"oidc_google_issuers" optional:"true"`
+	OIDCGoogleJWKSURL   EnvVar `json:"oidc_google_jwks_url" optional:"true"`
+	OIDCAppleClientIDs  EnvVar `json:"oidc_apple_client_ids" optional:"true"`
+	OIDCAppleIssuers    EnvVar `json:"oidc_apple_issuers" optional:"true"`
+	OIDCAppleJWKSURL    EnvVar `json:"oidc_apple_jwks_url" optional:"true"`
+	TrustedProxies      EnvVar `json:"trusted_proxies" optional:"true"`
+	MFAEncryptionKey    EnvVar `json:"mfa_encryption_key"`
+	ModerationProvider  EnvVar `json:"moderation_provider" optional:"true" values:"openai,local"`
 }
 
 // EnvVar is a string that represents an environment variable.
+// Tag an Env field optional:"true" when the variable may be unset, and values:"a,b" to restrict its value.
 type EnvVar string
 
 // Value returns the value of the environment variable.
@@ -42,7 +63,7 @@ func (e EnvVar) Value() string {
 	return os.Getenv(string(e))
 }
 
-// Prompts are actually the templates to construct the usable prompts.
+// Prompts are actually the templates to construct the usable prompts, rendered with text/template.
 // Use the FillSysPrompt and FillUserPrompt methods to retrieve a prompt.
 type OpenaiPrompts struct {
 	GenNewRecipeSys              OpenaiPromptTemplate `json:"/saltybytes/openai_prompts/gen_new_recipe_sys"`
@@ -100,9 +121,12 @@ func checkFieldsRecursive(v reflect.Value) error {
 		if field.Type().String() == "config.EnvVar" {
 			envVar := EnvVar(field.String())
 			envVal := envVar.Value()
-			if envVal == "" {
+			if envVal == "" && fieldType.Tag.Get("optional") != "true" {
 				return fmt.Errorf("value of $%s must be set", fieldType.Name)
 			}
+			if values := fieldType.Tag.Get("values"); values != "" && envVal != "" && !containsValue(values, envVal) {
+				return fmt.Errorf("value of $%s must be one of %s", fieldType.Name, values)
+			}
 		}
 
 		// Recursively check nested structs
@@ -116,6 +140,16 @@ func checkFieldsRecursive(v reflect.Value) error {
 	return nil
 }
 
+// containsValue checks if a comma separated list of values contains the value.
+func containsValue(values, value string) bool {
+	for _, v := range strings.Split(values, ",") {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
 // isZeroValue checks if the value is a zero value for its type.
 func isZeroValue(v reflect.Value) bool {
 	return v.Interface() == reflect.Zero(v.Type()).Interface()
@@ -180,25 +214,61 @@ func (c *Config) LoadOpenaiPrompts() error {
 	return nil
 }
 
-// FillSysPrompt fetches a system prompt and replaces placeholders.
-func (p *OpenaiPrompts) FillSysPrompt(promptTemplate OpenaiPromptTemplate, unitSystem string, requirements string) string {
-	prompt := string(promptTemplate)
+// Validate checks that every prompt template parses, only references the fields of prompts.Context and
+// references the user's text: .Requirements for system prompts and .UserPrompt for user prompts.
+func (p *OpenaiPrompts) Validate() error {
+	v := reflect.ValueOf(*p)
+	for i := 0; i < v.NumField(); i++ {
+		name := v.Type().Field(i).Name
+		kind := prompts.KindSys
+		if strings.HasSuffix(name, "User") {
+			kind = prompts.KindUser
+		}
+		if err := prompts.Validate(name, v.Field(i).String(), kind); err != nil {
+			return err
+		}
+	}
 
-	sanitizedRequirements := strings.Replace(requirements, "`", "", -1)
+	return nil
+}
 
-	prompt = strings.Replace(prompt, "{unitSystem}", unitSystem, -1)
-	prompt = strings.Replace(prompt, "{requirements}", sanitizedRequirements, 1)
+// FillSysPrompt renders a system prompt template.
+// Templates that don't reference .DietaryRestrictions get the dietary restrictions with the requirements.
+// The user's requirements are wrapped in a delimited block, which the appended notice tells the model to treat as data.
+func (p *OpenaiPrompts) FillSysPrompt(promptTemplate OpenaiPromptTemplate, unitSystem string, requirements string, dietaryRestrictions string) (string, error) {
+	tmpl, err := prompts.Parse("system prompt", string(promptTemplate))
+	if err != nil {
+		return "", err
+	}
 
-	return prompt
-}
+	ctx := prompts.Context{
+		UnitSystem:          unitSystem,
+		DietaryRestrictions: dietaryRestrictions,
+	}
+	if strings.TrimSpace(requirements) != "" {
+		ctx.Requirements = promptguard.Wrap(promptguard.UserRequirementsTag, requirements, promptguard.MaxRequirementsLength)
+	}
+	if !tmpl.References("DietaryRestrictions") && dietaryRestrictions != "" {
+		ctx.Requirements = strings.TrimSpace(dietaryRestrictions + "\n" + ctx.Requirements)
+	}
 
-// FillUserPrompt fetches a user prompt and replaces placeholders.
-func (p *OpenaiPrompts) FillUserPrompt(promptTemplate OpenaiPromptTemplate, userPrompt string) string {
-	prompt := string(promptTemplate)
+	prompt, err := tmpl.Render(ctx)
+	if err != nil {
+		return "", err
+	}
 
-	sanitizedUserPrompt := strings.Replace(userPrompt, "`", "", -1)
+	return prompt + "\n\n" + promptguard.SystemNotice, nil
+}
 
-	prompt = strings.Replace(prompt, "{userPrompt}", sanitizedUserPrompt, 1)
+// FillUserPrompt renders a user prompt template.
+// The user's prompt is wrapped in a delimited block.
+func (p *OpenaiPrompts) FillUserPrompt(promptTemplate OpenaiPromptTemplate, userPrompt string) (string, error) {
+	tmpl, err := prompts.Parse("user prompt", string(promptTemplate))
+	if err != nil {
+		return "", err
+	}
 
-	return prompt
+	return tmpl.Render(prompts.Context{
+		UserPrompt: promptguard.Wrap(promptguard.UserRequestTag, userPrompt, promptguard.MaxUserPromptLength),
+	})
 }
@@ -3,8 +3,10 @@ package db
 import (
 	"fmt"
 	"log"
+	"strings"
 	"time"
 
+	"github.com/google/uuid"
 	_ "github.com/heroku/x/hmetrics/onload"
 	"github.com/jinzhu/gorm"
 	_ "github.com/jinzhu/gorm/dialects/postgres"
@@ -39,17 +41,175 @@ func connectToDatabaseWithRetry(dbURL string) (*gorm.DB, error) {
 	// Set a 5-second timeout for all queries in this session
 	// db.Exec("SET statement_timeout = 5000")
 
+	// The forbidden username list is seeded when its table is first created, admins manage it afterwards
+	seedForbiddenUsernames := !database.HasTable(&models.ForbiddenUsername{})
+
 	database.AutoMigrate(
 		&models.User{},
+		&models.ForbiddenUsername{},
 		&models.UserAuth{},
+		&models.RefreshToken{},
+		&models.UserToken{},
+		&models.UserIdentity{},
+		&models.LoginAttempt{},
+		&models.UserMFA{},
+		&models.MFARecoveryCode{},
+		&models.AccountDeletionJob{},
 		&models.Subscription{},
 		&models.UserSettings{},
 		&models.Personalization{},
 		&models.Recipe{},
 		&models.Tag{},
+		&models.TagAlias{},
 		&models.RecipeHistory{},
 		&models.RecipeHistoryEntry{},
+		&models.RecipeEmbedding{},
+		&models.ModerationFlag{},
+		&models.PromptTemplate{},
+		&models.PromptRun{},
+		&models.Collection{},
+		&models.CollectionRecipe{},
 	)
 
+	migrateCollectedRecipeShareSlugs(database)
+	backfillRecipeHistoryVersions(database)
+	backfillRecipeVisibility(database)
+	backfillPersonalizationUIDs(database)
+	if seedForbiddenUsernames {
+		createDefaultForbiddenUsernames(database)
+	}
+
 	return database, err
 }
+
+// migrateCollectedRecipeShareSlugs adds the share slug an unlisted recipe was saved through to the saved recipes,
+// a join table AutoMigrate doesn't add columns to. Unlisted recipes saved before by their ID are left out of
+// the user's saved recipes until they are saved again through their share slug.
+func migrateCollectedRecipeShareSlugs(database *gorm.DB) {
+	err := database.Exec("ALTER TABLE user_collected_recipes ADD COLUMN IF NOT EXISTS share_slug text").Error
+	if err != nil {
+		log.Printf("Error adding share slugs to saved recipes: %v", err)
+	}
+}
+
+// backfillRecipeHistoryVersions numbers the recipe history entries created before entries were versioned,
+// links them to their parent entries and points each history without an active entry to its latest entry.
+func backfillRecipeHistoryVersions(database *gorm.DB) {
+	err := database.Exec(`UPDATE recipe_history_entries AS e SET version = numbered.version
+		FROM (
+			SELECT id, ROW_NUMBER() OVER (PARTITION BY recipe_history_id ORDER BY created_at, id) AS version
+			FROM recipe_history_entries
+			WHERE recipe_history_id IN (
+				SELECT recipe_history_id FROM recipe_history_entries WHERE version IS NULL OR version = 0
+			)
+		) AS numbered
+		WHERE e.id = numbered.id`).Error
+	if err != nil {
+		log.Printf("Error backfilling recipe history versions: %v", err)
+		return
+	}
+
+	// Entries created before history branched form a single line, each continuing from the previous version
+	err = database.Exec(`UPDATE recipe_history_entries AS e SET parent_entry_id = (
+			SELECT p.id FROM recipe_history_entries AS p
+			WHERE p.recipe_history_id = e.recipe_history_id AND p.version = e.version - 1
+			LIMIT 1
+		)
+		WHERE e.parent_entry_id IS NULL AND e.version > 1`).Error
+	if err != nil {
+		log.Printf("Error backfilling recipe history entry parents: %v", err)
+		return
+	}
+
+	err = database.Exec(`UPDATE recipe_histories AS h SET active_entry_id = (
+			SELECT id FROM recipe_history_entries
+			WHERE recipe_history_id = h.id AND deleted_at IS NULL
+			ORDER BY version DESC LIMIT 1
+		)
+		WHERE h.active_entry_id IS NULL`).Error
+	if err != nil {
+		log.Printf("Error backfilling active recipe history entries: %v", err)
+	}
+}
+
+// backfillRecipeVisibility makes the recipes created before recipes had a visibility private.
+// They were never published by their creators, only reachable by guessing IDs, so each creator
+// decides whether to share them. They get a share slug when their visibility is changed.
+func backfillRecipeVisibility(database *gorm.DB) {
+	err := database.Model(&models.Recipe{}).
+		Where("visibility IS NULL OR visibility = ''").
+		UpdateColumn("visibility", models.RecipeVisibilityPrivate).Error
+	if err != nil {
+		log.Printf("Error backfilling recipe visibility: %v", err)
+	}
+}
+
+// backfillPersonalizationUIDs gives a UID to the personalizations created before UIDs were generated.
+func backfillPersonalizationUIDs(database *gorm.DB) {
+	var personalizations []models.Personalization
+	err := database.Where("uid IS NULL OR uid = ?", uuid.Nil).
+		Find(&personalizations).Error
+	if err != nil {
+		log.Printf("Error retrieving personalizations without a UID: %v", err)
+		return
+	}
+
+	for _, personalization := range personalizations {
+		err := database.Model(&personalization).
+			UpdateColumn("uid", uuid.New()).Error
+		if err != nil {
+			log.Printf("Error backfilling personalization %d UID: %v", personalization.ID, err)
+		}
+	}
+}
+
+// defaultForbiddenUsernames are the usernames reserved before admins could manage the list.
+var defaultForbiddenUsernames = []string{
+	"admin",
+	"administrator",
+	"root",
+	"julian",
+	"awfulbits",
+	// "windoze95",
+	"yana",
+	"russianminx",
+	"russianminxx",
+	"sys",
+	"sysadmin",
+	"system",
+	"test",
+	"testuser",
+	"test-user",
+	"test_user",
+	"login",
+	"logout",
+	"register",
+	"password",
+	"user",
+	"newuser",
+	"yourapp",
+	"yourcompany",
+	"yourbrand",
+	"support",
+	"help",
+	"faq",
+	"saltybytes",
+	"saltybytes_ai",
+	"saltybytes-ai",
+	"saltybytesadmin",
+	"saltybytes_admin",
+	"saltybytes-admin",
+	"saltybytesroot",
+	"saltybytes_root",
+	"saltybytes-root",
+}
+
+// createDefaultForbiddenUsernames fills the forbidden username list with the default usernames.
+func createDefaultForbiddenUsernames(database *gorm.DB) {
+	for _, username := range defaultForbiddenUsernames {
+		err := database.Create(&models.ForbiddenUsername{Username: strings.ToLower(username)}).Error
+		if err != nil {
+			log.Printf("Error seeding forbidden username %s: %v", username, err)
+		}
+	}
+}
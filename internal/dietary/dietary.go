@@ -0,0 +1,248 @@
+package dietary
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/windoze95/saltybytes-api/internal/models"
+)
+
+// Diets a user can follow.
+const (
+	DietVegetarian = "vegetarian"
+	DietVegan      = "vegan"
+	DietGlutenFree = "gluten_free"
+	DietHalal      = "halal"
+	DietKosher     = "kosher"
+)
+
+// Allergens a user can avoid, the major food allergens.
+const (
+	AllergenMilk      = "milk"
+	AllergenEggs      = "eggs"
+	AllergenFish      = "fish"
+	AllergenShellfish = "shellfish"
+	AllergenTreeNuts  = "tree nuts"
+	AllergenPeanuts   = "peanuts"
+	AllergenWheat     = "wheat"
+	AllergenSoy       = "soy"
+	AllergenSesame    = "sesame"
+)
+
+// dietNames are how diets read in prompts and warnings.
+var dietNames = map[string]string{
+	DietVegetarian: "vegetarian",
+	DietVegan:      "vegan",
+	DietGlutenFree: "gluten-free",
+	DietHalal:      "halal",
+	DietKosher:     "kosher",
+}
+
+// IsValidDiet checks if a diet is one of the known diets.
+func IsValidDiet(diet string) bool {
+	_, ok := dietCategories[diet]
+	return ok
+}
+
+// IsValidAllergen checks if an allergen is one of the known allergens.
+func IsValidAllergen(allergen string) bool {
+	_, ok := allergenCategories[allergen]
+	return ok
+}
+
+// Restrictions are the diets a user follows and the allergens they avoid.
+type Restrictions struct {
+	Diets     []string
+	Allergens []string
+}
+
+// FromPersonalization reads the dietary restrictions from a user's personalization, which may be nil.
+func FromPersonalization(p *models.Personalization) Restrictions {
+	if p == nil {
+		return Restrictions{}
+	}
+	return Restrictions{Diets: p.Diets, Allergens: p.Allergens}
+}
+
+// IsEmpty checks if there are no restrictions.
+func (r Restrictions) IsEmpty() bool {
+	return len(r.Diets) == 0 && len(r.Allergens) == 0
+}
+
+// PromptText describes the restrictions for the system prompt, or is empty when there are none.
+func (r Restrictions) PromptText() string {
+	var sentences []string
+
+	var diets []string
+	for _, diet := range r.Diets {
+		if name, ok := dietNames[diet]; ok {
+			diets = append(diets, name)
+		}
+	}
+	if len(diets) > 0 {
+		sentences = append(sentences, fmt.Sprintf("The recipe must be strictly %s.", strings.Join(diets, " and ")))
+	}
+	if containsString(r.Diets, DietKosher) {
+		sentences = append(sentences, "Do not combine meat and dairy.")
+	}
+
+	var allergens []string
+	for _, allergen := range r.Allergens {
+		if IsValidAllergen(allergen) {
+			allergens = append(allergens, allergen)
+		}
+	}
+	if len(allergens) > 0 {
+		sentences = append(sentences, fmt.Sprintf("The user is allergic to %s: no ingredient may contain or be derived from them.", strings.Join(allergens, ", ")))
+	}
+
+	return strings.Join(sentences, " ")
+}
+
+// Violation is an ingredient that breaks a restriction.
+type Violation struct {
+	Ingredient  string `json:"ingredient"`
+	Restriction string `json:"restriction"`
+}
+
+// String describes the violation for the user, e.g. "Peanut butter is not peanut-free".
+func (v Violation) String() string {
+	if name, ok := dietNames[v.Restriction]; ok {
+		return fmt.Sprintf("%s is not %s", v.Ingredient, name)
+	}
+	if IsValidAllergen(v.Restriction) {
+		return fmt.Sprintf("%s contains %s", v.Ingredient, v.Restriction)
+	}
+	return fmt.Sprintf("%s: %s", v.Ingredient, v.Restriction)
+}
+
+// Check checks the ingredients of a recipe against the restrictions.
+func (r Restrictions) Check(ingredients models.Ingredients) []Violation {
+	var violations []Violation
+
+	for _, diet := range r.Diets {
+		for _, ingredient := range ingredients {
+			for _, c := range dietCategories[diet] {
+				if inCategory(ingredient.Name, c) {
+					violations = append(violations, Violation{Ingredient: ingredient.Name, Restriction: diet})
+					break
+				}
+			}
+		}
+	}
+
+	if containsString(r.Diets, DietKosher) {
+		var meat, dairy string
+		for _, ingredient := range ingredients {
+			if meat == "" && inCategory(ingredient.Name, categoryMeat) {
+				meat = ingredient.Name
+			}
+			if dairy == "" && inCategory(ingredient.Name, categoryDairy) {
+				dairy = ingredient.Name
+			}
+		}
+		if meat != "" && dairy != "" {
+			violations = append(violations, Violation{
+				Ingredient:  fmt.Sprintf("%s with %s", meat, dairy),
+				Restriction: DietKosher,
+			})
+		}
+	}
+
+	for _, allergen := range r.Allergens {
+		c, ok := allergenCategories[allergen]
+		if !ok {
+			continue
+		}
+		for _, ingredient := range ingredients {
+			if inCategory(ingredient.Name, c) {
+				violations = append(violations, Violation{Ingredient: ingredient.Name, Restriction: allergen})
+			}
+		}
+	}
+
+	return violations
+}
+
+// Feedback tells the model what was wrong with its last attempt, for retrying generation.
+func Feedback(violations []Violation) string {
+	descriptions := make([]string, 0, len(violations))
+	for _, violation := range violations {
+		descriptions = append(descriptions, violation.String())
+	}
+	return fmt.Sprintf("A previous attempt at this recipe broke the dietary restrictions (%s). Replace those ingredients with compliant alternatives.", strings.Join(descriptions, "; "))
+}
+
+// Warnings describes the violations for display on the recipe, without duplicates.
+func Warnings(violations []Violation) []string {
+	seen := make(map[string]bool)
+	warnings := []string{}
+	for _, violation := range violations {
+		warning := violation.String()
+		if !seen[warning] {
+			seen[warning] = true
+			warnings = append(warnings, warning)
+		}
+	}
+	sort.Strings(warnings)
+	return warnings
+}
+
+// IsAllergenException checks if an ingredient is one of the exceptions to an allergen's category,
+// a name that contains one of its keywords without containing the allergen, like "soy milk" for milk.
+func IsAllergenException(ingredient, allergen string) bool {
+	c, ok := allergenCategories[allergen]
+	if !ok {
+		return false
+	}
+
+	name := normalizeName(ingredient)
+	for _, exception := range taxonomy[c].exceptions {
+		if strings.Contains(name, " "+exception+" ") {
+			return true
+		}
+	}
+
+	return false
+}
+
+// inCategory checks if an ingredient belongs to a category, matching whole words.
+func inCategory(ingredient, categoryName string) bool {
+	c := taxonomy[categoryName]
+	name := normalizeName(ingredient)
+
+	for _, exception := range c.exceptions {
+		if strings.Contains(name, " "+exception+" ") {
+			return false
+		}
+	}
+
+	for _, keyword := range c.keywords {
+		if strings.Contains(name, " "+keyword+" ") {
+			return true
+		}
+	}
+
+	return false
+}
+
+// normalizeName lowercases an ingredient name and pads it with spaces, keeping only words,
+// so keywords can be matched as " keyword ".
+func normalizeName(ingredient string) string {
+	words := strings.FieldsFunc(strings.ToLower(ingredient), func(r rune) bool {
+		return !unicode.IsLetter(r) && r != '-' && r != '\''
+	})
+	return " " + strings.Join(words, " ") + " "
+}
+
+// containsString checks if a slice contains a string.
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
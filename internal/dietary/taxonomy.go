@@ -0,0 +1,138 @@
+package dietary
+
+// category is a group of ingredients a restriction can rule out.
+type category struct {
+	// keywords are matched against ingredient names on whole words.
+	keywords []string
+	// exceptions are ingredients that contain a keyword but don't belong to the category, like "coconut milk".
+	exceptions []string
+}
+
+// Ingredient categories.
+const (
+	categoryMeat      = "meat"
+	categoryPork      = "pork"
+	categoryFish      = "fish"
+	categoryShellfish = "shellfish"
+	categoryDairy     = "dairy"
+	categoryEggs      = "eggs"
+	categoryHoney     = "honey"
+	categoryGluten    = "gluten"
+	categoryPeanuts   = "peanuts"
+	categoryTreeNuts  = "tree nuts"
+	categorySoy       = "soy"
+	categorySesame    = "sesame"
+	categoryAlcohol   = "alcohol"
+)
+
+// taxonomy is the local ingredient taxonomy the validator checks recipes against.
+var taxonomy = map[string]category{
+	categoryMeat: {
+		keywords: []string{
+			"beef", "steak", "veal", "lamb", "mutton", "goat", "venison", "bison", "chicken", "turkey", "duck", "goose",
+			"quail", "rabbit", "mince", "meatball", "meatballs", "sausage", "sausages", "bratwurst", "hot dog", "jerky",
+			"gelatin", "gelatine", "bone broth", "oxtail", "liver",
+		},
+		exceptions: []string{"vegan sausage", "plant-based", "meatless", "vegetarian", "beefsteak tomato", "chicken of the woods"},
+	},
+	categoryPork: {
+		keywords: []string{
+			"pork", "bacon", "ham", "prosciutto", "pancetta", "guanciale", "lard", "chorizo", "salami", "pepperoni",
+			"speck", "gelatin", "gelatine", "pork rinds", "sausage", "sausages", "bratwurst", "hot dog",
+		},
+		exceptions: []string{"turkey bacon", "beef bacon", "chicken sausage", "turkey sausage", "beef sausage", "vegan", "plant-based", "halal", "kosher", "hamburger bun", "graham"},
+	},
+	categoryFish: {
+		keywords: []string{
+			"fish", "salmon", "tuna", "cod", "anchovy", "anchovies", "sardine", "sardines", "tilapia", "halibut", "trout",
+			"mackerel", "haddock", "snapper", "bass", "swordfish", "mahi", "catfish", "herring", "fish sauce",
+			"worcestershire", "bonito", "dashi", "caviar", "roe",
+		},
+		exceptions: []string{"vegan fish sauce", "vegan worcestershire"},
+	},
+	categoryShellfish: {
+		keywords: []string{
+			"shrimp", "prawn", "prawns", "crab", "lobster", "crawfish", "crayfish", "clam", "clams", "mussel", "mussels",
+			"oyster", "oysters", "scallop", "scallops", "squid", "calamari", "octopus", "oyster sauce",
+		},
+		exceptions: []string{"oyster mushroom", "oyster mushrooms", "vegan oyster sauce", "vegetarian oyster sauce"},
+	},
+	categoryDairy: {
+		keywords: []string{
+			"milk", "butter", "buttermilk", "cream", "cheese", "yogurt", "yoghurt", "ghee", "whey", "casein", "kefir",
+			"parmesan", "mozzarella", "cheddar", "ricotta", "mascarpone", "feta", "brie", "gouda", "gruyere",
+			"half-and-half", "creme fraiche", "custard", "ice cream", "paneer", "queso",
+		},
+		exceptions: []string{
+			"coconut milk", "coconut cream", "almond milk", "oat milk", "soy milk", "rice milk", "cashew milk",
+			"peanut butter", "almond butter", "cashew butter", "nut butter", "cocoa butter", "apple butter",
+			"cream of tartar", "vegan", "dairy-free", "non-dairy", "plant-based", "butternut", "butter beans",
+		},
+	},
+	categoryEggs: {
+		keywords:   []string{"egg", "eggs", "egg yolk", "egg yolks", "egg white", "egg whites", "mayonnaise", "mayo", "aioli", "meringue"},
+		exceptions: []string{"vegan mayo", "vegan mayonnaise", "egg replacer", "flax egg", "vegan egg", "egg-free"},
+	},
+	categoryHoney: {
+		keywords:   []string{"honey", "honeycomb"},
+		exceptions: []string{"honeydew"},
+	},
+	categoryGluten: {
+		keywords: []string{
+			"flour", "wheat", "bread", "breadcrumbs", "bread crumbs", "panko", "pasta", "spaghetti", "penne", "fettuccine",
+			"linguine", "macaroni", "lasagna", "noodles", "couscous", "barley", "rye", "semolina", "farro", "bulgur",
+			"spelt", "seitan", "soy sauce", "beer", "tortilla", "tortillas", "crackers", "croutons", "pita", "bun", "buns",
+			"baguette", "pie crust", "puff pastry", "phyllo", "malt",
+		},
+		exceptions: []string{
+			"gluten-free", "almond flour", "rice flour", "coconut flour", "corn flour", "cornflour", "chickpea flour",
+			"tapioca flour", "oat flour", "buckwheat flour", "rice noodles", "glass noodles", "corn tortilla", "corn tortillas",
+			"tamari",
+		},
+	},
+	categoryPeanuts: {
+		keywords: []string{"peanut", "peanuts", "peanut butter", "peanut oil", "groundnut", "satay"},
+	},
+	categoryTreeNuts: {
+		keywords: []string{
+			"almond", "almonds", "walnut", "walnuts", "pecan", "pecans", "cashew", "cashews", "pistachio", "pistachios",
+			"hazelnut", "hazelnuts", "macadamia", "pine nuts", "brazil nuts", "nuts", "praline", "marzipan", "nutella",
+			"almond flour", "almond milk", "pesto",
+		},
+	},
+	categorySoy: {
+		keywords: []string{"soy", "soya", "soy sauce", "soybean", "soybeans", "tofu", "tempeh", "edamame", "miso", "tamari", "soy milk"},
+	},
+	categorySesame: {
+		keywords: []string{"sesame", "sesame oil", "sesame seeds", "tahini", "furikake", "za'atar", "zaatar"},
+	},
+	categoryAlcohol: {
+		keywords: []string{
+			"wine", "beer", "ale", "lager", "rum", "vodka", "gin", "tequila", "whiskey", "whisky", "bourbon", "brandy",
+			"cognac", "sake", "mirin", "sherry", "vermouth", "liqueur", "kahlua", "amaretto", "marsala", "port",
+		},
+		exceptions: []string{"wine vinegar", "non-alcoholic", "port salut"},
+	},
+}
+
+// dietCategories are the ingredient categories each diet rules out.
+var dietCategories = map[string][]string{
+	DietVegetarian: {categoryMeat, categoryPork, categoryFish, categoryShellfish},
+	DietVegan:      {categoryMeat, categoryPork, categoryFish, categoryShellfish, categoryDairy, categoryEggs, categoryHoney},
+	DietGlutenFree: {categoryGluten},
+	DietHalal:      {categoryPork, categoryAlcohol},
+	DietKosher:     {categoryPork, categoryShellfish},
+}
+
+// allergenCategories are the ingredient categories each allergen rules out.
+var allergenCategories = map[string]string{
+	AllergenMilk:      categoryDairy,
+	AllergenEggs:      categoryEggs,
+	AllergenFish:      categoryFish,
+	AllergenShellfish: categoryShellfish,
+	AllergenTreeNuts:  categoryTreeNuts,
+	AllergenPeanuts:   categoryPeanuts,
+	AllergenWheat:     categoryGluten,
+	AllergenSoy:       categorySoy,
+	AllergenSesame:    categorySesame,
+}
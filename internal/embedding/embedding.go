@@ -0,0 +1,100 @@
+package embedding
+
+import (
+	"math"
+	"strings"
+
+	"github.com/windoze95/saltybytes-api/internal/config"
+	"github.com/windoze95/saltybytes-api/internal/models"
+	"github.com/windoze95/saltybytes-api/internal/openai"
+)
+
+// Provider computes embedding vectors for text.
+type Provider interface {
+	// Name identifies the provider and model, vectors from different providers are not comparable.
+	Name() string
+	// Embed returns the embedding vector for the text.
+	Embed(text string) ([]float64, error)
+}
+
+// NewProvider returns the provider selected by the EmbeddingProvider environment variable.
+// Defaults to the OpenAI provider.
+func NewProvider(cfg *config.Config) Provider {
+	switch cfg.Env.EmbeddingProvider.Value() {
+	case "local":
+		return NewLocalProvider(LocalDimensions)
+	default:
+		return &OpenaiProvider{Cfg: cfg}
+	}
+}
+
+// OpenaiProvider computes embeddings with the OpenAI embeddings API.
+type OpenaiProvider struct {
+	Cfg *config.Config
+}
+
+// Name returns the name of the provider.
+func (p *OpenaiProvider) Name() string {
+	return "openai:text-embedding-ada-002"
+}
+
+// Embed returns the embedding vector for the text.
+func (p *OpenaiProvider) Embed(text string) ([]float64, error) {
+	vector, err := openai.CreateEmbedding(text, p.Cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	out := make([]float64, len(vector))
+	for i, v := range vector {
+		out[i] = float64(v)
+	}
+
+	return out, nil
+}
+
+// RecipeText builds the text that represents a recipe for embedding,
+// made up of the title, ingredient names and hashtags.
+func RecipeText(recipeDef *models.RecipeDef) string {
+	var b strings.Builder
+
+	b.WriteString(recipeDef.Title)
+
+	if len(recipeDef.Ingredients) > 0 {
+		b.WriteString(". Ingredients: ")
+		for i, ingredient := range recipeDef.Ingredients {
+			if i > 0 {
+				b.WriteString(", ")
+			}
+			b.WriteString(ingredient.Name)
+		}
+	}
+
+	if len(recipeDef.Hashtags) > 0 {
+		b.WriteString(". Tags: ")
+		b.WriteString(strings.Join(recipeDef.Hashtags, ", "))
+	}
+
+	return b.String()
+}
+
+// CosineSimilarity returns the cosine similarity of two vectors.
+// Vectors of different lengths or zero vectors have a similarity of 0.
+func CosineSimilarity(a, b []float64) float64 {
+	if len(a) != len(b) || len(a) == 0 {
+		return 0
+	}
+
+	var dot, normA, normB float64
+	for i := range a {
+		dot += a[i] * b[i]
+		normA += a[i] * a[i]
+		normB += b[i] * b[i]
+	}
+
+	if normA == 0 || normB == 0 {
+		return 0
+	}
+
+	return dot / (math.Sqrt(normA) * math.Sqrt(normB))
+}
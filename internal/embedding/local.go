@@ -0,0 +1,73 @@
+package embedding
+
+import (
+	"fmt"
+	"hash/fnv"
+	"math"
+	"strings"
+	"unicode"
+)
+
+// LocalDimensions is the default vector size of the LocalProvider.
+const LocalDimensions = 256
+
+// LocalProvider is a deterministic, offline embedding provider.
+// It hashes word unigrams and bigrams into a fixed size vector, which is good enough
+// to find recipes sharing ingredients and tags in development and tests.
+type LocalProvider struct {
+	Dimensions int
+}
+
+// NewLocalProvider creates a new LocalProvider.
+func NewLocalProvider(dimensions int) *LocalProvider {
+	return &LocalProvider{Dimensions: dimensions}
+}
+
+// Name returns the name of the provider.
+func (p *LocalProvider) Name() string {
+	return fmt.Sprintf("local:hash-%d", p.Dimensions)
+}
+
+// Embed returns the embedding vector for the text.
+func (p *LocalProvider) Embed(text string) ([]float64, error) {
+	vector := make([]float64, p.Dimensions)
+
+	words := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	})
+
+	for i, word := range words {
+		p.add(vector, word, 1)
+		if i > 0 {
+			p.add(vector, words[i-1]+" "+word, 0.5)
+		}
+	}
+
+	// Normalize to unit length
+	var norm float64
+	for _, v := range vector {
+		norm += v * v
+	}
+	if norm > 0 {
+		norm = math.Sqrt(norm)
+		for i := range vector {
+			vector[i] /= norm
+		}
+	}
+
+	return vector, nil
+}
+
+// add hashes a feature into the vector with the given weight.
+func (p *LocalProvider) add(vector []float64, feature string, weight float64) {
+	h := fnv.New64a()
+	h.Write([]byte(feature))
+	sum := h.Sum64()
+
+	// Use the high bit as the sign to reduce collision bias
+	if sum>>63 == 1 {
+		weight = -weight
+	}
+
+	vector[sum%uint64(p.Dimensions)] += weight
+}
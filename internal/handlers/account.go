@@ -0,0 +1,106 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/windoze95/saltybytes-api/internal/models"
+	"github.com/windoze95/saltybytes-api/internal/repository"
+	"github.com/windoze95/saltybytes-api/internal/service"
+	"github.com/windoze95/saltybytes-api/internal/util"
+)
+
+// AccountHandler is the handler for account export and deletion requests.
+type AccountHandler struct {
+	Service *service.AccountService
+}
+
+// NewAccountHandler is the constructor function for initializing a new AccountHandler.
+func NewAccountHandler(accountService *service.AccountService) *AccountHandler {
+	return &AccountHandler{Service: accountService}
+}
+
+// ExportAccount sends the user a zip of all of their data.
+func (h *AccountHandler) ExportAccount(c *gin.Context) {
+	// Retrieve the user from the context
+	user, err := util.GetUserFromContext(c)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	filename := fmt.Sprintf("saltybytes-export-%s-%s.zip", user.Username, time.Now().Format("2006-01-02"))
+	c.Header("Content-Type", "application/zip")
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+
+	// The zip is streamed, so once writing starts an error can only be logged
+	if err := h.Service.WriteExport(user, c.Writer); err != nil {
+		log.Printf("error: handlers.ExportAccount: %v", err)
+		if !c.Writer.Written() {
+			c.Header("Content-Disposition", "")
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to export account"})
+		}
+		return
+	}
+}
+
+// DeleteAccount starts deleting the user's account, either deleting or anonymizing their recipes.
+func (h *AccountHandler) DeleteAccount(c *gin.Context) {
+	// Retrieve the user from the context
+	user, err := util.GetUserFromContext(c)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	var request struct {
+		Recipes  models.RecipeDeletionAction `json:"recipes" binding:"required"`
+		Password string                      `json:"password"`
+	}
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "recipes is required, either \"delete\" or \"anonymize\""})
+		return
+	}
+
+	if !models.IsValidRecipeDeletionAction(request.Recipes) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "recipes must be either \"delete\" or \"anonymize\""})
+		return
+	}
+
+	deletion, err := h.Service.RequestAccountDeletion(user, request.Recipes, request.Password)
+	if err != nil {
+		if errors.Is(err, service.ErrIncorrectPassword) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "password is incorrect"})
+			return
+		}
+		log.Printf("error: handlers.DeleteAccount: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete account"})
+		return
+	}
+
+	c.JSON(http.StatusAccepted, gin.H{
+		"message":     "Account deletion started",
+		"deletion":    deletion,
+		"status_path": "/v1/account-deletions/" + deletion.ID,
+	})
+}
+
+// GetAccountDeletion fetches the status of an account deletion.
+func (h *AccountHandler) GetAccountDeletion(c *gin.Context) {
+	deletion, err := h.Service.GetAccountDeletion(c.Param("deletion_id"))
+	if err != nil {
+		switch e := err.(type) {
+		case repository.NotFoundError:
+			c.JSON(http.StatusNotFound, gin.H{"error": e.Error()})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": e.Error()})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"deletion": deletion})
+}
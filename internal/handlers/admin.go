@@ -0,0 +1,483 @@
+package handlers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/windoze95/saltybytes-api/internal/models"
+	"github.com/windoze95/saltybytes-api/internal/repository"
+	"github.com/windoze95/saltybytes-api/internal/service"
+	"github.com/windoze95/saltybytes-api/internal/util"
+)
+
+// AdminHandler is the handler for admin API requests.
+type AdminHandler struct {
+	Service       *service.AdminService
+	TagService    *service.TagService
+	PromptService *service.PromptService
+}
+
+// NewAdminHandler is the constructor function for initializing a new AdminHandler.
+func NewAdminHandler(adminService *service.AdminService, tagService *service.TagService, promptService *service.PromptService) *AdminHandler {
+	return &AdminHandler{
+		Service:       adminService,
+		TagService:    tagService,
+		PromptService: promptService,
+	}
+}
+
+// SearchUsers returns a page of users matching the q query parameter, by ID, username or email.
+func (h *AdminHandler) SearchUsers(c *gin.Context) {
+	page, pageSize, err := parsePageQuery(c.Query("page"), c.Query("page_size"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	users, err := h.Service.SearchUsers(c.Query("q"), page, pageSize)
+	if err != nil {
+		log.Printf("Error searching users: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, users)
+}
+
+// GetUser returns a user with their subscription.
+func (h *AdminHandler) GetUser(c *gin.Context) {
+	userID, err := parseUintParam(c.Param("user_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
+	}
+
+	user, err := h.Service.GetUser(userID)
+	if err != nil {
+		respondWithAdminError(c, "Error getting user", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"user": user})
+}
+
+// UpdateUserRole changes the role of a user.
+func (h *AdminHandler) UpdateUserRole(c *gin.Context) {
+	// Retrieve the admin from the context
+	admin, err := util.GetUserFromContext(c)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	userID, err := parseUintParam(c.Param("user_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
+	}
+
+	var request struct {
+		Role models.UserRole `json:"role" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "role is required"})
+		return
+	}
+
+	user, err := h.Service.UpdateUserRole(admin, userID, request.Role)
+	if err != nil {
+		respondWithAdminError(c, "Error updating user role", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Role updated successfully", "user": user})
+}
+
+// UpdateSubscription changes the tier, expiry or remaining tokens of a user's subscription.
+func (h *AdminHandler) UpdateSubscription(c *gin.Context) {
+	// Retrieve the admin from the context
+	admin, err := util.GetUserFromContext(c)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	userID, err := parseUintParam(c.Param("user_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
+	}
+
+	var update service.SubscriptionUpdate
+	if err := c.ShouldBindJSON(&update); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+		return
+	}
+
+	user, err := h.Service.UpdateSubscription(admin, userID, update)
+	if err != nil {
+		respondWithAdminError(c, "Error updating subscription", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Subscription updated successfully", "user": user})
+}
+
+// GetHiddenRecipes returns a page of the recipes moderators hid.
+func (h *AdminHandler) GetHiddenRecipes(c *gin.Context) {
+	page, pageSize, err := parsePageQuery(c.Query("page"), c.Query("page_size"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	recipes, err := h.Service.GetHiddenRecipes(page, pageSize)
+	if err != nil {
+		log.Printf("Error getting hidden recipes: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, recipes)
+}
+
+// HideRecipe hides a recipe from everyone but its creator.
+func (h *AdminHandler) HideRecipe(c *gin.Context) {
+	// Retrieve the moderator from the context
+	moderator, err := util.GetUserFromContext(c)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	recipeID, err := parseUintParam(c.Param("recipe_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid recipe ID"})
+		return
+	}
+
+	var request struct {
+		Reason string `json:"reason" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "reason is required"})
+		return
+	}
+
+	if err := h.Service.HideRecipe(moderator, recipeID, request.Reason); err != nil {
+		respondWithAdminError(c, "Error hiding recipe", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Recipe hidden successfully"})
+}
+
+// RestoreRecipe makes a hidden recipe visible again.
+func (h *AdminHandler) RestoreRecipe(c *gin.Context) {
+	// Retrieve the moderator from the context
+	moderator, err := util.GetUserFromContext(c)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	recipeID, err := parseUintParam(c.Param("recipe_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid recipe ID"})
+		return
+	}
+
+	if err := h.Service.RestoreRecipe(moderator, recipeID); err != nil {
+		respondWithAdminError(c, "Error restoring recipe", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Recipe restored successfully"})
+}
+
+// GetModerationFlags returns a page of the recipes automatic moderation flagged,
+// filtered by the status query parameter, pending by default.
+func (h *AdminHandler) GetModerationFlags(c *gin.Context) {
+	page, pageSize, err := parsePageQuery(c.Query("page"), c.Query("page_size"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	flags, err := h.Service.GetModerationFlags(models.ModerationFlagStatus(c.Query("status")), page, pageSize)
+	if err != nil {
+		respondWithAdminError(c, "Error getting moderation flags", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, flags)
+}
+
+// ApproveModerationFlag clears a flagged recipe, making it visible again.
+func (h *AdminHandler) ApproveModerationFlag(c *gin.Context) {
+	h.resolveModerationFlag(c, models.ModerationFlagApproved)
+}
+
+// RejectModerationFlag confirms a flagged recipe, keeping it hidden.
+func (h *AdminHandler) RejectModerationFlag(c *gin.Context) {
+	h.resolveModerationFlag(c, models.ModerationFlagRejected)
+}
+
+// resolveModerationFlag records a moderator's review of a moderation flag.
+func (h *AdminHandler) resolveModerationFlag(c *gin.Context, status models.ModerationFlagStatus) {
+	// Retrieve the moderator from the context
+	moderator, err := util.GetUserFromContext(c)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	flagID, err := parseUintParam(c.Param("flag_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid moderation flag ID"})
+		return
+	}
+
+	flag, err := h.Service.ResolveModerationFlag(moderator, flagID, status)
+	if err != nil {
+		respondWithAdminError(c, "Error resolving moderation flag", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"flag": flag})
+}
+
+// GetTagAliases returns every tag alias.
+func (h *AdminHandler) GetTagAliases(c *gin.Context) {
+	tagAliases, err := h.TagService.GetTagAliases()
+	if err != nil {
+		log.Printf("Error getting tag aliases: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"tag_aliases": tagAliases})
+}
+
+// CreateTagAlias makes an alias resolve to a canonical hashtag, merging the aliased tag into it.
+func (h *AdminHandler) CreateTagAlias(c *gin.Context) {
+	var request struct {
+		Alias   string `json:"alias" binding:"required"`
+		Hashtag string `json:"hashtag" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "alias and hashtag are required"})
+		return
+	}
+
+	tagAlias, err := h.TagService.CreateTagAlias(request.Alias, request.Hashtag)
+	if err != nil {
+		respondWithAdminError(c, "Error creating tag alias", err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"message": "Tag alias created successfully", "tag_alias": tagAlias})
+}
+
+// DeleteTagAlias deletes a tag alias.
+func (h *AdminHandler) DeleteTagAlias(c *gin.Context) {
+	tagAliasID, err := parseUintParam(c.Param("alias_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid tag alias ID"})
+		return
+	}
+
+	if err := h.TagService.DeleteTagAlias(tagAliasID); err != nil {
+		respondWithAdminError(c, "Error deleting tag alias", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Tag alias deleted successfully"})
+}
+
+// MergeDuplicateTags merges every tag into its normalized form, e.g. "burgers" into "burger".
+func (h *AdminHandler) MergeDuplicateTags(c *gin.Context) {
+	merged, err := h.TagService.MergeDuplicateTags()
+	if err != nil {
+		log.Printf("Error merging duplicate tags: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error(), "merged": merged})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Duplicate tags merged successfully", "merged": merged})
+}
+
+// GetPromptTemplates returns every version of the prompt templates, or of the prompt in the name query parameter.
+func (h *AdminHandler) GetPromptTemplates(c *gin.Context) {
+	promptTemplates, err := h.PromptService.GetPromptTemplates(models.PromptName(c.Query("name")))
+	if err != nil {
+		respondWithAdminError(c, "Error getting prompt templates", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"prompt_templates": promptTemplates})
+}
+
+// CreatePromptTemplate creates the next version of a prompt template.
+func (h *AdminHandler) CreatePromptTemplate(c *gin.Context) {
+	// Retrieve the admin from the context
+	admin, err := util.GetUserFromContext(c)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	var request struct {
+		Name     models.PromptName `json:"name" binding:"required"`
+		Template string            `json:"template" binding:"required"`
+		Weight   int               `json:"weight"`
+		Note     string            `json:"note"`
+	}
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "name and template are required"})
+		return
+	}
+
+	promptTemplate, err := h.PromptService.CreatePromptTemplate(admin, request.Name, request.Template, request.Weight, request.Note)
+	if err != nil {
+		respondWithAdminError(c, "Error creating prompt template", err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"prompt_template": promptTemplate})
+}
+
+// UpdatePromptTemplateWeight changes the weight of a prompt template version in its experiment.
+func (h *AdminHandler) UpdatePromptTemplateWeight(c *gin.Context) {
+	// Retrieve the admin from the context
+	admin, err := util.GetUserFromContext(c)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	promptTemplateID, err := parseUintParam(c.Param("template_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid prompt template ID"})
+		return
+	}
+
+	var request struct {
+		Weight *int `json:"weight" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "weight is required"})
+		return
+	}
+
+	promptTemplate, err := h.PromptService.UpdatePromptTemplateWeight(admin, promptTemplateID, *request.Weight)
+	if err != nil {
+		respondWithAdminError(c, "Error updating prompt template weight", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"prompt_template": promptTemplate})
+}
+
+// GetPromptReport returns the outcomes of every version of the prompt in the name query parameter.
+func (h *AdminHandler) GetPromptReport(c *gin.Context) {
+	report, err := h.PromptService.GetPromptReport(models.PromptName(c.Query("name")))
+	if err != nil {
+		respondWithAdminError(c, "Error getting prompt report", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, report)
+}
+
+// GetForbiddenUsernames returns every forbidden username.
+func (h *AdminHandler) GetForbiddenUsernames(c *gin.Context) {
+	forbiddenUsernames, err := h.Service.GetForbiddenUsernames()
+	if err != nil {
+		log.Printf("Error getting forbidden usernames: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"forbidden_usernames": forbiddenUsernames})
+}
+
+// AddForbiddenUsername stops users from signing up with, or changing to, a username.
+func (h *AdminHandler) AddForbiddenUsername(c *gin.Context) {
+	// Retrieve the admin from the context
+	admin, err := util.GetUserFromContext(c)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	var request struct {
+		Username string `json:"username" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "username is required"})
+		return
+	}
+
+	forbiddenUsername, err := h.Service.AddForbiddenUsername(admin, request.Username)
+	if err != nil {
+		switch e := err.(type) {
+		case repository.ConflictError:
+			c.JSON(http.StatusConflict, gin.H{"error": e.Error()})
+		default:
+			c.JSON(http.StatusBadRequest, gin.H{"error": e.Error()})
+		}
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"message": "Username forbidden successfully", "forbidden_username": forbiddenUsername})
+}
+
+// RemoveForbiddenUsername allows a forbidden username again.
+func (h *AdminHandler) RemoveForbiddenUsername(c *gin.Context) {
+	// Retrieve the admin from the context
+	admin, err := util.GetUserFromContext(c)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	forbiddenUsernameID, err := parseUintParam(c.Param("username_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid forbidden username ID"})
+		return
+	}
+
+	if err := h.Service.RemoveForbiddenUsername(admin, forbiddenUsernameID); err != nil {
+		respondWithAdminError(c, "Error removing forbidden username", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Forbidden username removed successfully"})
+}
+
+// respondWithAdminError responds to a failed admin API request.
+func respondWithAdminError(c *gin.Context, logMessage string, err error) {
+	log.Printf("%s: %v", logMessage, err)
+	switch {
+	case errors.Is(err, service.ErrCannotChangeOwnRole):
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+	case errors.Is(err, service.ErrInvalidRole), errors.Is(err, service.ErrInvalidSubscriptionTier),
+		errors.Is(err, service.ErrInvalidRemainingTokens), errors.Is(err, service.ErrInvalidModerationFlagStatus),
+		errors.Is(err, service.ErrInvalidPromptName), errors.Is(err, service.ErrEmptyPromptTemplate),
+		errors.Is(err, service.ErrInvalidPromptWeight), errors.Is(err, service.ErrInvalidPromptTemplate),
+		errors.Is(err, service.ErrInvalidTagAlias):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	default:
+		switch e := err.(type) {
+		case repository.NotFoundError:
+			c.JSON(http.StatusNotFound, gin.H{"error": e.Error()})
+		case repository.ConflictError:
+			c.JSON(http.StatusConflict, gin.H{"error": e.Error()})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": e.Error()})
+		}
+	}
+}
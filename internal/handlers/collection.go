@@ -0,0 +1,333 @@
+package handlers
+
+import (
+	"log"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/windoze95/saltybytes-api/internal/repository"
+	"github.com/windoze95/saltybytes-api/internal/service"
+	"github.com/windoze95/saltybytes-api/internal/util"
+)
+
+// CollectionHandler is the handler for saved recipe and collection requests.
+type CollectionHandler struct {
+	Service *service.CollectionService
+}
+
+// NewCollectionHandler is the constructor function for initializing a new CollectionHandler.
+func NewCollectionHandler(collectionService *service.CollectionService) *CollectionHandler {
+	return &CollectionHandler{Service: collectionService}
+}
+
+// SaveRecipe saves a recipe for the user.
+func (h *CollectionHandler) SaveRecipe(c *gin.Context) {
+	user, err := util.GetUserFromContext(c)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	recipeID, err := parseUintParam(c.Param("recipe_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid recipe ID"})
+		return
+	}
+
+	if err := h.Service.SaveRecipe(user, recipeID); err != nil {
+		respondWithCollectionError(c, "Error saving recipe", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Recipe saved"})
+}
+
+// SaveSharedRecipe saves a recipe for the user through its share slug.
+func (h *CollectionHandler) SaveSharedRecipe(c *gin.Context) {
+	user, err := util.GetUserFromContext(c)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := h.Service.SaveSharedRecipe(user, c.Param("share_slug")); err != nil {
+		respondWithCollectionError(c, "Error saving shared recipe", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Recipe saved"})
+}
+
+// UnsaveRecipe removes a saved recipe for the user.
+func (h *CollectionHandler) UnsaveRecipe(c *gin.Context) {
+	user, err := util.GetUserFromContext(c)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	recipeID, err := parseUintParam(c.Param("recipe_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid recipe ID"})
+		return
+	}
+
+	if err := h.Service.UnsaveRecipe(user, recipeID); err != nil {
+		respondWithCollectionError(c, "Error unsaving recipe", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Recipe removed from saved recipes"})
+}
+
+// GetCollections returns the user's collections.
+func (h *CollectionHandler) GetCollections(c *gin.Context) {
+	user, err := util.GetUserFromContext(c)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	collections, err := h.Service.GetCollections(user)
+	if err != nil {
+		respondWithCollectionError(c, "Error getting collections", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"collections": collections})
+}
+
+// GetCollection returns one of the user's collections with its recipes.
+func (h *CollectionHandler) GetCollection(c *gin.Context) {
+	user, err := util.GetUserFromContext(c)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	collectionID, err := parseUintParam(c.Param("collection_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid collection ID"})
+		return
+	}
+
+	collection, err := h.Service.GetCollection(user, collectionID)
+	if err != nil {
+		respondWithCollectionError(c, "Error getting collection", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"collection": collection})
+}
+
+// GetSharedCollection returns a shared collection by its share slug.
+func (h *CollectionHandler) GetSharedCollection(c *gin.Context) {
+	collection, err := h.Service.GetSharedCollection(c.Param("share_slug"))
+	if err != nil {
+		respondWithCollectionError(c, "Error getting shared collection", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"collection": collection})
+}
+
+// CreateCollection creates a new collection for the user.
+func (h *CollectionHandler) CreateCollection(c *gin.Context) {
+	user, err := util.GetUserFromContext(c)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	var request struct {
+		Name string `json:"name" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Collection name is required"})
+		return
+	}
+
+	collection, err := h.Service.CreateCollection(user, request.Name)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"collection": collection})
+}
+
+// UpdateCollection renames a collection or turns its sharing on or off.
+func (h *CollectionHandler) UpdateCollection(c *gin.Context) {
+	user, err := util.GetUserFromContext(c)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	collectionID, err := parseUintParam(c.Param("collection_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid collection ID"})
+		return
+	}
+
+	var request service.CollectionUpdate
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request: " + err.Error()})
+		return
+	}
+
+	collection, err := h.Service.UpdateCollection(user, collectionID, request)
+	if err != nil {
+		respondWithCollectionError(c, "Error updating collection", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"collection": collection})
+}
+
+// DeleteCollection deletes one of the user's collections.
+func (h *CollectionHandler) DeleteCollection(c *gin.Context) {
+	user, err := util.GetUserFromContext(c)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	collectionID, err := parseUintParam(c.Param("collection_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid collection ID"})
+		return
+	}
+
+	if err := h.Service.DeleteCollection(user, collectionID); err != nil {
+		respondWithCollectionError(c, "Error deleting collection", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Collection deleted"})
+}
+
+// ReorderCollections sets the order of the user's collections.
+func (h *CollectionHandler) ReorderCollections(c *gin.Context) {
+	user, err := util.GetUserFromContext(c)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	var request struct {
+		CollectionIDs []uint `json:"collection_ids" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Collection IDs are required"})
+		return
+	}
+
+	if err := h.Service.ReorderCollections(user, request.CollectionIDs); err != nil {
+		respondWithCollectionError(c, "Error reordering collections", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Collections reordered"})
+}
+
+// AddRecipeToCollection adds a recipe to one of the user's collections.
+func (h *CollectionHandler) AddRecipeToCollection(c *gin.Context) {
+	user, err := util.GetUserFromContext(c)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	collectionID, err := parseUintParam(c.Param("collection_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid collection ID"})
+		return
+	}
+
+	// Unlisted recipes are added by their share slug
+	var request struct {
+		RecipeID  uint   `json:"recipe_id"`
+		ShareSlug string `json:"share_slug"`
+	}
+	if err := c.ShouldBindJSON(&request); err != nil || (request.RecipeID == 0) == (request.ShareSlug == "") {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Either a recipe ID or a share slug is required"})
+		return
+	}
+
+	if err := h.Service.AddRecipeToCollection(user, collectionID, request.RecipeID, request.ShareSlug); err != nil {
+		respondWithCollectionError(c, "Error adding recipe to collection", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Recipe added to collection"})
+}
+
+// RemoveRecipeFromCollection removes a recipe from one of the user's collections.
+func (h *CollectionHandler) RemoveRecipeFromCollection(c *gin.Context) {
+	user, err := util.GetUserFromContext(c)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	collectionID, err := parseUintParam(c.Param("collection_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid collection ID"})
+		return
+	}
+
+	recipeID, err := parseUintParam(c.Param("recipe_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid recipe ID"})
+		return
+	}
+
+	if err := h.Service.RemoveRecipeFromCollection(user, collectionID, recipeID); err != nil {
+		respondWithCollectionError(c, "Error removing recipe from collection", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Recipe removed from collection"})
+}
+
+// ReorderCollectionRecipes sets the order of the recipes in one of the user's collections.
+func (h *CollectionHandler) ReorderCollectionRecipes(c *gin.Context) {
+	user, err := util.GetUserFromContext(c)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	collectionID, err := parseUintParam(c.Param("collection_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid collection ID"})
+		return
+	}
+
+	var request struct {
+		RecipeIDs []uint `json:"recipe_ids" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Recipe IDs are required"})
+		return
+	}
+
+	if err := h.Service.ReorderCollectionRecipes(user, collectionID, request.RecipeIDs); err != nil {
+		respondWithCollectionError(c, "Error reordering collection recipes", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Collection recipes reordered"})
+}
+
+// respondWithCollectionError logs an error and responds with the matching status code.
+func respondWithCollectionError(c *gin.Context, logMessage string, err error) {
+	log.Printf("%s: %v", logMessage, err)
+	switch e := err.(type) {
+	case repository.NotFoundError:
+		c.JSON(http.StatusNotFound, gin.H{"error": e.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": e.Error()})
+	}
+}
@@ -16,3 +16,37 @@ func parseUintParam(param string) (uint, error) {
 	}
 	return uint(parsed), nil
 }
+
+// parseLimitQuery parses an optional limit query parameter, applying a default and a maximum.
+func parseLimitQuery(param string, defaultLimit, maxLimit int) (int, error) {
+	if param == "" {
+		return defaultLimit, nil
+	}
+	limit, err := strconv.Atoi(param)
+	if err != nil || limit < 1 {
+		return 0, fmt.Errorf("invalid limit: %s", param)
+	}
+	if limit > maxLimit {
+		limit = maxLimit
+	}
+	return limit, nil
+}
+
+// parsePageQuery parses the optional page and page_size query parameters.
+// Pages start at 1, page_size defaults to 20 and is capped at 100.
+func parsePageQuery(pageParam, pageSizeParam string) (page int, pageSize int, err error) {
+	page = 1
+	if pageParam != "" {
+		page, err = strconv.Atoi(pageParam)
+		if err != nil || page < 1 {
+			return 0, 0, fmt.Errorf("invalid page: %s", pageParam)
+		}
+	}
+
+	pageSize, err = parseLimitQuery(pageSizeParam, 20, 100)
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid page_size: %s", pageSizeParam)
+	}
+
+	return page, pageSize, nil
+}
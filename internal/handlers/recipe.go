@@ -1,10 +1,13 @@
 package handlers
 
 import (
+	"errors"
 	"log"
 	"net/http"
+	"strconv"
 
 	"github.com/gin-gonic/gin"
+	"github.com/windoze95/saltybytes-api/internal/models"
 	"github.com/windoze95/saltybytes-api/internal/repository"
 	"github.com/windoze95/saltybytes-api/internal/service"
 	"github.com/windoze95/saltybytes-api/internal/util"
@@ -21,6 +24,7 @@ func NewRecipeHandler(recipeService *service.RecipeService) *RecipeHandler {
 }
 
 // GetRecipe returns a recipe by ID.
+// The optional servings and unit_system query parameters scale and convert the ingredients.
 func (h *RecipeHandler) GetRecipe(c *gin.Context) {
 	recipeIDStr := c.Param("recipe_id")
 	recipeID, err := parseUintParam(recipeIDStr)
@@ -29,7 +33,16 @@ func (h *RecipeHandler) GetRecipe(c *gin.Context) {
 		return
 	}
 
-	recipeResponse, err := h.Service.GetRecipeByID(recipeID)
+	options, err := parseRecipeDisplayOptions(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// The user is only in the context when a valid token was provided
+	user, _ := util.GetUserFromContext(c)
+
+	recipeResponse, err := h.Service.GetRecipeByID(recipeID, user, options)
 	if err != nil {
 		log.Printf("Error getting recipe: %v", err)
 		switch e := err.(type) {
@@ -44,8 +57,369 @@ func (h *RecipeHandler) GetRecipe(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{"recipe": recipeResponse})
 }
 
+// GetSharedRecipe returns a recipe by its share slug.
+// The optional servings and unit_system query parameters scale and convert the ingredients.
+func (h *RecipeHandler) GetSharedRecipe(c *gin.Context) {
+	options, err := parseRecipeDisplayOptions(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// The user is only in the context when a valid token was provided
+	user, _ := util.GetUserFromContext(c)
+
+	recipeResponse, err := h.Service.GetRecipeByShareSlug(c.Param("share_slug"), user, options)
+	if err != nil {
+		log.Printf("Error getting shared recipe: %v", err)
+		switch e := err.(type) {
+		case repository.NotFoundError:
+			c.JSON(http.StatusNotFound, gin.H{"error": e.Error()})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": e.Error()})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"recipe": recipeResponse})
+}
+
+// UpdateRecipeVisibility changes who can see a recipe.
+func (h *RecipeHandler) UpdateRecipeVisibility(c *gin.Context) {
+	// Retrieve the user from the context
+	user, err := util.GetUserFromContext(c)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	recipeID, err := parseUintParam(c.Param("recipe_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid recipe ID"})
+		return
+	}
+
+	var request struct {
+		Visibility models.RecipeVisibility `json:"visibility" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Visibility is required"})
+		return
+	}
+
+	switch request.Visibility {
+	case models.RecipeVisibilityPrivate, models.RecipeVisibilityUnlisted, models.RecipeVisibilityPublic:
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Visibility must be one of private, unlisted or public"})
+		return
+	}
+
+	recipeResponse, err := h.Service.UpdateRecipeVisibility(recipeID, user, request.Visibility)
+	if err != nil {
+		log.Printf("Error updating recipe visibility: %v", err)
+		switch e := err.(type) {
+		case repository.NotFoundError:
+			c.JSON(http.StatusNotFound, gin.H{"error": e.Error()})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": e.Error()})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"recipe": recipeResponse})
+}
+
+// GetRecipeVersions returns the versions of a recipe.
+func (h *RecipeHandler) GetRecipeVersions(c *gin.Context) {
+	recipeID, err := parseUintParam(c.Param("recipe_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid recipe ID"})
+		return
+	}
+
+	// The user is only in the context when a valid token was provided
+	user, _ := util.GetUserFromContext(c)
+
+	versions, err := h.Service.GetRecipeVersions(recipeID, user)
+	if err != nil {
+		log.Printf("Error getting recipe versions: %v", err)
+		switch e := err.(type) {
+		case repository.NotFoundError:
+			c.JSON(http.StatusNotFound, gin.H{"error": e.Error()})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": e.Error()})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"versions": versions})
+}
+
+// GetRecipeVersionTree returns the versions of a recipe as a tree of variations.
+func (h *RecipeHandler) GetRecipeVersionTree(c *gin.Context) {
+	recipeID, err := parseUintParam(c.Param("recipe_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid recipe ID"})
+		return
+	}
+
+	// The user is only in the context when a valid token was provided
+	user, _ := util.GetUserFromContext(c)
+
+	tree, err := h.Service.GetRecipeVersionTree(recipeID, user)
+	if err != nil {
+		log.Printf("Error getting recipe version tree: %v", err)
+		switch e := err.(type) {
+		case repository.NotFoundError:
+			c.JSON(http.StatusNotFound, gin.H{"error": e.Error()})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": e.Error()})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"tree": tree})
+}
+
+// DiffRecipeVersions returns a structured diff between two versions of a recipe.
+func (h *RecipeHandler) DiffRecipeVersions(c *gin.Context) {
+	recipeID, err := parseUintParam(c.Param("recipe_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid recipe ID"})
+		return
+	}
+
+	fromVersion, err := strconv.Atoi(c.Param("from_version"))
+	if err != nil || fromVersion < 1 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid version"})
+		return
+	}
+
+	toVersion, err := strconv.Atoi(c.Param("to_version"))
+	if err != nil || toVersion < 1 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid version"})
+		return
+	}
+
+	// The user is only in the context when a valid token was provided
+	user, _ := util.GetUserFromContext(c)
+
+	recipeDiff, err := h.Service.DiffRecipeVersions(recipeID, fromVersion, toVersion, user)
+	if err != nil {
+		log.Printf("Error diffing recipe versions: %v", err)
+		switch e := err.(type) {
+		case repository.NotFoundError:
+			c.JSON(http.StatusNotFound, gin.H{"error": e.Error()})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": e.Error()})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"diff": recipeDiff})
+}
+
+// ActivateRecipeVersion restores an older version of a recipe as the active version.
+func (h *RecipeHandler) ActivateRecipeVersion(c *gin.Context) {
+	// Retrieve the user from the context
+	user, err := util.GetUserFromContext(c)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	recipeID, err := parseUintParam(c.Param("recipe_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid recipe ID"})
+		return
+	}
+
+	version, err := strconv.Atoi(c.Param("version"))
+	if err != nil || version < 1 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid version"})
+		return
+	}
+
+	recipeResponse, err := h.Service.ActivateRecipeVersion(recipeID, version, user)
+	if err != nil {
+		log.Printf("Error activating recipe version: %v", err)
+		switch e := err.(type) {
+		case repository.NotFoundError:
+			c.JSON(http.StatusNotFound, gin.H{"error": e.Error()})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": e.Error()})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"recipe": recipeResponse})
+}
+
+// DeleteRecipe moves a recipe to the trash.
+func (h *RecipeHandler) DeleteRecipe(c *gin.Context) {
+	// Retrieve the user from the context
+	user, err := util.GetUserFromContext(c)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	recipeID, err := parseUintParam(c.Param("recipe_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid recipe ID"})
+		return
+	}
+
+	if err := h.Service.DeleteRecipe(recipeID, user); err != nil {
+		log.Printf("Error deleting recipe: %v", err)
+		switch e := err.(type) {
+		case repository.NotFoundError:
+			c.JSON(http.StatusNotFound, gin.H{"error": e.Error()})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": e.Error()})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Recipe moved to trash"})
+}
+
+// GetTrash returns the user's deleted recipes that can still be restored.
+func (h *RecipeHandler) GetTrash(c *gin.Context) {
+	// Retrieve the user from the context
+	user, err := util.GetUserFromContext(c)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	recipes, err := h.Service.GetTrash(user)
+	if err != nil {
+		log.Printf("Error getting trash: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"recipes": recipes})
+}
+
+// RestoreRecipe restores a recipe from the trash.
+func (h *RecipeHandler) RestoreRecipe(c *gin.Context) {
+	// Retrieve the user from the context
+	user, err := util.GetUserFromContext(c)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	recipeID, err := parseUintParam(c.Param("recipe_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid recipe ID"})
+		return
+	}
+
+	recipeResponse, err := h.Service.RestoreRecipe(recipeID, user)
+	if err != nil {
+		log.Printf("Error restoring recipe: %v", err)
+		switch e := err.(type) {
+		case repository.NotFoundError:
+			c.JSON(http.StatusNotFound, gin.H{"error": e.Error()})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": e.Error()})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"recipe": recipeResponse, "message": "Recipe restored"})
+}
+
+// GetSimilarRecipes returns recipes similar in meaning to a recipe.
+func (h *RecipeHandler) GetSimilarRecipes(c *gin.Context) {
+	recipeIDStr := c.Param("recipe_id")
+	recipeID, err := parseUintParam(recipeIDStr)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid recipe ID"})
+		return
+	}
+
+	limit, err := parseLimitQuery(c.Query("limit"), 10, 50)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid limit"})
+		return
+	}
+
+	// The user is only in the context when a valid token was provided
+	user, _ := util.GetUserFromContext(c)
+
+	recipeResponses, err := h.Service.GetSimilarRecipes(recipeID, user, limit)
+	if err != nil {
+		log.Printf("Error getting similar recipes: %v", err)
+		switch e := err.(type) {
+		case repository.NotFoundError:
+			c.JSON(http.StatusNotFound, gin.H{"error": e.Error()})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": e.Error()})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"recipes": recipeResponses})
+}
+
+// GetUserRecipes returns a page of the recipes created or collected by the user.
+func (h *RecipeHandler) GetUserRecipes(c *gin.Context) {
+	user, err := util.GetUserFromContext(c)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	page, pageSize, err := parsePageQuery(c.Query("page"), c.Query("page_size"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	filter := repository.UserRecipesFilter{
+		Scope:   repository.UserRecipesScope(c.DefaultQuery("scope", string(repository.UserRecipesAll))),
+		Hashtag: c.Query("tag"),
+		Query:   c.Query("q"),
+	}
+
+	switch filter.Scope {
+	case repository.UserRecipesAll, repository.UserRecipesCreated, repository.UserRecipesCollected:
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Scope must be one of all, created or collected"})
+		return
+	}
+
+	if collectionIDStr := c.Query("collection_id"); collectionIDStr != "" {
+		filter.CollectionID, err = parseUintParam(collectionIDStr)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid collection ID"})
+			return
+		}
+	}
+
+	recipePage, err := h.Service.GetUserRecipes(user, filter, page, pageSize)
+	if err != nil {
+		log.Printf("Error getting user recipes: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, recipePage)
+}
+
 // GetRecipeHistory returns a recipe history by ID.
 func (h *RecipeHandler) GetRecipeHistory(c *gin.Context) {
+	// Retrieve the user from the context
+	user, err := util.GetUserFromContext(c)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
 	historyIDStr := c.Param("history_id")
 	historyID, err := parseUintParam(historyIDStr)
 	if err != nil {
@@ -53,7 +427,7 @@ func (h *RecipeHandler) GetRecipeHistory(c *gin.Context) {
 		return
 	}
 
-	history, err := h.Service.GetRecipeHistoryByID(historyID)
+	history, err := h.Service.GetRecipeHistoryByID(historyID, user)
 	if err != nil {
 		log.Printf("Error getting recipe history: %v", err)
 		switch e := err.(type) {
@@ -95,6 +469,14 @@ func (h *RecipeHandler) GenerateRecipeWithChat(c *gin.Context) {
 
 	recipeResponse, err := h.Service.InitGenerateRecipeWithChat(user, request.UserPrompt)
 	if err != nil {
+		if e, ok := err.(service.ContentRejectedError); ok {
+			c.JSON(http.StatusUnprocessableEntity, gin.H{"error": e.Error(), "categories": e.Categories})
+			return
+		}
+		if errors.Is(err, service.ErrPromptTooLong) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
@@ -103,3 +485,87 @@ func (h *RecipeHandler) GenerateRecipeWithChat(c *gin.Context) {
 
 	c.JSON(http.StatusOK, gin.H{"recipe": recipeResponse, "message": "Generating recipe"})
 }
+
+// RegenerateRecipeWithChat regenerates a recipe from its active version or the given version.
+func (h *RecipeHandler) RegenerateRecipeWithChat(c *gin.Context) {
+	// Retrieve the user from the context
+	user, err := util.GetUserFromContext(c)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	recipeID, err := parseUintParam(c.Param("recipe_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid recipe ID"})
+		return
+	}
+
+	// Parse the request body for the user's prompt and the version to start from
+	var request struct {
+		UserPrompt  string `json:"user_prompt"`
+		FromVersion int    `json:"from_version"`
+	}
+
+	if err := c.BindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request: " + err.Error()})
+		return
+	}
+
+	if request.UserPrompt == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "User prompt is required"})
+		return
+	}
+
+	if request.FromVersion < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid version"})
+		return
+	}
+
+	recipeResponse, err := h.Service.InitRegenerateRecipeWithChat(recipeID, user, request.UserPrompt, request.FromVersion)
+	if err != nil {
+		log.Printf("Error regenerating recipe: %v", err)
+		if errors.Is(err, service.ErrPromptTooLong) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		switch e := err.(type) {
+		case repository.NotFoundError:
+			c.JSON(http.StatusNotFound, gin.H{"error": e.Error()})
+		case service.ContentRejectedError:
+			c.JSON(http.StatusUnprocessableEntity, gin.H{"error": e.Error(), "categories": e.Categories})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": e.Error()})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"recipe": recipeResponse, "message": "Regenerating recipe"})
+}
+
+// parseRecipeDisplayOptions parses the optional query parameters that adjust how a recipe is displayed.
+func parseRecipeDisplayOptions(c *gin.Context) (service.RecipeDisplayOptions, error) {
+	var options service.RecipeDisplayOptions
+
+	if servingsParam := c.Query("servings"); servingsParam != "" {
+		servings, err := strconv.Atoi(servingsParam)
+		if err != nil || servings < 1 || servings > 100 {
+			return options, errors.New("servings must be a number between 1 and 100")
+		}
+		options.Servings = servings
+	}
+
+	switch c.Query("unit_system") {
+	case "":
+	case "us_customary", "us":
+		unitSystem := models.USCustomary
+		options.UnitSystem = &unitSystem
+	case "metric":
+		unitSystem := models.Metric
+		options.UnitSystem = &unitSystem
+	default:
+		return options, errors.New("unit_system must be us_customary or metric")
+	}
+
+	return options, nil
+}
@@ -0,0 +1,94 @@
+package handlers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/windoze95/saltybytes-api/internal/repository"
+	"github.com/windoze95/saltybytes-api/internal/service"
+)
+
+// TagHandler is the handler for tag-related requests.
+type TagHandler struct {
+	Service *service.TagService
+}
+
+// NewTagHandler is the constructor function for initializing a new TagHandler.
+func NewTagHandler(tagService *service.TagService) *TagHandler {
+	return &TagHandler{Service: tagService}
+}
+
+// SearchTags returns tags matching a prefix with their usage counts, for autocomplete.
+func (h *TagHandler) SearchTags(c *gin.Context) {
+	limit, err := parseLimitQuery(c.Query("limit"), 20, 100)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid limit"})
+		return
+	}
+
+	tags, err := h.Service.SearchTags(c.Query("prefix"), limit)
+	if err != nil {
+		log.Printf("Error searching tags: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"tags": tags})
+}
+
+// GetTrendingTags returns the most used tags of recently created recipes.
+func (h *TagHandler) GetTrendingTags(c *gin.Context) {
+	limit, err := parseLimitQuery(c.Query("limit"), 20, 100)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid limit"})
+		return
+	}
+
+	days := 7
+	if daysStr := c.Query("days"); daysStr != "" {
+		days, err = strconv.Atoi(daysStr)
+		if err != nil || days < 1 || days > 90 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Days must be between 1 and 90"})
+			return
+		}
+	}
+
+	tags, err := h.Service.GetTrendingTags(days, limit)
+	if err != nil {
+		log.Printf("Error getting trending tags: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"tags": tags, "days": days})
+}
+
+// GetRecipesByTag returns a page of recipes associated with a hashtag.
+func (h *TagHandler) GetRecipesByTag(c *gin.Context) {
+	page, pageSize, err := parsePageQuery(c.Query("page"), c.Query("page_size"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	tagRecipes, err := h.Service.GetRecipesByTag(c.Param("hashtag"), page, pageSize)
+	if err != nil {
+		log.Printf("Error getting recipes by tag: %v", err)
+		if errors.Is(err, service.ErrInvalidHashtag) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		switch e := err.(type) {
+		case repository.NotFoundError:
+			c.JSON(http.StatusNotFound, gin.H{"error": e.Error()})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": e.Error()})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, tagRecipes)
+}
@@ -1,24 +1,29 @@
 package handlers
 
 import (
-	"fmt"
+	"errors"
 	"log"
+	"math"
 	"net/http"
+	"strconv"
 
-	"github.com/dgrijalva/jwt-go"
 	"github.com/gin-gonic/gin"
+	"github.com/windoze95/saltybytes-api/internal/models"
+	"github.com/windoze95/saltybytes-api/internal/oidc"
+	"github.com/windoze95/saltybytes-api/internal/repository"
 	"github.com/windoze95/saltybytes-api/internal/service"
 	"github.com/windoze95/saltybytes-api/internal/util"
 )
 
 // UserHandler is the handler for user-related requests.
 type UserHandler struct {
-	Service *service.UserService
+	Service     *service.UserService
+	AuthService *service.AuthService
 }
 
 // NewUserHandler is the constructor function for initializing a new UserHandler.
-func NewUserHandler(userService *service.UserService) *UserHandler {
-	return &UserHandler{Service: userService}
+func NewUserHandler(userService *service.UserService, authService *service.AuthService) *UserHandler {
+	return &UserHandler{Service: userService, AuthService: authService}
 }
 
 // CreateUser creates a new user.
@@ -62,14 +67,21 @@ func (h *UserHandler) CreateUser(c *gin.Context) {
 	}
 
 	// Log the user in
-	tokenString, err := generateAuthToken(user.ID, h.Service.Cfg.Env.JwtSecretKey.Value())
+	tokens, err := h.AuthService.IssueTokens(user.ID)
 	if err != nil {
-		log.Printf("error: handlers.LoginUser: %v", err)
+		log.Printf("error: handlers.CreateUser: %v", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"access_token": tokenString, "message": "User signed up successfully", "user": user})
+	c.JSON(http.StatusOK, gin.H{
+		"access_token":             tokens.AccessToken,
+		"access_token_expires_at":  tokens.AccessExpiresAt,
+		"refresh_token":            tokens.RefreshToken,
+		"refresh_token_expires_at": tokens.RefreshExpiresAt,
+		"message":                  "User signed up successfully",
+		"user":                     user,
+	})
 }
 
 // LoginUser logs a user in.
@@ -84,39 +96,24 @@ func (h *UserHandler) LoginUser(c *gin.Context) {
 		return
 	}
 
-	userResponse, err := h.Service.LoginUser(userCredentials.Username, userCredentials.Password)
+	userResponse, err := h.Service.LoginUser(userCredentials.Username, userCredentials.Password, c.ClientIP())
 	if err != nil {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		var throttled service.LoginThrottledError
+		switch {
+		case errors.As(err, &throttled):
+			c.Header("Retry-After", strconv.Itoa(int(math.Ceil(throttled.RetryAfter.Seconds()))))
+			c.JSON(http.StatusTooManyRequests, gin.H{"error": throttled.Error()})
+		case errors.Is(err, service.ErrInvalidCredentials):
+			c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		default:
+			log.Printf("error: handlers.LoginUser: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to log in"})
+		}
 		return
 	}
 
 	// Log the user in
-	tokenString, err := generateAuthToken(userResponse.ID, h.Service.Cfg.Env.JwtSecretKey.Value())
-	if err != nil {
-		log.Printf("error: handlers.LoginUser: %v", err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-		return
-	}
-
-	c.JSON(http.StatusOK, gin.H{"access_token": tokenString, "message": "User logged in successfully", "user": userResponse})
-}
-
-// generateAuthToken generates a JWT token for a user.
-func generateAuthToken(userID uint, secretKey string) (string, error) {
-	// Create a new token object, specifying signing method and the claims you would like it to contain.
-	token := jwt.New(jwt.SigningMethodHS256)
-
-	// Set claims
-	claims := token.Claims.(jwt.MapClaims)
-	claims["user_id"] = userID
-
-	// Sign and get the complete encoded token as a string using the secret
-	tokenString, err := token.SignedString([]byte(secretKey))
-	if err != nil {
-		return "", fmt.Errorf("generateAuthToken: %v ", err)
-	}
-
-	return tokenString, nil
+	h.respondWithLogin(c, "handlers.LoginUser", userResponse, gin.H{"message": "User logged in successfully"})
 }
 
 // VerifyToken verifies a user's JWT token.
@@ -153,3 +150,413 @@ func (h *UserHandler) GetUserSettings(c *gin.Context) {
 
 	c.JSON(http.StatusOK, gin.H{"settings": user.Settings})
 }
+
+// UpdateProfile changes the user's first name, email or username.
+func (h *UserHandler) UpdateProfile(c *gin.Context) {
+	// Retrieve the user from the context
+	user, err := util.GetUserFromContext(c)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	var request struct {
+		FirstName *string `json:"first_name"`
+		Email     *string `json:"email"`
+		Username  *string `json:"username"`
+	}
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request: " + err.Error()})
+		return
+	}
+
+	update := &service.ProfileUpdate{
+		FirstName: request.FirstName,
+		Email:     request.Email,
+		Username:  request.Username,
+	}
+
+	// Validate the changed fields
+	if err := h.Service.ValidateProfileUpdate(user, update); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	userResponse, err := h.Service.UpdateProfile(user, update)
+	if err != nil {
+		log.Printf("Error updating profile: %v", err)
+		switch e := err.(type) {
+		case repository.ConflictError:
+			c.JSON(http.StatusConflict, gin.H{"error": e.Error()})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": e.Error()})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"user": userResponse})
+}
+
+// UpdateSettings changes the user's settings.
+func (h *UserHandler) UpdateSettings(c *gin.Context) {
+	// Retrieve the user from the context
+	user, err := util.GetUserFromContext(c)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	var request struct {
+		KeepScreenAwake *bool              `json:"keep_screen_awake"`
+		Theme           *models.Theme      `json:"theme"`
+		DefaultServings *int               `json:"default_servings"`
+		TimerSound      *models.TimerSound `json:"timer_sound"`
+	}
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request: " + err.Error()})
+		return
+	}
+
+	update := &service.SettingsUpdate{
+		KeepScreenAwake: request.KeepScreenAwake,
+		Theme:           request.Theme,
+		DefaultServings: request.DefaultServings,
+		TimerSound:      request.TimerSound,
+	}
+
+	if err := h.Service.ValidateSettingsUpdate(update); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	settings, err := h.Service.UpdateSettings(user, update)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"settings": settings})
+}
+
+// ChangePassword changes the user's password, given their current password.
+func (h *UserHandler) ChangePassword(c *gin.Context) {
+	// Retrieve the user from the context
+	user, err := util.GetUserFromContext(c)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	var request struct {
+		CurrentPassword string `json:"current_password" binding:"required"`
+		NewPassword     string `json:"new_password" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Current and new passwords are required"})
+		return
+	}
+
+	// Validate the new password
+	if err := h.Service.ValidatePassword(request.NewPassword); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// The session the password is changed in stays signed in
+	sessionID, err := util.GetSessionIDFromContext(c)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := h.Service.ChangePassword(user, sessionID, request.CurrentPassword, request.NewPassword); err != nil {
+		if errors.Is(err, service.ErrIncorrectPassword) {
+			c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Password changed successfully"})
+}
+
+// GetPersonalization fetches the user's personalization settings.
+func (h *UserHandler) GetPersonalization(c *gin.Context) {
+	// Retrieve the user from the context
+	user, err := util.GetUserFromContext(c)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	personalization, err := h.Service.GetPersonalization(user)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"personalization": personalization})
+}
+
+// UpdatePersonalization replaces the user's personalization settings.
+func (h *UserHandler) UpdatePersonalization(c *gin.Context) {
+	// Retrieve the user from the context
+	user, err := util.GetUserFromContext(c)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	var request struct {
+		UnitSystem   *models.UnitSystem `json:"unit_system" binding:"required"`
+		Requirements string             `json:"requirements"`
+		Diets        []string           `json:"diets"`
+		Allergens    []string           `json:"allergens"`
+	}
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Unit system is required"})
+		return
+	}
+
+	updatedPersonalization := &models.Personalization{
+		UnitSystem:   *request.UnitSystem,
+		Requirements: request.Requirements,
+		Diets:        request.Diets,
+		Allergens:    request.Allergens,
+	}
+
+	personalization, err := h.Service.UpdatePersonalization(user, updatedPersonalization)
+	if err != nil {
+		log.Printf("Error updating personalization: %v", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"personalization": personalization})
+}
+
+// RequestEmailVerification emails the user a link to verify their email address.
+func (h *UserHandler) RequestEmailVerification(c *gin.Context) {
+	// Retrieve the user from the context
+	user, err := util.GetUserFromContext(c)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := h.Service.SendEmailVerification(user); err != nil {
+		switch {
+		case errors.Is(err, service.ErrEmailAlreadyVerified):
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		case errors.Is(err, service.ErrTooManyEmails):
+			c.JSON(http.StatusTooManyRequests, gin.H{"error": err.Error()})
+		default:
+			log.Printf("error: handlers.RequestEmailVerification: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to send verification email"})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Verification email sent"})
+}
+
+// ConfirmEmailVerification verifies the user's email address with the token from a verification email.
+func (h *UserHandler) ConfirmEmailVerification(c *gin.Context) {
+	var request struct {
+		Token string `json:"token" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "token is required"})
+		return
+	}
+
+	if err := h.Service.ConfirmEmailVerification(request.Token); err != nil {
+		if errors.Is(err, service.ErrInvalidUserToken) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		log.Printf("error: handlers.ConfirmEmailVerification: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to verify email"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Email verified successfully"})
+}
+
+// RequestPasswordReset emails a password reset link to the user with the given email address, if there is one.
+func (h *UserHandler) RequestPasswordReset(c *gin.Context) {
+	var request struct {
+		Email string `json:"email" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "email is required"})
+		return
+	}
+
+	if err := h.Service.RequestPasswordReset(request.Email); err != nil {
+		if errors.Is(err, service.ErrTooManyEmails) {
+			c.JSON(http.StatusTooManyRequests, gin.H{"error": err.Error()})
+			return
+		}
+		log.Printf("error: handlers.RequestPasswordReset: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to request password reset"})
+		return
+	}
+
+	// The response is the same whether or not the address has an account
+	c.JSON(http.StatusOK, gin.H{"message": "If an account uses that email, a password reset link has been sent to it"})
+}
+
+// ResetPassword sets a new password with the token from a password reset email.
+func (h *UserHandler) ResetPassword(c *gin.Context) {
+	var request struct {
+		Token       string `json:"token" binding:"required"`
+		NewPassword string `json:"new_password" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Token and new password are required"})
+		return
+	}
+
+	// Validate the new password
+	if err := h.Service.ValidatePassword(request.NewPassword); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := h.Service.ResetPassword(request.Token, request.NewPassword); err != nil {
+		if errors.Is(err, service.ErrInvalidUserToken) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		log.Printf("error: handlers.ResetPassword: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to reset password"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Password reset successfully, please log in again"})
+}
+
+// LoginWithIdentity logs a user in, or signs them up, with an ID token from an identity provider.
+func (h *UserHandler) LoginWithIdentity(c *gin.Context) {
+	var request struct {
+		IDToken string `json:"id_token" binding:"required"`
+		Nonce   string `json:"nonce"`
+	}
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "id_token is required"})
+		return
+	}
+
+	provider := models.UserAuthType(c.Param("provider"))
+	userResponse, created, err := h.Service.LoginWithIdentity(provider, request.IDToken, request.Nonce)
+	if err != nil {
+		respondWithIdentityError(c, "Error logging in with identity", err)
+		return
+	}
+
+	message := "User logged in successfully"
+	if created {
+		message = "User signed up successfully"
+	}
+
+	h.respondWithLogin(c, "handlers.LoginWithIdentity", userResponse, gin.H{"message": message, "created": created})
+}
+
+// GetIdentities fetches the identities linked to the user.
+func (h *UserHandler) GetIdentities(c *gin.Context) {
+	// Retrieve the user from the context
+	user, err := util.GetUserFromContext(c)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	identities, err := h.Service.GetIdentities(user)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"identities": identities})
+}
+
+// LinkIdentity links the identity of an ID token from an identity provider to the user.
+func (h *UserHandler) LinkIdentity(c *gin.Context) {
+	// Retrieve the user from the context
+	user, err := util.GetUserFromContext(c)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	var request struct {
+		IDToken string `json:"id_token" binding:"required"`
+		Nonce   string `json:"nonce"`
+	}
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "id_token is required"})
+		return
+	}
+
+	provider := models.UserAuthType(c.Param("provider"))
+	identity, err := h.Service.LinkIdentity(user, provider, request.IDToken, request.Nonce)
+	if err != nil {
+		respondWithIdentityError(c, "Error linking identity", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Identity linked successfully", "identity": identity})
+}
+
+// UnlinkIdentity unlinks an identity from the user.
+func (h *UserHandler) UnlinkIdentity(c *gin.Context) {
+	// Retrieve the user from the context
+	user, err := util.GetUserFromContext(c)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	identityID, err := parseUintParam(c.Param("identity_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid identity ID"})
+		return
+	}
+
+	if err := h.Service.UnlinkIdentity(user, identityID); err != nil {
+		if errors.Is(err, service.ErrLastLoginMethod) {
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+			return
+		}
+		switch e := err.(type) {
+		case repository.NotFoundError:
+			c.JSON(http.StatusNotFound, gin.H{"error": e.Error()})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": e.Error()})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Identity unlinked successfully"})
+}
+
+// respondWithIdentityError responds to a failed sign in with, or link of, an identity.
+func respondWithIdentityError(c *gin.Context, logMessage string, err error) {
+	log.Printf("%s: %v", logMessage, err)
+	switch {
+	case errors.Is(err, service.ErrUnknownIdentityProvider):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case errors.Is(err, oidc.ErrInvalidIDToken):
+		c.JSON(http.StatusUnauthorized, gin.H{"error": oidc.ErrInvalidIDToken.Error()})
+	case errors.Is(err, service.ErrIdentityEmailInUse):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	default:
+		if e, ok := err.(repository.ConflictError); ok {
+			c.JSON(http.StatusConflict, gin.H{"error": e.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to sign in with identity provider"})
+	}
+}
@@ -0,0 +1,232 @@
+package handlers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/windoze95/saltybytes-api/internal/service"
+	"github.com/windoze95/saltybytes-api/internal/util"
+)
+
+// mfaCodeRequest is the request body carrying a code from an authenticator app or a recovery code.
+type mfaCodeRequest struct {
+	Code         string `json:"code"`
+	RecoveryCode string `json:"recovery_code"`
+}
+
+// respondWithLogin issues the tokens of a new session to a user who logged in and responds with them
+// along with the given fields. Users with two-factor authentication get an MFA challenge token instead,
+// which VerifyMFA exchanges for the tokens.
+func (h *UserHandler) respondWithLogin(c *gin.Context, handlerName string, userResponse *service.UserResponse, body gin.H) {
+	mfaEnabled, err := h.Service.IsMFAEnabled(userResponse.ID)
+	if err != nil {
+		log.Printf("error: %s: %v", handlerName, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to log in"})
+		return
+	}
+
+	if mfaEnabled {
+		challenge, expiresAt, err := h.AuthService.IssueMFAChallenge(userResponse.ID)
+		if err != nil {
+			log.Printf("error: %s: %v", handlerName, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to log in"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"mfa_required":         true,
+			"mfa_token":            challenge,
+			"mfa_token_expires_at": expiresAt,
+			"message":              "Two-factor authentication required",
+		})
+		return
+	}
+
+	tokens, err := h.AuthService.IssueTokens(userResponse.ID)
+	if err != nil {
+		log.Printf("error: %s: %v", handlerName, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	body["access_token"] = tokens.AccessToken
+	body["access_token_expires_at"] = tokens.AccessExpiresAt
+	body["refresh_token"] = tokens.RefreshToken
+	body["refresh_token_expires_at"] = tokens.RefreshExpiresAt
+	body["user"] = userResponse
+	c.JSON(http.StatusOK, body)
+}
+
+// VerifyMFA finishes logging in a user with two-factor authentication, exchanging the MFA challenge token
+// from the first step and a code from their authenticator app, or a recovery code, for the session's tokens.
+func (h *UserHandler) VerifyMFA(c *gin.Context) {
+	var request struct {
+		MFAToken string `json:"mfa_token" binding:"required"`
+		mfaCodeRequest
+	}
+	if err := c.ShouldBindJSON(&request); err != nil || (request.Code == "" && request.RecoveryCode == "") {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "mfa_token and a code or recovery_code are required"})
+		return
+	}
+
+	userResponse, err := h.Service.CompleteMFALogin(request.MFAToken, request.Code, request.RecoveryCode)
+	if err != nil {
+		respondWithMFAError(c, "Error verifying two-factor authentication", err)
+		return
+	}
+
+	tokens, err := h.AuthService.IssueTokens(userResponse.ID)
+	if err != nil {
+		log.Printf("error: handlers.VerifyMFA: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"access_token":             tokens.AccessToken,
+		"access_token_expires_at":  tokens.AccessExpiresAt,
+		"refresh_token":            tokens.RefreshToken,
+		"refresh_token_expires_at": tokens.RefreshExpiresAt,
+		"message":                  "User logged in successfully",
+		"user":                     userResponse,
+	})
+}
+
+// GetMFAStatus fetches the user's two-factor authentication status.
+func (h *UserHandler) GetMFAStatus(c *gin.Context) {
+	// Retrieve the user from the context
+	user, err := util.GetUserFromContext(c)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	status, err := h.Service.GetMFAStatus(user)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"mfa": status})
+}
+
+// StartTOTPEnrollment generates a TOTP secret for the user to add to their authenticator app.
+func (h *UserHandler) StartTOTPEnrollment(c *gin.Context) {
+	// Retrieve the user from the context
+	user, err := util.GetUserFromContext(c)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	enrollment, err := h.Service.StartTOTPEnrollment(user)
+	if err != nil {
+		respondWithMFAError(c, "Error starting TOTP enrollment", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":    "Scan the QR code with your authenticator app, then confirm a code to enable two-factor authentication",
+		"enrollment": enrollment,
+	})
+}
+
+// ConfirmTOTPEnrollment enables two-factor authentication once the user enters a code from their authenticator app.
+func (h *UserHandler) ConfirmTOTPEnrollment(c *gin.Context) {
+	// Retrieve the user from the context
+	user, err := util.GetUserFromContext(c)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	var request struct {
+		Code string `json:"code" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "code is required"})
+		return
+	}
+
+	recoveryCodes, err := h.Service.ConfirmTOTPEnrollment(user, request.Code)
+	if err != nil {
+		respondWithMFAError(c, "Error confirming TOTP enrollment", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":        "Two-factor authentication enabled, store the recovery codes somewhere safe",
+		"recovery_codes": recoveryCodes,
+	})
+}
+
+// DisableTOTP turns off the user's two-factor authentication.
+func (h *UserHandler) DisableTOTP(c *gin.Context) {
+	// Retrieve the user from the context
+	user, err := util.GetUserFromContext(c)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	var request mfaCodeRequest
+	if err := c.ShouldBindJSON(&request); err != nil || (request.Code == "" && request.RecoveryCode == "") {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "A code or recovery_code is required"})
+		return
+	}
+
+	if err := h.Service.DisableTOTP(user, request.Code, request.RecoveryCode); err != nil {
+		respondWithMFAError(c, "Error disabling TOTP", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Two-factor authentication disabled"})
+}
+
+// RegenerateRecoveryCodes replaces the user's recovery codes.
+func (h *UserHandler) RegenerateRecoveryCodes(c *gin.Context) {
+	// Retrieve the user from the context
+	user, err := util.GetUserFromContext(c)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	var request mfaCodeRequest
+	if err := c.ShouldBindJSON(&request); err != nil || (request.Code == "" && request.RecoveryCode == "") {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "A code or recovery_code is required"})
+		return
+	}
+
+	recoveryCodes, err := h.Service.RegenerateRecoveryCodes(user, request.Code, request.RecoveryCode)
+	if err != nil {
+		respondWithMFAError(c, "Error regenerating recovery codes", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":        "Recovery codes regenerated, the old ones no longer work",
+		"recovery_codes": recoveryCodes,
+	})
+}
+
+// respondWithMFAError responds to a failed two-factor authentication request.
+func respondWithMFAError(c *gin.Context, logMessage string, err error) {
+	log.Printf("%s: %v", logMessage, err)
+	switch {
+	case errors.Is(err, service.ErrInvalidMFAChallenge):
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+	case errors.Is(err, service.ErrInvalidMFACode):
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+	case errors.Is(err, service.ErrMFALocked):
+		c.JSON(http.StatusTooManyRequests, gin.H{"error": err.Error()})
+	case errors.Is(err, service.ErrMFAAlreadyEnabled):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	case errors.Is(err, service.ErrMFANotEnabled), errors.Is(err, service.ErrMFAEnrollmentNotStarted):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to process two-factor authentication"})
+	}
+}
@@ -0,0 +1,47 @@
+package mailer
+
+import (
+	"errors"
+	"log"
+
+	"github.com/windoze95/saltybytes-api/internal/config"
+)
+
+// Message is an email to send.
+type Message struct {
+	To      string
+	Subject string
+	Body    string // Plain text
+}
+
+// Mailer sends emails.
+type Mailer interface {
+	Send(msg Message) error
+}
+
+// New returns the mailer selected by the Mailer environment variable, which must be set.
+// "smtp" sends through the server configured by the SMTP environment variables, "log" logs emails
+// instead of sending them and "memory" keeps them in memory. Emails carry password reset and
+// verification links, so only use the log mailer where nobody else can read the logs.
+func New(cfg *config.Config) (Mailer, error) {
+	switch cfg.Env.Mailer.Value() {
+	case "smtp":
+		if cfg.Env.SMTPHost.Value() == "" || cfg.Env.MailFrom.Value() == "" {
+			return nil, errors.New("the smtp mailer needs $SMTPHost and $MailFrom to be set")
+		}
+		return NewSMTPMailer(
+			cfg.Env.SMTPHost.Value(),
+			cfg.Env.SMTPPort.Value(),
+			cfg.Env.SMTPUsername.Value(),
+			cfg.Env.SMTPPassword.Value(),
+			cfg.Env.MailFrom.Value(),
+		), nil
+	case "log":
+		log.Printf("warning: emails are logged instead of sent, including password reset links")
+		return &LogMailer{}, nil
+	case "memory":
+		return &MemoryMailer{}, nil
+	default:
+		return nil, errors.New("no mailer configured, set $Mailer to smtp, log or memory")
+	}
+}
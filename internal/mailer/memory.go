@@ -0,0 +1,43 @@
+package mailer
+
+import (
+	"log"
+	"sync"
+)
+
+// LogMailer logs emails instead of sending them, for development.
+type LogMailer struct{}
+
+// Send logs an email.
+func (m *LogMailer) Send(msg Message) error {
+	log.Printf("mailer: email to %s with subject %q:\n%s", msg.To, msg.Subject, msg.Body)
+	return nil
+}
+
+// MemoryMailer keeps emails in memory instead of sending them, for tests.
+type MemoryMailer struct {
+	mu       sync.Mutex
+	messages []Message
+}
+
+// Send records an email.
+func (m *MemoryMailer) Send(msg Message) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.messages = append(m.messages, msg)
+	return nil
+}
+
+// Messages returns the emails sent so far.
+func (m *MemoryMailer) Messages() []Message {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]Message(nil), m.messages...)
+}
+
+// Reset forgets the emails sent so far.
+func (m *MemoryMailer) Reset() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.messages = nil
+}
@@ -3,45 +3,44 @@ package middleware
 import (
 	"net/http"
 
-	"github.com/dgrijalva/jwt-go"
 	"github.com/gin-gonic/gin"
-	"github.com/windoze95/saltybytes-api/internal/config"
+	"github.com/windoze95/saltybytes-api/internal/service"
 )
 
-// VerifyTokenMiddleware verifies the JWT token provided in the Authorization header.
-func VerifyTokenMiddleware(cfg *config.Config) gin.HandlerFunc {
+// VerifyTokenMiddleware verifies the JWT access token provided in the Authorization header.
+// Expired and revoked tokens, and tokens not signed with HS256, are rejected.
+func VerifyTokenMiddleware(authService *service.AuthService) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		authHeader := c.GetHeader("Authorization")
-		tokenString := authHeader // Token is directly provided in the Authorization header
+		tokenString := c.GetHeader("Authorization") // Token is directly provided in the Authorization header
 
-		token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
-			return []byte(cfg.Env.JwtSecretKey.Value()), nil
-		})
+		userID, sessionID, err := authService.VerifyAccessToken(tokenString)
 		if err != nil {
 			c.JSON(http.StatusUnauthorized, gin.H{"message": "Invalid or expired token"})
 			c.Abort()
 			return
 		}
 
-		// Check if the token is valid
-		if claims, ok := token.Claims.(jwt.MapClaims); ok && token.Valid {
-			// Type assert to float64 (default for JSON numbers)
-			if idFloat, ok := claims["user_id"].(float64); ok {
-				// Convert to uint
-				userID := uint(idFloat)
-				// Set the userID in the context
-				c.Set("user_id", userID)
-				c.Next()
-			} else {
-				// Handle error: claim is not a float64
-				c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid user_id in token"})
-				c.Abort()
-				return
-			}
-		} else {
-			c.JSON(http.StatusUnauthorized, gin.H{"message": "Unauthorized"})
-			c.Abort()
+		// Set the userID and the session ID in the context
+		c.Set("user_id", userID)
+		c.Set("session_id", sessionID)
+		c.Next()
+	}
+}
+
+// OptionalVerifyTokenMiddleware sets the user ID in the context when a valid JWT access token is provided
+// in the Authorization header. Requests without a valid token continue anonymously.
+func OptionalVerifyTokenMiddleware(authService *service.AuthService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		tokenString := c.GetHeader("Authorization")
+		if tokenString == "" {
+			c.Next()
 			return
 		}
+
+		if userID, sessionID, err := authService.VerifyAccessToken(tokenString); err == nil {
+			c.Set("user_id", userID)
+			c.Set("session_id", sessionID)
+		}
+		c.Next()
 	}
 }
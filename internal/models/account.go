@@ -0,0 +1,52 @@
+package models
+
+import (
+	"time"
+
+	"github.com/jinzhu/gorm"
+)
+
+// AccountDeletionJob is the model for a background job deleting a user's account and data.
+// The job outlives the user, so it is looked up by its opaque PublicID rather than by user.
+type AccountDeletionJob struct {
+	gorm.Model
+	PublicID     string                `gorm:"unique;index"`
+	UserID       uint                  `gorm:"index"` // Not a foreign key, the user is deleted by the job
+	RecipeAction RecipeDeletionAction  `gorm:"type:text"`
+	Status       AccountDeletionStatus `gorm:"type:text;index"`
+	Error        string                `gorm:"default:null"` // Why the last run failed
+	CompletedAt  *time.Time
+}
+
+// RecipeDeletionAction is the type for the RecipeDeletionAction enum.
+type RecipeDeletionAction string
+
+// RecipeDeletionAction enum values.
+const (
+	// RecipeDeletionDelete deletes every recipe the user created.
+	RecipeDeletionDelete RecipeDeletionAction = "delete"
+	// RecipeDeletionAnonymize keeps the user's public and unlisted recipes without a creator,
+	// their private and trashed recipes are deleted.
+	RecipeDeletionAnonymize RecipeDeletionAction = "anonymize"
+)
+
+// IsValidRecipeDeletionAction checks if the RecipeDeletionAction is valid.
+func IsValidRecipeDeletionAction(action RecipeDeletionAction) bool {
+	switch action {
+	case RecipeDeletionDelete, RecipeDeletionAnonymize:
+		return true
+	default:
+		return false
+	}
+}
+
+// AccountDeletionStatus is the type for the AccountDeletionStatus enum.
+type AccountDeletionStatus string
+
+// AccountDeletionStatus enum values.
+const (
+	AccountDeletionPending   AccountDeletionStatus = "pending"
+	AccountDeletionRunning   AccountDeletionStatus = "running"
+	AccountDeletionCompleted AccountDeletionStatus = "completed"
+	AccountDeletionFailed    AccountDeletionStatus = "failed" // Retried when the API restarts
+)
@@ -0,0 +1,102 @@
+package models
+
+import (
+	"time"
+
+	"github.com/jinzhu/gorm"
+)
+
+// RefreshToken is the model for a refresh token issued to a user.
+// Refresh tokens are rotated on every use, each token in a chain of rotations shares a FamilyID
+// so a login session can be revoked as a whole. Only a hash of the token is stored.
+type RefreshToken struct {
+	gorm.Model
+	UserID       uint   `gorm:"index"`
+	FamilyID     string `gorm:"index"`
+	TokenHash    string `gorm:"unique;index"`
+	ExpiresAt    time.Time
+	RevokedAt    *time.Time
+	ReplacedByID *uint // The token this one was rotated into
+}
+
+// UserToken is the model for a single-use token emailed to a user, e.g. to reset their password.
+// Only a hash of the token is stored.
+type UserToken struct {
+	gorm.Model
+	UserID    uint         `gorm:"index"`
+	Purpose   TokenPurpose `gorm:"type:text;index"`
+	Email     string       // The address the token was sent to
+	TokenHash string       `gorm:"unique;index"`
+	ExpiresAt time.Time
+	UsedAt    *time.Time
+}
+
+// TokenPurpose is the type for the TokenPurpose enum.
+type TokenPurpose string
+
+// TokenPurpose enum values.
+const (
+	EmailVerificationToken TokenPurpose = "email_verification"
+	PasswordResetToken     TokenPurpose = "password_reset"
+)
+
+// UserIdentity is the model for an account with an identity provider, like Google, linked to a user.
+// A user can sign in with any of their linked identities.
+type UserIdentity struct {
+	gorm.Model
+	UserID   uint         `gorm:"index"`
+	Provider UserAuthType `gorm:"type:text;unique_index:idx_user_identities_provider_subject"`
+	Subject  string       `gorm:"unique_index:idx_user_identities_provider_subject"` // The provider's ID for the account
+	Email    string       // The email of the account at the provider when it was linked
+}
+
+// IsValidIdentityProvider checks if an auth type is an identity provider users can link.
+func IsValidIdentityProvider(provider UserAuthType) bool {
+	switch provider {
+	case Google, Apple:
+		return true
+	default:
+		return false
+	}
+}
+
+// LoginAttempt is the model for the audit record of an attempt to log in with a username and password.
+type LoginAttempt struct {
+	ID        uint        `gorm:"primary_key"`
+	CreatedAt time.Time   `gorm:"index"`
+	Username  string      `gorm:"index"` // Lowercased, recorded whether or not a user has it
+	UserID    *uint       `gorm:"index"`
+	IP        string      `gorm:"index"`
+	Result    LoginResult `gorm:"type:text"`
+}
+
+// LoginResult is the type for the LoginResult enum.
+type LoginResult string
+
+// LoginResult enum values.
+const (
+	LoginSucceeded LoginResult = "succeeded"
+	LoginFailed    LoginResult = "failed"    // Unknown username or wrong password
+	LoginThrottled LoginResult = "throttled" // Rejected without checking the password
+)
+
+// UserMFA is the model for a user's two-factor authentication with an authenticator app (TOTP).
+// The secret is created when the user starts enrolling and only protects logins once EnabledAt is set.
+type UserMFA struct {
+	gorm.Model
+	UserID          uint `gorm:"unique;index"`
+	EncryptedSecret string
+	EnabledAt       *time.Time
+	LastUsedStep    int64 // The time step of the last code used, so a code can't be used twice
+	FailedAttempts  int   // Consecutive failed codes
+	LockedUntil     *time.Time
+}
+
+// MFARecoveryCode is the model for a single-use code a user can log in with instead of a TOTP code.
+// Only a hash of the code is stored.
+type MFARecoveryCode struct {
+	gorm.Model
+	UserID   uint   `gorm:"index"`
+	CodeHash string `gorm:"index"`
+	UsedAt   *time.Time
+}
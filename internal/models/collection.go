@@ -0,0 +1,28 @@
+package models
+
+import (
+	"time"
+
+	"github.com/jinzhu/gorm"
+)
+
+// Collection is the model for a named folder of recipes saved by a user, e.g. "Weeknight" or "Holiday".
+type Collection struct {
+	gorm.Model
+	UserID    uint `gorm:"index"`
+	Name      string
+	Position  int                // To track the order of the user's collections
+	IsShared  bool               `gorm:"default:false"`
+	ShareSlug string             `gorm:"unique;index"` // Opaque slug for the public link
+	Recipes   []CollectionRecipe `gorm:"foreignKey:CollectionID"`
+}
+
+// CollectionRecipe is the model for a recipe placed in a collection.
+type CollectionRecipe struct {
+	CollectionID uint    `gorm:"primary_key;auto_increment:false"`
+	RecipeID     uint    `gorm:"primary_key;auto_increment:false"`
+	ShareSlug    *string // The share slug an unlisted recipe was added through, nil for recipes added by ID
+	Position     int     // To track the order of the recipes in the collection
+	CreatedAt    time.Time
+	Recipe       *Recipe `gorm:"foreignKey:RecipeID"`
+}
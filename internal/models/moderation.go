@@ -0,0 +1,42 @@
+package models
+
+import (
+	"time"
+
+	"github.com/jinzhu/gorm"
+	"github.com/lib/pq"
+)
+
+// ModerationFlag is the model for a generated recipe that automatic moderation flagged,
+// queued for a moderator to review. The recipe stays hidden until the flag is approved.
+type ModerationFlag struct {
+	gorm.Model
+	RecipeID     uint                 `gorm:"index"`
+	UserID       uint                 `gorm:"index"` // The creator of the recipe
+	Moderator    string               // The moderator that flagged the recipe, e.g. "openai"
+	Categories   pq.StringArray       `gorm:"type:text[]"`
+	Content      string               // The text that was flagged
+	Status       ModerationFlagStatus `gorm:"type:text;default:'pending';index"`
+	ReviewedByID *uint
+	ReviewedAt   *time.Time
+}
+
+// ModerationFlagStatus is the type for the ModerationFlagStatus enum.
+type ModerationFlagStatus string
+
+// ModerationFlagStatus enum values.
+const (
+	ModerationFlagPending  ModerationFlagStatus = "pending"
+	ModerationFlagApproved ModerationFlagStatus = "approved" // The recipe was fine and is visible again
+	ModerationFlagRejected ModerationFlagStatus = "rejected" // The recipe stays hidden
+)
+
+// IsValidModerationFlagStatus checks if the ModerationFlagStatus is valid.
+func IsValidModerationFlagStatus(status ModerationFlagStatus) bool {
+	switch status {
+	case ModerationFlagPending, ModerationFlagApproved, ModerationFlagRejected:
+		return true
+	default:
+		return false
+	}
+}
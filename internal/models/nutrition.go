@@ -0,0 +1,53 @@
+package models
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+// Nutrition is the estimated nutrition of a recipe.
+type Nutrition struct {
+	Total      Nutrients  `json:"total"`
+	PerServing *Nutrients `json:"per_serving"` // Nil when the recipe doesn't say how many servings it makes
+	Servings   int        `json:"servings"`
+	Allergens  []string   `json:"allergens"`
+	// Unmatched are the ingredients that could not be found in the nutrient table or weighed,
+	// and so are missing from the totals.
+	Unmatched []string `json:"unmatched_ingredients"`
+}
+
+// Nutrients are the amounts of the tracked nutrients, in grams except for calories and sodium.
+type Nutrients struct {
+	Calories      float64 `json:"calories"`
+	Protein       float64 `json:"protein_g"`
+	Fat           float64 `json:"fat_g"`
+	Carbohydrates float64 `json:"carbohydrates_g"`
+	Fiber         float64 `json:"fiber_g"`
+	Sodium        float64 `json:"sodium_mg"`
+}
+
+// Scan is a GORM hook that scans jsonb into Nutrition.
+func (j *Nutrition) Scan(value interface{}) error {
+	if value == nil {
+		*j = Nutrition{}
+		return nil
+	}
+
+	bytes, ok := value.([]byte)
+	if !ok {
+		return errors.New(fmt.Sprint("Failed to unmarshal JSONB value:", value))
+	}
+
+	result := Nutrition{}
+	err := json.Unmarshal(bytes, &result)
+	*j = Nutrition(result)
+
+	return err
+}
+
+// Value is a GORM hook that returns json value of Nutrition.
+func (j Nutrition) Value() (driver.Value, error) {
+	return json.Marshal(j)
+}
@@ -15,6 +15,7 @@ type RecipeDef struct {
 	Ingredients       Ingredients    `json:"ingredients" gorm:"type:jsonb;column:ingredients"`
 	Instructions      pq.StringArray `json:"instructions" gorm:"type:text[];column:instructions"`
 	CookTime          int            `json:"cook_time" gorm:"column:cook_time"`
+	Servings          int            `json:"servings" gorm:"column:servings"`
 	ImagePrompt       string         `json:"image_prompt" gorm:"column:image_prompt"`
 	Hashtags          []string       `json:"hashtags"` // Hashtags is shadowed by the Hashtags field in the Recipe model
 	LinkedSuggestions pq.StringArray `json:"linked_recipe_suggestions" gorm:"type:text[];column:linked_recipe_suggestions"`
@@ -42,9 +43,10 @@ func (j RecipeDef) Value() (driver.Value, error) {
 
 // Ingredient is a struct that represents an ingredient in a recipe.
 type Ingredient struct {
-	Name   string  `json:"name"`
-	Unit   string  `json:"unit"`
-	Amount float64 `json:"amount"`
+	Name       string  `json:"name"`
+	Unit       string  `json:"unit"`
+	Amount     float64 `json:"amount"`
+	AmountText string  `json:"amount_text,omitempty"` // Amount formatted for display, only set in responses
 }
 
 // Ingredients is a slice of Ingredient.
@@ -0,0 +1,60 @@
+package models
+
+import (
+	"github.com/jinzhu/gorm"
+)
+
+// PromptTemplate is the model for a version of a system prompt template stored in the database.
+// Every version of a prompt with a weight above zero is an arm of its experiment: users are assigned
+// to one deterministically, in proportion to the weights. Prompts without weighted versions use the
+// templates from the config.
+type PromptTemplate struct {
+	gorm.Model
+	Name     PromptName `gorm:"type:text;unique_index:idx_prompt_template_name_version"`
+	Version  int        `gorm:"unique_index:idx_prompt_template_name_version"`
+	Template string     `gorm:"type:text"`
+	Weight   int        `gorm:"default:0"` // 0 takes the version out of the experiment
+	Note     string     // What changed in this version
+}
+
+// PromptName is the type for the PromptName enum, the system prompts that can be versioned.
+type PromptName string
+
+// PromptName enum values.
+const (
+	PromptGenNewRecipeSys PromptName = "gen_new_recipe_sys"
+	PromptRegenRecipeSys  PromptName = "regen_recipe_sys"
+)
+
+// IsValidPromptName checks if the PromptName is valid.
+func IsValidPromptName(name PromptName) bool {
+	switch name {
+	case PromptGenNewRecipeSys, PromptRegenRecipeSys:
+		return true
+	default:
+		return false
+	}
+}
+
+// PromptRecipeType returns the type of the recipe history entries generated with the prompt.
+func PromptRecipeType(name PromptName) RecipeType {
+	switch name {
+	case PromptRegenRecipeSys:
+		return RecipeTypeRegenChat
+	default:
+		return RecipeTypeChat
+	}
+}
+
+// PromptRun is the model for a recipe generation, successful or not, recorded to compare
+// the outcomes of prompt template versions.
+type PromptRun struct {
+	gorm.Model
+	PromptName       PromptName `gorm:"type:text;index"`
+	PromptTemplateID *uint      `gorm:"index"` // Nil when the template from the config was used
+	UserID           uint       `gorm:"index"`
+	RecipeID         uint
+	Succeeded        bool
+	TotalTokens      int // Across every attempt of the generation
+	Error            string
+}
@@ -1,8 +1,11 @@
 package models
 
 import (
+	"time"
+
 	"github.com/google/uuid"
 	"github.com/jinzhu/gorm"
+	"github.com/lib/pq"
 )
 
 // Recipe is the model for a recipe.
@@ -14,8 +17,11 @@ type Recipe struct {
 	// Ingredients  Ingredients    `gorm:"type:jsonb"` // Embedded slice of Ingredient
 	// Instructions pq.StringArray `gorm:"type:text[]"`
 	// CookTime      int
-	UnitSystem    UnitSystem `gorm:"type:int"`
-	LinkedRecipes []*Recipe  `gorm:"many2many:recipe_linked_recipes;association_jointable_foreignkey:link_recipe_id"`
+	UnitSystem UnitSystem `gorm:"type:int"`
+	Nutrition  *Nutrition `gorm:"type:jsonb"` // Estimated from the ingredients whenever they change
+	// DietaryWarnings are the creator's dietary restrictions the recipe still breaks after generation was retried
+	DietaryWarnings pq.StringArray `gorm:"type:text[]"`
+	LinkedRecipes   []*Recipe      `gorm:"many2many:recipe_linked_recipes;association_jointable_foreignkey:link_recipe_id"`
 	// LinkedSuggestions  pq.StringArray `gorm:"type:text[]"`
 	Hashtags []*Tag `gorm:"many2many:recipe_tags;"`
 	// ImagePrompt        string
@@ -27,8 +33,43 @@ type Recipe struct {
 	HistoryID          uint           `gorm:"unique;index"`
 	History            *RecipeHistory `gorm:"foreignKey:HistoryID"`
 	ForkedFromID       *uint
-	ForkedFrom         *Recipe    `gorm:"foreignKey:ForkedFromID"`
-	CreateType         RecipeType `gorm:"type:text"`
+	ForkedFrom         *Recipe          `gorm:"foreignKey:ForkedFromID"`
+	CreateType         RecipeType       `gorm:"type:text"`
+	Visibility         RecipeVisibility `gorm:"type:text;default:'private'"`
+	ShareSlug          string           `gorm:"unique;default:null"` // Opaque slug used to share unlisted recipes
+	HiddenAt           *time.Time       // Set when a moderator hides the recipe from everyone but its creator
+	HiddenByID         *uint
+	HiddenReason       string
+}
+
+// RecipeVisibility is the type for the RecipeVisibility enum.
+type RecipeVisibility string
+
+// RecipeVisibility enum values.
+const (
+	RecipeVisibilityPrivate  RecipeVisibility = "private"  // Only the creator can see the recipe
+	RecipeVisibilityUnlisted RecipeVisibility = "unlisted" // Anyone with the share slug can see the recipe
+	RecipeVisibilityPublic   RecipeVisibility = "public"   // Anyone can see the recipe
+)
+
+// IsValidVisibility checks if the Visibility is valid.
+func (r *Recipe) IsValidVisibility() bool {
+	switch r.Visibility {
+	case RecipeVisibilityPrivate, RecipeVisibilityUnlisted, RecipeVisibilityPublic:
+		return true
+	default:
+		return false
+	}
+}
+
+// BeforeCreate is a GORM hook that runs before creating a new Recipe.
+func (r *Recipe) BeforeCreate(tx *gorm.DB) (err error) {
+	if !r.IsValidVisibility() {
+		// Set default
+		r.Visibility = RecipeVisibilityPrivate
+	}
+
+	return nil
 }
 
 // RecipeHistory is the model for a recipe history and the current entry that is being used to represent the recipe.
@@ -41,11 +82,17 @@ type RecipeHistory struct {
 // RecipeHistoryEntry is the model for a recipe history entry.
 type RecipeHistoryEntry struct {
 	gorm.Model
-	RecipeHistoryID uint // Foreign key (belongs to RecipeHistory)
+	RecipeHistoryID uint  // Foreign key (belongs to RecipeHistory)
+	ParentEntryID   *uint // The entry this entry was generated from, nil for the first entry
 	UserPrompt      string
 	Type            RecipeType `gorm:"type:text"`
 	RecipeResponse  *RecipeDef `gorm:"type:jsonb"` // Embedded struct
 	Version         int        // To track the order of the entries
+	// UnitSystem is the unit system the entry was generated in, nil for entries from before it was recorded
+	UnitSystem *UnitSystem `gorm:"type:int"`
+	// PromptTemplateID is the version of the system prompt the entry was generated with,
+	// nil for entries generated with the template from the config or entered by the user
+	PromptTemplateID *uint `gorm:"index"`
 }
 
 // Tag is the model for a recipe hashtag.
@@ -54,6 +101,23 @@ type Tag struct {
 	Hashtag string `gorm:"index:idx_hashtag;unique"`
 }
 
+// TagAlias is the model for an alias that resolves to a canonical Tag, e.g. "burgers" to "burger".
+type TagAlias struct {
+	gorm.Model
+	Alias string `gorm:"unique;index"`
+	TagID uint   `gorm:"index"`
+	Tag   *Tag   `gorm:"foreignKey:TagID"`
+}
+
+// RecipeEmbedding is the model for the embedding vector of a recipe, used for semantic search.
+type RecipeEmbedding struct {
+	gorm.Model
+	RecipeID uint            `gorm:"unique;index"`
+	Provider string          `gorm:"index"` // Vectors are only comparable within the same provider
+	Vector   pq.Float64Array `gorm:"type:float8[]"`
+	Stale    bool            `gorm:"default:false;index"` // The recipe changed since the vector was computed
+}
+
 // RecipeType is the type for the RecipeType enum.
 type RecipeType string
 
@@ -6,6 +6,7 @@ import (
 
 	"github.com/google/uuid"
 	"github.com/jinzhu/gorm"
+	"github.com/lib/pq"
 )
 
 // User is the model for a user.
@@ -14,6 +15,8 @@ type User struct {
 	Username         string           `gorm:"unique;index"`
 	FirstName        string           `gorm:"default:null"`
 	Email            string           `gorm:"unique;default:null"`
+	EmailVerified    bool             `gorm:"default:false"`
+	Role             UserRole         `gorm:"type:text;default:'user'"`
 	Auth             *UserAuth        `gorm:"foreignKey:UserID"`
 	Subscription     *Subscription    `gorm:"foreignKey:UserID"`
 	Settings         *UserSettings    `gorm:"foreignKey:UserID"`
@@ -21,6 +24,49 @@ type User struct {
 	CollectedRecipes []*Recipe        `gorm:"many2many:user_collected_recipes;"`
 }
 
+// UserRole is the type for the UserRole enum.
+type UserRole string
+
+// UserRole enum values, each role may do everything the roles before it may.
+const (
+	RoleUser      UserRole = "user"      // Regular user
+	RoleModerator UserRole = "moderator" // Can hide recipes and manage tags
+	RoleAdmin     UserRole = "admin"     // Can also manage users, subscriptions and forbidden usernames
+)
+
+// IsValidUserRole checks if the UserRole is valid.
+func IsValidUserRole(role UserRole) bool {
+	switch role {
+	case RoleUser, RoleModerator, RoleAdmin:
+		return true
+	default:
+		return false
+	}
+}
+
+// HasRole reports whether the user's role is the given role or one above it.
+func (u *User) HasRole(role UserRole) bool {
+	return roleRank(u.Role) >= roleRank(role)
+}
+
+// roleRank orders the roles from least to most privileged.
+func roleRank(role UserRole) int {
+	switch role {
+	case RoleModerator:
+		return 1
+	case RoleAdmin:
+		return 2
+	default:
+		return 0
+	}
+}
+
+// ForbiddenUsername is the model for a username users may not sign up with or change to.
+type ForbiddenUsername struct {
+	gorm.Model
+	Username string `gorm:"unique;index"` // Lowercase
+}
+
 // UserAuth is the model for a user's authentication information.
 type UserAuth struct {
 	gorm.Model
@@ -35,12 +81,14 @@ type UserAuthType string
 // UserAuthType enum values.
 const (
 	Standard UserAuthType = "standard"
+	Google   UserAuthType = "google"
+	Apple    UserAuthType = "apple"
 )
 
 // IsValidAuthType checks if the AuthType is valid.
 func (ua *UserAuth) IsValidAuthType() bool {
 	switch ua.AuthType {
-	case Standard:
+	case Standard, Google, Apple:
 		return true
 	default:
 		return false
@@ -119,16 +167,62 @@ func (s *Subscription) BeforeUpdate(tx *gorm.DB) (err error) {
 // UserSettings is the model for a user's settings.
 type UserSettings struct {
 	gorm.Model
-	UserID          uint `gorm:"unique;index"`
-	KeepScreenAwake bool `gorm:"default:true"`
+	UserID          uint       `gorm:"unique;index"`
+	KeepScreenAwake bool       `gorm:"default:true"`
+	Theme           Theme      `gorm:"type:text;default:'system'"`
+	DefaultServings int        `gorm:"default:0"` // Servings recipes are scaled to when opened, 0 keeps the recipe's own
+	TimerSound      TimerSound `gorm:"type:text;default:'chime'"`
+}
+
+// Theme is the type for the Theme enum.
+type Theme string
+
+// Theme enum values.
+const (
+	ThemeSystem Theme = "system"
+	ThemeLight  Theme = "light"
+	ThemeDark   Theme = "dark"
+)
+
+// IsValidTheme checks if the Theme is valid.
+func IsValidTheme(theme Theme) bool {
+	switch theme {
+	case ThemeSystem, ThemeLight, ThemeDark:
+		return true
+	default:
+		return false
+	}
+}
+
+// TimerSound is the type for the TimerSound enum.
+type TimerSound string
+
+// TimerSound enum values.
+const (
+	TimerSoundChime TimerSound = "chime"
+	TimerSoundBell  TimerSound = "bell"
+	TimerSoundBeep  TimerSound = "beep"
+	TimerSoundNone  TimerSound = "none"
+)
+
+// IsValidTimerSound checks if the TimerSound is valid.
+func IsValidTimerSound(timerSound TimerSound) bool {
+	switch timerSound {
+	case TimerSoundChime, TimerSoundBell, TimerSoundBeep, TimerSoundNone:
+		return true
+	default:
+		return false
+	}
 }
 
 // Personalization is the model for a user's personalization settings.
 type Personalization struct {
 	gorm.Model
-	UserID       uint       `gorm:"unique;index"`
-	UnitSystem   UnitSystem `gorm:"type:int"`
-	Requirements string     // Additional instructions or guidelines
+	UserID       uint           `gorm:"unique;index"`
+	UnitSystem   UnitSystem     `gorm:"type:int"`
+	Requirements string         // Additional instructions or guidelines
+	Diets        pq.StringArray `gorm:"type:text[]"` // Diets the user follows, e.g. vegetarian
+	Allergens    pq.StringArray `gorm:"type:text[]"` // Allergens the user avoids, e.g. peanuts
 	UID          uuid.UUID
 }
 
@@ -0,0 +1,61 @@
+package moderation
+
+import (
+	goaway "github.com/TwiN/go-away"
+)
+
+// culinaryFalsePositives are ingredients and cooking words that contain a profanity.
+var culinaryFalsePositives = []string{
+	"analysis",
+	"assam",
+	"assemble",
+	"assorted",
+	"brass",
+	"cassava",
+	"cassis",
+	"cassoulet",
+	"cucumber",
+	"cumin",
+	"molasses",
+	"scunthorpe",
+	"shiitake",
+	"shitake",
+	"spotted dick",
+}
+
+// LocalModerator is an offline, rule-based moderator that flags profanity with the go-away detector.
+// It doesn't understand meaning, so it is a fallback for development and for when the OpenAI
+// moderation API isn't wanted, not a replacement for it.
+type LocalModerator struct {
+	detector *goaway.ProfanityDetector
+}
+
+// NewLocalModerator creates a new LocalModerator.
+func NewLocalModerator() *LocalModerator {
+	falsePositives := append(append([]string{}, goaway.DefaultFalsePositives...), culinaryFalsePositives...)
+
+	// Leetspeak and spaces aren't sanitized, recipes are full of quantities and short words
+	// that would otherwise run together into false positives
+	detector := goaway.NewProfanityDetector().
+		WithSanitizeLeetSpeak(false).
+		WithSanitizeSpecialCharacters(true).
+		WithSanitizeAccents(false).
+		WithSanitizeSpaces(false).
+		WithCustomDictionary(goaway.DefaultProfanities, falsePositives, goaway.DefaultFalseNegatives)
+
+	return &LocalModerator{detector: detector}
+}
+
+// Name returns the name of the moderator.
+func (m *LocalModerator) Name() string {
+	return "local:go-away"
+}
+
+// Moderate classifies the text.
+func (m *LocalModerator) Moderate(text string) (*Result, error) {
+	if m.detector.IsProfane(text) {
+		return &Result{Flagged: true, Categories: []string{"profanity"}}, nil
+	}
+
+	return &Result{}, nil
+}
@@ -0,0 +1,57 @@
+package moderation
+
+import (
+	"strings"
+
+	"github.com/windoze95/saltybytes-api/internal/config"
+	"github.com/windoze95/saltybytes-api/internal/openai"
+)
+
+// Result is the verdict on a piece of text.
+type Result struct {
+	Flagged    bool
+	Categories []string // Why the text was flagged, e.g. "hate" or "profanity"
+}
+
+// Moderator classifies text that is unsafe to generate or publish.
+type Moderator interface {
+	// Name identifies the moderator, recorded with the recipes it flags.
+	Name() string
+	// Moderate classifies the text.
+	Moderate(text string) (*Result, error)
+}
+
+// NewModerator returns the moderator selected by the ModerationProvider environment variable.
+// Defaults to the OpenAI moderator.
+func NewModerator(cfg *config.Config) Moderator {
+	switch cfg.Env.ModerationProvider.Value() {
+	case "local":
+		return NewLocalModerator()
+	default:
+		return &OpenaiModerator{Cfg: cfg}
+	}
+}
+
+// OpenaiModerator classifies text with the OpenAI moderation API.
+type OpenaiModerator struct {
+	Cfg *config.Config
+}
+
+// Name returns the name of the moderator.
+func (m *OpenaiModerator) Name() string {
+	return "openai"
+}
+
+// Moderate classifies the text.
+func (m *OpenaiModerator) Moderate(text string) (*Result, error) {
+	if strings.TrimSpace(text) == "" {
+		return &Result{}, nil
+	}
+
+	flagged, categories, err := openai.CreateModeration(text, m.Cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Result{Flagged: flagged, Categories: categories}, nil
+}
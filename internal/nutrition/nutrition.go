@@ -0,0 +1,233 @@
+package nutrition
+
+import (
+	_ "embed"
+	"encoding/json"
+	"math"
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/windoze95/saltybytes-api/internal/dietary"
+	"github.com/windoze95/saltybytes-api/internal/models"
+	"github.com/windoze95/saltybytes-api/internal/units"
+)
+
+// foodsJSON is the nutrient table, derived from USDA FoodData Central.
+//
+//go:embed data/foods.json
+var foodsJSON []byte
+
+// Food is an entry in the nutrient table. Nutrients are per 100 grams.
+type Food struct {
+	Name          string   `json:"name"`
+	Aliases       []string `json:"aliases"`
+	Calories      float64  `json:"calories"`
+	Protein       float64  `json:"protein"`
+	Fat           float64  `json:"fat"`
+	Carbohydrates float64  `json:"carbohydrates"`
+	Fiber         float64  `json:"fiber"`
+	Sodium        float64  `json:"sodium"`      // Milligrams
+	Density       float64  `json:"density"`     // Grams per milliliter, 0 when the food isn't measured by volume
+	PieceGrams    float64  `json:"piece_grams"` // Grams in one piece, 0 when the food isn't counted
+	Allergens     []string `json:"allergens"`
+}
+
+// pinchGrams are the approximate weights of the units too small to measure.
+var pinchGrams = map[string]float64{
+	"pinch": 0.36,
+	"dash":  0.6,
+	"drop":  0.05,
+}
+
+// foods indexes the nutrient table by name and alias, and foodKeys are its keys, longest first,
+// so "chicken broth" matches before "chicken".
+var foods, foodKeys = func() (map[string]*Food, []string) {
+	var table []*Food
+	if err := json.Unmarshal(foodsJSON, &table); err != nil {
+		panic("nutrition: invalid nutrient table: " + err.Error())
+	}
+
+	byName := make(map[string]*Food)
+	for _, food := range table {
+		byName[food.Name] = food
+		for _, alias := range food.Aliases {
+			byName[alias] = food
+		}
+	}
+
+	keys := make([]string, 0, len(byName))
+	for key := range byName {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if len(keys[i]) != len(keys[j]) {
+			return len(keys[i]) > len(keys[j])
+		}
+		return keys[i] < keys[j]
+	})
+
+	return byName, keys
+}()
+
+// Lookup finds the food an ingredient name refers to, matching whole words,
+// so "2 large eggs, beaten" is an egg. Foods with an allergen the dietary taxonomy lists the
+// ingredient as an exception to are skipped, so "soy milk" is never whole milk.
+func Lookup(ingredient string) (*Food, bool) {
+	words := strings.FieldsFunc(strings.ToLower(ingredient), func(r rune) bool {
+		return !unicode.IsLetter(r) && r != '-'
+	})
+
+	names := []string{strings.Join(words, " ")}
+	singular := make([]string, len(words))
+	for i, word := range words {
+		singular[i] = singularize(word)
+	}
+	names = append(names, strings.Join(singular, " "))
+
+	for _, name := range names {
+		name = " " + name + " "
+		for _, key := range foodKeys {
+			if strings.Contains(name, " "+key+" ") && !isAllergenException(ingredient, foods[key]) {
+				return foods[key], true
+			}
+		}
+	}
+
+	return nil, false
+}
+
+// isAllergenException checks if the ingredient is an exception to one of the food's allergens,
+// like "vegan butter" for butter.
+func isAllergenException(ingredient string, food *Food) bool {
+	for _, allergen := range food.Allergens {
+		if dietary.IsAllergenException(ingredient, allergen) {
+			return true
+		}
+	}
+	return false
+}
+
+// singularize strips the common English plural endings from a word.
+func singularize(word string) string {
+	switch {
+	case strings.HasSuffix(word, "ies") && len(word) > 4:
+		return strings.TrimSuffix(word, "ies") + "y"
+	case strings.HasSuffix(word, "oes"):
+		return strings.TrimSuffix(word, "es")
+	case strings.HasSuffix(word, "s") && !strings.HasSuffix(word, "ss") && len(word) > 3:
+		return strings.TrimSuffix(word, "s")
+	default:
+		return word
+	}
+}
+
+// Grams estimates the weight of an amount of a food, returning false when the unit can't be weighed.
+func (f *Food) Grams(amount float64, unit string) (float64, bool) {
+	if grams, ok := pinchGrams[strings.ToLower(unit)]; ok {
+		return amount * grams, true
+	}
+
+	u, ok := units.Lookup(unit)
+	if !ok {
+		// A bare count, like "3 eggs"
+		if strings.TrimSpace(unit) == "" && f.PieceGrams > 0 {
+			return amount * f.PieceGrams, true
+		}
+		return 0, false
+	}
+
+	switch u.Dimension {
+	case units.Mass:
+		return amount * u.Base, true
+	case units.Volume:
+		if f.Density == 0 {
+			return 0, false
+		}
+		return amount * u.Base * f.Density, true
+	case units.Count:
+		if f.PieceGrams == 0 {
+			return 0, false
+		}
+		return amount * f.PieceGrams, true
+	default:
+		return 0, false
+	}
+}
+
+// Estimate estimates the nutrition of a recipe from its ingredients.
+// Servings of 0 means the recipe doesn't say how many it serves, so only the totals are estimated.
+func Estimate(ingredients models.Ingredients, servings int) *models.Nutrition {
+	estimate := &models.Nutrition{
+		Servings:  servings,
+		Allergens: []string{},
+		Unmatched: []string{},
+	}
+
+	allergens := make(map[string]bool)
+	for _, ingredient := range ingredients {
+		food, ok := Lookup(ingredient.Name)
+		if !ok {
+			estimate.Unmatched = append(estimate.Unmatched, ingredient.Name)
+			continue
+		}
+
+		// Allergens count even when the amount can't be weighed
+		for _, allergen := range food.Allergens {
+			allergens[allergen] = true
+		}
+
+		grams, ok := food.Grams(ingredient.Amount, ingredient.Unit)
+		if !ok {
+			estimate.Unmatched = append(estimate.Unmatched, ingredient.Name)
+			continue
+		}
+
+		factor := grams / 100
+		estimate.Total.Calories += food.Calories * factor
+		estimate.Total.Protein += food.Protein * factor
+		estimate.Total.Fat += food.Fat * factor
+		estimate.Total.Carbohydrates += food.Carbohydrates * factor
+		estimate.Total.Fiber += food.Fiber * factor
+		estimate.Total.Sodium += food.Sodium * factor
+	}
+
+	for allergen := range allergens {
+		estimate.Allergens = append(estimate.Allergens, allergen)
+	}
+	sort.Strings(estimate.Allergens)
+
+	if servings > 0 {
+		perServing := scaleNutrients(estimate.Total, 1/float64(servings))
+		estimate.PerServing = &perServing
+	}
+	estimate.Total = scaleNutrients(estimate.Total, 1)
+
+	return estimate
+}
+
+// Scale returns a copy of an estimate for the recipe scaled to the given number of servings.
+// The per serving nutrients don't change.
+func Scale(estimate *models.Nutrition, servings int) *models.Nutrition {
+	if estimate == nil || estimate.Servings == 0 || servings == estimate.Servings {
+		return estimate
+	}
+
+	scaled := *estimate
+	scaled.Total = scaleNutrients(estimate.Total, float64(servings)/float64(estimate.Servings))
+	scaled.Servings = servings
+
+	return &scaled
+}
+
+// scaleNutrients multiplies nutrients by factor and rounds them to a sensible precision.
+func scaleNutrients(nutrients models.Nutrients, factor float64) models.Nutrients {
+	return models.Nutrients{
+		Calories:      math.Round(nutrients.Calories * factor),
+		Protein:       math.Round(nutrients.Protein*factor*10) / 10,
+		Fat:           math.Round(nutrients.Fat*factor*10) / 10,
+		Carbohydrates: math.Round(nutrients.Carbohydrates*factor*10) / 10,
+		Fiber:         math.Round(nutrients.Fiber*factor*10) / 10,
+		Sodium:        math.Round(nutrients.Sodium * factor),
+	}
+}
@@ -0,0 +1,116 @@
+package nutrition
+
+import (
+	"reflect"
+	"sort"
+	"testing"
+
+	"github.com/windoze95/saltybytes-api/internal/dietary"
+	"github.com/windoze95/saltybytes-api/internal/models"
+)
+
+func TestLookup(t *testing.T) {
+	tests := []struct {
+		ingredient string
+		want       string // Name of the food, empty when nothing should match
+	}{
+		{"2 large eggs, beaten", "egg"},
+		{"chicken broth", "chicken broth"},
+		{"milk", "whole milk"},
+		{"soy milk", "soy milk"},
+		{"unsweetened oat milk", "oat milk"},
+		{"almond milk", "almond milk"},
+		{"coconut milk", "coconut milk"},
+		{"butter", "butter"},
+		{"vegan butter", "vegan butter"},
+		{"heavy cream", "heavy cream"},
+		{"cream of tartar", "cream of tartar"},
+		{"coconut cream", "coconut cream"},
+		{"shredded cheddar", "cheddar cheese"},
+		{"dairy-free cheese", "vegan cheese"},
+		{"spaghetti", "pasta"},
+		{"rice noodles", "rice noodles"},
+		{"all-purpose flour", "all-purpose flour"},
+		{"gluten-free flour", "gluten-free flour"},
+		{"peanuts", "peanuts"},
+		{"peanut oil", "peanut oil"},
+		{"peanut butter", "peanut butter"},
+		// Exceptions without an entry of their own are left unmatched rather than matched to the dairy food
+		{"vegan cheddar", ""},
+		{"non-dairy creamer", ""},
+	}
+
+	for _, tt := range tests {
+		food, ok := Lookup(tt.ingredient)
+		got := ""
+		if ok {
+			got = food.Name
+		}
+		if got != tt.want {
+			t.Errorf("Lookup(%q) = %q, want %q", tt.ingredient, got, tt.want)
+		}
+	}
+}
+
+// TestLookupAllergensMatchDietary checks the nutrition estimate and the dietary restrictions agree
+// on the allergens of ingredients whose names contain another food's name.
+func TestLookupAllergensMatchDietary(t *testing.T) {
+	allergens := []string{
+		dietary.AllergenMilk, dietary.AllergenEggs, dietary.AllergenFish, dietary.AllergenShellfish,
+		dietary.AllergenTreeNuts, dietary.AllergenPeanuts, dietary.AllergenWheat, dietary.AllergenSoy,
+		dietary.AllergenSesame,
+	}
+
+	ingredients := []string{
+		"soy milk", "oat milk", "almond milk", "coconut milk", "vegan butter", "peanut butter",
+		"cream of tartar", "coconut cream", "dairy-free cheese", "rice noodles", "gluten-free flour",
+		"peanut oil", "sesame oil", "butter", "milk", "heavy cream", "cheddar", "all-purpose flour",
+	}
+
+	for _, ingredient := range ingredients {
+		food, ok := Lookup(ingredient)
+		if !ok {
+			t.Errorf("Lookup(%q) found nothing", ingredient)
+			continue
+		}
+		got := append([]string{}, food.Allergens...)
+		sort.Strings(got)
+
+		want := []string{}
+		for _, allergen := range allergens {
+			restrictions := dietary.Restrictions{Allergens: []string{allergen}}
+			if len(restrictions.Check(models.Ingredients{{Name: ingredient}})) > 0 {
+				want = append(want, allergen)
+			}
+		}
+		sort.Strings(want)
+
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("Lookup(%q) is %s with allergens %v, the dietary restrictions find %v", ingredient, food.Name, got, want)
+		}
+	}
+}
+
+func TestEstimate(t *testing.T) {
+	ingredients := models.Ingredients{
+		{Name: "peanut oil", Amount: 100, Unit: "g"},
+		{Name: "soy milk", Amount: 1, Unit: "cup"},
+		{Name: "mystery spice", Amount: 1, Unit: "tsp"},
+	}
+
+	estimate := Estimate(ingredients, 2)
+
+	if want := []string{"peanuts", "soy"}; !reflect.DeepEqual(estimate.Allergens, want) {
+		t.Errorf("allergens = %v, want %v", estimate.Allergens, want)
+	}
+	if want := []string{"mystery spice"}; !reflect.DeepEqual(estimate.Unmatched, want) {
+		t.Errorf("unmatched = %v, want %v", estimate.Unmatched, want)
+	}
+	// 884 kcal of peanut oil and about 132 of soy milk, not 567 of whole peanuts
+	if estimate.Total.Calories < 950 || estimate.Total.Calories > 1080 {
+		t.Errorf("calories = %v, want about 1016", estimate.Total.Calories)
+	}
+	if estimate.PerServing == nil || estimate.PerServing.Calories*2 != estimate.Total.Calories {
+		t.Errorf("per serving = %+v, want half of %v", estimate.PerServing, estimate.Total.Calories)
+	}
+}
@@ -0,0 +1,156 @@
+package oidc
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const (
+	// keySetTTL is how long fetched signing keys are trusted before they are fetched again.
+	keySetTTL = 1 * time.Hour
+	// keySetMinRefresh is how often an unknown key ID may trigger fetching the keys again,
+	// so tokens with made up key IDs can't hammer the issuer.
+	keySetMinRefresh = 1 * time.Minute
+)
+
+// httpClient is used to fetch signing keys.
+var httpClient = &http.Client{Timeout: 10 * time.Second}
+
+// keySet is a cached JSON Web Key Set of an issuer's signing keys.
+type keySet struct {
+	url string
+
+	mu        sync.Mutex
+	keys      map[string]interface{} // *rsa.PublicKey or *ecdsa.PublicKey by key ID
+	fetchedAt time.Time
+}
+
+// jwk is a JSON Web Key, limited to the fields of RSA and EC signing keys.
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+// key returns the public key with the given key ID, fetching the key set when it is stale
+// or doesn't have the key, e.g. because the issuer rotated its keys.
+func (ks *keySet) key(kid string) (interface{}, error) {
+	ks.mu.Lock()
+	defer ks.mu.Unlock()
+
+	if key, ok := ks.keys[kid]; ok && time.Since(ks.fetchedAt) < keySetTTL {
+		return key, nil
+	}
+
+	if ks.keys == nil || time.Since(ks.fetchedAt) >= keySetMinRefresh {
+		keys, err := fetchKeys(ks.url)
+		if err != nil {
+			// Keep using the keys we have if the issuer can't be reached
+			if key, ok := ks.keys[kid]; ok {
+				return key, nil
+			}
+			return nil, err
+		}
+		ks.keys = keys
+		ks.fetchedAt = time.Now()
+	}
+
+	key, ok := ks.keys[kid]
+	if !ok {
+		return nil, fmt.Errorf("unknown signing key %q", kid)
+	}
+
+	return key, nil
+}
+
+// fetchKeys fetches a JSON Web Key Set and parses its signing keys.
+// Keys of unsupported types are skipped.
+func fetchKeys(url string) (map[string]interface{}, error) {
+	resp, err := httpClient.Get(url)
+	if err != nil {
+		return nil, fmt.Errorf("error fetching signing keys: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("error fetching signing keys: unexpected status %d", resp.StatusCode)
+	}
+
+	var set struct {
+		Keys []jwk `json:"keys"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&set); err != nil {
+		return nil, fmt.Errorf("error decoding signing keys: %v", err)
+	}
+
+	keys := make(map[string]interface{}, len(set.Keys))
+	for _, k := range set.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+		key, err := k.publicKey()
+		if err != nil {
+			continue
+		}
+		keys[k.Kid] = key
+	}
+
+	return keys, nil
+}
+
+// publicKey parses the public key of a JSON Web Key.
+func (k jwk) publicKey() (interface{}, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err := decodeBigInt(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := decodeBigInt(k.E)
+		if err != nil {
+			return nil, err
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	case "EC":
+		if k.Crv != "P-256" {
+			return nil, fmt.Errorf("unsupported curve %q", k.Crv)
+		}
+		x, err := decodeBigInt(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := decodeBigInt(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		return &ecdsa.PublicKey{Curve: elliptic.P256(), X: x, Y: y}, nil
+	default:
+		return nil, fmt.Errorf("unsupported key type %q", k.Kty)
+	}
+}
+
+// decodeBigInt decodes a base64url encoded big-endian integer.
+func decodeBigInt(s string) (*big.Int, error) {
+	if s == "" {
+		return nil, errors.New("missing key parameter")
+	}
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, err
+	}
+	return new(big.Int).SetBytes(b), nil
+}
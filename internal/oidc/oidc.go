@@ -0,0 +1,218 @@
+package oidc
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/windoze95/saltybytes-api/internal/config"
+)
+
+// clockSkew is how far the clocks of an issuer and the API may disagree when checking token times.
+const clockSkew = 1 * time.Minute
+
+// ErrInvalidIDToken is returned when an ID token can't be verified.
+var ErrInvalidIDToken = errors.New("invalid ID token")
+
+// Provider is an OpenID Connect identity provider whose ID tokens can be verified.
+type Provider struct {
+	Name string
+	// Issuers are the accepted values of the iss claim.
+	Issuers []string
+	// ClientIDs are the accepted values of the aud claim, one per app signing in with the provider.
+	ClientIDs []string
+	keys      *keySet
+}
+
+// Claims are the claims of a verified ID token.
+type Claims struct {
+	Subject       string
+	Email         string
+	EmailVerified bool
+	Name          string
+}
+
+// NewProvider creates a new Provider that fetches its signing keys from the JWKS URL.
+func NewProvider(name string, issuers []string, jwksURL string, clientIDs []string) *Provider {
+	return &Provider{
+		Name:      name,
+		Issuers:   issuers,
+		ClientIDs: clientIDs,
+		keys:      &keySet{url: jwksURL},
+	}
+}
+
+// ProvidersFromConfig returns the built in providers that have client IDs configured, by name.
+// For Google, the comma separated client IDs are read from OIDCGoogleClientIDs, and OIDCGoogleIssuers
+// and OIDCGoogleJWKSURL override the issuers and key set URL, e.g. to point at a local fake issuer.
+// Returns an error when a provider's overrides are set without client IDs or its key set URL is invalid.
+func ProvidersFromConfig(cfg *config.Config) (map[string]*Provider, error) {
+	defaults := []struct {
+		name      string
+		clientIDs config.EnvVar
+		issuers   config.EnvVar
+		jwksURL   config.EnvVar
+		// Used when the issuers and key set URL aren't overridden
+		defaultIssuers string
+		defaultJWKSURL string
+	}{
+		{
+			name: "google", clientIDs: cfg.Env.OIDCGoogleClientIDs, issuers: cfg.Env.OIDCGoogleIssuers, jwksURL: cfg.Env.OIDCGoogleJWKSURL,
+			defaultIssuers: "https://accounts.google.com,accounts.google.com", defaultJWKSURL: "https://www.googleapis.com/oauth2/v3/certs",
+		},
+		{
+			name: "apple", clientIDs: cfg.Env.OIDCAppleClientIDs, issuers: cfg.Env.OIDCAppleIssuers, jwksURL: cfg.Env.OIDCAppleJWKSURL,
+			defaultIssuers: "https://appleid.apple.com", defaultJWKSURL: "https://appleid.apple.com/auth/keys",
+		},
+	}
+
+	providers := make(map[string]*Provider)
+	for _, d := range defaults {
+		clientIDs := splitList(d.clientIDs.Value())
+		if len(clientIDs) == 0 {
+			if d.issuers.Value() != "" || d.jwksURL.Value() != "" {
+				return nil, fmt.Errorf("the %s issuers or key set URL are set without client IDs", d.name)
+			}
+			continue
+		}
+
+		issuers := d.defaultIssuers
+		if v := d.issuers.Value(); v != "" {
+			issuers = v
+		}
+		jwksURL := d.defaultJWKSURL
+		if v := d.jwksURL.Value(); v != "" {
+			jwksURL = v
+		}
+		if u, err := url.Parse(jwksURL); err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" {
+			return nil, fmt.Errorf("invalid %s key set URL: %s", d.name, jwksURL)
+		}
+
+		providers[d.name] = NewProvider(d.name, splitList(issuers), jwksURL, clientIDs)
+	}
+
+	return providers, nil
+}
+
+// Verify verifies an ID token issued by the provider for one of its client IDs and returns its claims.
+// When nonce is not empty the token must carry the same nonce.
+func (p *Provider) Verify(idToken, nonce string) (*Claims, error) {
+	parser := &jwt.Parser{
+		ValidMethods: []string{"RS256", "ES256"},
+		// Times are checked below, allowing for clock skew
+		SkipClaimsValidation: true,
+	}
+
+	token, err := parser.Parse(idToken, func(token *jwt.Token) (interface{}, error) {
+		kid, _ := token.Header["kid"].(string)
+		return p.keys.key(kid)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidIDToken, err)
+	}
+
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok || !token.Valid {
+		return nil, ErrInvalidIDToken
+	}
+
+	if err := p.validate(claims, nonce); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidIDToken, err)
+	}
+
+	email, _ := claims["email"].(string)
+	name, _ := claims["name"].(string)
+
+	return &Claims{
+		Subject:       claims["sub"].(string),
+		Email:         email,
+		EmailVerified: isTrue(claims["email_verified"]),
+		Name:          name,
+	}, nil
+}
+
+// validate checks the issuer, audience, subject, times and nonce of an ID token's claims.
+func (p *Provider) validate(claims jwt.MapClaims, nonce string) error {
+	iss, _ := claims["iss"].(string)
+	if !contains(p.Issuers, iss) {
+		return fmt.Errorf("unexpected issuer %q", iss)
+	}
+
+	if !p.hasAudience(claims["aud"]) {
+		return errors.New("unexpected audience")
+	}
+
+	if sub, _ := claims["sub"].(string); sub == "" {
+		return errors.New("missing subject")
+	}
+
+	now := time.Now()
+	exp, ok := claims["exp"].(float64)
+	if !ok {
+		return errors.New("missing expiry")
+	}
+	if now.After(time.Unix(int64(exp), 0).Add(clockSkew)) {
+		return errors.New("token is expired")
+	}
+	if iat, ok := claims["iat"].(float64); ok && now.Add(clockSkew).Before(time.Unix(int64(iat), 0)) {
+		return errors.New("token was issued in the future")
+	}
+
+	if nonce != "" {
+		if tokenNonce, _ := claims["nonce"].(string); tokenNonce != nonce {
+			return errors.New("nonce mismatch")
+		}
+	}
+
+	return nil
+}
+
+// hasAudience checks whether the aud claim, a string or a list of strings, has one of the provider's client IDs.
+func (p *Provider) hasAudience(aud interface{}) bool {
+	switch aud := aud.(type) {
+	case string:
+		return contains(p.ClientIDs, aud)
+	case []interface{}:
+		for _, a := range aud {
+			if s, ok := a.(string); ok && contains(p.ClientIDs, s) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// isTrue reads a boolean claim, which some providers, like Apple, send as a string.
+func isTrue(v interface{}) bool {
+	switch v := v.(type) {
+	case bool:
+		return v
+	case string:
+		return v == "true"
+	}
+	return false
+}
+
+// contains checks whether a list of strings has a value.
+func contains(list []string, value string) bool {
+	for _, v := range list {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// splitList splits a comma separated list, dropping empty entries.
+func splitList(s string) []string {
+	var list []string
+	for _, v := range strings.Split(s, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			list = append(list, v)
+		}
+	}
+	return list
+}
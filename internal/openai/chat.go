@@ -6,6 +6,7 @@ import (
 
 	openai "github.com/sashabaranov/go-openai"
 	"github.com/windoze95/saltybytes-api/internal/models"
+	"github.com/windoze95/saltybytes-api/internal/promptguard"
 	"github.com/windoze95/saltybytes-api/internal/util"
 )
 
@@ -17,13 +18,16 @@ func generateRecipeWithChat(r *RecipeManager) error {
 	}
 
 	// Build the chat completion message stream
-	sysPromptTemplate := r.Cfg.OpenaiPrompts.GenNewRecipeSys
+	sysPromptTemplate, promptTemplateID := r.sysPrompt(r.Cfg.OpenaiPrompts.GenNewRecipeSys)
 	// userPromptTemplate := r.Cfg.OpenaiPrompts.GenNewRecipeUser
-	sysPrompt := r.Cfg.OpenaiPrompts.FillSysPrompt(sysPromptTemplate, r.UnitSystem, r.Requirements)
+	sysPrompt, err := r.Cfg.OpenaiPrompts.FillSysPrompt(sysPromptTemplate, r.UnitSystem, r.Requirements, r.DietaryRestrictions)
+	if err != nil {
+		return err
+	}
 	// userPrompt := r.Cfg.OpenaiPrompts.FillUserPrompt(userPromptTemplate, r.UserPrompt)
 	chatCompletionMessages := []openai.ChatCompletionMessage{
 		createSysMsg(sysPrompt),
-		createUserMsg(r.UserPrompt),
+		createUserMsg(promptguard.Wrap(promptguard.UserRequestTag, r.UserPrompt, promptguard.MaxUserPromptLength)),
 	}
 
 	// Create the request
@@ -37,10 +41,14 @@ func generateRecipeWithChat(r *RecipeManager) error {
 	if err != nil {
 		return fmt.Errorf("failed to create chat completion: %v", err)
 	}
+	r.TotalTokens += resp.Usage.TotalTokens
 
 	// Get the recipe def
+	if len(resp.Choices) == 0 || resp.Choices[0].Message.FunctionCall == nil {
+		return errors.New("OpenAI API returned an empty message")
+	}
 	recipeDefJSON := resp.Choices[0].Message.FunctionCall.Arguments
-	if len(resp.Choices) == 0 || recipeDefJSON == "" {
+	if recipeDefJSON == "" {
 		return errors.New("OpenAI API returned an empty message")
 	}
 
@@ -50,14 +58,97 @@ func generateRecipeWithChat(r *RecipeManager) error {
 		return fmt.Errorf("failed to deserialize FunctionCallArgument: %v", err)
 	}
 
+	// Check that the user didn't talk the model out of returning a recipe
+	if err := promptguard.CheckRecipeDef(&functionCallArgument.RecipeDef); err != nil {
+		return err
+	}
+
 	// Set the recipe def
 	r.RecipeDef = &functionCallArgument.RecipeDef
 
 	// Set the next history message
 	r.NextRecipeHistoryEntry = models.RecipeHistoryEntry{
-		UserPrompt:     r.UserPrompt,
-		RecipeResponse: &functionCallArgument.RecipeDef,
-		Type:           models.RecipeTypeChat,
+		UserPrompt:       r.UserPrompt,
+		RecipeResponse:   &functionCallArgument.RecipeDef,
+		Type:             models.RecipeTypeChat,
+		PromptTemplateID: promptTemplateID,
+	}
+
+	return nil
+}
+
+// regenerateRecipeWithChat regenerates a recipe from its history entries.
+func regenerateRecipeWithChat(r *RecipeManager) error {
+	// Regenerated recipe, there must be a history to start from
+	if len(r.RecipeHistoryEntries) == 0 {
+		return errors.New("RecipeHistoryEntries was empty")
+	}
+
+	// Replay the history entries the new entry is based on
+	historyMessages, err := processExistingRecipeHistoryEntries(r.RecipeHistoryEntries)
+	if err != nil {
+		return err
+	}
+
+	// Build the chat completion message stream
+	sysPromptTemplate, promptTemplateID := r.sysPrompt(r.Cfg.OpenaiPrompts.RegenRecipeSys)
+	userPromptTemplate := r.Cfg.OpenaiPrompts.RegenRecipeUser
+	sysPrompt, err := r.Cfg.OpenaiPrompts.FillSysPrompt(sysPromptTemplate, r.UnitSystem, r.Requirements, r.DietaryRestrictions)
+	if err != nil {
+		return err
+	}
+	userPrompt, err := r.Cfg.OpenaiPrompts.FillUserPrompt(userPromptTemplate, r.UserPrompt)
+	if err != nil {
+		return err
+	}
+	chatCompletionMessages := []openai.ChatCompletionMessage{createSysMsg(sysPrompt)}
+	chatCompletionMessages = append(chatCompletionMessages, historyMessages...)
+	chatCompletionMessages = append(chatCompletionMessages, createUserMsg(userPrompt))
+
+	// Create the request
+	recipeDefRequest, err := createRecipeDefRequest(chatCompletionMessages, true)
+	if err != nil {
+		return err
+	}
+
+	// Perform the chat completion
+	resp, err := createChatCompletionWithRetry(recipeDefRequest, r.Cfg)
+	if err != nil {
+		return fmt.Errorf("failed to create chat completion: %v", err)
+	}
+	r.TotalTokens += resp.Usage.TotalTokens
+
+	// Get the recipe def
+	if len(resp.Choices) == 0 || resp.Choices[0].Message.FunctionCall == nil {
+		return errors.New("OpenAI API returned an empty message")
+	}
+	recipeDefJSON := resp.Choices[0].Message.FunctionCall.Arguments
+	if recipeDefJSON == "" {
+		return errors.New("OpenAI API returned an empty message")
+	}
+
+	// Deserialize the recipe def
+	var functionCallArgument FunctionCallArgument
+	if err = util.DeserializeFromJSONString(recipeDefJSON, &functionCallArgument); err != nil {
+		return fmt.Errorf("failed to deserialize FunctionCallArgument: %v", err)
+	}
+
+	// Check that the user didn't talk the model out of returning a recipe
+	if err := promptguard.CheckRecipeDef(&functionCallArgument.RecipeDef); err != nil {
+		return err
+	}
+
+	// Set the recipe def
+	r.RecipeDef = &functionCallArgument.RecipeDef
+
+	// Set the next history message, branching from the last replayed entry
+	parentEntryID := r.RecipeHistoryEntries[len(r.RecipeHistoryEntries)-1].ID
+	r.NextRecipeHistoryEntry = models.RecipeHistoryEntry{
+		UserPrompt:       r.UserPrompt,
+		RecipeResponse:   &functionCallArgument.RecipeDef,
+		Type:             models.RecipeTypeRegenChat,
+		ParentEntryID:    &parentEntryID,
+		PromptTemplateID: promptTemplateID,
 	}
 
 	return nil
@@ -0,0 +1,57 @@
+package openai
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	openai "github.com/sashabaranov/go-openai"
+	"github.com/windoze95/saltybytes-api/internal/config"
+)
+
+// CreateEmbedding creates an embedding vector for the provided text.
+func CreateEmbedding(text string, cfg *config.Config) ([]float32, error) {
+	maxRetries := 3
+	var resp openai.EmbeddingResponse
+	var embeddingRespErr error
+
+	for i := 0; i < maxRetries; i++ {
+		c, err := newOpenaiClient(cfg)
+		if err != nil {
+			log.Printf("error: failed to create embedding service: %v", err)
+			return nil, err
+		}
+
+		resp, embeddingRespErr = c.Client.CreateEmbeddings(
+			context.Background(),
+			openai.EmbeddingRequestStrings{
+				Input: []string{text},
+				Model: openai.AdaEmbeddingV2,
+			},
+		)
+
+		if embeddingRespErr == nil {
+			break
+		}
+
+		shouldRetry, waitTime, noRetryErr := handleAPIError(embeddingRespErr)
+		if !shouldRetry {
+			return nil, noRetryErr
+		}
+
+		// Wait before next retry
+		time.Sleep(waitTime * time.Duration(i))
+	}
+
+	if embeddingRespErr != nil {
+		return nil, fmt.Errorf("exhausted maximum retries. Exiting. CreateEmbeddings error: %v", embeddingRespErr)
+	}
+
+	if len(resp.Data) == 0 || len(resp.Data[0].Embedding) == 0 {
+		return nil, errors.New("openAI API returned an empty embedding")
+	}
+
+	return resp.Data[0].Embedding, nil
+}
@@ -7,6 +7,7 @@ import (
 	openai "github.com/sashabaranov/go-openai"
 	"github.com/windoze95/saltybytes-api/internal/config"
 	"github.com/windoze95/saltybytes-api/internal/models"
+	"github.com/windoze95/saltybytes-api/internal/promptguard"
 	"github.com/windoze95/saltybytes-api/internal/util"
 )
 
@@ -19,8 +20,14 @@ func generateRecipeWithImportVision(r *RecipeManager) error {
 
 	sysPromptTemplate := r.Cfg.OpenaiPrompts.GenNewVisionImportArgsSys
 	userPromptTemplate := r.Cfg.OpenaiPrompts.GenNewVisionImportArgsUser
-	sysPrompt := r.Cfg.OpenaiPrompts.FillSysPrompt(sysPromptTemplate, r.UnitSystem, r.Requirements)
-	userPrompt := r.Cfg.OpenaiPrompts.FillUserPrompt(userPromptTemplate, r.UserPrompt)
+	sysPrompt, err := r.Cfg.OpenaiPrompts.FillSysPrompt(sysPromptTemplate, r.UnitSystem, r.Requirements, r.DietaryRestrictions)
+	if err != nil {
+		return err
+	}
+	userPrompt, err := r.Cfg.OpenaiPrompts.FillUserPrompt(userPromptTemplate, r.UserPrompt)
+	if err != nil {
+		return err
+	}
 	chatCompletionMessages := []openai.ChatCompletionMessage{
 		createSysMsg(sysPrompt),
 		createUserMultiMsgVision(userPrompt, r.VisionImageURL),
@@ -60,6 +67,11 @@ func generateRecipeWithImportVision(r *RecipeManager) error {
 		return fmt.Errorf("failed to deserialize FunctionCallArgument: %v", err)
 	}
 
+	// Check that the user didn't talk the model out of returning a recipe
+	if err := promptguard.CheckRecipeDef(&functionCallArgument.RecipeDef); err != nil {
+		return err
+	}
+
 	// Set the recipe def
 	r.RecipeDef = &functionCallArgument.RecipeDef
 
@@ -5,6 +5,7 @@ import (
 
 	openai "github.com/sashabaranov/go-openai"
 	"github.com/windoze95/saltybytes-api/internal/models"
+	"github.com/windoze95/saltybytes-api/internal/promptguard"
 	"github.com/windoze95/saltybytes-api/internal/util"
 )
 
@@ -30,7 +31,7 @@ func processExistingRecipeHistoryEntries(historyIn []models.RecipeHistoryEntry)
 		default:
 			messagesOut = append(messagesOut, openai.ChatCompletionMessage{
 				Role:    openai.ChatMessageRoleUser,
-				Content: entryIn.UserPrompt,
+				Content: promptguard.Wrap(promptguard.UserRequestTag, entryIn.UserPrompt, promptguard.MaxUserPromptLength),
 			})
 		}
 
@@ -79,7 +80,7 @@ func createUserMsg(userPrompt string) openai.ChatCompletionMessage {
 // createMsg creates a chat completion message with the provided role and prompt.
 func createMsg(role string, prompt string) openai.ChatCompletionMessage {
 	return openai.ChatCompletionMessage{
-		Role:    openai.ChatMessageRoleUser,
+		Role:    role,
 		Content: prompt,
 	}
 }
@@ -0,0 +1,84 @@
+package openai
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sort"
+	"time"
+
+	openai "github.com/sashabaranov/go-openai"
+	"github.com/windoze95/saltybytes-api/internal/config"
+)
+
+// CreateModeration classifies text with the OpenAI moderation API.
+// It returns whether the text was flagged and the categories it was flagged for.
+func CreateModeration(text string, cfg *config.Config) (bool, []string, error) {
+	maxRetries := 3
+	var resp openai.ModerationResponse
+	var moderationRespErr error
+
+	for i := 0; i < maxRetries; i++ {
+		c, err := newOpenaiClient(cfg)
+		if err != nil {
+			log.Printf("error: failed to create moderation service: %v", err)
+			return false, nil, err
+		}
+
+		resp, moderationRespErr = c.Client.Moderations(
+			context.Background(),
+			openai.ModerationRequest{
+				Input: text,
+				Model: openai.ModerationTextLatest,
+			},
+		)
+
+		if moderationRespErr == nil {
+			break
+		}
+
+		shouldRetry, waitTime, noRetryErr := handleAPIError(moderationRespErr)
+		if !shouldRetry {
+			return false, nil, noRetryErr
+		}
+
+		// Wait before next retry
+		time.Sleep(waitTime * time.Duration(i))
+	}
+
+	if moderationRespErr != nil {
+		return false, nil, fmt.Errorf("exhausted maximum retries. Exiting. Moderations error: %v", moderationRespErr)
+	}
+
+	flagged := false
+	var categories []string
+	for _, result := range resp.Results {
+		if !result.Flagged {
+			continue
+		}
+		flagged = true
+		categories = append(categories, flaggedCategories(result.Categories)...)
+	}
+
+	return flagged, categories, nil
+}
+
+// flaggedCategories lists the names of the moderation categories that were flagged.
+func flaggedCategories(c openai.ResultCategories) []string {
+	var categories []string
+	for name, flagged := range map[string]bool{
+		"hate":             c.Hate,
+		"hate/threatening": c.HateThreatening,
+		"self-harm":        c.SelfHarm,
+		"sexual":           c.Sexual,
+		"sexual/minors":    c.SexualMinors,
+		"violence":         c.Violence,
+		"violence/graphic": c.ViolenceGraphic,
+	} {
+		if flagged {
+			categories = append(categories, name)
+		}
+	}
+	sort.Strings(categories)
+	return categories
+}
@@ -21,6 +21,7 @@ type OpenaiClient struct {
 type RecipeManager struct {
 	UserPrompt             string
 	Requirements           string
+	DietaryRestrictions    string
 	UnitSystem             string
 	CreateType             models.RecipeType
 	RecipeHistoryEntries   []models.RecipeHistoryEntry
@@ -29,6 +30,11 @@ type RecipeManager struct {
 	ImageBytes             []byte
 	Cfg                    *config.Config
 	RecipeDef              *models.RecipeDef
+	// SysPromptTemplate is the version of the system prompt selected for the user,
+	// nil to use the template from the config
+	SysPromptTemplate *models.PromptTemplate
+	// TotalTokens is the number of tokens used by the chat completions so far
+	TotalTokens int
 }
 
 // GenerateRecipeWithChat generates a new recipe using chat.
@@ -36,6 +42,12 @@ func (rm *RecipeManager) GenerateRecipeWithChat() error {
 	return generateRecipeWithChat(rm)
 }
 
+// RegenerateRecipeWithChat regenerates a recipe using chat, replaying RecipeManager.RecipeHistoryEntries
+// as the conversation so far. The new history entry's parent is the last of those entries.
+func (rm *RecipeManager) RegenerateRecipeWithChat() error {
+	return regenerateRecipeWithChat(rm)
+}
+
 // GenerateRecipeWithImportVision generates a new recipe using vision import.
 func (rm *RecipeManager) GenerateRecipeWithImportVision() error {
 	return generateRecipeWithImportVision(rm)
@@ -47,6 +59,17 @@ func (rm *RecipeManager) GenerateRecipeImage() error {
 	return generateRecipeImage(rm)
 }
 
+// sysPrompt returns the system prompt template to use and the ID of its version, falling back to
+// the template from the config when no version was selected.
+func (rm *RecipeManager) sysPrompt(fallback config.OpenaiPromptTemplate) (config.OpenaiPromptTemplate, *uint) {
+	if rm.SysPromptTemplate == nil {
+		return fallback, nil
+	}
+
+	promptTemplateID := rm.SysPromptTemplate.ID
+	return config.OpenaiPromptTemplate(rm.SysPromptTemplate.Template), &promptTemplateID
+}
+
 // newOpenaiClient creates a new OpenAI client.
 func newOpenaiClient(cfg *config.Config) (*OpenaiClient, error) {
 	return &OpenaiClient{
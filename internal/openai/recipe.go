@@ -7,6 +7,7 @@ import (
 	openai "github.com/sashabaranov/go-openai"
 	"github.com/sashabaranov/go-openai/jsonschema"
 	"github.com/windoze95/saltybytes-api/internal/models"
+	"github.com/windoze95/saltybytes-api/internal/units"
 )
 
 type FunctionCallArgument struct {
@@ -34,7 +35,7 @@ func createRecipeDefRequest(chatCompletionMessages []openai.ChatCompletionMessag
 				Type: jsonschema.Object,
 				Properties: map[string]jsonschema.Definition{
 					"name":   {Type: jsonschema.String, Description: "Name of the ingredient, do not include unit or amount in this field"},
-					"unit":   {Type: jsonschema.String, Description: "Unit for the ingredient, comply with UnitSystem specified.", Enum: []string{"pieces", "tsp", "tbsp", "fl oz", "cup", "pt", "qt", "gal", "oz", "lb", "mL", "L", "mg", "g", "kg", "pinch", "dash", "drop", "bushel"}},
+					"unit":   {Type: jsonschema.String, Description: "Unit for the ingredient, comply with UnitSystem specified.", Enum: units.Names()},
 					"amount": {Type: jsonschema.Number, Description: "Amount of the ingredient"},
 				},
 			},
@@ -48,6 +49,10 @@ func createRecipeDefRequest(chatCompletionMessages []openai.ChatCompletionMessag
 			Type:        jsonschema.Number,
 			Description: "Total time to prepare the recipe(s) in minutes",
 		},
+		"servings": {
+			Type:        jsonschema.Integer,
+			Description: "Number of servings the recipe makes",
+		},
 		"image_prompt": {
 			Type:        jsonschema.String,
 			Description: "Prompt to generate an image for the recipe, this should be relavent to the recipe and not the user request",
@@ -0,0 +1,180 @@
+// Package prompts renders the OpenAI prompt templates with text/template.
+// Templates are rendered with a Context; adding a variable for prompt authors means adding a field to it.
+// Templates still using the legacy {placeholder} syntax, e.g. {unitSystem}, are converted when parsed.
+package prompts
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"text/template"
+	"text/template/parse"
+)
+
+// Context is the data prompt templates are rendered with, e.g. {{.UnitSystem}}.
+// User-controlled text is already sanitized and wrapped in its delimited block.
+type Context struct {
+	UnitSystem          string `json:"unit_system"`          // "US Customary" or "Metric"
+	Requirements        string `json:"requirements"`         // The user's free-text requirements
+	DietaryRestrictions string `json:"dietary_restrictions"` // The user's diets and allergens
+	UserPrompt          string `json:"user_prompt"`          // What the user asked for
+}
+
+// SampleContext returns a context with typical data, for trying out templates.
+func SampleContext() Context {
+	return Context{
+		UnitSystem:          "US Customary",
+		Requirements:        "I like spicy food and cook for two on weeknights.",
+		DietaryRestrictions: "The recipe must be vegetarian. The recipe must not contain peanuts.",
+		UserPrompt:          "A quick weeknight curry with chickpeas",
+	}
+}
+
+// legacyPlaceholders maps the {placeholder} syntax of older templates to template actions.
+var legacyPlaceholders = strings.NewReplacer(
+	"{unitSystem}", "{{.UnitSystem}}",
+	"{requirements}", "{{.Requirements}}",
+	"{dietaryRestrictions}", "{{.DietaryRestrictions}}",
+	"{userPrompt}", "{{.UserPrompt}}",
+)
+
+// contextFields are the names of the fields templates can reference.
+var contextFields = func() map[string]bool {
+	fields := make(map[string]bool)
+	t := reflect.TypeOf(Context{})
+	for i := 0; i < t.NumField(); i++ {
+		fields[t.Field(i).Name] = true
+	}
+	return fields
+}()
+
+// Template is a parsed prompt template.
+type Template struct {
+	tmpl   *template.Template
+	fields map[string]bool // The Context fields the template references
+}
+
+// Parse parses a prompt template and checks that it only references fields of Context.
+func Parse(name, text string) (*Template, error) {
+	tmpl, err := template.New(name).Parse(legacyPlaceholders.Replace(text))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse prompt template %s: %w", name, err)
+	}
+
+	fields := make(map[string]bool)
+	for _, t := range tmpl.Templates() {
+		if t.Tree == nil {
+			continue
+		}
+		collectFields(t.Tree.Root, true, fields)
+	}
+
+	for field := range fields {
+		if !contextFields[field] {
+			return nil, fmt.Errorf("prompt template %s references unknown field .%s", name, field)
+		}
+	}
+
+	return &Template{tmpl: tmpl, fields: fields}, nil
+}
+
+// Kind is the kind of a prompt template, which decides the field of Context it must reference.
+type Kind string
+
+// Kind enum values.
+const (
+	KindSys  Kind = "sys"  // A system prompt, which must reference .Requirements
+	KindUser Kind = "user" // A user prompt, which must reference .UserPrompt
+)
+
+// requiredFields are the fields each kind of template must reference, so the user's text reaches the model.
+// System prompts that don't reference .DietaryRestrictions get the restrictions with the requirements.
+var requiredFields = map[Kind]string{
+	KindSys:  "Requirements",
+	KindUser: "UserPrompt",
+}
+
+// Validate checks that a prompt template parses, only references fields of Context and references
+// the field its kind requires.
+func Validate(name, text string, kind Kind) error {
+	required, ok := requiredFields[kind]
+	if !ok {
+		return fmt.Errorf("unknown kind of prompt template: %s", kind)
+	}
+
+	tmpl, err := Parse(name, text)
+	if err != nil {
+		return err
+	}
+	if !tmpl.References(required) {
+		return fmt.Errorf("prompt template %s must reference .%s", name, required)
+	}
+	return nil
+}
+
+// References reports whether the template references a field of Context.
+func (t *Template) References(field string) bool {
+	return t.fields[field]
+}
+
+// Render renders the template with the context.
+func (t *Template) Render(ctx Context) (string, error) {
+	var b strings.Builder
+	if err := t.tmpl.Execute(&b, ctx); err != nil {
+		return "", fmt.Errorf("failed to render prompt template %s: %w", t.tmpl.Name(), err)
+	}
+	return b.String(), nil
+}
+
+// collectFields adds the Context fields referenced under a node to fields. Inside {{with}} and {{range}}
+// the dot is no longer the Context, so only fields referenced through $ are collected there.
+func collectFields(node parse.Node, dotIsContext bool, fields map[string]bool) {
+	switch n := node.(type) {
+	case *parse.ListNode:
+		if n == nil {
+			return
+		}
+		for _, child := range n.Nodes {
+			collectFields(child, dotIsContext, fields)
+		}
+	case *parse.ActionNode:
+		collectFields(n.Pipe, dotIsContext, fields)
+	case *parse.IfNode:
+		collectBranchFields(&n.BranchNode, dotIsContext, dotIsContext, fields)
+	case *parse.WithNode:
+		collectBranchFields(&n.BranchNode, dotIsContext, false, fields)
+	case *parse.RangeNode:
+		collectBranchFields(&n.BranchNode, dotIsContext, false, fields)
+	case *parse.TemplateNode:
+		collectFields(n.Pipe, dotIsContext, fields)
+	case *parse.PipeNode:
+		if n == nil {
+			return
+		}
+		for _, cmd := range n.Cmds {
+			collectFields(cmd, dotIsContext, fields)
+		}
+	case *parse.CommandNode:
+		for _, arg := range n.Args {
+			collectFields(arg, dotIsContext, fields)
+		}
+	case *parse.ChainNode:
+		collectFields(n.Node, dotIsContext, fields)
+	case *parse.FieldNode:
+		if dotIsContext {
+			fields[n.Ident[0]] = true
+		}
+	case *parse.VariableNode:
+		if n.Ident[0] == "$" && len(n.Ident) > 1 {
+			fields[n.Ident[1]] = true
+		}
+	}
+}
+
+// collectBranchFields adds the Context fields referenced by an {{if}}, {{with}} or {{range}}.
+// The pipeline and the else branch are evaluated with the outer dot, the body with bodyDotIsContext.
+func collectBranchFields(n *parse.BranchNode, dotIsContext, bodyDotIsContext bool, fields map[string]bool) {
+	collectFields(n.Pipe, dotIsContext, fields)
+	collectFields(n.List, bodyDotIsContext, fields)
+	collectFields(n.ElseList, dotIsContext, fields)
+}
@@ -0,0 +1,33 @@
+package prompts
+
+import "testing"
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		text    string
+		kind    Kind
+		wantErr bool
+	}{
+		{"Write recipes in {{.UnitSystem}} units.\n{{.Requirements}}", KindSys, false},
+		{"Write recipes in {unitSystem} units.\n{requirements}", KindSys, false},
+		{"{{if .DietaryRestrictions}}{{.DietaryRestrictions}}{{end}}\n{{.Requirements}}", KindSys, false},
+		{"Write recipes in {{.UnitSystem}} units.", KindSys, true},
+		{"Make changes: {{.UserPrompt}}", KindUser, false},
+		{"Make changes: {userPrompt}", KindUser, false},
+		{"Make changes to the recipe.", KindUser, true},
+		{"{{.Requirements}}", KindUser, true},
+		{"{{.Pantry}} {{.Requirements}}", KindSys, true},
+		{"{{.Requirements", KindSys, true},
+		{"{{.UserPrompt}}", Kind("other"), true},
+	}
+
+	for _, tt := range tests {
+		err := Validate("test", tt.text, tt.kind)
+		if tt.wantErr && err == nil {
+			t.Errorf("Validate(%q, %s) = nil, want an error", tt.text, tt.kind)
+		}
+		if !tt.wantErr && err != nil {
+			t.Errorf("Validate(%q, %s) = %v, want nil", tt.text, tt.kind, err)
+		}
+	}
+}
@@ -0,0 +1,266 @@
+package repository
+
+import (
+	"log"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jinzhu/gorm"
+	"github.com/windoze95/saltybytes-api/internal/models"
+)
+
+// AccountRepository is a repository for exporting and deleting all of a user's data.
+type AccountRepository struct {
+	DB *gorm.DB
+}
+
+// NewAccountRepository creates a new AccountRepository.
+func NewAccountRepository(db *gorm.DB) *AccountRepository {
+	return &AccountRepository{DB: db}
+}
+
+// GetExportRecipes retrieves every recipe a user created, including those in the trash,
+// with their hashtags and full history.
+func (r *AccountRepository) GetExportRecipes(userID uint) ([]models.Recipe, error) {
+	var recipes []models.Recipe
+	err := r.DB.Unscoped().
+		Preload("Hashtags").
+		Preload("History", func(db *gorm.DB) *gorm.DB {
+			return db.Unscoped()
+		}).
+		Preload("History.Entries", func(db *gorm.DB) *gorm.DB {
+			return db.Unscoped().Order("version")
+		}).
+		Where("created_by_id = ?", userID).
+		Order("created_at").
+		Find(&recipes).Error
+	if err != nil {
+		log.Printf("Error retrieving recipes for export: %v", err)
+		return nil, err
+	}
+
+	return recipes, nil
+}
+
+// GetExportCollections retrieves a user's collections in order, with the IDs of the recipes in each.
+func (r *AccountRepository) GetExportCollections(userID uint) ([]models.Collection, error) {
+	var collections []models.Collection
+	err := r.DB.Preload("Recipes", func(db *gorm.DB) *gorm.DB {
+		return db.Order("position")
+	}).
+		Where("user_id = ?", userID).
+		Order("position").
+		Find(&collections).Error
+	if err != nil {
+		log.Printf("Error retrieving collections for export: %v", err)
+		return nil, err
+	}
+
+	return collections, nil
+}
+
+// GetSavedRecipeIDs retrieves the IDs of the recipes a user saved.
+func (r *AccountRepository) GetSavedRecipeIDs(userID uint) ([]uint, error) {
+	var recipeIDs []uint
+	err := r.DB.Table("user_collected_recipes").
+		Where("user_id = ?", userID).
+		Pluck("recipe_id", &recipeIDs).Error
+	if err != nil {
+		log.Printf("Error retrieving saved recipes for export: %v", err)
+		return nil, err
+	}
+
+	return recipeIDs, nil
+}
+
+// CreateAccountDeletionJob creates a new account deletion job.
+func (r *AccountRepository) CreateAccountDeletionJob(job *models.AccountDeletionJob) error {
+	if err := r.DB.Create(job).Error; err != nil {
+		log.Printf("Error creating account deletion job: %v", err)
+		return err
+	}
+
+	return nil
+}
+
+// GetAccountDeletionJobByPublicID retrieves an account deletion job by its public ID.
+func (r *AccountRepository) GetAccountDeletionJobByPublicID(publicID string) (*models.AccountDeletionJob, error) {
+	var job models.AccountDeletionJob
+	if err := r.DB.Where("public_id = ?", publicID).First(&job).Error; err != nil {
+		if gorm.IsRecordNotFoundError(err) {
+			return nil, NotFoundError{message: "Account deletion not found"}
+		}
+
+		log.Printf("Error retrieving account deletion job: %v", err)
+		return nil, err
+	}
+
+	return &job, nil
+}
+
+// GetUnfinishedAccountDeletionJobByUserID retrieves the account deletion job of a user that hasn't completed.
+func (r *AccountRepository) GetUnfinishedAccountDeletionJobByUserID(userID uint) (*models.AccountDeletionJob, error) {
+	var job models.AccountDeletionJob
+	err := r.DB.Where("user_id = ? AND status <> ?", userID, models.AccountDeletionCompleted).
+		First(&job).Error
+	if err != nil {
+		if gorm.IsRecordNotFoundError(err) {
+			return nil, NotFoundError{message: "Account deletion not found"}
+		}
+
+		log.Printf("Error retrieving account deletion job: %v", err)
+		return nil, err
+	}
+
+	return &job, nil
+}
+
+// GetUnfinishedAccountDeletionJobs retrieves the account deletion jobs that haven't completed, oldest first.
+func (r *AccountRepository) GetUnfinishedAccountDeletionJobs() ([]models.AccountDeletionJob, error) {
+	var jobs []models.AccountDeletionJob
+	err := r.DB.Where("status <> ?", models.AccountDeletionCompleted).
+		Order("created_at").
+		Find(&jobs).Error
+	if err != nil {
+		log.Printf("Error retrieving unfinished account deletion jobs: %v", err)
+		return nil, err
+	}
+
+	return jobs, nil
+}
+
+// UpdateAccountDeletionJobStatus updates the status of an account deletion job and the error of its last run.
+func (r *AccountRepository) UpdateAccountDeletionJobStatus(job *models.AccountDeletionJob, status models.AccountDeletionStatus, errMessage string) error {
+	updates := map[string]interface{}{
+		"status": status,
+		"error":  errMessage,
+	}
+	if status == models.AccountDeletionCompleted {
+		updates["completed_at"] = time.Now()
+	}
+
+	if err := r.DB.Model(job).Updates(updates).Error; err != nil {
+		log.Printf("Error updating account deletion job: %v", err)
+		return err
+	}
+
+	return nil
+}
+
+// GetRecipeIDsForAccountDeletion retrieves the IDs of a user's recipes that have to be purged to delete their account.
+// Anonymized accounts keep their public and unlisted recipes, the rest are purged.
+func (r *AccountRepository) GetRecipeIDsForAccountDeletion(userID uint, action models.RecipeDeletionAction) ([]uint, error) {
+	query := r.DB.Unscoped().Model(&models.Recipe{}).Where("created_by_id = ?", userID)
+	if action == models.RecipeDeletionAnonymize {
+		query = query.Where("visibility = ? OR deleted_at IS NOT NULL", models.RecipeVisibilityPrivate)
+	}
+
+	var recipeIDs []uint
+	if err := query.Pluck("id", &recipeIDs).Error; err != nil {
+		log.Printf("Error retrieving recipes for account deletion: %v", err)
+		return nil, err
+	}
+
+	return recipeIDs, nil
+}
+
+// AnonymizeUserRecipes detaches a user's remaining recipes, and the moderation flags of those recipes,
+// from them and clears the prompts they wrote in the recipes' histories. The flags stay queued for review,
+// since the recipes stay visible once approved.
+func (r *AccountRepository) AnonymizeUserRecipes(userID uint) error {
+	tx := r.DB.Begin()
+
+	err := tx.Exec(`UPDATE moderation_flags SET user_id = 0
+		WHERE user_id = ? AND recipe_id IN (SELECT id FROM recipes WHERE created_by_id = ?)`, userID, userID).Error
+	if err != nil {
+		tx.Rollback()
+		log.Printf("Error anonymizing moderation flags: %v", err)
+		return err
+	}
+
+	err = tx.Exec(`UPDATE recipe_history_entries SET user_prompt = ''
+		WHERE recipe_history_id IN (SELECT history_id FROM recipes WHERE created_by_id = ?)`, userID).Error
+	if err != nil {
+		tx.Rollback()
+		log.Printf("Error clearing recipe history prompts: %v", err)
+		return err
+	}
+
+	err = tx.Unscoped().Model(&models.Recipe{}).
+		Where("created_by_id = ?", userID).
+		Updates(map[string]interface{}{"created_by_id": 0, "personalization_uid": uuid.Nil}).Error
+	if err != nil {
+		tx.Rollback()
+		log.Printf("Error anonymizing recipes: %v", err)
+		return err
+	}
+
+	return tx.Commit().Error
+}
+
+// DeleteUserData permanently deletes a user along with their auth records, sessions, settings,
+// personalization, subscription, moderation flags, generation records, saved recipes, collections and login history.
+// Their recipes have to be purged or anonymized first, anonymizing keeps the moderation flags of the kept recipes.
+func (r *AccountRepository) DeleteUserData(userID uint) error {
+	tx := r.DB.Begin()
+	if tx.Error != nil {
+		return tx.Error
+	}
+
+	var user models.User
+	if err := tx.Unscoped().Where("id = ?", userID).First(&user).Error; err != nil {
+		tx.Rollback()
+		if gorm.IsRecordNotFoundError(err) {
+			// Already deleted by an earlier run
+			return nil
+		}
+		log.Printf("Error retrieving user to delete: %v", err)
+		return err
+	}
+
+	statements := []struct {
+		query string
+		args  []interface{}
+	}{
+		{"DELETE FROM collection_recipes WHERE collection_id IN (SELECT id FROM collections WHERE user_id = ?)", []interface{}{userID}},
+		{"DELETE FROM collections WHERE user_id = ?", []interface{}{userID}},
+		{"DELETE FROM user_collected_recipes WHERE user_id = ?", []interface{}{userID}},
+		{"DELETE FROM login_attempts WHERE user_id = ? OR username = LOWER(?)", []interface{}{userID, user.Username}},
+	}
+	for _, statement := range statements {
+		if err := tx.Exec(statement.query, statement.args...).Error; err != nil {
+			tx.Rollback()
+			log.Printf("Error deleting data of user %d: %v", userID, err)
+			return err
+		}
+	}
+
+	userOwned := []interface{}{
+		&models.RefreshToken{},
+		&models.UserToken{},
+		&models.UserIdentity{},
+		&models.UserMFA{},
+		&models.MFARecoveryCode{},
+		&models.UserSettings{},
+		&models.Personalization{},
+		&models.Subscription{},
+		&models.UserAuth{},
+		&models.ModerationFlag{},
+		&models.PromptRun{},
+	}
+	for _, model := range userOwned {
+		if err := tx.Unscoped().Where("user_id = ?", userID).Delete(model).Error; err != nil {
+			tx.Rollback()
+			log.Printf("Error deleting data of user %d: %v", userID, err)
+			return err
+		}
+	}
+
+	if err := tx.Unscoped().Delete(&user).Error; err != nil {
+		tx.Rollback()
+		log.Printf("Error deleting user %d: %v", userID, err)
+		return err
+	}
+
+	return tx.Commit().Error
+}
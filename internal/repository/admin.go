@@ -0,0 +1,294 @@
+package repository
+
+import (
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jinzhu/gorm"
+	"github.com/lib/pq"
+	"github.com/windoze95/saltybytes-api/internal/models"
+)
+
+// AdminRepository is a repository for the moderation and support operations of the admin API.
+type AdminRepository struct {
+	DB *gorm.DB
+}
+
+// NewAdminRepository creates a new AdminRepository.
+func NewAdminRepository(db *gorm.DB) *AdminRepository {
+	return &AdminRepository{DB: db}
+}
+
+// SearchUsers retrieves a page of users whose ID matches the query, or whose username or email contains it,
+// along with the total number of matching users. An empty query matches every user.
+func (r *AdminRepository) SearchUsers(query string, offset, limit int) ([]models.User, int, error) {
+	var users []models.User
+	var total int
+
+	db := r.DB.Model(&models.User{})
+	if query = strings.TrimSpace(query); query != "" {
+		pattern := "%" + escapeLike(query) + "%"
+		if id, err := strconv.ParseUint(query, 10, 32); err == nil {
+			db = db.Where("id = ? OR username ILIKE ? OR email ILIKE ?", id, pattern, pattern)
+		} else {
+			db = db.Where("username ILIKE ? OR email ILIKE ?", pattern, pattern)
+		}
+	}
+
+	if err := db.Count(&total).Error; err != nil {
+		log.Printf("Error counting users: %v", err)
+		return nil, 0, err
+	}
+
+	err := db.Preload("Auth").
+		Preload("Subscription").
+		Order("id").
+		Offset(offset).
+		Limit(limit).
+		Find(&users).Error
+	if err != nil {
+		log.Printf("Error searching users: %v", err)
+		return nil, 0, err
+	}
+
+	return users, total, nil
+}
+
+// GetUser retrieves a user with their auth information and subscription.
+func (r *AdminRepository) GetUser(userID uint) (*models.User, error) {
+	var user models.User
+	err := r.DB.Preload("Auth").
+		Preload("Subscription").
+		Where("id = ?", userID).
+		First(&user).Error
+	if err != nil {
+		if gorm.IsRecordNotFoundError(err) {
+			return nil, NotFoundError{message: "User not found"}
+		}
+
+		log.Printf("Error retrieving user: %v", err)
+		return nil, err
+	}
+
+	return &user, nil
+}
+
+// UpdateUserRole updates the role of a user.
+func (r *AdminRepository) UpdateUserRole(userID uint, role models.UserRole) error {
+	result := r.DB.Model(&models.User{}).
+		Where("id = ?", userID).
+		Update("role", role)
+	if result.Error != nil {
+		log.Printf("Error updating user role: %v", result.Error)
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return NotFoundError{message: "User not found"}
+	}
+
+	return nil
+}
+
+// UpdateSubscription updates the given fields of a subscription.
+func (r *AdminRepository) UpdateSubscription(subscription *models.Subscription, updates map[string]interface{}) error {
+	if err := r.DB.Model(subscription).Updates(updates).Error; err != nil {
+		log.Printf("Error updating subscription: %v", err)
+		return err
+	}
+
+	return nil
+}
+
+// HideRecipe hides a recipe from everyone but its creator, recording who hid it and why.
+func (r *AdminRepository) HideRecipe(recipeID, moderatorID uint, reason string) error {
+	result := r.DB.Model(&models.Recipe{}).
+		Where("id = ?", recipeID).
+		Updates(map[string]interface{}{
+			"hidden_at":     time.Now(),
+			"hidden_by_id":  moderatorID,
+			"hidden_reason": reason,
+		})
+	if result.Error != nil {
+		log.Printf("Error hiding recipe: %v", result.Error)
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return NotFoundError{message: "Recipe not found"}
+	}
+
+	return nil
+}
+
+// RestoreHiddenRecipe makes a hidden recipe visible again according to its visibility.
+func (r *AdminRepository) RestoreHiddenRecipe(recipeID uint) error {
+	result := r.DB.Model(&models.Recipe{}).
+		Where("id = ? AND hidden_at IS NOT NULL", recipeID).
+		Updates(map[string]interface{}{
+			"hidden_at":     nil,
+			"hidden_by_id":  nil,
+			"hidden_reason": "",
+		})
+	if result.Error != nil {
+		log.Printf("Error restoring hidden recipe: %v", result.Error)
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return NotFoundError{message: "Hidden recipe not found"}
+	}
+
+	return nil
+}
+
+// GetHiddenRecipes retrieves a page of hidden recipes, most recently hidden first,
+// along with the total number of hidden recipes.
+func (r *AdminRepository) GetHiddenRecipes(offset, limit int) ([]models.Recipe, int, error) {
+	var recipes []models.Recipe
+	var total int
+
+	query := r.DB.Model(&models.Recipe{}).Where("hidden_at IS NOT NULL")
+
+	if err := query.Count(&total).Error; err != nil {
+		log.Printf("Error counting hidden recipes: %v", err)
+		return nil, 0, err
+	}
+
+	err := query.Preload("Hashtags").
+		Preload("CreatedBy").
+		Order("hidden_at DESC").
+		Offset(offset).
+		Limit(limit).
+		Find(&recipes).Error
+	if err != nil {
+		log.Printf("Error retrieving hidden recipes: %v", err)
+		return nil, 0, err
+	}
+
+	return recipes, total, nil
+}
+
+// GetForbiddenUsernames retrieves every forbidden username in alphabetical order.
+func (r *AdminRepository) GetForbiddenUsernames() ([]models.ForbiddenUsername, error) {
+	var forbiddenUsernames []models.ForbiddenUsername
+	if err := r.DB.Order("username").Find(&forbiddenUsernames).Error; err != nil {
+		log.Printf("Error retrieving forbidden usernames: %v", err)
+		return nil, err
+	}
+
+	return forbiddenUsernames, nil
+}
+
+// CreateForbiddenUsername adds a username to the forbidden username list.
+func (r *AdminRepository) CreateForbiddenUsername(forbiddenUsername *models.ForbiddenUsername) error {
+	if err := r.DB.Create(forbiddenUsername).Error; err != nil {
+		if pgErr, ok := err.(*pq.Error); ok && pgErr.Code == "23505" {
+			return ConflictError{message: "username is already forbidden"}
+		}
+		log.Printf("Error creating forbidden username: %v", err)
+		return err
+	}
+
+	return nil
+}
+
+// DeleteForbiddenUsername permanently removes a username from the forbidden username list.
+func (r *AdminRepository) DeleteForbiddenUsername(forbiddenUsernameID uint) error {
+	result := r.DB.Unscoped().Delete(&models.ForbiddenUsername{}, forbiddenUsernameID)
+	if result.Error != nil {
+		log.Printf("Error deleting forbidden username: %v", result.Error)
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return NotFoundError{message: "Forbidden username not found"}
+	}
+
+	return nil
+}
+
+// GetModerationFlags retrieves a page of moderation flags with a status, oldest first,
+// along with the total number of flags with that status.
+func (r *AdminRepository) GetModerationFlags(status models.ModerationFlagStatus, offset, limit int) ([]models.ModerationFlag, int, error) {
+	var flags []models.ModerationFlag
+	var total int
+
+	query := r.DB.Model(&models.ModerationFlag{}).Where("status = ?", status)
+
+	if err := query.Count(&total).Error; err != nil {
+		log.Printf("Error counting moderation flags: %v", err)
+		return nil, 0, err
+	}
+
+	err := query.Order("created_at").
+		Offset(offset).
+		Limit(limit).
+		Find(&flags).Error
+	if err != nil {
+		log.Printf("Error retrieving moderation flags: %v", err)
+		return nil, 0, err
+	}
+
+	return flags, total, nil
+}
+
+// ResolveModerationFlag records a moderator's review of a pending moderation flag.
+// Approving the flag makes its recipe visible again, unless the recipe has other pending flags;
+// rejecting it keeps the recipe hidden under the moderator's name.
+func (r *AdminRepository) ResolveModerationFlag(flagID, moderatorID uint, status models.ModerationFlagStatus) (*models.ModerationFlag, error) {
+	tx := r.DB.Begin()
+	if tx.Error != nil {
+		return nil, tx.Error
+	}
+
+	var flag models.ModerationFlag
+	if err := tx.Where("id = ?", flagID).First(&flag).Error; err != nil {
+		tx.Rollback()
+		if gorm.IsRecordNotFoundError(err) {
+			return nil, NotFoundError{message: "Moderation flag not found"}
+		}
+		log.Printf("Error retrieving moderation flag: %v", err)
+		return nil, err
+	}
+
+	now := time.Now()
+	result := tx.Model(&flag).
+		Where("status = ?", models.ModerationFlagPending).
+		Updates(map[string]interface{}{
+			"status":         status,
+			"reviewed_by_id": moderatorID,
+			"reviewed_at":    now,
+		})
+	if result.Error != nil {
+		tx.Rollback()
+		log.Printf("Error resolving moderation flag: %v", result.Error)
+		return nil, result.Error
+	}
+	if result.RowsAffected == 0 {
+		tx.Rollback()
+		return nil, ConflictError{message: "moderation flag was already reviewed"}
+	}
+
+	var err error
+	if status == models.ModerationFlagApproved {
+		// Only recipes hidden by automatic moderation are restored, not those a moderator hid
+		err = tx.Exec(`UPDATE recipes SET hidden_at = NULL, hidden_reason = ''
+			WHERE id = ? AND hidden_by_id IS NULL
+			AND NOT EXISTS (SELECT 1 FROM moderation_flags WHERE recipe_id = ? AND status = ? AND deleted_at IS NULL)`,
+			flag.RecipeID, flag.RecipeID, models.ModerationFlagPending).Error
+	} else {
+		err = tx.Model(&models.Recipe{}).
+			Where("id = ? AND hidden_at IS NOT NULL AND hidden_by_id IS NULL", flag.RecipeID).
+			Update("hidden_by_id", moderatorID).Error
+	}
+	if err != nil {
+		tx.Rollback()
+		log.Printf("Error updating flagged recipe: %v", err)
+		return nil, err
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		return nil, err
+	}
+
+	return &flag, nil
+}
@@ -0,0 +1,249 @@
+package repository
+
+import (
+	"log"
+	"time"
+
+	"github.com/jinzhu/gorm"
+	"github.com/windoze95/saltybytes-api/internal/models"
+)
+
+// AuthRepository is a repository for interacting with refresh tokens and login attempts.
+type AuthRepository struct {
+	DB *gorm.DB
+}
+
+// NewAuthRepository creates a new AuthRepository.
+func NewAuthRepository(db *gorm.DB) *AuthRepository {
+	return &AuthRepository{DB: db}
+}
+
+// CreateRefreshToken creates a new refresh token.
+func (r *AuthRepository) CreateRefreshToken(token *models.RefreshToken) error {
+	if err := r.DB.Create(token).Error; err != nil {
+		log.Printf("Error creating refresh token: %v", err)
+		return err
+	}
+
+	return nil
+}
+
+// GetRefreshTokenByHash retrieves a refresh token by the hash of the token.
+func (r *AuthRepository) GetRefreshTokenByHash(tokenHash string) (*models.RefreshToken, error) {
+	var token models.RefreshToken
+	if err := r.DB.Where("token_hash = ?", tokenHash).First(&token).Error; err != nil {
+		if gorm.IsRecordNotFoundError(err) {
+			return nil, NotFoundError{message: "Refresh token not found"}
+		}
+
+		log.Printf("Error retrieving refresh token: %v", err)
+		return nil, err
+	}
+
+	return &token, nil
+}
+
+// RotateRefreshToken replaces a refresh token with a new token in the same family.
+// It returns false without creating the new token when the old token was already rotated or revoked,
+// so two requests racing to rotate the same token cannot both succeed.
+func (r *AuthRepository) RotateRefreshToken(oldToken, newToken *models.RefreshToken) (bool, error) {
+	tx := r.DB.Begin()
+
+	if err := tx.Create(newToken).Error; err != nil {
+		tx.Rollback()
+		log.Printf("Error creating rotated refresh token: %v", err)
+		return false, err
+	}
+
+	result := tx.Model(&models.RefreshToken{}).
+		Where("id = ? AND replaced_by_id IS NULL AND revoked_at IS NULL", oldToken.ID).
+		Updates(map[string]interface{}{"replaced_by_id": newToken.ID, "revoked_at": time.Now()})
+	if result.Error != nil {
+		tx.Rollback()
+		log.Printf("Error rotating refresh token: %v", result.Error)
+		return false, result.Error
+	}
+	if result.RowsAffected == 0 {
+		tx.Rollback()
+		return false, nil
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		log.Printf("Error committing refresh token rotation: %v", err)
+		return false, err
+	}
+
+	return true, nil
+}
+
+// RevokeRefreshTokenFamily revokes every token in a refresh token family.
+func (r *AuthRepository) RevokeRefreshTokenFamily(familyID string) error {
+	err := r.DB.Model(&models.RefreshToken{}).
+		Where("family_id = ? AND revoked_at IS NULL", familyID).
+		Update("revoked_at", time.Now()).Error
+	if err != nil {
+		log.Printf("Error revoking refresh token family: %v", err)
+		return err
+	}
+
+	return nil
+}
+
+// RevokeUserRefreshTokens revokes every refresh token issued to a user, except those of the session
+// keepFamilyID, if not empty.
+func (r *AuthRepository) RevokeUserRefreshTokens(userID uint, keepFamilyID string) error {
+	query := r.DB.Model(&models.RefreshToken{}).
+		Where("user_id = ? AND revoked_at IS NULL", userID)
+	if keepFamilyID != "" {
+		query = query.Where("family_id <> ?", keepFamilyID)
+	}
+
+	err := query.Update("revoked_at", time.Now()).Error
+	if err != nil {
+		log.Printf("Error revoking user refresh tokens: %v", err)
+		return err
+	}
+
+	return nil
+}
+
+// IsRefreshTokenFamilyActive reports whether a refresh token family still has a token
+// that has been neither revoked nor rotated and has not expired.
+func (r *AuthRepository) IsRefreshTokenFamilyActive(familyID string) (bool, error) {
+	var count int
+	err := r.DB.Model(&models.RefreshToken{}).
+		Where("family_id = ? AND revoked_at IS NULL AND expires_at > ?", familyID, time.Now()).
+		Count(&count).Error
+	if err != nil {
+		log.Printf("Error checking refresh token family: %v", err)
+		return false, err
+	}
+
+	return count > 0, nil
+}
+
+// DeleteExpiredRefreshTokens permanently deletes the refresh tokens that expired before the given time.
+// It returns the number of tokens deleted.
+func (r *AuthRepository) DeleteExpiredRefreshTokens(expiredBefore time.Time) (int64, error) {
+	result := r.DB.Unscoped().Where("expires_at < ?", expiredBefore).Delete(&models.RefreshToken{})
+	if result.Error != nil {
+		log.Printf("Error deleting expired refresh tokens: %v", result.Error)
+		return 0, result.Error
+	}
+
+	return result.RowsAffected, nil
+}
+
+// Advisory lock classes serializing the login attempts for a username and for an IP address.
+const (
+	loginUsernameLockClass = 1
+	loginIPLockClass       = 2
+)
+
+// LoginFailures are the recent failed attempts to log in as a username and from an IP address.
+type LoginFailures struct {
+	Username       int
+	LatestUsername *time.Time
+	IP             int
+	LatestIP       *time.Time
+}
+
+// ReserveLoginAttempt counts the failed attempts to log in as the username and from the IP address of the attempt
+// since the given time, then creates the attempt as failed. Attempts for the same username or IP address are
+// serialized, so each one counts the attempts reserved before it, even those still checking their password.
+func (r *AuthRepository) ReserveLoginAttempt(attempt *models.LoginAttempt, since time.Time) (*LoginFailures, error) {
+	tx := r.DB.Begin()
+
+	// The username lock is always taken before the IP address lock, so attempts can't deadlock
+	err := tx.Exec("SELECT pg_advisory_xact_lock(?, hashtext(?)), pg_advisory_xact_lock(?, hashtext(?))",
+		loginUsernameLockClass, attempt.Username, loginIPLockClass, attempt.IP).Error
+	if err != nil {
+		tx.Rollback()
+		log.Printf("Error locking login attempts: %v", err)
+		return nil, err
+	}
+
+	var failures LoginFailures
+	failures.Username, failures.LatestUsername, err = getUsernameLoginFailures(tx, attempt.Username, since)
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	failures.IP, failures.LatestIP, err = getIPLoginFailures(tx, attempt.IP, since)
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	attempt.Result = models.LoginFailed
+	if err := tx.Create(attempt).Error; err != nil {
+		tx.Rollback()
+		log.Printf("Error creating login attempt: %v", err)
+		return nil, err
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		log.Printf("Error committing login attempt: %v", err)
+		return nil, err
+	}
+
+	return &failures, nil
+}
+
+// UpdateLoginAttempt records the user and the result of a reserved login attempt.
+func (r *AuthRepository) UpdateLoginAttempt(attempt *models.LoginAttempt) error {
+	err := r.DB.Model(&models.LoginAttempt{}).
+		Where("id = ?", attempt.ID).
+		Updates(map[string]interface{}{"user_id": attempt.UserID, "result": attempt.Result}).Error
+	if err != nil {
+		log.Printf("Error updating login attempt: %v", err)
+		return err
+	}
+
+	return nil
+}
+
+// getUsernameLoginFailures counts the failed attempts to log in as a username since the given time
+// and since the last successful attempt, and returns the time of the latest failure.
+func getUsernameLoginFailures(db *gorm.DB, username string, since time.Time) (int, *time.Time, error) {
+	return getLoginFailures(db, `username = ? AND created_at > ? AND created_at > COALESCE(
+		(SELECT MAX(created_at) FROM login_attempts WHERE username = ? AND result = ?), '-infinity')`,
+		username, since, username, models.LoginSucceeded)
+}
+
+// getIPLoginFailures counts the failed attempts to log in from an IP address since the given time,
+// and returns the time of the latest failure. Successful attempts don't reset the count,
+// so an attacker can't clear it by logging in to their own account.
+func getIPLoginFailures(db *gorm.DB, ip string, since time.Time) (int, *time.Time, error) {
+	return getLoginFailures(db, "ip = ? AND created_at > ?", ip, since)
+}
+
+// getLoginFailures counts the failed login attempts matching the query and returns the time of the latest one.
+func getLoginFailures(db *gorm.DB, query string, args ...interface{}) (int, *time.Time, error) {
+	var count int
+	var latest *time.Time
+
+	row := db.Model(&models.LoginAttempt{}).
+		Select("COUNT(*), MAX(created_at)").
+		Where("result = ?", models.LoginFailed).
+		Where(query, args...).
+		Row()
+	if err := row.Scan(&count, &latest); err != nil {
+		log.Printf("Error counting login failures: %v", err)
+		return 0, nil, err
+	}
+
+	return count, latest, nil
+}
+
+// DeleteLoginAttemptsBefore permanently deletes the login attempts made before the given time.
+// It returns the number of attempts deleted.
+func (r *AuthRepository) DeleteLoginAttemptsBefore(before time.Time) (int64, error) {
+	result := r.DB.Where("created_at < ?", before).Delete(&models.LoginAttempt{})
+	if result.Error != nil {
+		log.Printf("Error deleting login attempts: %v", result.Error)
+		return 0, result.Error
+	}
+
+	return result.RowsAffected, nil
+}
@@ -0,0 +1,56 @@
+package repository
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/windoze95/saltybytes-api/internal/models"
+)
+
+// TestReserveLoginAttemptConcurrent reserves a burst of attempts to log in as the same username at once.
+// Each attempt must count every attempt reserved before it, so no two see the same number of failures.
+func TestReserveLoginAttemptConcurrent(t *testing.T) {
+	database := openTestDB(t)
+	if err := database.AutoMigrate(&models.LoginAttempt{}).Error; err != nil {
+		t.Fatalf("failed to migrate the test database: %v", err)
+	}
+
+	username := fmt.Sprintf("burst%d", time.Now().UnixNano())
+	t.Cleanup(func() { database.Exec("DELETE FROM login_attempts WHERE username = ?", username) })
+
+	repo := NewAuthRepository(database)
+	since := time.Now().Add(-time.Hour)
+
+	const attempts = 20
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	var counts []int
+	for i := 0; i < attempts; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+
+			attempt := &models.LoginAttempt{Username: username, IP: fmt.Sprintf("%s-%d", username, i)}
+			failures, err := repo.ReserveLoginAttempt(attempt, since)
+			if err != nil {
+				t.Errorf("attempt %d: %v", i, err)
+				return
+			}
+
+			mu.Lock()
+			counts = append(counts, failures.Username)
+			mu.Unlock()
+		}(i)
+	}
+	wg.Wait()
+
+	sort.Ints(counts)
+	for i, count := range counts {
+		if count != i {
+			t.Fatalf("attempts saw %v failures, want each of 0 to %d once", counts, attempts-1)
+		}
+	}
+}
@@ -0,0 +1,366 @@
+package repository
+
+import (
+	"log"
+
+	"github.com/jinzhu/gorm"
+	"github.com/windoze95/saltybytes-api/internal/models"
+)
+
+// CollectionRepository is a repository for interacting with saved recipes and collections.
+type CollectionRepository struct {
+	DB *gorm.DB
+}
+
+// NewCollectionRepository creates a new CollectionRepository.
+func NewCollectionRepository(db *gorm.DB) *CollectionRepository {
+	return &CollectionRepository{DB: db}
+}
+
+// SaveRecipe adds a recipe to a user's collected recipes, by its ID or, for an unlisted recipe, by its share slug.
+func (r *CollectionRepository) SaveRecipe(userID, recipeID uint, shareSlug string) error {
+	recipeID, savedShareSlug, err := r.collectableRecipe(r.DB, userID, recipeID, shareSlug)
+	if err != nil {
+		return err
+	}
+
+	err = r.DB.Exec(saveRecipeQuery, userID, recipeID, savedShareSlug).Error
+	if err != nil {
+		log.Printf("Error saving recipe: %v", err)
+	}
+	return err
+}
+
+// saveRecipeQuery adds a recipe to a user's collected recipes, keeping the share slug it was saved through, if any.
+const saveRecipeQuery = `INSERT INTO user_collected_recipes (user_id, recipe_id, share_slug) VALUES (?, ?, NULLIF(?, ''))
+	ON CONFLICT (user_id, recipe_id) DO UPDATE
+	SET share_slug = COALESCE(EXCLUDED.share_slug, user_collected_recipes.share_slug)`
+
+// UnsaveRecipe removes a recipe from a user's collected recipes and from all of the user's collections.
+func (r *CollectionRepository) UnsaveRecipe(userID, recipeID uint) error {
+	tx := r.DB.Begin()
+	if tx.Error != nil {
+		return tx.Error
+	}
+
+	err := tx.Exec("DELETE FROM user_collected_recipes WHERE user_id = ? AND recipe_id = ?", userID, recipeID).Error
+	if err != nil {
+		tx.Rollback()
+		log.Printf("Error unsaving recipe: %v", err)
+		return err
+	}
+
+	err = tx.Exec(`DELETE FROM collection_recipes WHERE recipe_id = ?
+		AND collection_id IN (SELECT id FROM collections WHERE user_id = ?)`, recipeID, userID).Error
+	if err != nil {
+		tx.Rollback()
+		log.Printf("Error removing recipe from collections: %v", err)
+		return err
+	}
+
+	return tx.Commit().Error
+}
+
+// CreateCollection creates a new collection, positioned after the user's existing collections.
+func (r *CollectionRepository) CreateCollection(collection *models.Collection) error {
+	var maxPosition struct{ Position int }
+	err := r.DB.Model(&models.Collection{}).
+		Select("COALESCE(MAX(position), 0) AS position").
+		Where("user_id = ?", collection.UserID).
+		Scan(&maxPosition).Error
+	if err != nil {
+		return err
+	}
+	collection.Position = maxPosition.Position + 1
+
+	if err := r.DB.Create(collection).Error; err != nil {
+		log.Printf("Error creating collection: %v", err)
+		return err
+	}
+	return nil
+}
+
+// GetCollectionsByUserID retrieves a user's collections in order, with the number of recipes in each.
+func (r *CollectionRepository) GetCollectionsByUserID(userID uint) ([]models.Collection, map[uint]int, error) {
+	var collections []models.Collection
+	err := r.DB.Where("user_id = ?", userID).
+		Order("position ASC, id ASC").
+		Find(&collections).Error
+	if err != nil {
+		log.Printf("Error retrieving collections: %v", err)
+		return nil, nil, err
+	}
+
+	var counts []struct {
+		CollectionID uint
+		RecipeCount  int
+	}
+	err = r.DB.Table("collection_recipes").
+		Select("collection_recipes.collection_id, COUNT(*) AS recipe_count").
+		Joins("JOIN recipes ON recipes.id = collection_recipes.recipe_id AND recipes.deleted_at IS NULL").
+		Joins("JOIN collections ON collections.id = collection_recipes.collection_id").
+		Where("collections.user_id = ?", userID).
+		Group("collection_recipes.collection_id").
+		Scan(&counts).Error
+	if err != nil {
+		log.Printf("Error counting collection recipes: %v", err)
+		return nil, nil, err
+	}
+
+	recipeCounts := make(map[uint]int, len(counts))
+	for _, count := range counts {
+		recipeCounts[count.CollectionID] = count.RecipeCount
+	}
+
+	return collections, recipeCounts, nil
+}
+
+// GetCollectionByID retrieves a user's collection with its recipes in order.
+func (r *CollectionRepository) GetCollectionByID(collectionID, userID uint) (*models.Collection, error) {
+	return r.getCollection(r.DB.Where("id = ? AND user_id = ?", collectionID, userID))
+}
+
+// GetSharedCollectionBySlug retrieves a shared collection with its recipes in order.
+func (r *CollectionRepository) GetSharedCollectionBySlug(shareSlug string) (*models.Collection, error) {
+	return r.getCollection(r.DB.Where("share_slug = ? AND is_shared = ?", shareSlug, true))
+}
+
+// getCollection retrieves the first collection matching the query, with its recipes in order.
+func (r *CollectionRepository) getCollection(query *gorm.DB) (*models.Collection, error) {
+	var collection models.Collection
+
+	err := query.Preload("Recipes", func(db *gorm.DB) *gorm.DB {
+		return db.Order("position ASC, created_at ASC")
+	}).
+		Preload("Recipes.Recipe").
+		Preload("Recipes.Recipe.Hashtags").
+		Preload("Recipes.Recipe.CreatedBy", func(db *gorm.DB) *gorm.DB {
+			return db.Select("id, username")
+		}).
+		First(&collection).Error
+	if err != nil {
+		if gorm.IsRecordNotFoundError(err) {
+			return nil, NotFoundError{message: "Collection not found"}
+		}
+		log.Printf("Error retrieving collection: %v", err)
+		return nil, err
+	}
+
+	return &collection, nil
+}
+
+// UpdateCollection updates fields of a user's collection.
+func (r *CollectionRepository) UpdateCollection(collectionID, userID uint, updates map[string]interface{}) error {
+	result := r.DB.Model(&models.Collection{}).
+		Where("id = ? AND user_id = ?", collectionID, userID).
+		Updates(updates)
+	if result.Error != nil {
+		log.Printf("Error updating collection: %v", result.Error)
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return NotFoundError{message: "Collection not found"}
+	}
+	return nil
+}
+
+// DeleteCollection deletes a user's collection, the recipes themselves stay saved.
+func (r *CollectionRepository) DeleteCollection(collectionID, userID uint) error {
+	tx := r.DB.Begin()
+	if tx.Error != nil {
+		return tx.Error
+	}
+
+	result := tx.Where("id = ? AND user_id = ?", collectionID, userID).
+		Delete(&models.Collection{})
+	if result.Error != nil {
+		tx.Rollback()
+		log.Printf("Error deleting collection: %v", result.Error)
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		tx.Rollback()
+		return NotFoundError{message: "Collection not found"}
+	}
+
+	if err := tx.Exec("DELETE FROM collection_recipes WHERE collection_id = ?", collectionID).Error; err != nil {
+		tx.Rollback()
+		log.Printf("Error deleting collection recipes: %v", err)
+		return err
+	}
+
+	return tx.Commit().Error
+}
+
+// AddRecipeToCollection adds a recipe to the end of a user's collection and saves it for the user.
+// The recipe is given by its ID or, for an unlisted recipe, by its share slug.
+// Adding a recipe that is already in the collection leaves it in place.
+func (r *CollectionRepository) AddRecipeToCollection(collectionID, userID, recipeID uint, shareSlug string) error {
+	tx := r.DB.Begin()
+	if tx.Error != nil {
+		return tx.Error
+	}
+
+	if err := r.checkCollectionOwner(tx, collectionID, userID); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	recipeID, savedShareSlug, err := r.collectableRecipe(tx, userID, recipeID, shareSlug)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	err = tx.Exec(`INSERT INTO collection_recipes (collection_id, recipe_id, share_slug, position, created_at)
+		SELECT ?, ?, NULLIF(?, ''), COALESCE(MAX(position), 0) + 1, NOW() FROM collection_recipes WHERE collection_id = ?
+		ON CONFLICT (collection_id, recipe_id) DO UPDATE
+		SET share_slug = COALESCE(EXCLUDED.share_slug, collection_recipes.share_slug)`,
+		collectionID, recipeID, savedShareSlug, collectionID).Error
+	if err != nil {
+		tx.Rollback()
+		log.Printf("Error adding recipe to collection: %v", err)
+		return err
+	}
+
+	if err := tx.Exec(saveRecipeQuery, userID, recipeID, savedShareSlug).Error; err != nil {
+		tx.Rollback()
+		log.Printf("Error saving recipe: %v", err)
+		return err
+	}
+
+	return tx.Commit().Error
+}
+
+// RemoveRecipeFromCollection removes a recipe from a user's collection, the recipe stays saved.
+func (r *CollectionRepository) RemoveRecipeFromCollection(collectionID, userID, recipeID uint) error {
+	if err := r.checkCollectionOwner(r.DB, collectionID, userID); err != nil {
+		return err
+	}
+
+	result := r.DB.Exec("DELETE FROM collection_recipes WHERE collection_id = ? AND recipe_id = ?", collectionID, recipeID)
+	if result.Error != nil {
+		log.Printf("Error removing recipe from collection: %v", result.Error)
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return NotFoundError{message: "Recipe not in collection"}
+	}
+	return nil
+}
+
+// ReorderCollectionRecipes sets the order of the recipes in a user's collection.
+// Recipes that are not listed keep their position after the listed ones.
+func (r *CollectionRepository) ReorderCollectionRecipes(collectionID, userID uint, recipeIDs []uint) error {
+	tx := r.DB.Begin()
+	if tx.Error != nil {
+		return tx.Error
+	}
+
+	if err := r.checkCollectionOwner(tx, collectionID, userID); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	// Move every recipe after the listed ones, then number the listed ones
+	err := tx.Exec("UPDATE collection_recipes SET position = position + ? WHERE collection_id = ?", len(recipeIDs), collectionID).Error
+	if err != nil {
+		tx.Rollback()
+		log.Printf("Error reordering collection recipes: %v", err)
+		return err
+	}
+
+	for i, recipeID := range recipeIDs {
+		err := tx.Exec("UPDATE collection_recipes SET position = ? WHERE collection_id = ? AND recipe_id = ?", i+1, collectionID, recipeID).Error
+		if err != nil {
+			tx.Rollback()
+			log.Printf("Error reordering collection recipes: %v", err)
+			return err
+		}
+	}
+
+	return tx.Commit().Error
+}
+
+// ReorderCollections sets the order of a user's collections.
+func (r *CollectionRepository) ReorderCollections(userID uint, collectionIDs []uint) error {
+	tx := r.DB.Begin()
+	if tx.Error != nil {
+		return tx.Error
+	}
+
+	for i, collectionID := range collectionIDs {
+		err := tx.Model(&models.Collection{}).
+			Where("id = ? AND user_id = ?", collectionID, userID).
+			Update("position", i+1).Error
+		if err != nil {
+			tx.Rollback()
+			log.Printf("Error reordering collections: %v", err)
+			return err
+		}
+	}
+
+	return tx.Commit().Error
+}
+
+// checkCollectionOwner returns a NotFoundError unless the collection exists and belongs to the user.
+func (r *CollectionRepository) checkCollectionOwner(db *gorm.DB, collectionID, userID uint) error {
+	var count int
+	err := db.Model(&models.Collection{}).
+		Where("id = ? AND user_id = ?", collectionID, userID).
+		Count(&count).Error
+	if err != nil {
+		return err
+	}
+	if count == 0 {
+		return NotFoundError{message: "Collection not found"}
+	}
+	return nil
+}
+
+// collectableRecipe looks up the recipe a user may collect and returns its ID along with the share slug
+// to save it with. Public recipes and the user's own may be collected by their ID, an unlisted recipe only
+// through its share slug, or by its ID once the user saved it through the slug. Private and hidden recipes
+// of others return a NotFoundError, the same as recipes that don't exist.
+func (r *CollectionRepository) collectableRecipe(db *gorm.DB, userID, recipeID uint, shareSlug string) (uint, string, error) {
+	notFound := NotFoundError{message: "Recipe not found"}
+
+	query := db.Select("id, created_by_id, visibility, share_slug, hidden_at")
+	if shareSlug != "" {
+		query = query.Where("share_slug = ?", shareSlug)
+	} else {
+		query = query.Where("id = ?", recipeID)
+	}
+
+	var recipe models.Recipe
+	if err := query.First(&recipe).Error; err != nil {
+		if gorm.IsRecordNotFoundError(err) {
+			return 0, "", notFound
+		}
+		return 0, "", err
+	}
+
+	switch {
+	case recipe.CreatedByID == userID:
+		return recipe.ID, recipe.ShareSlug, nil
+	case recipe.Visibility == models.RecipeVisibilityPrivate || recipe.HiddenAt != nil:
+		return 0, "", notFound
+	case shareSlug != "":
+		return recipe.ID, recipe.ShareSlug, nil
+	case recipe.Visibility == models.RecipeVisibilityPublic:
+		return recipe.ID, "", nil
+	}
+
+	// An unlisted recipe by its ID, only once saved through its current share slug
+	var count int
+	err := db.Table("user_collected_recipes").
+		Where("user_id = ? AND recipe_id = ? AND share_slug = ?", userID, recipe.ID, recipe.ShareSlug).
+		Count(&count).Error
+	if err != nil {
+		return 0, "", err
+	}
+	if count == 0 {
+		return 0, "", notFound
+	}
+	return recipe.ID, recipe.ShareSlug, nil
+}
@@ -0,0 +1,72 @@
+package repository
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/windoze95/saltybytes-api/internal/models"
+)
+
+// TestSaveUnlistedRecipe checks an unlisted recipe can only be saved through its share slug, and
+// only shows up in the saved recipes once it was.
+func TestSaveUnlistedRecipe(t *testing.T) {
+	database := openTestDB(t)
+	if err := database.AutoMigrate(&models.User{}).Error; err != nil {
+		t.Fatalf("failed to migrate the test database: %v", err)
+	}
+	if err := database.Exec("ALTER TABLE user_collected_recipes ADD COLUMN IF NOT EXISTS share_slug text").Error; err != nil {
+		t.Fatalf("failed to migrate the test database: %v", err)
+	}
+
+	unique := uint(time.Now().UnixNano()%1000000) + 1000000000
+	creatorID, userID := unique, unique+1
+	recipe := &models.Recipe{
+		CreatedByID: creatorID,
+		HistoryID:   unique,
+		Visibility:  models.RecipeVisibilityUnlisted,
+		ShareSlug:   fmt.Sprintf("slug%d", unique),
+	}
+	if err := database.Create(recipe).Error; err != nil {
+		t.Fatalf("failed to create recipe: %v", err)
+	}
+	t.Cleanup(func() {
+		database.Exec("DELETE FROM user_collected_recipes WHERE recipe_id = ?", recipe.ID)
+		database.Unscoped().Delete(&models.Recipe{}, recipe.ID)
+	})
+
+	collectionRepo := NewCollectionRepository(database)
+	recipeRepo := NewRecipeRepository(database)
+	savedRecipes := func() int {
+		t.Helper()
+		_, total, err := recipeRepo.GetUserRecipes(userID, UserRecipesFilter{Scope: UserRecipesCollected}, 0, 10)
+		if err != nil {
+			t.Fatalf("GetUserRecipes failed: %v", err)
+		}
+		return total
+	}
+
+	if err := collectionRepo.SaveRecipe(userID, recipe.ID, ""); err == nil {
+		t.Fatal("saved the unlisted recipe by its ID")
+	} else if _, ok := err.(NotFoundError); !ok {
+		t.Fatalf("SaveRecipe by ID = %v, want a NotFoundError", err)
+	}
+
+	// A save by ID from before saves required the slug is left out
+	database.Exec("INSERT INTO user_collected_recipes (user_id, recipe_id) VALUES (?, ?)", userID, recipe.ID)
+	if total := savedRecipes(); total != 0 {
+		t.Errorf("got %d saved recipes before saving through the slug, want 0", total)
+	}
+
+	if err := collectionRepo.SaveRecipe(userID, 0, recipe.ShareSlug); err != nil {
+		t.Fatalf("SaveRecipe by share slug failed: %v", err)
+	}
+	if total := savedRecipes(); total != 1 {
+		t.Errorf("got %d saved recipes after saving through the slug, want 1", total)
+	}
+
+	// Once saved through the slug, the recipe may be collected by its ID
+	if err := collectionRepo.SaveRecipe(userID, recipe.ID, ""); err != nil {
+		t.Errorf("SaveRecipe by ID after saving through the slug failed: %v", err)
+	}
+}
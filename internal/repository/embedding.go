@@ -0,0 +1,111 @@
+package repository
+
+import (
+	"log"
+	"strconv"
+	"strings"
+
+	"github.com/jinzhu/gorm"
+	"github.com/windoze95/saltybytes-api/internal/models"
+)
+
+// hasPgvector checks if the pgvector extension is installed in the database.
+func hasPgvector(db *gorm.DB) bool {
+	var count int
+	err := db.Table("pg_extension").
+		Where("extname = ?", "vector").
+		Count(&count).Error
+	if err != nil {
+		log.Printf("Error checking for pgvector extension: %v", err)
+		return false
+	}
+	return count > 0
+}
+
+// GetRecipeEmbedding retrieves the embedding of a recipe.
+func (r *RecipeRepository) GetRecipeEmbedding(recipeID uint) (*models.RecipeEmbedding, error) {
+	var recipeEmbedding models.RecipeEmbedding
+	err := r.DB.Where("recipe_id = ?", recipeID).
+		First(&recipeEmbedding).Error
+	if err != nil {
+		if gorm.IsRecordNotFoundError(err) {
+			return nil, NotFoundError{message: "Recipe embedding not found"}
+		}
+		return nil, err
+	}
+	return &recipeEmbedding, nil
+}
+
+// UpsertRecipeEmbedding creates or replaces the embedding of a recipe.
+func (r *RecipeRepository) UpsertRecipeEmbedding(recipeEmbedding *models.RecipeEmbedding) error {
+	err := r.DB.Where(models.RecipeEmbedding{RecipeID: recipeEmbedding.RecipeID}).
+		Assign(map[string]interface{}{
+			"provider": recipeEmbedding.Provider,
+			"vector":   recipeEmbedding.Vector,
+			"stale":    false,
+		}).
+		FirstOrCreate(recipeEmbedding).Error
+	if err != nil {
+		log.Printf("Error upserting recipe embedding: %v", err)
+	}
+	return err
+}
+
+// GetRecipeEmbeddingsByProvider retrieves the up to date embeddings of all live public recipes computed by a provider.
+func (r *RecipeRepository) GetRecipeEmbeddingsByProvider(provider string) ([]models.RecipeEmbedding, error) {
+	var recipeEmbeddings []models.RecipeEmbedding
+	err := r.DB.Joins("JOIN recipes ON recipes.id = recipe_embeddings.recipe_id AND recipes.deleted_at IS NULL").
+		Where("recipe_embeddings.provider = ? AND NOT recipe_embeddings.stale", provider).
+		Where("recipes.visibility = ? AND recipes.hidden_at IS NULL", models.RecipeVisibilityPublic).
+		Find(&recipeEmbeddings).Error
+	if err != nil {
+		log.Printf("Error retrieving recipe embeddings: %v", err)
+		return nil, err
+	}
+	return recipeEmbeddings, nil
+}
+
+// FindNearestRecipeIDs uses pgvector to find the IDs of the public recipes whose up to date embeddings are closest to a vector,
+// excluding the given recipe. Only usable when VectorSearch is true.
+func (r *RecipeRepository) FindNearestRecipeIDs(vector []float64, provider string, excludeRecipeID uint, limit int) ([]uint, error) {
+	var recipeIDs []uint
+	err := r.DB.Table("recipe_embeddings").
+		Joins("JOIN recipes ON recipes.id = recipe_embeddings.recipe_id AND recipes.deleted_at IS NULL").
+		Where("recipe_embeddings.deleted_at IS NULL AND recipes.visibility = ? AND recipes.hidden_at IS NULL", models.RecipeVisibilityPublic).
+		Where("recipe_embeddings.provider = ? AND NOT recipe_embeddings.stale AND recipe_embeddings.recipe_id <> ?", provider, excludeRecipeID).
+		Order(gorm.Expr("recipe_embeddings.vector::vector <=> ?::vector", vectorLiteral(vector))).
+		Limit(limit).
+		Pluck("recipe_embeddings.recipe_id", &recipeIDs).Error
+	if err != nil {
+		log.Printf("Error searching nearest recipes: %v", err)
+		return nil, err
+	}
+	return recipeIDs, nil
+}
+
+// GetRecipesToEmbed retrieves up to limit live recipes, with their tags, whose embeddings are missing,
+// stale or computed by another provider. Recipes still being generated have no title and are left out.
+func (r *RecipeRepository) GetRecipesToEmbed(provider string, limit int) ([]models.Recipe, error) {
+	var recipes []models.Recipe
+	err := r.DB.Preload("Hashtags").
+		Where("title <> ''").
+		Where(`NOT EXISTS (SELECT 1 FROM recipe_embeddings e
+			WHERE e.recipe_id = recipes.id AND e.deleted_at IS NULL AND e.provider = ? AND NOT e.stale)`, provider).
+		Order("id").
+		Limit(limit).
+		Find(&recipes).Error
+	if err != nil {
+		log.Printf("Error retrieving recipes to embed: %v", err)
+		return nil, err
+	}
+	return recipes, nil
+}
+
+// vectorLiteral formats a vector as a pgvector literal, e.g. "[0.1,0.2]".
+func vectorLiteral(vector []float64) string {
+	parts := make([]string, len(vector))
+	for i, v := range vector {
+		parts[i] = strconv.FormatFloat(v, 'f', -1, 64)
+	}
+	return "[" + strings.Join(parts, ",") + "]"
+}
@@ -9,3 +9,24 @@ type NotFoundError struct {
 func (e NotFoundError) Error() string {
 	return e.message
 }
+
+// NewNotFoundError creates a new NotFoundError.
+func NewNotFoundError(message string) NotFoundError {
+	return NotFoundError{message: message}
+}
+
+// ConflictError is an error type for when a change conflicts with an existing resource,
+// such as a username that is already in use.
+type ConflictError struct {
+	message string
+}
+
+// Error returns the error message.
+func (e ConflictError) Error() string {
+	return e.message
+}
+
+// NewConflictError creates a new ConflictError.
+func NewConflictError(message string) ConflictError {
+	return ConflictError{message: message}
+}
@@ -0,0 +1,167 @@
+package repository
+
+import (
+	"log"
+
+	"github.com/jinzhu/gorm"
+	"github.com/lib/pq"
+	"github.com/windoze95/saltybytes-api/internal/models"
+)
+
+// PromptRepository is a repository for versioned prompt templates and the outcomes of their experiments.
+type PromptRepository struct {
+	DB *gorm.DB
+}
+
+// PromptArmStats are the outcomes of the recipes generated with a prompt template version,
+// or with the template from the config for the baseline arm.
+type PromptArmStats struct {
+	PromptTemplateID uint // 0 for the baseline arm
+	Version          int
+	Weight           int
+	Baseline         bool    // The arm of the template from the config, the control of the experiment
+	Runs             int     // Generations attempted with the version
+	Failures         int     // Generations that failed or timed out
+	AverageTokens    float64 // Average tokens used by a successful generation
+	Recipes          int     // Recipes with an entry generated with the version
+	Edits            int     // Entries the users regenerated or edited from an entry generated with the version
+	Favorites        int     // Times the recipes were saved by a user
+}
+
+// NewPromptRepository creates a new PromptRepository.
+func NewPromptRepository(db *gorm.DB) *PromptRepository {
+	return &PromptRepository{DB: db}
+}
+
+// GetPromptTemplates retrieves every version of the prompt templates, by name and version.
+// An empty name retrieves the versions of every prompt.
+func (r *PromptRepository) GetPromptTemplates(name models.PromptName) ([]models.PromptTemplate, error) {
+	query := r.DB.Order("name").Order("version")
+	if name != "" {
+		query = query.Where("name = ?", name)
+	}
+
+	var promptTemplates []models.PromptTemplate
+	if err := query.Find(&promptTemplates).Error; err != nil {
+		log.Printf("Error retrieving prompt templates: %v", err)
+		return nil, err
+	}
+
+	return promptTemplates, nil
+}
+
+// GetWeightedPromptTemplates retrieves the versions of a prompt that are arms of its experiment, by version.
+func (r *PromptRepository) GetWeightedPromptTemplates(name models.PromptName) ([]models.PromptTemplate, error) {
+	var promptTemplates []models.PromptTemplate
+	err := r.DB.Where("name = ? AND weight > 0", name).
+		Order("version").
+		Find(&promptTemplates).Error
+	if err != nil {
+		log.Printf("Error retrieving weighted prompt templates: %v", err)
+		return nil, err
+	}
+
+	return promptTemplates, nil
+}
+
+// CreatePromptTemplate creates the next version of a prompt template.
+func (r *PromptRepository) CreatePromptTemplate(promptTemplate *models.PromptTemplate) error {
+	var latest struct{ Version int }
+	err := r.DB.Unscoped().Model(&models.PromptTemplate{}).
+		Select("COALESCE(MAX(version), 0) AS version").
+		Where("name = ?", promptTemplate.Name).
+		Scan(&latest).Error
+	if err != nil {
+		log.Printf("Error retrieving latest prompt template version: %v", err)
+		return err
+	}
+	promptTemplate.Version = latest.Version + 1
+
+	if err := r.DB.Create(promptTemplate).Error; err != nil {
+		if pgErr, ok := err.(*pq.Error); ok && pgErr.Code == "23505" {
+			// Another version was created at the same time
+			return ConflictError{message: "prompt template version already exists, try again"}
+		}
+		log.Printf("Error creating prompt template: %v", err)
+		return err
+	}
+
+	return nil
+}
+
+// UpdatePromptTemplateWeight updates the weight of a prompt template version in its experiment.
+func (r *PromptRepository) UpdatePromptTemplateWeight(promptTemplateID uint, weight int) (*models.PromptTemplate, error) {
+	var promptTemplate models.PromptTemplate
+	if err := r.DB.First(&promptTemplate, promptTemplateID).Error; err != nil {
+		if gorm.IsRecordNotFoundError(err) {
+			return nil, NotFoundError{message: "Prompt template not found"}
+		}
+		log.Printf("Error retrieving prompt template: %v", err)
+		return nil, err
+	}
+
+	if err := r.DB.Model(&promptTemplate).Update("weight", weight).Error; err != nil {
+		log.Printf("Error updating prompt template weight: %v", err)
+		return nil, err
+	}
+
+	return &promptTemplate, nil
+}
+
+// CreatePromptRun records the outcome of a recipe generation.
+func (r *PromptRepository) CreatePromptRun(run *models.PromptRun) error {
+	if err := r.DB.Create(run).Error; err != nil {
+		log.Printf("Error creating prompt run: %v", err)
+		return err
+	}
+
+	return nil
+}
+
+// GetPromptArmStats retrieves the outcomes of the template from the config, as the baseline arm,
+// followed by the outcomes of every version of a prompt, by version. The baseline's recipes are those with
+// entries of the prompt's type generated without a version since runs of the prompt were first recorded,
+// so recipes from before the experiment don't count towards it.
+func (r *PromptRepository) GetPromptArmStats(name models.PromptName) ([]PromptArmStats, error) {
+	var stats []PromptArmStats
+	err := r.DB.Raw(`SELECT 0 AS prompt_template_id, 0 AS version, 0 AS weight, TRUE AS baseline, `+
+		promptArmStatsColumns(
+			"pr.prompt_name = b.name AND pr.prompt_template_id IS NULL",
+			`e.prompt_template_id IS NULL AND e.type = b.entry_type AND e.created_at >= (
+				SELECT MIN(fr.created_at) FROM prompt_runs fr WHERE fr.prompt_name = b.name)`)+`
+		FROM (SELECT CAST(? AS text) AS name, CAST(? AS text) AS entry_type) b
+		UNION ALL
+		SELECT t.id AS prompt_template_id, t.version, t.weight, FALSE AS baseline, `+
+		promptArmStatsColumns("pr.prompt_template_id = t.id", "e.prompt_template_id = t.id")+`
+		FROM prompt_templates t
+		WHERE t.name = ? AND t.deleted_at IS NULL
+		ORDER BY baseline DESC, version`, name, models.PromptRecipeType(name), name).
+		Scan(&stats).Error
+	if err != nil {
+		log.Printf("Error retrieving prompt experiment outcomes: %v", err)
+		return nil, err
+	}
+
+	return stats, nil
+}
+
+// promptArmStatsColumns returns the outcome columns of an arm, given the conditions matching
+// its prompt runs (pr) and its recipe history entries (e).
+func promptArmStatsColumns(runCondition, entryCondition string) string {
+	return `(SELECT COUNT(*) FROM prompt_runs pr
+				WHERE ` + runCondition + ` AND pr.deleted_at IS NULL) AS runs,
+			(SELECT COUNT(*) FROM prompt_runs pr
+				WHERE ` + runCondition + ` AND NOT pr.succeeded AND pr.deleted_at IS NULL) AS failures,
+			(SELECT COALESCE(AVG(pr.total_tokens), 0) FROM prompt_runs pr
+				WHERE ` + runCondition + ` AND pr.succeeded AND pr.deleted_at IS NULL) AS average_tokens,
+			(SELECT COUNT(DISTINCT r.id) FROM recipe_history_entries e
+				JOIN recipes r ON r.history_id = e.recipe_history_id
+				WHERE ` + entryCondition + ` AND r.deleted_at IS NULL) AS recipes,
+			(SELECT COUNT(*) FROM recipe_history_entries child
+				JOIN recipe_history_entries e ON child.parent_entry_id = e.id
+				WHERE ` + entryCondition + ` AND child.deleted_at IS NULL) AS edits,
+			(SELECT COUNT(*) FROM user_collected_recipes ucr
+				WHERE ucr.recipe_id IN (SELECT r.id FROM recipe_history_entries e
+					JOIN recipes r ON r.history_id = e.recipe_history_id
+					WHERE ` + entryCondition + ` AND r.deleted_at IS NULL)) AS favorites`
+}
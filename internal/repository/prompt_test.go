@@ -0,0 +1,86 @@
+package repository
+
+import (
+	"testing"
+	"time"
+
+	"github.com/jinzhu/gorm"
+	"github.com/windoze95/saltybytes-api/internal/models"
+)
+
+// TestGetPromptArmStatsBaseline checks the runs with the template from the config are reported
+// as the baseline arm, ahead of the versions.
+func TestGetPromptArmStatsBaseline(t *testing.T) {
+	database := openTestDB(t)
+	err := database.AutoMigrate(&models.User{}, &models.Recipe{}, &models.RecipeHistory{}, &models.RecipeHistoryEntry{},
+		&models.PromptTemplate{}, &models.PromptRun{}).Error
+	if err != nil {
+		t.Fatalf("failed to migrate the test database: %v", err)
+	}
+
+	repo := NewPromptRepository(database)
+	before, err := repo.GetPromptArmStats(models.PromptRegenRecipeSys)
+	if err != nil {
+		t.Fatalf("GetPromptArmStats failed: %v", err)
+	}
+
+	runs := []*models.PromptRun{
+		{PromptName: models.PromptRegenRecipeSys, Succeeded: true, TotalTokens: 100},
+		{PromptName: models.PromptRegenRecipeSys, Succeeded: false},
+		// Runs of another prompt aren't part of the baseline
+		{PromptName: models.PromptGenNewRecipeSys, Succeeded: true},
+	}
+	for _, run := range runs {
+		if err := repo.CreatePromptRun(run); err != nil {
+			t.Fatalf("failed to create prompt run: %v", err)
+		}
+		id := run.ID
+		t.Cleanup(func() { database.Unscoped().Delete(&models.PromptRun{}, id) })
+	}
+
+	// A recipe regenerated long before any run was recorded isn't part of the experiment
+	history := &models.RecipeHistory{}
+	if err := database.Create(history).Error; err != nil {
+		t.Fatalf("failed to create recipe history: %v", err)
+	}
+	oldRecipe := &models.Recipe{HistoryID: history.ID}
+	if err := database.Create(oldRecipe).Error; err != nil {
+		t.Fatalf("failed to create recipe: %v", err)
+	}
+	oldEntry := &models.RecipeHistoryEntry{
+		Model:           gorm.Model{CreatedAt: time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC)},
+		RecipeHistoryID: history.ID,
+		Type:            models.PromptRecipeType(models.PromptRegenRecipeSys),
+	}
+	if err := database.Create(oldEntry).Error; err != nil {
+		t.Fatalf("failed to create recipe history entry: %v", err)
+	}
+	t.Cleanup(func() {
+		database.Unscoped().Delete(oldEntry)
+		database.Unscoped().Delete(oldRecipe)
+		database.Unscoped().Delete(history)
+	})
+
+	after, err := repo.GetPromptArmStats(models.PromptRegenRecipeSys)
+	if err != nil {
+		t.Fatalf("GetPromptArmStats failed: %v", err)
+	}
+	if len(before) == 0 || len(after) != len(before) || !after[0].Baseline {
+		t.Fatalf("got arms %+v, want the baseline arm first", after)
+	}
+	for _, arm := range after[1:] {
+		if arm.Baseline || arm.PromptTemplateID == 0 {
+			t.Errorf("got arm %+v after the baseline, want a version", arm)
+		}
+	}
+
+	if runs := after[0].Runs - before[0].Runs; runs != 2 {
+		t.Errorf("baseline has %d new runs, want 2", runs)
+	}
+	if failures := after[0].Failures - before[0].Failures; failures != 1 {
+		t.Errorf("baseline has %d new failures, want 1", failures)
+	}
+	if recipes := after[0].Recipes - before[0].Recipes; recipes != 0 {
+		t.Errorf("baseline has %d new recipes, want the recipe from before the runs left out", recipes)
+	}
+}
@@ -2,20 +2,27 @@ package repository
 
 import (
 	"errors"
+	"fmt"
 	"log"
+	"sort"
+	"strings"
+	"time"
 
 	"github.com/jinzhu/gorm"
 	"github.com/windoze95/saltybytes-api/internal/models"
+	"github.com/windoze95/saltybytes-api/internal/nutrition"
 )
 
 // RecipeRepository is a repository for interacting with recipes.
 type RecipeRepository struct {
 	DB *gorm.DB
+	// VectorSearch is true when pgvector is available for nearest-neighbour queries.
+	VectorSearch bool
 }
 
 // NewRecipeRepository creates a new RecipeRepository.
 func NewRecipeRepository(db *gorm.DB) *RecipeRepository {
-	return &RecipeRepository{DB: db}
+	return &RecipeRepository{DB: db, VectorSearch: hasPgvector(db)}
 }
 
 // GetRecipeByID retrieves a recipe by its ID.
@@ -41,12 +48,183 @@ func (r *RecipeRepository) GetRecipeByID(recipeID uint) (*models.Recipe, error)
 	return &recipe, nil
 }
 
+// GetRecipeByShareSlug retrieves a recipe by its share slug.
+func (r *RecipeRepository) GetRecipeByShareSlug(shareSlug string) (*models.Recipe, error) {
+	var recipe models.Recipe
+
+	err := r.DB.Preload("Hashtags").
+		Preload("CreatedBy", func(db *gorm.DB) *gorm.DB {
+			return db.Select("id, username")
+		}).
+		Where("share_slug = ?", shareSlug).
+		First(&recipe).Error
+	if err != nil {
+		if gorm.IsRecordNotFoundError(err) {
+			return nil, NotFoundError{message: "Recipe not found"}
+		}
+		log.Printf("Error retrieving recipe by share slug: %v", err)
+		return nil, err
+	}
+
+	return &recipe, nil
+}
+
+// GetRecipeByHistoryID retrieves the recipe a recipe history belongs to.
+func (r *RecipeRepository) GetRecipeByHistoryID(historyID uint) (*models.Recipe, error) {
+	var recipe models.Recipe
+
+	err := r.DB.Where("history_id = ?", historyID).
+		First(&recipe).Error
+	if err != nil {
+		if gorm.IsRecordNotFoundError(err) {
+			return nil, NotFoundError{message: "Recipe history not found"}
+		}
+		log.Printf("Error retrieving recipe by history ID: %v", err)
+		return nil, err
+	}
+
+	return &recipe, nil
+}
+
+// UpdateRecipeVisibility updates the visibility of a recipe, setting its share slug if it has none yet.
+// Returns the share slug of the recipe.
+func (r *RecipeRepository) UpdateRecipeVisibility(recipeID uint, visibility models.RecipeVisibility, shareSlug string) (string, error) {
+	var updated struct{ ShareSlug string }
+	err := r.DB.Raw(`UPDATE recipes SET visibility = ?, share_slug = COALESCE(share_slug, ?), updated_at = ?
+		WHERE id = ? AND deleted_at IS NULL
+		RETURNING share_slug`, visibility, shareSlug, time.Now(), recipeID).
+		Scan(&updated).Error
+	if err != nil {
+		if gorm.IsRecordNotFoundError(err) {
+			return "", NotFoundError{message: "Recipe not found"}
+		}
+		log.Printf("Error updating recipe visibility: %v", err)
+		return "", err
+	}
+	return updated.ShareSlug, nil
+}
+
+// GetRecipesByIDs retrieves recipes by their IDs, in the order of the given IDs.
+// IDs that don't match a recipe are skipped.
+func (r *RecipeRepository) GetRecipesByIDs(recipeIDs []uint) ([]models.Recipe, error) {
+	var recipes []models.Recipe
+
+	err := r.DB.Preload("Hashtags").
+		Preload("CreatedBy", func(db *gorm.DB) *gorm.DB {
+			return db.Select("id, username")
+		}).
+		Where("id IN (?)", recipeIDs).
+		Find(&recipes).Error
+	if err != nil {
+		log.Printf("Error retrieving recipes: %v", err)
+		return nil, err
+	}
+
+	// Restore the requested order
+	byID := make(map[uint]models.Recipe, len(recipes))
+	for _, recipe := range recipes {
+		byID[recipe.ID] = recipe
+	}
+	ordered := make([]models.Recipe, 0, len(recipes))
+	for _, recipeID := range recipeIDs {
+		if recipe, ok := byID[recipeID]; ok {
+			ordered = append(ordered, recipe)
+		}
+	}
+
+	return ordered, nil
+}
+
+// UserRecipesScope selects which of a user's recipes are listed.
+type UserRecipesScope string
+
+// UserRecipesScope enum values.
+const (
+	UserRecipesAll       UserRecipesScope = "all"
+	UserRecipesCreated   UserRecipesScope = "created"
+	UserRecipesCollected UserRecipesScope = "collected"
+)
+
+// UserRecipesFilter filters the recipes listed by GetUserRecipes.
+type UserRecipesFilter struct {
+	Scope        UserRecipesScope
+	Hashtag      string // Only recipes with this tag
+	Query        string // Only recipes with a title containing this text
+	CollectionID uint   // Only recipes in this collection
+}
+
+// GetUserRecipes retrieves a page of the recipes created or collected by a user, newest first,
+// along with the total number of matching recipes.
+func (r *RecipeRepository) GetUserRecipes(userID uint, filter UserRecipesFilter, offset, limit int) ([]models.Recipe, int, error) {
+	var recipes []models.Recipe
+	var total int
+
+	query := r.DB.Model(&models.Recipe{})
+
+	collected := "SELECT recipe_id FROM user_collected_recipes WHERE user_id = ?"
+	switch filter.Scope {
+	case UserRecipesCreated:
+		query = query.Where("recipes.created_by_id = ?", userID)
+	case UserRecipesCollected:
+		query = query.Where("recipes.id IN ("+collected+")", userID)
+	default:
+		query = query.Where("recipes.created_by_id = ? OR recipes.id IN ("+collected+")", userID, userID)
+	}
+
+	// Collected recipes their creator made private, or a moderator hid, are left out, and unlisted ones
+	// unless they were saved through their current share slug
+	query = query.Where(`recipes.created_by_id = ? OR (recipes.hidden_at IS NULL AND (recipes.visibility = ?
+		OR (recipes.visibility = ? AND EXISTS (SELECT 1 FROM user_collected_recipes
+			WHERE user_id = ? AND recipe_id = recipes.id AND share_slug = recipes.share_slug))))`,
+		userID, models.RecipeVisibilityPublic, models.RecipeVisibilityUnlisted, userID)
+
+	if filter.Hashtag != "" {
+		query = query.Where(`recipes.id IN (SELECT recipe_tags.recipe_id FROM recipe_tags
+			JOIN tags ON tags.id = recipe_tags.tag_id WHERE tags.hashtag = ?)`, filter.Hashtag)
+	}
+
+	if filter.Query != "" {
+		query = query.Where("recipes.title ILIKE ?", "%"+escapeLike(filter.Query)+"%")
+	}
+
+	if filter.CollectionID != 0 {
+		query = query.Where(`recipes.id IN (SELECT collection_recipes.recipe_id FROM collection_recipes
+			JOIN collections ON collections.id = collection_recipes.collection_id
+			WHERE collections.id = ? AND collections.user_id = ?)`, filter.CollectionID, userID)
+	}
+
+	if err := query.Count(&total).Error; err != nil {
+		log.Printf("Error counting user recipes: %v", err)
+		return nil, 0, err
+	}
+
+	err := query.Preload("Hashtags").
+		Preload("CreatedBy", func(db *gorm.DB) *gorm.DB {
+			return db.Select("id, username")
+		}).
+		Order("recipes.created_at DESC").
+		Offset(offset).
+		Limit(limit).
+		Find(&recipes).Error
+	if err != nil {
+		log.Printf("Error retrieving user recipes: %v", err)
+		return nil, 0, err
+	}
+
+	return recipes, total, nil
+}
+
+// escapeLike escapes the LIKE wildcards in a string.
+func escapeLike(s string) string {
+	return strings.NewReplacer("\\", "\\\\", "%", "\\%", "_", "\\_").Replace(s)
+}
+
 // GetHistoryByID retrieves a recipe history by its ID.
 func (r *RecipeRepository) GetHistoryByID(historyID uint) (*models.RecipeHistory, error) {
 	history := new(models.RecipeHistory)
 
 	err := r.DB.Preload("Entries", func(db *gorm.DB) *gorm.DB {
-		return db.Order("created_at ASC")
+		return db.Order("version ASC, created_at ASC")
 	}).First(history, historyID).Error
 	if err != nil {
 		return nil, err
@@ -87,13 +265,185 @@ func (r *RecipeRepository) CreateRecipe(recipe *models.Recipe) error {
 	return tx.Commit().Error
 }
 
-// DeleteRecipe deletes a recipe.
+// DeleteRecipe soft-deletes a recipe along with its history and history entries.
 func (r *RecipeRepository) DeleteRecipe(recipeID uint) error {
-	err := r.DB.Delete(&models.Recipe{}, recipeID).Error
-	if err != nil {
+	tx := r.DB.Begin()
+	if tx.Error != nil {
+		return tx.Error
+	}
+
+	var recipe models.Recipe
+	if err := tx.Where("id = ?", recipeID).First(&recipe).Error; err != nil {
+		tx.Rollback()
+		if gorm.IsRecordNotFoundError(err) {
+			return NotFoundError{message: "Recipe not found"}
+		}
 		log.Printf("Error deleting recipe: %v", err)
+		return err
 	}
-	return err
+
+	if err := tx.Delete(&recipe).Error; err != nil {
+		tx.Rollback()
+		log.Printf("Error deleting recipe: %v", err)
+		return err
+	}
+
+	if recipe.HistoryID != 0 {
+		err := tx.Where("recipe_history_id = ?", recipe.HistoryID).
+			Delete(&models.RecipeHistoryEntry{}).Error
+		if err != nil {
+			tx.Rollback()
+			log.Printf("Error deleting recipe history entries: %v", err)
+			return err
+		}
+
+		if err := tx.Delete(&models.RecipeHistory{}, recipe.HistoryID).Error; err != nil {
+			tx.Rollback()
+			log.Printf("Error deleting recipe history: %v", err)
+			return err
+		}
+	}
+
+	return tx.Commit().Error
+}
+
+// GetDeletedRecipesByUserID retrieves the recipes created by a user that were deleted after a given time,
+// most recently deleted first.
+func (r *RecipeRepository) GetDeletedRecipesByUserID(userID uint, deletedAfter time.Time) ([]models.Recipe, error) {
+	var recipes []models.Recipe
+
+	err := r.DB.Unscoped().
+		Preload("Hashtags").
+		Preload("CreatedBy", func(db *gorm.DB) *gorm.DB {
+			return db.Select("id, username")
+		}).
+		Where("created_by_id = ? AND deleted_at IS NOT NULL AND deleted_at > ?", userID, deletedAfter).
+		Order("deleted_at DESC").
+		Find(&recipes).Error
+	if err != nil {
+		log.Printf("Error retrieving deleted recipes: %v", err)
+		return nil, err
+	}
+
+	return recipes, nil
+}
+
+// GetDeletedRecipeByID retrieves a deleted recipe by its ID.
+func (r *RecipeRepository) GetDeletedRecipeByID(recipeID uint) (*models.Recipe, error) {
+	var recipe models.Recipe
+
+	err := r.DB.Unscoped().
+		Where("id = ? AND deleted_at IS NOT NULL", recipeID).
+		First(&recipe).Error
+	if err != nil {
+		if gorm.IsRecordNotFoundError(err) {
+			return nil, NotFoundError{message: "Deleted recipe not found"}
+		}
+		log.Printf("Error retrieving deleted recipe: %v", err)
+		return nil, err
+	}
+
+	return &recipe, nil
+}
+
+// RestoreRecipe restores a soft-deleted recipe along with its history and history entries.
+func (r *RecipeRepository) RestoreRecipe(recipe *models.Recipe) error {
+	tx := r.DB.Begin()
+	if tx.Error != nil {
+		return tx.Error
+	}
+
+	if err := tx.Exec("UPDATE recipes SET deleted_at = NULL WHERE id = ?", recipe.ID).Error; err != nil {
+		tx.Rollback()
+		log.Printf("Error restoring recipe: %v", err)
+		return err
+	}
+
+	if recipe.HistoryID != 0 {
+		err := tx.Exec("UPDATE recipe_histories SET deleted_at = NULL WHERE id = ?", recipe.HistoryID).Error
+		if err != nil {
+			tx.Rollback()
+			log.Printf("Error restoring recipe history: %v", err)
+			return err
+		}
+
+		err = tx.Exec("UPDATE recipe_history_entries SET deleted_at = NULL WHERE recipe_history_id = ?", recipe.HistoryID).Error
+		if err != nil {
+			tx.Rollback()
+			log.Printf("Error restoring recipe history entries: %v", err)
+			return err
+		}
+	}
+
+	recipe.DeletedAt = nil
+
+	return tx.Commit().Error
+}
+
+// GetRecipeIDsDeletedBefore retrieves the IDs of the recipes that were soft-deleted before a given time.
+func (r *RecipeRepository) GetRecipeIDsDeletedBefore(deletedBefore time.Time) ([]uint, error) {
+	var recipeIDs []uint
+
+	err := r.DB.Unscoped().
+		Model(&models.Recipe{}).
+		Where("deleted_at IS NOT NULL AND deleted_at < ?", deletedBefore).
+		Pluck("id", &recipeIDs).Error
+	if err != nil {
+		log.Printf("Error retrieving expired deleted recipes: %v", err)
+		return nil, err
+	}
+
+	return recipeIDs, nil
+}
+
+// PurgeRecipe permanently deletes a recipe, deleted or not, along with its history, history entries,
+// embedding and every association to tags, linked recipes, users and collections.
+func (r *RecipeRepository) PurgeRecipe(recipeID uint) error {
+	tx := r.DB.Begin()
+	if tx.Error != nil {
+		return tx.Error
+	}
+
+	var recipe models.Recipe
+	if err := tx.Unscoped().Where("id = ?", recipeID).First(&recipe).Error; err != nil {
+		tx.Rollback()
+		if gorm.IsRecordNotFoundError(err) {
+			return NotFoundError{message: "Recipe not found"}
+		}
+		return err
+	}
+
+	type statement struct {
+		query string
+		args  []interface{}
+	}
+
+	statements := []statement{
+		{"DELETE FROM recipe_tags WHERE recipe_id = ?", []interface{}{recipeID}},
+		{"DELETE FROM recipe_linked_recipes WHERE recipe_id = ? OR link_recipe_id = ?", []interface{}{recipeID, recipeID}},
+		{"DELETE FROM user_collected_recipes WHERE recipe_id = ?", []interface{}{recipeID}},
+		{"DELETE FROM collection_recipes WHERE recipe_id = ?", []interface{}{recipeID}},
+		{"DELETE FROM recipe_embeddings WHERE recipe_id = ?", []interface{}{recipeID}},
+		{"DELETE FROM moderation_flags WHERE recipe_id = ?", []interface{}{recipeID}},
+		{"UPDATE recipes SET forked_from_id = NULL WHERE forked_from_id = ?", []interface{}{recipeID}},
+		{"DELETE FROM recipes WHERE id = ?", []interface{}{recipeID}},
+	}
+	if recipe.HistoryID != 0 {
+		statements = append(statements,
+			statement{"DELETE FROM recipe_history_entries WHERE recipe_history_id = ?", []interface{}{recipe.HistoryID}},
+			statement{"DELETE FROM recipe_histories WHERE id = ?", []interface{}{recipe.HistoryID}},
+		)
+	}
+
+	for _, statement := range statements {
+		if err := tx.Exec(statement.query, statement.args...).Error; err != nil {
+			tx.Rollback()
+			log.Printf("Error purging recipe %d: %v", recipeID, err)
+			return err
+		}
+	}
+
+	return tx.Commit().Error
 }
 
 // UpdateRecipeTitle updates the title of a recipe.
@@ -117,42 +467,61 @@ func (r *RecipeRepository) UpdateRecipeImageURL(recipeID uint, imageURL string)
 	return err
 }
 
-// UpdateRecipeDef updates the core fields of a recipe and appends the new recipe history entry to the history.
+// flaggedRecipeReason is the hidden reason of recipes hidden by automatic moderation.
+const flaggedRecipeReason = "Flagged by automatic moderation"
+
+// UpdateRecipeDef updates the core fields of a recipe, appends the new recipe history entry to the history
+// as the next version, makes it the active entry and replaces the recipe's tags with the given hashtags,
+// all in a single transaction. An entry without a ParentEntryID branches from the active entry.
+// When automatic moderation flagged the new version, the recipe is hidden and the flag is queued for review
+// in the same transaction, so flagged content is never visible.
+//
+// The recipe takes the unit system the entry was generated in.
 //
-// Core fields: "Title", "Ingredients", "Instructions", "CookTime", "LinkedSuggestions", "ImagePrompt"
-func (r *RecipeRepository) UpdateRecipeDef(recipe *models.Recipe, newRecipeHistoryEntry models.RecipeHistoryEntry) error {
+// Core fields: "Title", "Ingredients", "Instructions", "CookTime", "Servings", "LinkedSuggestions", "ImagePrompt"
+func (r *RecipeRepository) UpdateRecipeDef(recipe *models.Recipe, newRecipeHistoryEntry models.RecipeHistoryEntry, hashtags []string, flag *models.ModerationFlag) error {
 	// Start a new transaction.
 	tx := r.DB.Begin()
 	if tx.Error != nil {
 		return tx.Error
 	}
 
-	// Update core fields of the recipe.
-	err := tx.Model(&models.Recipe{}).
-		Where("id = ?", recipe.ID).
-		Updates(map[string]interface{}{
-			"Title":             recipe.Title,
-			"Ingredients":       recipe.Ingredients,
-			"Instructions":      recipe.Instructions,
-			"CookTime":          recipe.CookTime,
-			"LinkedSuggestions": recipe.LinkedSuggestions,
-			"ImagePrompt":       recipe.ImagePrompt,
-		}).Error
+	// Check if HistoryID is set in the Recipe
+	if recipe.HistoryID == 0 {
+		tx.Rollback()
+		err := errors.New("recipe history ID not set in recipe")
+		log.Printf("Error: %v", err)
+		return err
+	}
+
+	// Lock the history so concurrent entries get distinct version numbers
+	var history models.RecipeHistory
+	err := tx.Set("gorm:query_option", "FOR UPDATE").
+		First(&history, recipe.HistoryID).Error
 	if err != nil {
 		tx.Rollback()
-		log.Printf("Error updating recipe core fields: %v", err)
+		log.Printf("Error locking recipe history: %v", err)
 		return err
 	}
 
-	// Check if HistoryID is set in the Recipe
-	if recipe.HistoryID == 0 {
+	var latest struct{ Version int }
+	err = tx.Model(&models.RecipeHistoryEntry{}).
+		Select("COALESCE(MAX(version), 0) AS version").
+		Where("recipe_history_id = ?", recipe.HistoryID).
+		Scan(&latest).Error
+	if err != nil {
 		tx.Rollback()
-		err = errors.New("recipe history ID not set in recipe")
-		log.Printf("Error: %v", err)
+		log.Printf("Error numbering recipe history entry: %v", err)
 		return err
 	}
 
 	newRecipeHistoryEntry.RecipeHistoryID = recipe.HistoryID
+	newRecipeHistoryEntry.Version = latest.Version + 1
+
+	// Entries without an explicit parent continue from the active entry
+	if newRecipeHistoryEntry.ParentEntryID == nil {
+		newRecipeHistoryEntry.ParentEntryID = history.ActiveEntryID
+	}
 
 	// Insert the new recipe history entry into the database
 	err = tx.Create(&newRecipeHistoryEntry).Error
@@ -162,50 +531,294 @@ func (r *RecipeRepository) UpdateRecipeDef(recipe *models.Recipe, newRecipeHisto
 		return err
 	}
 
+	recipe.Version = newRecipeHistoryEntry.Version
+	if newRecipeHistoryEntry.UnitSystem != nil {
+		recipe.UnitSystem = *newRecipeHistoryEntry.UnitSystem
+	}
+
+	// Update core fields of the recipe.
+	if err := updateRecipeCoreFields(tx, recipe); err != nil {
+		tx.Rollback()
+		log.Printf("Error updating recipe core fields: %v", err)
+		return err
+	}
+
+	// Make the new entry the active one
+	err = tx.Model(&history).
+		Update("ActiveEntryID", newRecipeHistoryEntry.ID).Error
+	if err != nil {
+		tx.Rollback()
+		log.Printf("Error updating active recipe history entry: %v", err)
+		return err
+	}
+
+	// Upsert the tags and replace the recipe's tag associations
+	tags, err := replaceRecipeTags(tx, recipe.ID, hashtags)
+	if err != nil {
+		tx.Rollback()
+		log.Printf("Error replacing recipe tags: %v", err)
+		return err
+	}
+
+	// Hide the flagged recipe and queue it for review
+	var hiddenAt *time.Time
+	if flag != nil {
+		now := time.Now()
+		hiddenAt = &now
+
+		err = tx.Model(&models.Recipe{}).
+			Where("id = ?", recipe.ID).
+			Updates(map[string]interface{}{
+				"hidden_at":     hiddenAt,
+				"hidden_by_id":  nil,
+				"hidden_reason": flaggedRecipeReason,
+			}).Error
+		if err != nil {
+			tx.Rollback()
+			log.Printf("Error hiding flagged recipe: %v", err)
+			return err
+		}
+
+		flag.RecipeID = recipe.ID
+		if err := tx.Create(flag).Error; err != nil {
+			tx.Rollback()
+			log.Printf("Error creating moderation flag: %v", err)
+			return err
+		}
+	}
+
 	err = tx.Commit().Error
 	if err != nil {
 		log.Printf("Error committing transaction in UpdateRecipeCoreFields: %v", err)
 		return err
 	}
 
+	recipe.Hashtags = tags
+	if hiddenAt != nil {
+		recipe.HiddenAt = hiddenAt
+		recipe.HiddenByID = nil
+		recipe.HiddenReason = flaggedRecipeReason
+	}
+
 	return nil
 }
 
-// FindTagByName finds a tag by its name.
-func (r *RecipeRepository) FindTagByName(tagName string) (*models.Tag, error) {
-	var tag models.Tag
-	err := r.DB.Where("Hashtag = ?", tagName).
-		First(&tag).Error
+// ActivateHistoryEntry makes an existing history entry the active one, restoring the recipe's core fields
+// and unit system from it and replacing the recipe's tags with the given hashtags, all in a single transaction.
+func (r *RecipeRepository) ActivateHistoryEntry(recipe *models.Recipe, entry *models.RecipeHistoryEntry, hashtags []string) error {
+	if entry.RecipeResponse == nil {
+		return errors.New("recipe history entry has no recipe")
+	}
+
+	tx := r.DB.Begin()
+	if tx.Error != nil {
+		return tx.Error
+	}
+
+	recipe.RecipeDef = *entry.RecipeResponse
+	recipe.Version = entry.Version
+	if entry.UnitSystem != nil {
+		recipe.UnitSystem = *entry.UnitSystem
+	}
+
+	if err := updateRecipeCoreFields(tx, recipe); err != nil {
+		tx.Rollback()
+		log.Printf("Error updating recipe core fields: %v", err)
+		return err
+	}
+
+	err := tx.Model(&models.RecipeHistory{}).
+		Where("id = ?", recipe.HistoryID).
+		Update("ActiveEntryID", entry.ID).Error
+	if err != nil {
+		tx.Rollback()
+		log.Printf("Error updating active recipe history entry: %v", err)
+		return err
+	}
+
+	tags, err := replaceRecipeTags(tx, recipe.ID, hashtags)
 	if err != nil {
+		tx.Rollback()
+		log.Printf("Error replacing recipe tags: %v", err)
+		return err
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		return err
+	}
+
+	recipe.Hashtags = tags
+
+	return nil
+}
+
+// updateRecipeCoreFields updates the core fields, version and unit system of a recipe within tx,
+// re-estimating its nutrition from the ingredients. The recipe's embedding is marked stale,
+// so it isn't searched by the previous version's vector until it is recomputed.
+func updateRecipeCoreFields(tx *gorm.DB, recipe *models.Recipe) error {
+	recipe.Nutrition = nutrition.Estimate(recipe.Ingredients, recipe.Servings)
+
+	err := tx.Model(&models.RecipeEmbedding{}).
+		Where("recipe_id = ?", recipe.ID).
+		UpdateColumn("stale", true).Error
+	if err != nil {
+		return err
+	}
+
+	return tx.Model(&models.Recipe{}).
+		Where("id = ?", recipe.ID).
+		Updates(map[string]interface{}{
+			"Title":              recipe.Title,
+			"Ingredients":        recipe.Ingredients,
+			"Instructions":       recipe.Instructions,
+			"CookTime":           recipe.CookTime,
+			"Servings":           recipe.Servings,
+			"LinkedSuggestions":  recipe.LinkedSuggestions,
+			"ImagePrompt":        recipe.ImagePrompt,
+			"Version":            recipe.Version,
+			"UnitSystem":         recipe.UnitSystem,
+			"Nutrition":          recipe.Nutrition,
+			"DietaryWarnings":    recipe.DietaryWarnings,
+			"PersonalizationUID": recipe.PersonalizationUID,
+		}).Error
+}
+
+// GetHistoryEntryByVersion retrieves the entry of a recipe history with the given version number.
+func (r *RecipeRepository) GetHistoryEntryByVersion(historyID uint, version int) (*models.RecipeHistoryEntry, error) {
+	var entry models.RecipeHistoryEntry
+
+	err := r.DB.Where("recipe_history_id = ? AND version = ?", historyID, version).
+		First(&entry).Error
+	if err != nil {
+		if gorm.IsRecordNotFoundError(err) {
+			return nil, NotFoundError{message: fmt.Sprintf("Version %d not found", version)}
+		}
+		log.Printf("Error retrieving recipe history entry: %v", err)
 		return nil, err
 	}
-	return &tag, nil
+
+	return &entry, nil
 }
 
-// CreateTag creates a new tag.
-func (r *RecipeRepository) CreateTag(tag *models.Tag) error {
-	err := r.DB.Create(tag).Error
+// replaceRecipeTags upserts the hashtags and replaces the recipe_tags associations of a recipe within tx.
+func replaceRecipeTags(tx *gorm.DB, recipeID uint, hashtags []string) ([]*models.Tag, error) {
+	tags, err := upsertTags(tx, hashtags)
 	if err != nil {
-		log.Printf("Error creating tag: %v", err)
+		return nil, err
 	}
-	return err
+
+	if err := tx.Exec("DELETE FROM recipe_tags WHERE recipe_id = ?", recipeID).Error; err != nil {
+		return nil, err
+	}
+
+	if len(tags) == 0 {
+		return tags, nil
+	}
+
+	placeholders := make([]string, len(tags))
+	args := make([]interface{}, 0, len(tags)*2)
+	for i, tag := range tags {
+		placeholders[i] = "(?, ?)"
+		args = append(args, recipeID, tag.ID)
+	}
+
+	err = tx.Exec("INSERT INTO recipe_tags (recipe_id, tag_id) VALUES "+strings.Join(placeholders, ", ")+
+		" ON CONFLICT DO NOTHING", args...).Error
+	if err != nil {
+		return nil, err
+	}
+
+	return tags, nil
 }
 
-// UpdateRecipeTagsAssociation updates the tags associated with a recipe.
-func (r *RecipeRepository) UpdateRecipeTagsAssociation(recipeID uint, newTags []models.Tag) error {
-	var recipe models.Recipe
-	result := r.DB.First(&recipe, recipeID)
-	if result.Error != nil {
-		return result.Error
+// upsertTags creates the tags that don't exist yet with a single INSERT ... ON CONFLICT,
+// so concurrent transactions inserting the same hashtag don't fail on the unique index,
+// then returns every tag for the hashtags in the given order. Soft deleted tags are restored.
+func upsertTags(tx *gorm.DB, hashtags []string) ([]*models.Tag, error) {
+	if len(hashtags) == 0 {
+		return []*models.Tag{}, nil
+	}
+
+	// Insert in sorted order without duplicates, so concurrent transactions with overlapping hashtags
+	// wait on each other's index entries in the same order instead of deadlocking
+	sorted := make([]string, 0, len(hashtags))
+	seenHashtags := make(map[string]bool, len(hashtags))
+	for _, hashtag := range hashtags {
+		if !seenHashtags[hashtag] {
+			seenHashtags[hashtag] = true
+			sorted = append(sorted, hashtag)
+		}
+	}
+	sort.Strings(sorted)
+
+	now := time.Now()
+	placeholders := make([]string, len(sorted))
+	args := make([]interface{}, 0, len(sorted)*3)
+	for i, hashtag := range sorted {
+		placeholders[i] = "(?, ?, ?)"
+		args = append(args, now, now, hashtag)
 	}
 
-	// Replace existing associations with new tags
-	err := r.DB.Model(&recipe).
-		Association("Hashtags").
-		Replace(newTags).Error
+	var inserted []models.Tag
+	err := tx.Raw("INSERT INTO tags (created_at, updated_at, hashtag) VALUES "+strings.Join(placeholders, ", ")+
+		" ON CONFLICT (hashtag) DO NOTHING RETURNING id, created_at, updated_at, hashtag", args...).
+		Scan(&inserted).Error
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	return nil
+	byHashtag := make(map[string]models.Tag, len(hashtags))
+	for _, tag := range inserted {
+		byHashtag[tag.Hashtag] = tag
+	}
+
+	// Fetch the tags that already existed, or were committed by a concurrent transaction
+	var missing []string
+	for _, hashtag := range sorted {
+		if _, ok := byHashtag[hashtag]; !ok {
+			missing = append(missing, hashtag)
+		}
+	}
+	if len(missing) > 0 {
+		// A soft deleted tag still holds its hashtag in the unique index, restore it rather than
+		// associating recipes with a deleted tag
+		var restored []models.Tag
+		err := tx.Raw(`UPDATE tags SET deleted_at = NULL, updated_at = ? WHERE id IN (
+				SELECT id FROM tags WHERE hashtag IN (?) AND deleted_at IS NOT NULL ORDER BY hashtag FOR UPDATE
+			)
+			RETURNING id, created_at, updated_at, hashtag`, now, missing).
+			Scan(&restored).Error
+		if err != nil {
+			return nil, err
+		}
+		for _, tag := range restored {
+			byHashtag[tag.Hashtag] = tag
+		}
+
+		var existing []models.Tag
+		err = tx.Where("hashtag IN (?)", missing).
+			Find(&existing).Error
+		if err != nil {
+			return nil, err
+		}
+		for _, tag := range existing {
+			byHashtag[tag.Hashtag] = tag
+		}
+	}
+
+	tags := make([]*models.Tag, 0, len(hashtags))
+	seen := make(map[uint]bool, len(hashtags))
+	for _, hashtag := range hashtags {
+		tag, ok := byHashtag[hashtag]
+		if !ok {
+			return nil, fmt.Errorf("tag %q missing after upsert", hashtag)
+		}
+		if !seen[tag.ID] {
+			seen[tag.ID] = true
+			t := tag
+			tags = append(tags, &t)
+		}
+	}
+
+	return tags, nil
 }
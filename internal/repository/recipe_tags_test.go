@@ -0,0 +1,183 @@
+package repository
+
+import (
+	"fmt"
+	"math/rand"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/jinzhu/gorm"
+	_ "github.com/jinzhu/gorm/dialects/postgres"
+	"github.com/windoze95/saltybytes-api/internal/models"
+)
+
+// openTestDB connects to the Postgres database in TEST_DATABASE_URL, skipping the test without one.
+// The database should be disposable, tests create and delete their own rows.
+func openTestDB(t *testing.T) *gorm.DB {
+	t.Helper()
+
+	url := os.Getenv("TEST_DATABASE_URL")
+	if url == "" {
+		t.Skip("TEST_DATABASE_URL is not set")
+	}
+
+	database, err := gorm.Open("postgres", url)
+	if err != nil {
+		t.Fatalf("failed to connect to the test database: %v", err)
+	}
+	t.Cleanup(func() { database.Close() })
+
+	if err := database.AutoMigrate(&models.Tag{}, &models.Recipe{}).Error; err != nil {
+		t.Fatalf("failed to migrate the test database: %v", err)
+	}
+
+	return database
+}
+
+// testHashtags returns hashtags unique to the test run, so runs don't see each other's tags.
+func testHashtags(n int) []string {
+	prefix := fmt.Sprintf("t%d", time.Now().UnixNano())
+	hashtags := make([]string, n)
+	for i := range hashtags {
+		hashtags[i] = fmt.Sprintf("%s%c", prefix, 'a'+i)
+	}
+	return hashtags
+}
+
+// cleanupTags deletes the tags and their recipe associations after the test.
+func cleanupTags(t *testing.T, database *gorm.DB, hashtags []string) {
+	t.Cleanup(func() {
+		database.Exec("DELETE FROM recipe_tags WHERE tag_id IN (SELECT id FROM tags WHERE hashtag IN (?))", hashtags)
+		database.Exec("DELETE FROM tags WHERE hashtag IN (?)", hashtags)
+	})
+}
+
+// TestReplaceRecipeTagsConcurrent saves the tags of many recipes at once, the way concurrent recipe
+// generations do, with overlapping hashtags in different orders. None of the transactions may fail
+// or deadlock, and every hashtag must end up as a single tag.
+func TestReplaceRecipeTagsConcurrent(t *testing.T) {
+	database := openTestDB(t)
+
+	hashtags := testHashtags(8)
+	cleanupTags(t, database, hashtags)
+
+	const generations = 32
+	baseRecipeID := uint(time.Now().UnixNano()%1000000) + 1000000000
+
+	var wg sync.WaitGroup
+	errs := make(chan error, generations)
+	for i := 0; i < generations; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+
+			// Every generation uses a shuffled subset of the hashtags, with a duplicate
+			r := rand.New(rand.NewSource(int64(i)))
+			shuffled := append([]string(nil), hashtags...)
+			r.Shuffle(len(shuffled), func(a, b int) { shuffled[a], shuffled[b] = shuffled[b], shuffled[a] })
+			recipeHashtags := append(shuffled[:5], shuffled[0])
+
+			tx := database.Begin()
+			if _, err := replaceRecipeTags(tx, baseRecipeID+uint(i), recipeHashtags); err != nil {
+				tx.Rollback()
+				errs <- fmt.Errorf("generation %d: %w", i, err)
+				return
+			}
+			if err := tx.Commit().Error; err != nil {
+				errs <- fmt.Errorf("generation %d: %w", i, err)
+			}
+		}(i)
+	}
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		t.Error(err)
+	}
+
+	var counts []struct {
+		Hashtag string
+		Count   int
+	}
+	err := database.Raw("SELECT hashtag, COUNT(*) AS count FROM tags WHERE hashtag IN (?) GROUP BY hashtag", hashtags).
+		Scan(&counts).Error
+	if err != nil {
+		t.Fatalf("failed to count tags: %v", err)
+	}
+	for _, c := range counts {
+		if c.Count != 1 {
+			t.Errorf("hashtag %s has %d tags, want 1", c.Hashtag, c.Count)
+		}
+	}
+
+	var associations int
+	err = database.Table("recipe_tags").
+		Where("recipe_id >= ? AND recipe_id < ?", baseRecipeID, baseRecipeID+generations).
+		Count(&associations).Error
+	if err != nil {
+		t.Fatalf("failed to count recipe tags: %v", err)
+	}
+	if associations != generations*5 {
+		t.Errorf("got %d recipe tags, want %d", associations, generations*5)
+	}
+}
+
+// TestUpsertTagsKeepsOrder checks the tags come back in the order of the hashtags, without duplicates.
+func TestUpsertTagsKeepsOrder(t *testing.T) {
+	database := openTestDB(t)
+
+	hashtags := testHashtags(3)
+	cleanupTags(t, database, hashtags)
+
+	// The second hashtag exists already
+	if err := database.Create(&models.Tag{Hashtag: hashtags[1]}).Error; err != nil {
+		t.Fatalf("failed to create tag: %v", err)
+	}
+
+	tags, err := upsertTags(database, []string{hashtags[2], hashtags[1], hashtags[0], hashtags[2]})
+	if err != nil {
+		t.Fatalf("upsertTags failed: %v", err)
+	}
+
+	want := []string{hashtags[2], hashtags[1], hashtags[0]}
+	if len(tags) != len(want) {
+		t.Fatalf("got %d tags, want %d", len(tags), len(want))
+	}
+	for i, tag := range tags {
+		if tag.Hashtag != want[i] || tag.ID == 0 {
+			t.Errorf("tag %d is %q (ID %d), want %q", i, tag.Hashtag, tag.ID, want[i])
+		}
+	}
+}
+
+// TestUpsertTagsRestoresDeletedTags checks a soft deleted tag is restored rather than
+// associated with recipes while deleted.
+func TestUpsertTagsRestoresDeletedTags(t *testing.T) {
+	database := openTestDB(t)
+
+	hashtags := testHashtags(1)
+	cleanupTags(t, database, hashtags)
+
+	deleted := models.Tag{Hashtag: hashtags[0]}
+	if err := database.Create(&deleted).Error; err != nil {
+		t.Fatalf("failed to create tag: %v", err)
+	}
+	if err := database.Delete(&deleted).Error; err != nil {
+		t.Fatalf("failed to delete tag: %v", err)
+	}
+
+	tags, err := upsertTags(database, hashtags)
+	if err != nil {
+		t.Fatalf("upsertTags failed: %v", err)
+	}
+	if len(tags) != 1 || tags[0].ID != deleted.ID {
+		t.Fatalf("got %+v, want the restored tag %d", tags, deleted.ID)
+	}
+
+	var restored models.Tag
+	if err := database.First(&restored, deleted.ID).Error; err != nil {
+		t.Errorf("tag is still deleted: %v", err)
+	}
+}
@@ -0,0 +1,77 @@
+package repository
+
+import (
+	"testing"
+
+	"github.com/windoze95/saltybytes-api/internal/models"
+)
+
+// TestRegenerateAfterUnitSystemChange checks a recipe regenerated after its creator switched unit systems
+// takes on the new unit system, and gets the old one back when the first version is restored.
+func TestRegenerateAfterUnitSystemChange(t *testing.T) {
+	database := openTestDB(t)
+	err := database.AutoMigrate(&models.RecipeHistory{}, &models.RecipeHistoryEntry{}, &models.RecipeEmbedding{}).Error
+	if err != nil {
+		t.Fatalf("failed to migrate the test database: %v", err)
+	}
+
+	history := &models.RecipeHistory{}
+	if err := database.Create(history).Error; err != nil {
+		t.Fatalf("failed to create recipe history: %v", err)
+	}
+	recipe := &models.Recipe{HistoryID: history.ID, UnitSystem: models.USCustomary}
+	if err := database.Create(recipe).Error; err != nil {
+		t.Fatalf("failed to create recipe: %v", err)
+	}
+	t.Cleanup(func() {
+		database.Exec("DELETE FROM recipe_tags WHERE recipe_id = ?", recipe.ID)
+		database.Unscoped().Delete(&models.Recipe{}, recipe.ID)
+		database.Unscoped().Where("recipe_history_id = ?", history.ID).Delete(&models.RecipeHistoryEntry{})
+		database.Unscoped().Delete(&models.RecipeHistory{}, history.ID)
+	})
+
+	repo := NewRecipeRepository(database)
+	generate := func(unitSystem models.UnitSystem, entryType models.RecipeType) *models.RecipeHistoryEntry {
+		t.Helper()
+		entry := models.RecipeHistoryEntry{
+			Type:           entryType,
+			RecipeResponse: &models.RecipeDef{Title: "Pancakes", Servings: 2},
+			UnitSystem:     &unitSystem,
+		}
+		recipe.RecipeDef = *entry.RecipeResponse
+		if err := repo.UpdateRecipeDef(recipe, entry, nil, nil); err != nil {
+			t.Fatalf("UpdateRecipeDef failed: %v", err)
+		}
+		saved, err := repo.GetHistoryEntryByVersion(history.ID, recipe.Version)
+		if err != nil {
+			t.Fatalf("GetHistoryEntryByVersion failed: %v", err)
+		}
+		return saved
+	}
+	savedUnitSystem := func() models.UnitSystem {
+		t.Helper()
+		var saved models.Recipe
+		if err := database.First(&saved, recipe.ID).Error; err != nil {
+			t.Fatalf("failed to retrieve recipe: %v", err)
+		}
+		return saved.UnitSystem
+	}
+
+	first := generate(models.USCustomary, models.RecipeTypeChat)
+
+	// The creator switched to metric before regenerating
+	regenerated := generate(models.Metric, models.RecipeTypeRegenChat)
+	if regenerated.UnitSystem == nil || *regenerated.UnitSystem != models.Metric {
+		t.Errorf("regenerated entry has unit system %v, want metric", regenerated.UnitSystem)
+	}
+	if got := savedUnitSystem(); got != models.Metric {
+		t.Errorf("regenerated recipe has unit system %d, want metric", got)
+	}
+
+	if err := repo.ActivateHistoryEntry(recipe, first, nil); err != nil {
+		t.Fatalf("ActivateHistoryEntry failed: %v", err)
+	}
+	if got := savedUnitSystem(); got != models.USCustomary {
+		t.Errorf("restored recipe has unit system %d, want US customary", got)
+	}
+}
@@ -0,0 +1,268 @@
+package repository
+
+import (
+	"log"
+	"time"
+
+	"github.com/jinzhu/gorm"
+	"github.com/windoze95/saltybytes-api/internal/models"
+)
+
+// TagRepository is a repository for interacting with tags.
+type TagRepository struct {
+	DB *gorm.DB
+}
+
+// NewTagRepository creates a new TagRepository.
+func NewTagRepository(db *gorm.DB) *TagRepository {
+	return &TagRepository{DB: db}
+}
+
+// TagUsage is a tag with the number of recipes using it.
+type TagUsage struct {
+	ID         uint
+	Hashtag    string
+	UsageCount int
+}
+
+// SearchTagsByPrefix retrieves tags starting with a prefix, most used by public recipes first.
+func (r *TagRepository) SearchTagsByPrefix(prefix string, limit int) ([]TagUsage, error) {
+	var tagUsages []TagUsage
+
+	err := r.DB.Table("tags").
+		Select("tags.id, tags.hashtag, COUNT(recipes.id) AS usage_count").
+		Joins("LEFT JOIN recipe_tags ON recipe_tags.tag_id = tags.id").
+		Joins("LEFT JOIN recipes ON recipes.id = recipe_tags.recipe_id AND recipes.deleted_at IS NULL AND recipes.visibility = ? AND recipes.hidden_at IS NULL", models.RecipeVisibilityPublic).
+		Where("tags.deleted_at IS NULL AND tags.hashtag LIKE ?", prefix+"%").
+		Group("tags.id, tags.hashtag").
+		Order("usage_count DESC, tags.hashtag ASC").
+		Limit(limit).
+		Scan(&tagUsages).Error
+	if err != nil {
+		log.Printf("Error searching tags: %v", err)
+		return nil, err
+	}
+
+	return tagUsages, nil
+}
+
+// GetTrendingTags retrieves the tags used by the most public recipes created since a given time.
+func (r *TagRepository) GetTrendingTags(since time.Time, limit int) ([]TagUsage, error) {
+	var tagUsages []TagUsage
+
+	err := r.DB.Table("tags").
+		Select("tags.id, tags.hashtag, COUNT(recipes.id) AS usage_count").
+		Joins("JOIN recipe_tags ON recipe_tags.tag_id = tags.id").
+		Joins("JOIN recipes ON recipes.id = recipe_tags.recipe_id AND recipes.deleted_at IS NULL").
+		Where("tags.deleted_at IS NULL AND recipes.visibility = ? AND recipes.hidden_at IS NULL AND recipes.created_at >= ?", models.RecipeVisibilityPublic, since).
+		Group("tags.id, tags.hashtag").
+		Order("usage_count DESC, tags.hashtag ASC").
+		Limit(limit).
+		Scan(&tagUsages).Error
+	if err != nil {
+		log.Printf("Error retrieving trending tags: %v", err)
+		return nil, err
+	}
+
+	return tagUsages, nil
+}
+
+// GetTagByHashtag retrieves a tag by its hashtag.
+func (r *TagRepository) GetTagByHashtag(hashtag string) (*models.Tag, error) {
+	var tag models.Tag
+	err := r.DB.Where("hashtag = ?", hashtag).
+		First(&tag).Error
+	if err != nil {
+		if gorm.IsRecordNotFoundError(err) {
+			return nil, NotFoundError{message: "Tag not found"}
+		}
+		return nil, err
+	}
+	return &tag, nil
+}
+
+// GetRecipesByTagID retrieves a page of public recipes associated with a tag, newest first,
+// along with the total number of public recipes associated with the tag.
+func (r *TagRepository) GetRecipesByTagID(tagID uint, offset, limit int) ([]models.Recipe, int, error) {
+	var recipes []models.Recipe
+	var total int
+
+	query := r.DB.Model(&models.Recipe{}).
+		Joins("JOIN recipe_tags ON recipe_tags.recipe_id = recipes.id").
+		Where("recipe_tags.tag_id = ? AND recipes.visibility = ? AND recipes.hidden_at IS NULL", tagID, models.RecipeVisibilityPublic)
+
+	if err := query.Count(&total).Error; err != nil {
+		log.Printf("Error counting recipes by tag: %v", err)
+		return nil, 0, err
+	}
+
+	err := query.Preload("Hashtags").
+		Preload("CreatedBy", func(db *gorm.DB) *gorm.DB {
+			return db.Select("id, username")
+		}).
+		Order("recipes.created_at DESC").
+		Offset(offset).
+		Limit(limit).
+		Find(&recipes).Error
+	if err != nil {
+		log.Printf("Error retrieving recipes by tag: %v", err)
+		return nil, 0, err
+	}
+
+	return recipes, total, nil
+}
+
+// GetAllTags retrieves every tag.
+func (r *TagRepository) GetAllTags() ([]models.Tag, error) {
+	var tags []models.Tag
+	if err := r.DB.Order("id ASC").Find(&tags).Error; err != nil {
+		log.Printf("Error retrieving tags: %v", err)
+		return nil, err
+	}
+	return tags, nil
+}
+
+// FindOrCreateTag retrieves a tag by its hashtag, creating it if it doesn't exist.
+func (r *TagRepository) FindOrCreateTag(hashtag string) (*models.Tag, error) {
+	var tag models.Tag
+	err := r.DB.Where(models.Tag{Hashtag: hashtag}).
+		FirstOrCreate(&tag).Error
+	if err != nil {
+		log.Printf("Error finding or creating tag: %v", err)
+		return nil, err
+	}
+	return &tag, nil
+}
+
+// GetTagAliases retrieves every tag alias along with its canonical tag.
+func (r *TagRepository) GetTagAliases() ([]models.TagAlias, error) {
+	var tagAliases []models.TagAlias
+	err := r.DB.Preload("Tag").
+		Order("alias ASC").
+		Find(&tagAliases).Error
+	if err != nil {
+		log.Printf("Error retrieving tag aliases: %v", err)
+		return nil, err
+	}
+	return tagAliases, nil
+}
+
+// ResolveTagAliases maps each of the given hashtags that is an alias to its canonical hashtag.
+func (r *TagRepository) ResolveTagAliases(hashtags []string) (map[string]string, error) {
+	var tagAliases []models.TagAlias
+	err := r.DB.Preload("Tag").
+		Where("alias IN (?)", hashtags).
+		Find(&tagAliases).Error
+	if err != nil {
+		log.Printf("Error resolving tag aliases: %v", err)
+		return nil, err
+	}
+
+	resolved := make(map[string]string, len(tagAliases))
+	for _, tagAlias := range tagAliases {
+		if tagAlias.Tag != nil {
+			resolved[tagAlias.Alias] = tagAlias.Tag.Hashtag
+		}
+	}
+
+	return resolved, nil
+}
+
+// CreateTagAlias creates an alias for a tag, or points an existing alias at it, and merges the tag with the same name as the alias, if any,
+// into the canonical tag.
+func (r *TagRepository) CreateTagAlias(tagAlias *models.TagAlias) error {
+	tx := r.DB.Begin()
+	if tx.Error != nil {
+		return tx.Error
+	}
+
+	// An existing alias is pointed at the new tag rather than failing on the unique alias
+	now := time.Now()
+	err := tx.Exec(`INSERT INTO tag_aliases (created_at, updated_at, alias, tag_id) VALUES (?, ?, ?, ?)
+		ON CONFLICT (alias) DO UPDATE SET tag_id = EXCLUDED.tag_id, updated_at = EXCLUDED.updated_at, deleted_at = NULL`,
+		now, now, tagAlias.Alias, tagAlias.TagID).Error
+	if err != nil {
+		tx.Rollback()
+		log.Printf("Error creating tag alias: %v", err)
+		return err
+	}
+
+	tag := tagAlias.Tag
+	if err := tx.Where("alias = ?", tagAlias.Alias).First(tagAlias).Error; err != nil {
+		tx.Rollback()
+		log.Printf("Error retrieving tag alias: %v", err)
+		return err
+	}
+	tagAlias.Tag = tag
+
+	var aliasedTag models.Tag
+	err = tx.Where("hashtag = ?", tagAlias.Alias).
+		First(&aliasedTag).Error
+	if err == nil {
+		if err := mergeTags(tx, aliasedTag.ID, tagAlias.TagID); err != nil {
+			tx.Rollback()
+			log.Printf("Error merging aliased tag: %v", err)
+			return err
+		}
+	} else if !gorm.IsRecordNotFoundError(err) {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit().Error
+}
+
+// DeleteTagAlias deletes a tag alias.
+func (r *TagRepository) DeleteTagAlias(tagAliasID uint) error {
+	result := r.DB.Unscoped().Delete(&models.TagAlias{}, tagAliasID)
+	if result.Error != nil {
+		log.Printf("Error deleting tag alias: %v", result.Error)
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return NotFoundError{message: "Tag alias not found"}
+	}
+	return nil
+}
+
+// MergeTags moves every recipe and alias of a tag to another tag and removes the merged tag.
+func (r *TagRepository) MergeTags(fromTagID, intoTagID uint) error {
+	tx := r.DB.Begin()
+	if tx.Error != nil {
+		return tx.Error
+	}
+
+	if err := mergeTags(tx, fromTagID, intoTagID); err != nil {
+		tx.Rollback()
+		log.Printf("Error merging tags: %v", err)
+		return err
+	}
+
+	return tx.Commit().Error
+}
+
+// mergeTags moves every recipe association and alias from one tag to another and removes the merged tag.
+func mergeTags(tx *gorm.DB, fromTagID, intoTagID uint) error {
+	if fromTagID == intoTagID {
+		return nil
+	}
+
+	err := tx.Exec(`INSERT INTO recipe_tags (recipe_id, tag_id)
+		SELECT recipe_id, ? FROM recipe_tags WHERE tag_id = ?
+		ON CONFLICT DO NOTHING`, intoTagID, fromTagID).Error
+	if err != nil {
+		return err
+	}
+
+	if err := tx.Exec("DELETE FROM recipe_tags WHERE tag_id = ?", fromTagID).Error; err != nil {
+		return err
+	}
+
+	// Aliases of the merged tag resolve to the tag it was merged into
+	if err := tx.Exec("UPDATE tag_aliases SET tag_id = ? WHERE tag_id = ?", intoTagID, fromTagID).Error; err != nil {
+		return err
+	}
+
+	// Hard delete so the unique hashtag is free, the alias now resolves it anyway
+	return tx.Unscoped().Delete(&models.Tag{}, fromTagID).Error
+}
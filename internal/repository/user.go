@@ -4,6 +4,7 @@ import (
 	"errors"
 	"log"
 	"strings"
+	"time"
 
 	"github.com/jinzhu/gorm"
 	"github.com/lib/pq"
@@ -62,12 +63,62 @@ func (r *UserRepository) GetUserAuthByUsername(username string) (*models.User, e
 	if err := r.DB.Preload("Auth").
 		Where("username = ?", username).
 		First(&user).Error; err != nil {
+		if gorm.IsRecordNotFoundError(err) {
+			return nil, NotFoundError{message: "User not found"}
+		}
+
+		log.Printf("Error retrieving user auth by username: %v", err)
 		return nil, err
 	}
 
 	return &user, nil
 }
 
+// GetUserAuthByUserID retrieves a user's authentication information by their ID.
+func (r *UserRepository) GetUserAuthByUserID(userID uint) (*models.UserAuth, error) {
+	var auth models.UserAuth
+	if err := r.DB.Where("user_id = ?", userID).
+		First(&auth).Error; err != nil {
+		log.Printf("Error retrieving user auth: %v", err)
+		return nil, err
+	}
+
+	return &auth, nil
+}
+
+// UpdateUserProfile updates the given profile fields of a user.
+// Usernames and emails already in use by another user are reported as a ConflictError.
+func (r *UserRepository) UpdateUserProfile(userID uint, updates map[string]interface{}) error {
+	err := r.DB.Model(&models.User{}).
+		Where("id = ?", userID).
+		Updates(updates).Error
+	if err != nil {
+		// Check for unique constraints
+		if pgErr, ok := err.(*pq.Error); ok && pgErr.Code == "23505" {
+			if strings.Contains(pgErr.Error(), "username") {
+				return ConflictError{message: "username already in use"}
+			} else if strings.Contains(pgErr.Error(), "email") {
+				return ConflictError{message: "email already in use"}
+			}
+		}
+		log.Printf("Error updating user profile: %v", err)
+	}
+
+	return err
+}
+
+// UpdateUserPassword updates a user's hashed password.
+func (r *UserRepository) UpdateUserPassword(userID uint, hashedPassword string) error {
+	err := r.DB.Model(&models.UserAuth{}).
+		Where("user_id = ?", userID).
+		Update("HashedPassword", hashedPassword).Error
+	if err != nil {
+		log.Printf("Error updating user password: %v", err)
+	}
+
+	return err
+}
+
 // UpdateUserEmail updates a user's email address.
 func (r *UserRepository) UpdateUserEmail(userID uint, email string) error {
 	err := r.DB.Model(&models.User{}).
@@ -92,6 +143,18 @@ func (r *UserRepository) UpdateUserSettingsKeepScreenAwake(userID uint, keepScre
 	return err
 }
 
+// UpdateUserSettings updates the given settings of a user.
+func (r *UserRepository) UpdateUserSettings(userID uint, updates map[string]interface{}) error {
+	err := r.DB.Model(&models.UserSettings{}).
+		Where("user_id = ?", userID).
+		Updates(updates).Error
+	if err != nil {
+		log.Printf("Error updating user settings: %v", err)
+	}
+
+	return err
+}
+
 // UpdatePersonalization updates a user's personalization settings.
 func (r *UserRepository) UpdatePersonalization(userID uint, updatedPersonalization *models.Personalization) error {
 	var existingPersonalization models.Personalization
@@ -107,6 +170,8 @@ func (r *UserRepository) UpdatePersonalization(userID uint, updatedPersonalizati
 	// Update fields
 	existingPersonalization.UnitSystem = updatedPersonalization.UnitSystem
 	existingPersonalization.Requirements = updatedPersonalization.Requirements
+	existingPersonalization.Diets = updatedPersonalization.Diets
+	existingPersonalization.Allergens = updatedPersonalization.Allergens
 	existingPersonalization.UID = updatedPersonalization.UID
 
 	// Perform the update
@@ -132,3 +197,420 @@ func (r *UserRepository) UsernameExists(username string) (bool, error) {
 	}
 	return true, nil
 }
+
+// IsUsernameForbidden checks if a username is on the forbidden username list, ignoring case.
+func (r *UserRepository) IsUsernameForbidden(username string) (bool, error) {
+	var count int
+	err := r.DB.Model(&models.ForbiddenUsername{}).
+		Where("username = ?", strings.ToLower(username)).
+		Count(&count).Error
+	if err != nil {
+		log.Printf("Error checking forbidden username: %v", err)
+		return false, err
+	}
+
+	return count > 0, nil
+}
+
+// GetUserByEmail retrieves a user by their email address, ignoring case.
+func (r *UserRepository) GetUserByEmail(email string) (*models.User, error) {
+	var user models.User
+	if err := r.DB.Where("LOWER(email) = ?", strings.ToLower(email)).
+		First(&user).Error; err != nil {
+		if gorm.IsRecordNotFoundError(err) {
+			return nil, NotFoundError{message: "User not found"}
+		}
+
+		log.Printf("Error retrieving user by email: %v", err)
+		return nil, err
+	}
+
+	return &user, nil
+}
+
+// CreateUserToken creates a new single-use user token.
+func (r *UserRepository) CreateUserToken(token *models.UserToken) error {
+	if err := r.DB.Create(token).Error; err != nil {
+		log.Printf("Error creating user token: %v", err)
+		return err
+	}
+
+	return nil
+}
+
+// GetUserTokenByHash retrieves a user token for the given purpose by the hash of the token.
+func (r *UserRepository) GetUserTokenByHash(tokenHash string, purpose models.TokenPurpose) (*models.UserToken, error) {
+	var token models.UserToken
+	if err := r.DB.Where("token_hash = ? AND purpose = ?", tokenHash, purpose).
+		First(&token).Error; err != nil {
+		if gorm.IsRecordNotFoundError(err) {
+			return nil, NotFoundError{message: "Token not found"}
+		}
+
+		log.Printf("Error retrieving user token: %v", err)
+		return nil, err
+	}
+
+	return &token, nil
+}
+
+// VerifyUserEmail uses an email verification token and marks the address it was sent to as verified,
+// as long as it is still the user's address. A token that was already used is reported as a NotFoundError.
+func (r *UserRepository) VerifyUserEmail(token *models.UserToken) error {
+	tx := r.DB.Begin()
+
+	if err := useUserToken(tx, token); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	err := tx.Model(&models.User{}).
+		Where("id = ? AND email = ?", token.UserID, token.Email).
+		Update("EmailVerified", true).Error
+	if err != nil {
+		tx.Rollback()
+		log.Printf("Error verifying user email: %v", err)
+		return err
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		log.Printf("Error committing email verification: %v", err)
+		return err
+	}
+
+	return nil
+}
+
+// ResetUserPassword uses a password reset token and updates the user's hashed password.
+// Every other outstanding reset token of the user is used up along with it.
+// A token that was already used, or was sent to an email the user has since changed, is reported as a NotFoundError.
+func (r *UserRepository) ResetUserPassword(token *models.UserToken, hashedPassword string) error {
+	tx := r.DB.Begin()
+
+	if err := useUserToken(tx, token); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	// Like email verification, the token only holds for the email it was sent to
+	var count int
+	err := tx.Model(&models.User{}).
+		Where("id = ? AND email = ?", token.UserID, token.Email).
+		Count(&count).Error
+	if err != nil {
+		tx.Rollback()
+		log.Printf("Error checking password reset email: %v", err)
+		return err
+	}
+	if count == 0 {
+		tx.Rollback()
+		return NotFoundError{message: "Token not found"}
+	}
+
+	err = tx.Model(&models.UserToken{}).
+		Where("user_id = ? AND purpose = ? AND used_at IS NULL", token.UserID, models.PasswordResetToken).
+		Update("used_at", time.Now()).Error
+	if err != nil {
+		tx.Rollback()
+		log.Printf("Error using outstanding password reset tokens: %v", err)
+		return err
+	}
+
+	err = tx.Model(&models.UserAuth{}).
+		Where("user_id = ?", token.UserID).
+		Update("HashedPassword", hashedPassword).Error
+	if err != nil {
+		tx.Rollback()
+		log.Printf("Error resetting user password: %v", err)
+		return err
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		log.Printf("Error committing password reset: %v", err)
+		return err
+	}
+
+	return nil
+}
+
+// useUserToken marks a user token as used, unless it already was.
+func useUserToken(tx *gorm.DB, token *models.UserToken) error {
+	result := tx.Model(&models.UserToken{}).
+		Where("id = ? AND used_at IS NULL", token.ID).
+		Update("used_at", time.Now())
+	if result.Error != nil {
+		log.Printf("Error using user token: %v", result.Error)
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return NotFoundError{message: "Token not found"}
+	}
+
+	return nil
+}
+
+// CreateUserWithIdentity creates a new user who signed up with an identity provider, along with the linked identity.
+// Usernames, emails and identities already in use are reported as a ConflictError.
+func (r *UserRepository) CreateUserWithIdentity(user *models.User, identity *models.UserIdentity) (*models.User, error) {
+	tx := r.DB.Begin()
+	if err := tx.Create(user).Error; err != nil {
+		tx.Rollback()
+		return nil, identityConflictError(err)
+	}
+
+	identity.UserID = user.ID
+	if err := tx.Create(identity).Error; err != nil {
+		tx.Rollback()
+		return nil, identityConflictError(err)
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		log.Printf("Error committing user with identity: %v", err)
+		return nil, err
+	}
+
+	return user, nil
+}
+
+// GetUserIdentity retrieves the linked identity with the given provider and subject.
+func (r *UserRepository) GetUserIdentity(provider models.UserAuthType, subject string) (*models.UserIdentity, error) {
+	var identity models.UserIdentity
+	if err := r.DB.Where("provider = ? AND subject = ?", provider, subject).
+		First(&identity).Error; err != nil {
+		if gorm.IsRecordNotFoundError(err) {
+			return nil, NotFoundError{message: "Identity not found"}
+		}
+
+		log.Printf("Error retrieving user identity: %v", err)
+		return nil, err
+	}
+
+	return &identity, nil
+}
+
+// GetUserIdentities retrieves the identities linked to a user.
+func (r *UserRepository) GetUserIdentities(userID uint) ([]models.UserIdentity, error) {
+	var identities []models.UserIdentity
+	if err := r.DB.Where("user_id = ?", userID).
+		Order("created_at").
+		Find(&identities).Error; err != nil {
+		log.Printf("Error retrieving user identities: %v", err)
+		return nil, err
+	}
+
+	return identities, nil
+}
+
+// CreateUserIdentity links an identity to a user.
+// An identity already linked to a user is reported as a ConflictError.
+func (r *UserRepository) CreateUserIdentity(identity *models.UserIdentity) error {
+	if err := r.DB.Create(identity).Error; err != nil {
+		return identityConflictError(err)
+	}
+
+	return nil
+}
+
+// DeleteUserIdentity unlinks an identity from a user. The identity is deleted permanently
+// so it can be linked again later.
+func (r *UserRepository) DeleteUserIdentity(userID, identityID uint) error {
+	result := r.DB.Unscoped().
+		Where("id = ? AND user_id = ?", identityID, userID).
+		Delete(&models.UserIdentity{})
+	if result.Error != nil {
+		log.Printf("Error deleting user identity: %v", result.Error)
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return NotFoundError{message: "Identity not found"}
+	}
+
+	return nil
+}
+
+// identityConflictError reports unique constraint violations from creating users and identities as a ConflictError.
+func identityConflictError(err error) error {
+	if pgErr, ok := err.(*pq.Error); ok && pgErr.Code == "23505" {
+		switch {
+		case strings.Contains(pgErr.Error(), "username"):
+			return ConflictError{message: "username already in use"}
+		case strings.Contains(pgErr.Error(), "email"):
+			return ConflictError{message: "email already in use"}
+		default:
+			return ConflictError{message: "identity already linked to a user"}
+		}
+	}
+
+	log.Printf("Error creating user identity: %v", err)
+	return err
+}
+
+// GetUserMFA retrieves a user's two-factor authentication.
+func (r *UserRepository) GetUserMFA(userID uint) (*models.UserMFA, error) {
+	var mfa models.UserMFA
+	if err := r.DB.Where("user_id = ?", userID).First(&mfa).Error; err != nil {
+		if gorm.IsRecordNotFoundError(err) {
+			return nil, NotFoundError{message: "Two-factor authentication not found"}
+		}
+
+		log.Printf("Error retrieving user mfa: %v", err)
+		return nil, err
+	}
+
+	return &mfa, nil
+}
+
+// SaveUserMFASecret creates or replaces the secret of a user's two-factor authentication that isn't enabled yet.
+func (r *UserRepository) SaveUserMFASecret(userID uint, encryptedSecret string) error {
+	err := r.DB.Exec(`INSERT INTO user_mfas (user_id, encrypted_secret, last_used_step, failed_attempts, created_at, updated_at)
+		VALUES (?, ?, 0, 0, NOW(), NOW())
+		ON CONFLICT (user_id) DO UPDATE SET encrypted_secret = EXCLUDED.encrypted_secret, updated_at = NOW()
+		WHERE user_mfas.enabled_at IS NULL`, userID, encryptedSecret).Error
+	if err != nil {
+		log.Printf("Error saving user mfa secret: %v", err)
+	}
+
+	return err
+}
+
+// EnableUserMFA enables a user's two-factor authentication, recording the time step of the code
+// that confirmed it, and replaces their recovery codes.
+func (r *UserRepository) EnableUserMFA(mfa *models.UserMFA, step int64, recoveryCodeHashes []string) error {
+	tx := r.DB.Begin()
+
+	err := tx.Model(mfa).Updates(map[string]interface{}{
+		"enabled_at":      time.Now(),
+		"last_used_step":  step,
+		"failed_attempts": 0,
+		"locked_until":    nil,
+	}).Error
+	if err != nil {
+		tx.Rollback()
+		log.Printf("Error enabling user mfa: %v", err)
+		return err
+	}
+
+	if err := replaceMFARecoveryCodes(tx, mfa.UserID, recoveryCodeHashes); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit().Error
+}
+
+// ReplaceMFARecoveryCodes replaces a user's recovery codes.
+func (r *UserRepository) ReplaceMFARecoveryCodes(userID uint, recoveryCodeHashes []string) error {
+	tx := r.DB.Begin()
+
+	if err := replaceMFARecoveryCodes(tx, userID, recoveryCodeHashes); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit().Error
+}
+
+// replaceMFARecoveryCodes deletes a user's recovery codes and creates new ones with the given hashes.
+func replaceMFARecoveryCodes(tx *gorm.DB, userID uint, recoveryCodeHashes []string) error {
+	if err := tx.Unscoped().Where("user_id = ?", userID).Delete(&models.MFARecoveryCode{}).Error; err != nil {
+		log.Printf("Error deleting mfa recovery codes: %v", err)
+		return err
+	}
+
+	for _, codeHash := range recoveryCodeHashes {
+		if err := tx.Create(&models.MFARecoveryCode{UserID: userID, CodeHash: codeHash}).Error; err != nil {
+			log.Printf("Error creating mfa recovery code: %v", err)
+			return err
+		}
+	}
+
+	return nil
+}
+
+// RecordMFASuccess records the time step of a code used to pass two-factor authentication and clears
+// earlier failures. It returns false when a code of the same or a later time step was already used.
+func (r *UserRepository) RecordMFASuccess(mfa *models.UserMFA, step int64) (bool, error) {
+	result := r.DB.Model(&models.UserMFA{}).
+		Where("id = ? AND last_used_step < ?", mfa.ID, step).
+		Updates(map[string]interface{}{"last_used_step": step, "failed_attempts": 0, "locked_until": nil})
+	if result.Error != nil {
+		log.Printf("Error recording mfa success: %v", result.Error)
+		return false, result.Error
+	}
+
+	return result.RowsAffected > 0, nil
+}
+
+// RecordMFAFailure counts a failed two-factor authentication code, locking it until the given time if set.
+func (r *UserRepository) RecordMFAFailure(mfa *models.UserMFA, lockedUntil *time.Time) error {
+	updates := map[string]interface{}{"failed_attempts": gorm.Expr("failed_attempts + 1")}
+	if lockedUntil != nil {
+		updates["locked_until"] = *lockedUntil
+	}
+
+	if err := r.DB.Model(&models.UserMFA{}).Where("id = ?", mfa.ID).Updates(updates).Error; err != nil {
+		log.Printf("Error recording mfa failure: %v", err)
+		return err
+	}
+
+	return nil
+}
+
+// UseMFARecoveryCode uses up the recovery code of a user with the given hash and clears earlier failures.
+// It returns false when the user has no unused recovery code with the hash.
+func (r *UserRepository) UseMFARecoveryCode(mfa *models.UserMFA, codeHash string) (bool, error) {
+	tx := r.DB.Begin()
+
+	result := tx.Model(&models.MFARecoveryCode{}).
+		Where("user_id = ? AND code_hash = ? AND used_at IS NULL", mfa.UserID, codeHash).
+		Update("used_at", time.Now())
+	if result.Error != nil {
+		tx.Rollback()
+		log.Printf("Error using mfa recovery code: %v", result.Error)
+		return false, result.Error
+	}
+	if result.RowsAffected == 0 {
+		tx.Rollback()
+		return false, nil
+	}
+
+	err := tx.Model(&models.UserMFA{}).
+		Where("id = ?", mfa.ID).
+		Updates(map[string]interface{}{"failed_attempts": 0, "locked_until": nil}).Error
+	if err != nil {
+		tx.Rollback()
+		log.Printf("Error recording mfa success: %v", err)
+		return false, err
+	}
+
+	return true, tx.Commit().Error
+}
+
+// CountUnusedMFARecoveryCodes counts a user's recovery codes that haven't been used.
+func (r *UserRepository) CountUnusedMFARecoveryCodes(userID uint) (int, error) {
+	var count int
+	err := r.DB.Model(&models.MFARecoveryCode{}).
+		Where("user_id = ? AND used_at IS NULL", userID).
+		Count(&count).Error
+	if err != nil {
+		log.Printf("Error counting mfa recovery codes: %v", err)
+		return 0, err
+	}
+
+	return count, nil
+}
+
+// DeleteUserMFA permanently deletes a user's two-factor authentication and recovery codes.
+func (r *UserRepository) DeleteUserMFA(userID uint) error {
+	tx := r.DB.Begin()
+
+	for _, model := range []interface{}{&models.MFARecoveryCode{}, &models.UserMFA{}} {
+		if err := tx.Unscoped().Where("user_id = ?", userID).Delete(model).Error; err != nil {
+			tx.Rollback()
+			log.Printf("Error deleting user mfa: %v", err)
+			return err
+		}
+	}
+
+	return tx.Commit().Error
+}
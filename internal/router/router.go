@@ -1,6 +1,8 @@
 package router
 
 import (
+	"fmt"
+	"strings"
 	"time"
 
 	"github.com/gin-contrib/cors"
@@ -8,19 +10,36 @@ import (
 	"github.com/jinzhu/gorm"
 	"github.com/windoze95/saltybytes-api/internal/config"
 	"github.com/windoze95/saltybytes-api/internal/handlers"
+	"github.com/windoze95/saltybytes-api/internal/mailer"
 	"github.com/windoze95/saltybytes-api/internal/middleware"
+	"github.com/windoze95/saltybytes-api/internal/models"
+	"github.com/windoze95/saltybytes-api/internal/oidc"
 	"github.com/windoze95/saltybytes-api/internal/repository"
 	"github.com/windoze95/saltybytes-api/internal/service"
+	"github.com/windoze95/saltybytes-api/internal/util"
 )
 
-// SetupRouter sets up the Gin router.
-func SetupRouter(cfg *config.Config, database *gorm.DB) *gin.Engine {
+// SetupRouter sets up the Gin router. Returns an error when a service is misconfigured.
+func SetupRouter(cfg *config.Config, database *gorm.DB) (*gin.Engine, error) {
 	// Set Gin mode to release
 	gin.SetMode(gin.ReleaseMode)
 
 	// Create default Gin router
 	r := gin.Default()
 
+	// Only the proxies in the comma-separated TRUSTED_PROXIES may set the client IP through
+	// X-Forwarded-For, without any the IP of the connection is used, so clients can't spoof their IP
+	// to get around the rate limits and login throttling
+	var trustedProxies []string
+	for _, proxy := range strings.Split(cfg.Env.TrustedProxies.Value(), ",") {
+		if proxy = strings.TrimSpace(proxy); proxy != "" {
+			trustedProxies = append(trustedProxies, proxy)
+		}
+	}
+	if err := r.SetTrustedProxies(trustedProxies); err != nil {
+		return nil, fmt.Errorf("invalid trusted proxies: %w", err)
+	}
+
 	config := cors.DefaultConfig()
 	config.AllowCredentials = true
 	config.AllowOrigins = []string{
@@ -49,16 +68,68 @@ func SetupRouter(cfg *config.Config, database *gorm.DB) *gin.Engine {
 		})
 	})
 
+	// Auth-related routes setup
+	authRepo := repository.NewAuthRepository(database)
+	authService := service.NewAuthService(cfg, authRepo)
+	authHandler := handlers.NewAuthHandler(authService)
+
+	// Delete refresh tokens that can no longer be used and login attempts past their retention
+	authService.StartCleanupJob(24 * time.Hour)
+
 	// User-related routes setup
 	userRepo := repository.NewUserRepository(database)
-	userService := service.NewUserService(cfg, userRepo)
-	userHandler := handlers.NewUserHandler(userService)
+	if _, err := util.GetMFASecretCipherConfig(cfg.Env.MFAEncryptionKey.Value()); err != nil {
+		return nil, fmt.Errorf("invalid $MFAEncryptionKey: %w", err)
+	}
+	userMailer, err := mailer.New(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("failed to set up the mailer: %w", err)
+	}
+	identityProviders, err := oidc.ProvidersFromConfig(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("failed to set up the identity providers: %w", err)
+	}
+	userService := service.NewUserService(cfg, userRepo, userMailer, authService, identityProviders)
+	userHandler := handlers.NewUserHandler(userService, authService)
+
+	// Tag-related routes setup
+	tagRepo := repository.NewTagRepository(database)
+	tagService := service.NewTagService(cfg, tagRepo)
+	tagHandler := handlers.NewTagHandler(tagService)
+
+	// Prompt template setup
+	promptRepo := repository.NewPromptRepository(database)
+	promptService := service.NewPromptService(cfg, promptRepo)
 
 	// Recipe-related routes setup
 	recipeRepo := repository.NewRecipeRepository(database)
-	recipeService := service.NewRecipeService(cfg, recipeRepo)
+	recipeService := service.NewRecipeService(cfg, recipeRepo, tagService, promptService)
 	recipeHandler := handlers.NewRecipeHandler(recipeService)
 
+	// Permanently delete recipes that have been in the trash for too long
+	recipeService.StartTrashPurgeJob(1 * time.Hour)
+
+	// Embed the recipes whose embeddings are missing or out of date
+	recipeService.StartEmbeddingJob(10 * time.Minute)
+
+	// Saved recipe and collection-related routes setup
+	collectionRepo := repository.NewCollectionRepository(database)
+	collectionService := service.NewCollectionService(cfg, collectionRepo)
+	collectionHandler := handlers.NewCollectionHandler(collectionService)
+
+	// Account export and deletion-related routes setup
+	accountRepo := repository.NewAccountRepository(database)
+	accountService := service.NewAccountService(cfg, accountRepo, userService, recipeService, authService)
+	accountHandler := handlers.NewAccountHandler(accountService)
+
+	// Finish account deletions interrupted by a restart or a failure
+	accountService.ResumeAccountDeletions()
+
+	// Admin-related routes setup
+	adminRepo := repository.NewAdminRepository(database)
+	adminService := service.NewAdminService(cfg, adminRepo)
+	adminHandler := handlers.NewAdminHandler(adminService, tagService, promptService)
+
 	// Group for API routes that don't require token verification
 	apiPublic := r.Group("/v1")
 	{
@@ -68,19 +139,65 @@ func SetupRouter(cfg *config.Config, database *gorm.DB) *gin.Engine {
 		apiPublic.POST("/users", userHandler.CreateUser)
 		// Login a user
 		apiPublic.POST("/auth/login", userHandler.LoginUser)
+		// Exchange a refresh token for a new access token and refresh token
+		apiPublic.POST("/auth/refresh", authHandler.RefreshTokens)
+		// Logout a user, revoking the session of the refresh token
+		apiPublic.POST("/auth/logout", authHandler.Logout)
+		// Login or sign up a user with an ID token from an identity provider, like Google or Apple
+		apiPublic.POST("/auth/oauth/:provider", userHandler.LoginWithIdentity)
+		// Finish logging in with a two-factor authentication code
+		apiPublic.POST("/auth/mfa/verify", userHandler.VerifyMFA)
+		// Verify a user's email address with the token from a verification email
+		apiPublic.POST("/auth/email/verify", userHandler.ConfirmEmailVerification)
+		// Request a password reset email
+		apiPublic.POST("/auth/password/forgot", userHandler.RequestPasswordReset)
+		// Reset a user's password with the token from a password reset email
+		apiPublic.POST("/auth/password/reset", userHandler.ResetPassword)
+
+		// Get the status of an account deletion
+		apiPublic.GET("/account-deletions/:deletion_id", accountHandler.GetAccountDeletion)
+
+		// Tag-related routes
+
+		// Search tags by prefix, with usage counts
+		apiPublic.GET("/tags", tagHandler.SearchTags)
+		// Get the trending tags
+		apiPublic.GET("/tags/trending", tagHandler.GetTrendingTags)
+		// Get a page of recipes associated with a tag
+		apiPublic.GET("/tags/:hashtag/recipes", tagHandler.GetRecipesByTag)
+
+		// Collection-related routes
+
+		// Get a shared collection by its share slug
+		apiPublic.GET("/collections/shared/:share_slug", collectionHandler.GetSharedCollection)
+	}
+
+	// Group for API routes where token verification is optional,
+	// the user is attached to the context only when a valid token is provided
+	apiOptionalAuth := r.Group("/v1")
+	{
+		apiOptionalAuth.Use(middleware.OptionalVerifyTokenMiddleware(authService), middleware.AttachUserToContext(userService))
 
 		// Recipe-related routes
 
 		// Get a single recipe by it's ID
-		apiPublic.GET("/recipes/:recipe_id", recipeHandler.GetRecipe)
-		// Get a single recipe history by the recipe history's ID
-		apiPublic.GET("/recipes/chat-history/:history_id", recipeHandler.GetRecipeHistory)
+		apiOptionalAuth.GET("/recipes/:recipe_id", recipeHandler.GetRecipe)
+		// Get a single unlisted or public recipe by it's share slug
+		apiOptionalAuth.GET("/recipes/shared/:share_slug", recipeHandler.GetSharedRecipe)
+		// Get recipes similar to a recipe ("more like this")
+		apiOptionalAuth.GET("/recipes/similar/:recipe_id", recipeHandler.GetSimilarRecipes)
+		// Get the versions of a recipe
+		apiOptionalAuth.GET("/recipes/:recipe_id/versions", recipeHandler.GetRecipeVersions)
+		// Get the versions of a recipe as a tree of variations
+		apiOptionalAuth.GET("/recipes/:recipe_id/versions/tree", recipeHandler.GetRecipeVersionTree)
+		// Compare two versions of a recipe
+		apiOptionalAuth.GET("/recipes/:recipe_id/versions/:from_version/diff/:to_version", recipeHandler.DiffRecipeVersions)
 	}
 
 	// Group for API routes that require token verification
 	apiProtected := r.Group("/v1")
 	{
-		apiProtected.Use(middleware.VerifyTokenMiddleware(cfg))
+		apiProtected.Use(middleware.VerifyTokenMiddleware(authService))
 
 		// User-related routes
 
@@ -90,13 +207,61 @@ func SetupRouter(cfg *config.Config, database *gorm.DB) *gin.Engine {
 		apiProtected.GET("/users/me", middleware.AttachUserToContext(userService), userHandler.GetUserByID)
 		// Get a user's settings
 		apiProtected.GET("/users/settings", middleware.AttachUserToContext(userService), userHandler.GetUserSettings)
+		// Change the user's settings
+		apiProtected.PATCH("/users/settings", middleware.AttachUserToContext(userService), userHandler.UpdateSettings)
+		// Change the user's first name, email or username
+		apiProtected.PATCH("/users/me", middleware.AttachUserToContext(userService), userHandler.UpdateProfile)
+		// Change the user's password
+		apiProtected.PUT("/users/me/password", middleware.AttachUserToContext(userService), userHandler.ChangePassword)
+		// Export all of the user's data as a zip
+		apiProtected.GET("/users/me/export", middleware.AttachUserToContext(userService), accountHandler.ExportAccount)
+		// Delete the user's account in the background
+		apiProtected.DELETE("/users/me", middleware.AttachUserToContext(userService), accountHandler.DeleteAccount)
+		// Get the identities linked to the user
+		apiProtected.GET("/users/me/identities", middleware.AttachUserToContext(userService), userHandler.GetIdentities)
+		// Link an identity from an identity provider to the user
+		apiProtected.POST("/users/me/identities/:provider", middleware.AttachUserToContext(userService), userHandler.LinkIdentity)
+		// Unlink an identity from the user
+		apiProtected.DELETE("/users/me/identities/:identity_id", middleware.AttachUserToContext(userService), userHandler.UnlinkIdentity)
+		// Get the user's two-factor authentication status
+		apiProtected.GET("/users/me/mfa", middleware.AttachUserToContext(userService), userHandler.GetMFAStatus)
+		// Start enrolling the user in TOTP two-factor authentication
+		apiProtected.POST("/users/me/mfa/totp", middleware.AttachUserToContext(userService), userHandler.StartTOTPEnrollment)
+		// Confirm the user's TOTP enrollment and get their recovery codes
+		apiProtected.POST("/users/me/mfa/totp/confirm", middleware.AttachUserToContext(userService), userHandler.ConfirmTOTPEnrollment)
+		// Disable the user's TOTP two-factor authentication
+		apiProtected.DELETE("/users/me/mfa/totp", middleware.AttachUserToContext(userService), userHandler.DisableTOTP)
+		// Regenerate the user's recovery codes
+		apiProtected.POST("/users/me/mfa/recovery-codes", middleware.AttachUserToContext(userService), userHandler.RegenerateRecoveryCodes)
+		// Request an email to verify the user's email address
+		apiProtected.POST("/auth/email/verification", middleware.AttachUserToContext(userService), userHandler.RequestEmailVerification)
+		// Get the recipes created or collected by the user
+		apiProtected.GET("/users/me/recipes", middleware.AttachUserToContext(userService), recipeHandler.GetUserRecipes)
+		// Get the user's personalization settings
+		apiProtected.GET("/users/me/personalization", middleware.AttachUserToContext(userService), userHandler.GetPersonalization)
+		// Replace the user's personalization settings
+		apiProtected.PUT("/users/me/personalization", middleware.AttachUserToContext(userService), userHandler.UpdatePersonalization)
 
 		// Recipe-related routes
 
 		// // Get a single recipe by it's ID
 		// apiProtected.GET("/recipes/:recipe_id", recipeHandler.GetRecipe)
+		// Get a single recipe history by the recipe history's ID
+		apiProtected.GET("/recipes/chat-history/:history_id", middleware.AttachUserToContext(userService), recipeHandler.GetRecipeHistory)
+		// Change who can see a recipe
+		apiProtected.PATCH("/recipes/:recipe_id/visibility", middleware.AttachUserToContext(userService), recipeHandler.UpdateRecipeVisibility)
+		// Restore an older version of a recipe as the active version
+		apiProtected.POST("/recipes/:recipe_id/versions/:version/activate", middleware.AttachUserToContext(userService), recipeHandler.ActivateRecipeVersion)
+		// Move a recipe to the trash
+		apiProtected.DELETE("/recipes/:recipe_id", middleware.AttachUserToContext(userService), recipeHandler.DeleteRecipe)
+		// Get the user's deleted recipes that can still be restored
+		apiProtected.GET("/recipes/trash", middleware.AttachUserToContext(userService), recipeHandler.GetTrash)
+		// Restore a recipe from the trash
+		apiProtected.POST("/recipes/:recipe_id/restore", middleware.AttachUserToContext(userService), recipeHandler.RestoreRecipe)
 		// Generate a new recipe
 		apiProtected.POST("/recipes/chat", middleware.AttachUserToContext(userService), recipeHandler.GenerateRecipeWithChat)
+		// Regenerate a recipe from its active version or an older one
+		apiProtected.POST("/recipes/:recipe_id/regenerate", middleware.AttachUserToContext(userService), recipeHandler.RegenerateRecipeWithChat)
 		// Import a recipe with a link
 		// apiProtected.POST("/recipes/import/link", middleware.AttachUserToContext(userService), recipeHandler.ImportRecipeLink)
 		// Import a recipe with vision
@@ -107,7 +272,98 @@ func SetupRouter(cfg *config.Config, database *gorm.DB) *gin.Engine {
 		// apiProtected.POST("/recipes/manual", middleware.AttachUserToContext(userService), recipeHandler.ManualEntryRecipe)
 		// Copycat a recipe
 		// apiProtected.POST("/recipes/copycat", middleware.AttachUserToContext(userService), recipeHandler.CopycatRecipe)
+		// Save a recipe
+		apiProtected.POST("/recipes/:recipe_id/save", middleware.AttachUserToContext(userService), collectionHandler.SaveRecipe)
+		// Save a recipe through its share slug
+		apiProtected.POST("/recipes/shared/:share_slug/save", middleware.AttachUserToContext(userService), collectionHandler.SaveSharedRecipe)
+		// Unsave a recipe
+		apiProtected.DELETE("/recipes/:recipe_id/save", middleware.AttachUserToContext(userService), collectionHandler.UnsaveRecipe)
+
+		// Collection-related routes
+
+		// Get the user's collections
+		apiProtected.GET("/collections", middleware.AttachUserToContext(userService), collectionHandler.GetCollections)
+		// Create a collection
+		apiProtected.POST("/collections", middleware.AttachUserToContext(userService), collectionHandler.CreateCollection)
+		// Set the order of the user's collections
+		apiProtected.PUT("/collections/order", middleware.AttachUserToContext(userService), collectionHandler.ReorderCollections)
+		// Get a collection with its recipes
+		apiProtected.GET("/collections/:collection_id", middleware.AttachUserToContext(userService), collectionHandler.GetCollection)
+		// Rename a collection or turn its sharing on or off
+		apiProtected.PATCH("/collections/:collection_id", middleware.AttachUserToContext(userService), collectionHandler.UpdateCollection)
+		// Delete a collection
+		apiProtected.DELETE("/collections/:collection_id", middleware.AttachUserToContext(userService), collectionHandler.DeleteCollection)
+		// Add a recipe to a collection
+		apiProtected.POST("/collections/:collection_id/recipes", middleware.AttachUserToContext(userService), collectionHandler.AddRecipeToCollection)
+		// Set the order of the recipes in a collection
+		apiProtected.PUT("/collections/:collection_id/recipes/order", middleware.AttachUserToContext(userService), collectionHandler.ReorderCollectionRecipes)
+		// Remove a recipe from a collection
+		apiProtected.DELETE("/collections/:collection_id/recipes/:recipe_id", middleware.AttachUserToContext(userService), collectionHandler.RemoveRecipeFromCollection)
+	}
+
+	// Group for admin API routes, open to moderators and admins,
+	// the routes only admins may use also require the admin role
+	apiAdmin := r.Group("/v1/admin")
+	{
+		apiAdmin.Use(middleware.VerifyTokenMiddleware(authService), middleware.AttachUserToContext(userService), middleware.RequireRole(models.RoleModerator))
+
+		// User-related routes
+
+		// Search users by ID, username or email
+		apiAdmin.GET("/users", adminHandler.SearchUsers)
+		// Get a user with their subscription
+		apiAdmin.GET("/users/:user_id", adminHandler.GetUser)
+		// Change a user's role
+		apiAdmin.PUT("/users/:user_id/role", middleware.RequireRole(models.RoleAdmin), adminHandler.UpdateUserRole)
+		// Change a user's subscription tier, expiry or remaining tokens
+		apiAdmin.PATCH("/users/:user_id/subscription", middleware.RequireRole(models.RoleAdmin), adminHandler.UpdateSubscription)
+		// Get the forbidden usernames
+		apiAdmin.GET("/forbidden-usernames", middleware.RequireRole(models.RoleAdmin), adminHandler.GetForbiddenUsernames)
+		// Forbid a username
+		apiAdmin.POST("/forbidden-usernames", middleware.RequireRole(models.RoleAdmin), adminHandler.AddForbiddenUsername)
+		// Allow a forbidden username again
+		apiAdmin.DELETE("/forbidden-usernames/:username_id", middleware.RequireRole(models.RoleAdmin), adminHandler.RemoveForbiddenUsername)
+
+		// Prompt-related routes
+
+		// Get the versions of the prompt templates
+		apiAdmin.GET("/prompts", middleware.RequireRole(models.RoleAdmin), adminHandler.GetPromptTemplates)
+		// Create the next version of a prompt template
+		apiAdmin.POST("/prompts", middleware.RequireRole(models.RoleAdmin), adminHandler.CreatePromptTemplate)
+		// Change the weight of a prompt template version in its experiment
+		apiAdmin.PUT("/prompts/:template_id/weight", middleware.RequireRole(models.RoleAdmin), adminHandler.UpdatePromptTemplateWeight)
+		// Get the outcomes of every version of a prompt
+		apiAdmin.GET("/prompts/report", middleware.RequireRole(models.RoleAdmin), adminHandler.GetPromptReport)
+
+		// Recipe-related routes
+
+		// Get the hidden recipes
+		apiAdmin.GET("/recipes/hidden", adminHandler.GetHiddenRecipes)
+		// Hide a recipe from everyone but its creator
+		apiAdmin.POST("/recipes/:recipe_id/hide", adminHandler.HideRecipe)
+		// Make a hidden recipe visible again
+		apiAdmin.POST("/recipes/:recipe_id/restore", adminHandler.RestoreRecipe)
+
+		// Moderation-related routes
+
+		// Get the recipes flagged by automatic moderation
+		apiAdmin.GET("/moderation/flags", adminHandler.GetModerationFlags)
+		// Approve a flagged recipe, making it visible again
+		apiAdmin.POST("/moderation/flags/:flag_id/approve", adminHandler.ApproveModerationFlag)
+		// Reject a flagged recipe, keeping it hidden
+		apiAdmin.POST("/moderation/flags/:flag_id/reject", adminHandler.RejectModerationFlag)
+
+		// Tag-related routes
+
+		// Get the tag aliases
+		apiAdmin.GET("/tag-aliases", adminHandler.GetTagAliases)
+		// Make an alias resolve to a canonical tag
+		apiAdmin.POST("/tag-aliases", adminHandler.CreateTagAlias)
+		// Delete a tag alias
+		apiAdmin.DELETE("/tag-aliases/:alias_id", adminHandler.DeleteTagAlias)
+		// Merge every tag into its normalized form
+		apiAdmin.POST("/tags/merge-duplicates", adminHandler.MergeDuplicateTags)
 	}
 
-	return r
+	return r, nil
 }
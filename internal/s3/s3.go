@@ -5,6 +5,7 @@ import (
 	"fmt"
 
 	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
 	"github.com/aws/aws-sdk-go/aws/credentials"
 	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/s3"
@@ -33,7 +34,7 @@ func UploadRecipeImageToS3(cfg *config.Config, imgBytes []byte, s3Key string) (s
 	return result.Location, nil
 }
 
-// DeleteRecipeImageFromS3 deletes a given image from an S3 bucket.
+// DeleteRecipeImageFromS3 deletes a given image from an S3 bucket. An image that doesn't exist counts as deleted.
 func DeleteRecipeImageFromS3(cfg *config.Config, s3Key string) error {
 	sess := session.Must(session.NewSession(&aws.Config{
 		Region:      aws.String(cfg.Env.AWSRegion.Value()),
@@ -46,6 +47,9 @@ func DeleteRecipeImageFromS3(cfg *config.Config, s3Key string) error {
 		Bucket: aws.String(cfg.Env.S3Bucket.Value()),
 		Key:    aws.String(s3Key),
 	})
+	if aerr, ok := err.(awserr.Error); ok && (aerr.Code() == s3.ErrCodeNoSuchKey || aerr.Code() == "NotFound") {
+		return nil
+	}
 	if err != nil {
 		return fmt.Errorf("failed to delete from S3: %v", err)
 	}
@@ -53,6 +57,27 @@ func DeleteRecipeImageFromS3(cfg *config.Config, s3Key string) error {
 	return nil
 }
 
+// GetRecipeImageFromS3 downloads a given image from an S3 bucket.
+func GetRecipeImageFromS3(cfg *config.Config, s3Key string) ([]byte, error) {
+	sess := session.Must(session.NewSession(&aws.Config{
+		Region:      aws.String(cfg.Env.AWSRegion.Value()),
+		Credentials: credentials.NewStaticCredentials(cfg.Env.AWSAccessKeyID.Value(), cfg.Env.AWSSecretAccessKey.Value(), ""),
+	}))
+
+	downloader := s3manager.NewDownloader(sess)
+
+	buf := aws.NewWriteAtBuffer([]byte{})
+	_, err := downloader.Download(buf, &s3.GetObjectInput{
+		Bucket: aws.String(cfg.Env.S3Bucket.Value()),
+		Key:    aws.String(s3Key),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to download from S3: %v", err)
+	}
+
+	return buf.Bytes(), nil
+}
+
 // GenerateS3Key generates the S3 key for a recipe image, given the recipe ID.
 func GenerateS3Key(recipeID uint) string {
 	return fmt.Sprintf("recipes/%d/images/recipe_image_%d.jpg", recipeID, recipeID)
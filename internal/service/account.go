@@ -0,0 +1,332 @@
+package service
+
+import (
+	"archive/zip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/windoze95/saltybytes-api/internal/config"
+	"github.com/windoze95/saltybytes-api/internal/models"
+	"github.com/windoze95/saltybytes-api/internal/repository"
+	"github.com/windoze95/saltybytes-api/internal/s3"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// AccountService is the business logic layer for exporting and deleting a user's account.
+type AccountService struct {
+	Cfg           *config.Config
+	Repo          *repository.AccountRepository
+	UserService   *UserService
+	RecipeService *RecipeService
+	AuthService   *AuthService
+}
+
+// AccountDeletionResponse is the response object for the status of an account deletion.
+type AccountDeletionResponse struct {
+	ID           string                       `json:"id"`
+	Status       models.AccountDeletionStatus `json:"status"`
+	RecipeAction models.RecipeDeletionAction  `json:"recipe_action"`
+	RequestedAt  time.Time                    `json:"requested_at"`
+	CompletedAt  *time.Time                   `json:"completed_at"`
+}
+
+// exportProfile is the profile of a user in their data export.
+type exportProfile struct {
+	*UserResponse
+	CreatedAt    time.Time            `json:"created_at"`
+	Subscription *models.Subscription `json:"subscription"`
+	Identities   []*IdentityResponse  `json:"identities"`
+}
+
+// exportRecipe is a recipe in a user's data export, with its full history.
+type exportRecipe struct {
+	Recipe    *RecipeResponse      `json:"recipe"`
+	DeletedAt *time.Time           `json:"deleted_at"`
+	History   []exportHistoryEntry `json:"history"`
+}
+
+// exportHistoryEntry is a version of a recipe in a user's data export.
+type exportHistoryEntry struct {
+	RecipeVersionResponse
+	Recipe *models.RecipeDef `json:"recipe"`
+}
+
+// exportCollection is a collection in a user's data export.
+type exportCollection struct {
+	Name      string `json:"name"`
+	Shared    bool   `json:"shared"`
+	RecipeIDs []uint `json:"recipe_ids"`
+}
+
+// NewAccountService is the constructor function for initializing a new AccountService.
+func NewAccountService(cfg *config.Config, repo *repository.AccountRepository, userService *UserService, recipeService *RecipeService, authService *AuthService) *AccountService {
+	return &AccountService{
+		Cfg:           cfg,
+		Repo:          repo,
+		UserService:   userService,
+		RecipeService: recipeService,
+		AuthService:   authService,
+	}
+}
+
+// WriteExport writes a zip of all of a user's data: their profile, personalization and settings,
+// every recipe they created with its full history and image, their saved recipes and their collections.
+func (s *AccountService) WriteExport(user *models.User, w io.Writer) error {
+	identities, err := s.UserService.GetIdentities(user)
+	if err != nil {
+		return err
+	}
+
+	recipes, err := s.Repo.GetExportRecipes(user.ID)
+	if err != nil {
+		return err
+	}
+
+	collections, err := s.Repo.GetExportCollections(user.ID)
+	if err != nil {
+		return err
+	}
+
+	savedRecipeIDs, err := s.Repo.GetSavedRecipeIDs(user.ID)
+	if err != nil {
+		return err
+	}
+
+	zw := zip.NewWriter(w)
+
+	profile := exportProfile{
+		UserResponse: toUserResponse(user),
+		CreatedAt:    user.CreatedAt,
+		Subscription: user.Subscription,
+		Identities:   identities,
+	}
+	if err := writeZipJSON(zw, "profile.json", profile); err != nil {
+		return err
+	}
+
+	var personalization *PersonalizationResponse
+	if user.Personalization != nil {
+		personalization = toPersonalizationResponse(user.Personalization)
+	}
+	if err := writeZipJSON(zw, "personalization.json", personalization); err != nil {
+		return err
+	}
+
+	if err := writeZipJSON(zw, "settings.json", user.Settings); err != nil {
+		return err
+	}
+
+	for i := range recipes {
+		recipe := &recipes[i]
+		dir := fmt.Sprintf("recipes/%d/", recipe.ID)
+
+		if err := writeZipJSON(zw, dir+"recipe.json", toExportRecipe(recipe, user)); err != nil {
+			return err
+		}
+
+		if recipe.ImageURL == "" {
+			continue
+		}
+		image, err := s3.GetRecipeImageFromS3(s.Cfg, s3.GenerateS3Key(recipe.ID))
+		if err != nil {
+			// A missing image shouldn't stop the user from getting the rest of their data
+			log.Printf("error: failed to export image of recipe %d: %v", recipe.ID, err)
+			continue
+		}
+		f, err := zw.Create(dir + "image.jpg")
+		if err != nil {
+			return err
+		}
+		if _, err := f.Write(image); err != nil {
+			return err
+		}
+	}
+
+	exportCollections := make([]exportCollection, 0, len(collections))
+	for _, collection := range collections {
+		recipeIDs := make([]uint, 0, len(collection.Recipes))
+		for _, collectionRecipe := range collection.Recipes {
+			recipeIDs = append(recipeIDs, collectionRecipe.RecipeID)
+		}
+		exportCollections = append(exportCollections, exportCollection{
+			Name:      collection.Name,
+			Shared:    collection.IsShared,
+			RecipeIDs: recipeIDs,
+		})
+	}
+	if err := writeZipJSON(zw, "collections.json", exportCollections); err != nil {
+		return err
+	}
+
+	if err := writeZipJSON(zw, "saved_recipes.json", savedRecipeIDs); err != nil {
+		return err
+	}
+
+	return zw.Close()
+}
+
+// RequestAccountDeletion logs a user out everywhere and starts deleting their account in the background.
+// Users with a password have to confirm it. Requesting deletion again returns the deletion in progress.
+func (s *AccountService) RequestAccountDeletion(user *models.User, action models.RecipeDeletionAction, password string) (*AccountDeletionResponse, error) {
+	if !models.IsValidRecipeDeletionAction(action) {
+		return nil, fmt.Errorf("unknown recipe action: %s", action)
+	}
+
+	auth, err := s.UserService.Repo.GetUserAuthByUserID(user.ID)
+	if err != nil {
+		return nil, err
+	}
+	if auth.HashedPassword != "" {
+		if err := bcrypt.CompareHashAndPassword([]byte(auth.HashedPassword), []byte(password)); err != nil {
+			return nil, ErrIncorrectPassword
+		}
+	}
+
+	job, err := s.Repo.GetUnfinishedAccountDeletionJobByUserID(user.ID)
+	if err == nil {
+		return toAccountDeletionResponse(job), nil
+	}
+	if _, ok := err.(repository.NotFoundError); !ok {
+		return nil, err
+	}
+
+	job = &models.AccountDeletionJob{
+		PublicID:     uuid.New().String(),
+		UserID:       user.ID,
+		RecipeAction: action,
+		Status:       models.AccountDeletionPending,
+	}
+	if err := s.Repo.CreateAccountDeletionJob(job); err != nil {
+		return nil, err
+	}
+
+	if err := s.AuthService.RevokeUserSessions(user.ID); err != nil {
+		log.Printf("error: failed to revoke sessions of user %d before deletion: %v", user.ID, err)
+	}
+
+	go s.runAccountDeletion(job)
+
+	return toAccountDeletionResponse(job), nil
+}
+
+// GetAccountDeletion fetches the status of an account deletion by its ID.
+func (s *AccountService) GetAccountDeletion(publicID string) (*AccountDeletionResponse, error) {
+	job, err := s.Repo.GetAccountDeletionJobByPublicID(publicID)
+	if err != nil {
+		return nil, err
+	}
+
+	return toAccountDeletionResponse(job), nil
+}
+
+// ResumeAccountDeletions runs the account deletions that didn't complete, e.g. because the API restarted
+// or a step failed, one after another in the background. Every step can safely be run again.
+func (s *AccountService) ResumeAccountDeletions() {
+	go func() {
+		jobs, err := s.Repo.GetUnfinishedAccountDeletionJobs()
+		if err != nil {
+			log.Printf("error: failed to resume account deletions: %v", err)
+			return
+		}
+
+		for i := range jobs {
+			s.runAccountDeletion(&jobs[i])
+		}
+	}()
+}
+
+// runAccountDeletion purges or anonymizes a user's recipes, along with their stored images,
+// then deletes the rest of their data, recording the job's progress as it goes.
+func (s *AccountService) runAccountDeletion(job *models.AccountDeletionJob) {
+	if err := s.Repo.UpdateAccountDeletionJobStatus(job, models.AccountDeletionRunning, ""); err != nil {
+		return
+	}
+
+	if err := s.deleteAccount(job); err != nil {
+		log.Printf("error: failed to delete account of user %d: %v", job.UserID, err)
+		s.Repo.UpdateAccountDeletionJobStatus(job, models.AccountDeletionFailed, err.Error())
+		return
+	}
+
+	if err := s.Repo.UpdateAccountDeletionJobStatus(job, models.AccountDeletionCompleted, ""); err != nil {
+		return
+	}
+	log.Printf("deleted account of user %d", job.UserID)
+}
+
+// deleteAccount does the work of an account deletion job.
+func (s *AccountService) deleteAccount(job *models.AccountDeletionJob) error {
+	recipeIDs, err := s.Repo.GetRecipeIDsForAccountDeletion(job.UserID, job.RecipeAction)
+	if err != nil {
+		return err
+	}
+
+	for _, recipeID := range recipeIDs {
+		if err := s.RecipeService.PurgeRecipe(recipeID); err != nil {
+			var notFound repository.NotFoundError
+			if !errors.As(err, &notFound) {
+				return err
+			}
+		}
+	}
+
+	if job.RecipeAction == models.RecipeDeletionAnonymize {
+		if err := s.Repo.AnonymizeUserRecipes(job.UserID); err != nil {
+			return err
+		}
+	}
+
+	return s.Repo.DeleteUserData(job.UserID)
+}
+
+// toExportRecipe converts a Recipe to the form it takes in a data export.
+func toExportRecipe(recipe *models.Recipe, user *models.User) exportRecipe {
+	// The recipes are the user's own, so CreatedBy isn't preloaded
+	recipe.CreatedBy = user
+
+	exported := exportRecipe{
+		Recipe:    toRecipeResponseForViewer(recipe, user),
+		DeletedAt: recipe.DeletedAt,
+		History:   []exportHistoryEntry{},
+	}
+
+	if recipe.History != nil {
+		for i := range recipe.History.Entries {
+			entry := &recipe.History.Entries[i]
+			exported.History = append(exported.History, exportHistoryEntry{
+				RecipeVersionResponse: toRecipeVersionResponse(entry, recipe.History.ActiveEntryID),
+				Recipe:                entry.RecipeResponse,
+			})
+		}
+	}
+
+	return exported
+}
+
+// toAccountDeletionResponse converts an AccountDeletionJob to an AccountDeletionResponse.
+func toAccountDeletionResponse(job *models.AccountDeletionJob) *AccountDeletionResponse {
+	return &AccountDeletionResponse{
+		ID:           job.PublicID,
+		Status:       job.Status,
+		RecipeAction: job.RecipeAction,
+		RequestedAt:  job.CreatedAt,
+		CompletedAt:  job.CompletedAt,
+	}
+}
+
+// writeZipJSON writes a value as an indented JSON file to a zip.
+func writeZipJSON(zw *zip.Writer, name string, v interface{}) error {
+	f, err := zw.Create(name)
+	if err != nil {
+		return err
+	}
+
+	encoder := json.NewEncoder(f)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(v)
+}
@@ -0,0 +1,380 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/asaskevich/govalidator"
+	"github.com/windoze95/saltybytes-api/internal/config"
+	"github.com/windoze95/saltybytes-api/internal/models"
+	"github.com/windoze95/saltybytes-api/internal/repository"
+)
+
+var (
+	// ErrInvalidRole is returned for roles that don't exist.
+	ErrInvalidRole = errors.New("invalid role")
+	// ErrCannotChangeOwnRole is returned when an admin changes their own role, which could leave no admin.
+	ErrCannotChangeOwnRole = errors.New("admins cannot change their own role")
+	// ErrInvalidSubscriptionTier is returned for subscription tiers that don't exist.
+	ErrInvalidSubscriptionTier = errors.New("invalid subscription tier")
+	// ErrInvalidRemainingTokens is returned when setting a negative number of remaining tokens.
+	ErrInvalidRemainingTokens = errors.New("remaining tokens cannot be negative")
+	// ErrInvalidModerationFlagStatus is returned for moderation flag statuses that don't exist.
+	ErrInvalidModerationFlagStatus = errors.New("invalid moderation flag status")
+)
+
+// AdminService is the business logic layer for the moderation and support operations of the admin API.
+type AdminService struct {
+	Cfg  *config.Config
+	Repo *repository.AdminRepository
+}
+
+// AdminUserResponse is the response object for a user looked up through the admin API.
+type AdminUserResponse struct {
+	*UserResponse
+	AuthType     models.UserAuthType   `json:"auth_type"`
+	CreatedAt    time.Time             `json:"created_at"`
+	Subscription *SubscriptionResponse `json:"subscription"`
+}
+
+// AdminUsersResponse is the response object for a page of users looked up through the admin API.
+type AdminUsersResponse struct {
+	Users    []*AdminUserResponse `json:"users"`
+	Page     int                  `json:"page"`
+	PageSize int                  `json:"page_size"`
+	Total    int                  `json:"total"`
+}
+
+// SubscriptionResponse is the response object for a user's subscription.
+type SubscriptionResponse struct {
+	Tier            models.SubscriptionTier `json:"tier"`
+	ExpiresAt       time.Time               `json:"expires_at"`
+	RemainingTokens int                     `json:"remaining_tokens"`
+}
+
+// SubscriptionUpdate holds the changes to a user's subscription, nil fields are left unchanged.
+type SubscriptionUpdate struct {
+	Tier            *models.SubscriptionTier `json:"tier"`
+	ExpiresAt       *time.Time               `json:"expires_at"`
+	RemainingTokens *int                     `json:"remaining_tokens"`
+}
+
+// HiddenRecipeResponse is the response object for a recipe a moderator hid.
+type HiddenRecipeResponse struct {
+	*RecipeResponse
+	HiddenAt     *time.Time `json:"hidden_at"`
+	HiddenByID   *uint      `json:"hidden_by_id"`
+	HiddenReason string     `json:"hidden_reason"`
+}
+
+// HiddenRecipesResponse is the response object for a page of hidden recipes.
+type HiddenRecipesResponse struct {
+	Recipes  []*HiddenRecipeResponse `json:"recipes"`
+	Page     int                     `json:"page"`
+	PageSize int                     `json:"page_size"`
+	Total    int                     `json:"total"`
+}
+
+// ModerationFlagResponse is the response object for a recipe flagged by automatic moderation.
+type ModerationFlagResponse struct {
+	ID           uint                        `json:"ID"`
+	RecipeID     uint                        `json:"recipe_id"`
+	UserID       uint                        `json:"user_id"`
+	Moderator    string                      `json:"moderator"`
+	Categories   []string                    `json:"categories"`
+	Content      string                      `json:"content"`
+	Status       models.ModerationFlagStatus `json:"status"`
+	ReviewedByID *uint                       `json:"reviewed_by_id"`
+	ReviewedAt   *time.Time                  `json:"reviewed_at"`
+	CreatedAt    time.Time                   `json:"created_at"`
+}
+
+// ModerationFlagsResponse is the response object for a page of moderation flags.
+type ModerationFlagsResponse struct {
+	Flags    []ModerationFlagResponse `json:"flags"`
+	Page     int                      `json:"page"`
+	PageSize int                      `json:"page_size"`
+	Total    int                      `json:"total"`
+}
+
+// ForbiddenUsernameResponse is the response object for a forbidden username.
+type ForbiddenUsernameResponse struct {
+	ID        uint      `json:"ID"`
+	Username  string    `json:"username"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// NewAdminService is the constructor function for initializing a new AdminService.
+func NewAdminService(cfg *config.Config, repo *repository.AdminRepository) *AdminService {
+	return &AdminService{
+		Cfg:  cfg,
+		Repo: repo,
+	}
+}
+
+// SearchUsers fetches a page of users whose ID matches the query, or whose username or email contains it.
+func (s *AdminService) SearchUsers(query string, page, pageSize int) (*AdminUsersResponse, error) {
+	users, total, err := s.Repo.SearchUsers(query, (page-1)*pageSize, pageSize)
+	if err != nil {
+		return nil, err
+	}
+
+	userResponses := make([]*AdminUserResponse, 0, len(users))
+	for i := range users {
+		userResponses = append(userResponses, toAdminUserResponse(&users[i]))
+	}
+
+	return &AdminUsersResponse{
+		Users:    userResponses,
+		Page:     page,
+		PageSize: pageSize,
+		Total:    total,
+	}, nil
+}
+
+// GetUser fetches a user with their subscription.
+func (s *AdminService) GetUser(userID uint) (*AdminUserResponse, error) {
+	user, err := s.Repo.GetUser(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	return toAdminUserResponse(user), nil
+}
+
+// UpdateUserRole changes the role of a user. Admins can't change their own role.
+func (s *AdminService) UpdateUserRole(admin *models.User, userID uint, role models.UserRole) (*AdminUserResponse, error) {
+	if !models.IsValidUserRole(role) {
+		return nil, ErrInvalidRole
+	}
+	if admin.ID == userID {
+		return nil, ErrCannotChangeOwnRole
+	}
+
+	if err := s.Repo.UpdateUserRole(userID, role); err != nil {
+		return nil, err
+	}
+	log.Printf("admin: user %d set the role of user %d to %s", admin.ID, userID, role)
+
+	return s.GetUser(userID)
+}
+
+// UpdateSubscription changes the tier, expiry or remaining tokens of a user's subscription.
+func (s *AdminService) UpdateSubscription(admin *models.User, userID uint, update SubscriptionUpdate) (*AdminUserResponse, error) {
+	user, err := s.Repo.GetUser(userID)
+	if err != nil {
+		return nil, err
+	}
+	if user.Subscription == nil {
+		return nil, repository.NewNotFoundError("Subscription not found")
+	}
+
+	updates := make(map[string]interface{})
+	if update.Tier != nil {
+		if !(&models.Subscription{SubscriptionTier: *update.Tier}).IsValidSubscriptionTier() {
+			return nil, ErrInvalidSubscriptionTier
+		}
+		updates["subscription_tier"] = *update.Tier
+	}
+	if update.ExpiresAt != nil {
+		updates["expires_at"] = *update.ExpiresAt
+	}
+	if update.RemainingTokens != nil {
+		if *update.RemainingTokens < 0 {
+			return nil, ErrInvalidRemainingTokens
+		}
+		updates["remaining_tokens"] = *update.RemainingTokens
+	}
+
+	if len(updates) > 0 {
+		if err := s.Repo.UpdateSubscription(user.Subscription, updates); err != nil {
+			return nil, err
+		}
+		log.Printf("admin: user %d updated the subscription of user %d: %v", admin.ID, userID, updates)
+	}
+
+	return toAdminUserResponse(user), nil
+}
+
+// HideRecipe hides a recipe from everyone but its creator.
+func (s *AdminService) HideRecipe(moderator *models.User, recipeID uint, reason string) error {
+	if err := s.Repo.HideRecipe(recipeID, moderator.ID, strings.TrimSpace(reason)); err != nil {
+		return err
+	}
+	log.Printf("admin: user %d hid recipe %d: %s", moderator.ID, recipeID, reason)
+
+	return nil
+}
+
+// RestoreRecipe makes a hidden recipe visible again according to its visibility.
+func (s *AdminService) RestoreRecipe(moderator *models.User, recipeID uint) error {
+	if err := s.Repo.RestoreHiddenRecipe(recipeID); err != nil {
+		return err
+	}
+	log.Printf("admin: user %d restored hidden recipe %d", moderator.ID, recipeID)
+
+	return nil
+}
+
+// GetHiddenRecipes fetches a page of hidden recipes, most recently hidden first.
+func (s *AdminService) GetHiddenRecipes(page, pageSize int) (*HiddenRecipesResponse, error) {
+	recipes, total, err := s.Repo.GetHiddenRecipes((page-1)*pageSize, pageSize)
+	if err != nil {
+		return nil, err
+	}
+
+	recipeResponses := make([]*HiddenRecipeResponse, 0, len(recipes))
+	for i := range recipes {
+		recipe := &recipes[i]
+		recipeResponses = append(recipeResponses, &HiddenRecipeResponse{
+			RecipeResponse: toRecipeResponse(recipe),
+			HiddenAt:       recipe.HiddenAt,
+			HiddenByID:     recipe.HiddenByID,
+			HiddenReason:   recipe.HiddenReason,
+		})
+	}
+
+	return &HiddenRecipesResponse{
+		Recipes:  recipeResponses,
+		Page:     page,
+		PageSize: pageSize,
+		Total:    total,
+	}, nil
+}
+
+// GetModerationFlags fetches a page of moderation flags with a status, oldest first.
+// An empty status fetches the flags waiting for review.
+func (s *AdminService) GetModerationFlags(status models.ModerationFlagStatus, page, pageSize int) (*ModerationFlagsResponse, error) {
+	if status == "" {
+		status = models.ModerationFlagPending
+	}
+	if !models.IsValidModerationFlagStatus(status) {
+		return nil, ErrInvalidModerationFlagStatus
+	}
+
+	flags, total, err := s.Repo.GetModerationFlags(status, (page-1)*pageSize, pageSize)
+	if err != nil {
+		return nil, err
+	}
+
+	flagResponses := make([]ModerationFlagResponse, 0, len(flags))
+	for i := range flags {
+		flagResponses = append(flagResponses, toModerationFlagResponse(&flags[i]))
+	}
+
+	return &ModerationFlagsResponse{
+		Flags:    flagResponses,
+		Page:     page,
+		PageSize: pageSize,
+		Total:    total,
+	}, nil
+}
+
+// ResolveModerationFlag approves or rejects a pending moderation flag. Approving it makes the recipe
+// visible again once it has no other pending flags, rejecting it keeps the recipe hidden.
+func (s *AdminService) ResolveModerationFlag(moderator *models.User, flagID uint, status models.ModerationFlagStatus) (*ModerationFlagResponse, error) {
+	if status != models.ModerationFlagApproved && status != models.ModerationFlagRejected {
+		return nil, ErrInvalidModerationFlagStatus
+	}
+
+	flag, err := s.Repo.ResolveModerationFlag(flagID, moderator.ID, status)
+	if err != nil {
+		return nil, err
+	}
+	log.Printf("admin: user %d %s moderation flag %d of recipe %d", moderator.ID, status, flag.ID, flag.RecipeID)
+
+	flagResponse := toModerationFlagResponse(flag)
+
+	return &flagResponse, nil
+}
+
+// GetForbiddenUsernames fetches every forbidden username.
+func (s *AdminService) GetForbiddenUsernames() ([]ForbiddenUsernameResponse, error) {
+	forbiddenUsernames, err := s.Repo.GetForbiddenUsernames()
+	if err != nil {
+		return nil, err
+	}
+
+	forbiddenUsernameResponses := make([]ForbiddenUsernameResponse, 0, len(forbiddenUsernames))
+	for i := range forbiddenUsernames {
+		forbiddenUsernameResponses = append(forbiddenUsernameResponses, toForbiddenUsernameResponse(&forbiddenUsernames[i]))
+	}
+
+	return forbiddenUsernameResponses, nil
+}
+
+// AddForbiddenUsername stops users from signing up with, or changing to, a username.
+// Users who already have the username keep it.
+func (s *AdminService) AddForbiddenUsername(admin *models.User, username string) (*ForbiddenUsernameResponse, error) {
+	username = strings.ToLower(strings.TrimSpace(username))
+	if username == "" || !govalidator.IsAlphanumeric(username) {
+		return nil, fmt.Errorf("username can only contain alphanumeric characters")
+	}
+
+	forbiddenUsername := &models.ForbiddenUsername{Username: username}
+	if err := s.Repo.CreateForbiddenUsername(forbiddenUsername); err != nil {
+		return nil, err
+	}
+	log.Printf("admin: user %d forbade username %s", admin.ID, username)
+
+	forbiddenUsernameResponse := toForbiddenUsernameResponse(forbiddenUsername)
+
+	return &forbiddenUsernameResponse, nil
+}
+
+// RemoveForbiddenUsername allows a forbidden username again.
+func (s *AdminService) RemoveForbiddenUsername(admin *models.User, forbiddenUsernameID uint) error {
+	if err := s.Repo.DeleteForbiddenUsername(forbiddenUsernameID); err != nil {
+		return err
+	}
+	log.Printf("admin: user %d removed forbidden username %d", admin.ID, forbiddenUsernameID)
+
+	return nil
+}
+
+// toAdminUserResponse converts a User to an AdminUserResponse.
+func toAdminUserResponse(user *models.User) *AdminUserResponse {
+	adminUserResponse := &AdminUserResponse{
+		UserResponse: toUserResponse(user),
+		CreatedAt:    user.CreatedAt,
+	}
+	if user.Auth != nil {
+		adminUserResponse.AuthType = user.Auth.AuthType
+	}
+	if user.Subscription != nil {
+		adminUserResponse.Subscription = &SubscriptionResponse{
+			Tier:            user.Subscription.SubscriptionTier,
+			ExpiresAt:       user.Subscription.ExpiresAt,
+			RemainingTokens: user.Subscription.RemainingTokens,
+		}
+	}
+	return adminUserResponse
+}
+
+// toModerationFlagResponse converts a ModerationFlag to a ModerationFlagResponse.
+func toModerationFlagResponse(flag *models.ModerationFlag) ModerationFlagResponse {
+	return ModerationFlagResponse{
+		ID:           flag.ID,
+		RecipeID:     flag.RecipeID,
+		UserID:       flag.UserID,
+		Moderator:    flag.Moderator,
+		Categories:   flag.Categories,
+		Content:      flag.Content,
+		Status:       flag.Status,
+		ReviewedByID: flag.ReviewedByID,
+		ReviewedAt:   flag.ReviewedAt,
+		CreatedAt:    flag.CreatedAt,
+	}
+}
+
+// toForbiddenUsernameResponse converts a ForbiddenUsername to a ForbiddenUsernameResponse.
+func toForbiddenUsernameResponse(forbiddenUsername *models.ForbiddenUsername) ForbiddenUsernameResponse {
+	return ForbiddenUsernameResponse{
+		ID:        forbiddenUsername.ID,
+		Username:  forbiddenUsername.Username,
+		CreatedAt: forbiddenUsername.CreatedAt,
+	}
+}
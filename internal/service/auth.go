@@ -0,0 +1,387 @@
+package service
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/google/uuid"
+	"github.com/windoze95/saltybytes-api/internal/config"
+	"github.com/windoze95/saltybytes-api/internal/models"
+	"github.com/windoze95/saltybytes-api/internal/repository"
+	"github.com/windoze95/saltybytes-api/internal/util"
+)
+
+const (
+	// AccessTokenTTL is how long an access token is valid for.
+	AccessTokenTTL = 15 * time.Minute
+	// RefreshTokenTTL is how long a refresh token is valid for if it is not used.
+	RefreshTokenTTL = 30 * 24 * time.Hour
+	// MFAChallengeTTL is how long a user has to complete the second step of logging in.
+	MFAChallengeTTL = 5 * time.Minute
+	// mfaChallengeType is the typ claim that tells MFA challenge tokens apart from access tokens.
+	mfaChallengeType = "mfa"
+	// sessionCacheTTL is how long the result of checking that a session has not been revoked is reused for.
+	sessionCacheTTL = 30 * time.Second
+)
+
+var (
+	// ErrInvalidRefreshToken is returned when a refresh token is unknown, expired or revoked.
+	ErrInvalidRefreshToken = errors.New("invalid or expired refresh token")
+	// ErrInvalidMFAChallenge is returned when an MFA challenge token is invalid or expired.
+	ErrInvalidMFAChallenge = errors.New("invalid or expired two-factor authentication challenge, log in again")
+)
+
+// AuthService is the business logic layer for issuing and verifying auth tokens.
+type AuthService struct {
+	Cfg  *config.Config
+	Repo *repository.AuthRepository
+
+	sessionsMu sync.Mutex
+	sessions   map[string]sessionCacheEntry
+}
+
+// sessionCacheEntry is a cached answer to whether a refresh token family is still active.
+type sessionCacheEntry struct {
+	active    bool
+	checkedAt time.Time
+}
+
+// TokenPair is the response object for a newly issued access token and refresh token.
+type TokenPair struct {
+	AccessToken      string    `json:"access_token"`
+	AccessExpiresAt  time.Time `json:"access_token_expires_at"`
+	RefreshToken     string    `json:"refresh_token"`
+	RefreshExpiresAt time.Time `json:"refresh_token_expires_at"`
+}
+
+// NewAuthService is the constructor function for initializing a new AuthService.
+func NewAuthService(cfg *config.Config, repo *repository.AuthRepository) *AuthService {
+	return &AuthService{
+		Cfg:      cfg,
+		Repo:     repo,
+		sessions: make(map[string]sessionCacheEntry),
+	}
+}
+
+// IssueTokens starts a new session for a user and issues its first access token and refresh token.
+func (s *AuthService) IssueTokens(userID uint) (*TokenPair, error) {
+	familyID := uuid.New().String()
+
+	refreshToken, token, err := newRefreshToken(userID, familyID)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.Repo.CreateRefreshToken(token); err != nil {
+		return nil, err
+	}
+
+	return s.toTokenPair(userID, familyID, refreshToken, token.ExpiresAt)
+}
+
+// RefreshTokens exchanges a refresh token for a new access token and refresh token.
+// Presenting a refresh token that was already rotated means it was leaked or replayed,
+// so the whole session is revoked.
+func (s *AuthService) RefreshTokens(refreshToken string) (*TokenPair, error) {
+	token, err := s.Repo.GetRefreshTokenByHash(hashToken(refreshToken))
+	if err != nil {
+		if _, ok := err.(repository.NotFoundError); ok {
+			return nil, ErrInvalidRefreshToken
+		}
+		return nil, err
+	}
+
+	if token.ReplacedByID != nil {
+		log.Printf("refresh token reuse detected for user %d, revoking session", token.UserID)
+		if err := s.revokeSession(token.FamilyID); err != nil {
+			return nil, err
+		}
+		return nil, ErrInvalidRefreshToken
+	}
+
+	if token.RevokedAt != nil || time.Now().After(token.ExpiresAt) {
+		return nil, ErrInvalidRefreshToken
+	}
+
+	newRefreshTokenString, newToken, err := newRefreshToken(token.UserID, token.FamilyID)
+	if err != nil {
+		return nil, err
+	}
+
+	rotated, err := s.Repo.RotateRefreshToken(token, newToken)
+	if err != nil {
+		return nil, err
+	}
+	if !rotated {
+		// Another request rotated the token first
+		log.Printf("refresh token reuse detected for user %d, revoking session", token.UserID)
+		if err := s.revokeSession(token.FamilyID); err != nil {
+			return nil, err
+		}
+		return nil, ErrInvalidRefreshToken
+	}
+
+	return s.toTokenPair(token.UserID, token.FamilyID, newRefreshTokenString, newToken.ExpiresAt)
+}
+
+// Logout revokes the session a refresh token belongs to, along with every access token issued in it.
+// Unknown refresh tokens are ignored so logging out twice is not an error.
+func (s *AuthService) Logout(refreshToken string) error {
+	token, err := s.Repo.GetRefreshTokenByHash(hashToken(refreshToken))
+	if err != nil {
+		if _, ok := err.(repository.NotFoundError); ok {
+			return nil
+		}
+		return err
+	}
+
+	return s.revokeSession(token.FamilyID)
+}
+
+// RevokeUserSessions revokes every session of a user, e.g. after their password is reset.
+func (s *AuthService) RevokeUserSessions(userID uint) error {
+	return s.RevokeOtherUserSessions(userID, "")
+}
+
+// RevokeOtherUserSessions revokes every session of a user but the one with the given ID,
+// e.g. after they change their password in it.
+func (s *AuthService) RevokeOtherUserSessions(userID uint, sessionID string) error {
+	if err := s.Repo.RevokeUserRefreshTokens(userID, sessionID); err != nil {
+		return err
+	}
+
+	// The families of the user are not known here, so forget every cached session
+	s.sessionsMu.Lock()
+	s.sessions = make(map[string]sessionCacheEntry)
+	s.sessionsMu.Unlock()
+
+	return nil
+}
+
+// VerifyAccessToken verifies an access token and returns the ID of the user it was issued to,
+// along with the ID of the session it was issued in.
+// Only HS256 tokens that carry an expiry and belong to a session that has not been revoked are accepted.
+func (s *AuthService) VerifyAccessToken(tokenString string) (uint, string, error) {
+	claims, err := s.parseToken(tokenString)
+	if err != nil {
+		return 0, "", err
+	}
+
+	// MFA challenge tokens only prove the password, they must not grant access
+	if _, ok := claims["typ"]; ok {
+		return 0, "", errors.New("not an access token")
+	}
+
+	idFloat, ok := claims["user_id"].(float64)
+	if !ok {
+		return 0, "", errors.New("invalid user_id in token")
+	}
+
+	familyID, ok := claims["sid"].(string)
+	if !ok || familyID == "" {
+		return 0, "", errors.New("invalid sid in token")
+	}
+
+	active, err := s.isSessionActive(familyID)
+	if err != nil {
+		return 0, "", err
+	}
+	if !active {
+		return 0, "", errors.New("token has been revoked")
+	}
+
+	return uint(idFloat), familyID, nil
+}
+
+// IssueMFAChallenge issues the short-lived token a user whose password checked out exchanges,
+// along with a second factor, for the tokens of a new session.
+func (s *AuthService) IssueMFAChallenge(userID uint) (string, time.Time, error) {
+	now := time.Now()
+	expiresAt := now.Add(MFAChallengeTTL)
+
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"typ":     mfaChallengeType,
+		"user_id": userID,
+		"jti":     uuid.New().String(),
+		"iat":     now.Unix(),
+		"exp":     expiresAt.Unix(),
+	})
+
+	tokenString, err := token.SignedString([]byte(s.Cfg.Env.JwtSecretKey.Value()))
+	if err != nil {
+		return "", time.Time{}, fmt.Errorf("IssueMFAChallenge: %v", err)
+	}
+
+	return tokenString, expiresAt, nil
+}
+
+// VerifyMFAChallenge verifies an MFA challenge token and returns the ID of the user it was issued to.
+func (s *AuthService) VerifyMFAChallenge(tokenString string) (uint, error) {
+	claims, err := s.parseToken(tokenString)
+	if err != nil {
+		return 0, ErrInvalidMFAChallenge
+	}
+
+	if typ, _ := claims["typ"].(string); typ != mfaChallengeType {
+		return 0, ErrInvalidMFAChallenge
+	}
+
+	idFloat, ok := claims["user_id"].(float64)
+	if !ok {
+		return 0, ErrInvalidMFAChallenge
+	}
+
+	return uint(idFloat), nil
+}
+
+// StartCleanupJob deletes expired refresh tokens and old login attempts in the background at the given interval.
+func (s *AuthService) StartCleanupJob(interval time.Duration) {
+	go func() {
+		for range time.Tick(interval) {
+			deleted, err := s.Repo.DeleteExpiredRefreshTokens(time.Now())
+			if err != nil {
+				log.Printf("error: failed to delete expired refresh tokens: %v", err)
+			} else if deleted > 0 {
+				log.Printf("deleted %d expired refresh tokens", deleted)
+			}
+
+			deleted, err = s.Repo.DeleteLoginAttemptsBefore(time.Now().Add(-LoginAttemptRetention))
+			if err != nil {
+				log.Printf("error: failed to delete old login attempts: %v", err)
+			} else if deleted > 0 {
+				log.Printf("deleted %d old login attempts", deleted)
+			}
+		}
+	}()
+}
+
+// parseToken verifies the signature and expiry of a JWT issued by the API and returns its claims.
+// Only HS256 tokens that carry an expiry are accepted.
+func (s *AuthService) parseToken(tokenString string) (jwt.MapClaims, error) {
+	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
+		if token.Method != jwt.SigningMethodHS256 {
+			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+		}
+		return []byte(s.Cfg.Env.JwtSecretKey.Value()), nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok || !token.Valid {
+		return nil, errors.New("invalid token")
+	}
+
+	// Tokens issued before access tokens expired never do, so they are rejected outright
+	if _, ok := claims["exp"].(float64); !ok {
+		return nil, errors.New("token has no expiry")
+	}
+
+	return claims, nil
+}
+
+// isSessionActive reports whether a refresh token family is still active.
+// The answer is cached briefly so every request does not hit the database; a session revoked by
+// another instance of the API stops being accepted here within sessionCacheTTL.
+func (s *AuthService) isSessionActive(familyID string) (bool, error) {
+	s.sessionsMu.Lock()
+	entry, ok := s.sessions[familyID]
+	s.sessionsMu.Unlock()
+	if ok && time.Since(entry.checkedAt) < sessionCacheTTL {
+		return entry.active, nil
+	}
+
+	active, err := s.Repo.IsRefreshTokenFamilyActive(familyID)
+	if err != nil {
+		return false, err
+	}
+
+	s.sessionsMu.Lock()
+	for id, e := range s.sessions {
+		if time.Since(e.checkedAt) >= sessionCacheTTL {
+			delete(s.sessions, id)
+		}
+	}
+	s.sessions[familyID] = sessionCacheEntry{active: active, checkedAt: time.Now()}
+	s.sessionsMu.Unlock()
+
+	return active, nil
+}
+
+// revokeSession revokes a refresh token family and stops accepting its access tokens immediately.
+func (s *AuthService) revokeSession(familyID string) error {
+	if err := s.Repo.RevokeRefreshTokenFamily(familyID); err != nil {
+		return err
+	}
+
+	s.sessionsMu.Lock()
+	s.sessions[familyID] = sessionCacheEntry{active: false, checkedAt: time.Now()}
+	s.sessionsMu.Unlock()
+
+	return nil
+}
+
+// toTokenPair issues an access token for a session and pairs it with the session's refresh token.
+func (s *AuthService) toTokenPair(userID uint, familyID, refreshToken string, refreshExpiresAt time.Time) (*TokenPair, error) {
+	accessToken, accessExpiresAt, err := s.generateAccessToken(userID, familyID)
+	if err != nil {
+		return nil, err
+	}
+
+	return &TokenPair{
+		AccessToken:      accessToken,
+		AccessExpiresAt:  accessExpiresAt,
+		RefreshToken:     refreshToken,
+		RefreshExpiresAt: refreshExpiresAt,
+	}, nil
+}
+
+// generateAccessToken generates a short-lived JWT access token for a user's session.
+func (s *AuthService) generateAccessToken(userID uint, familyID string) (string, time.Time, error) {
+	now := time.Now()
+	expiresAt := now.Add(AccessTokenTTL)
+
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"user_id": userID,
+		"sid":     familyID,
+		"jti":     uuid.New().String(),
+		"iat":     now.Unix(),
+		"exp":     expiresAt.Unix(),
+	})
+
+	tokenString, err := token.SignedString([]byte(s.Cfg.Env.JwtSecretKey.Value()))
+	if err != nil {
+		return "", time.Time{}, fmt.Errorf("generateAccessToken: %v", err)
+	}
+
+	return tokenString, expiresAt, nil
+}
+
+// newRefreshToken generates a random refresh token and the record storing its hash.
+func newRefreshToken(userID uint, familyID string) (string, *models.RefreshToken, error) {
+	refreshToken, err := util.GenerateRandomString(32)
+	if err != nil {
+		return "", nil, fmt.Errorf("error generating refresh token: %v", err)
+	}
+
+	return refreshToken, &models.RefreshToken{
+		UserID:    userID,
+		FamilyID:  familyID,
+		TokenHash: hashToken(refreshToken),
+		ExpiresAt: time.Now().Add(RefreshTokenTTL),
+	}, nil
+}
+
+// hashToken hashes a refresh token or emailed token for storage. The tokens are random,
+// so a fast unsalted hash is enough to keep a database leak from exposing usable tokens.
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,109 @@
+package service
+
+import (
+	"errors"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/windoze95/saltybytes-api/internal/models"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	// loginFailureWindow is how far back failed login attempts count towards throttling.
+	loginFailureWindow = 15 * time.Minute
+	// loginLockout is the longest a username or IP address has to wait between attempts.
+	loginLockout = 15 * time.Minute
+	// usernameFreeFailures is how many failures a username gets before each attempt has to wait,
+	// the wait doubles with every failure until usernameLockoutFailures locks the username out.
+	usernameFreeFailures    = 3
+	usernameLockoutFailures = 10
+	// ipFreeFailures and ipLockoutFailures are the same for an IP address, which may be shared by many users.
+	ipFreeFailures    = 10
+	ipLockoutFailures = 50
+	// LoginAttemptRetention is how long login attempts are kept for auditing.
+	LoginAttemptRetention = 90 * 24 * time.Hour
+)
+
+// ErrInvalidCredentials is returned for both unknown usernames and wrong passwords,
+// so logging in doesn't reveal which usernames exist.
+var ErrInvalidCredentials = errors.New("invalid username or password")
+
+// dummyPasswordHash is compared against when there is no password to check,
+// so failing to log in takes as long whether or not the username exists.
+var dummyPasswordHash, _ = bcrypt.GenerateFromPassword([]byte("saltybytes-dummy-password"), 10)
+
+// LoginThrottledError is returned when there have been too many failed attempts to log in
+// as a username or from an IP address.
+type LoginThrottledError struct {
+	RetryAfter time.Duration
+}
+
+// Error returns the error message.
+func (e LoginThrottledError) Error() string {
+	return "too many failed login attempts, try again later"
+}
+
+// ReserveLoginAttempt records an attempt to log in as a username from an IP address as failed before the password
+// is checked, so attempts made in parallel count against each other rather than all passing the throttle.
+// It returns a LoginThrottledError, and records the attempt as throttled, when the attempt has to wait because of
+// earlier failures. The check is the same whether or not a user has the username.
+// The outcome of an allowed attempt is recorded with FinishLoginAttempt.
+func (s *AuthService) ReserveLoginAttempt(username, ip string) (*models.LoginAttempt, error) {
+	attempt := &models.LoginAttempt{
+		Username: normalizeLoginUsername(username),
+		IP:       ip,
+	}
+
+	failures, err := s.Repo.ReserveLoginAttempt(attempt, time.Now().Add(-loginFailureWindow))
+	if err != nil {
+		return nil, err
+	}
+
+	wait := loginBackoff(failures.Username, failures.LatestUsername, usernameFreeFailures, usernameLockoutFailures)
+	if ipWait := loginBackoff(failures.IP, failures.LatestIP, ipFreeFailures, ipLockoutFailures); ipWait > wait {
+		wait = ipWait
+	}
+	if wait > 0 {
+		s.FinishLoginAttempt(attempt, nil, models.LoginThrottled)
+		return nil, LoginThrottledError{RetryAfter: wait}
+	}
+
+	return attempt, nil
+}
+
+// FinishLoginAttempt records the user and the result of a reserved attempt to log in.
+// Failing to record it is logged rather than failing the login.
+func (s *AuthService) FinishLoginAttempt(attempt *models.LoginAttempt, userID *uint, result models.LoginResult) {
+	attempt.UserID = userID
+	attempt.Result = result
+	if err := s.Repo.UpdateLoginAttempt(attempt); err != nil {
+		log.Printf("error: failed to record login attempt: %v", err)
+	}
+}
+
+// loginBackoff returns how much longer the next attempt has to wait after the given number of failures.
+func loginBackoff(failures int, latestFailure *time.Time, freeFailures, lockoutFailures int) time.Duration {
+	if latestFailure == nil || failures < freeFailures {
+		return 0
+	}
+
+	delay := loginLockout
+	if failures < lockoutFailures {
+		delay = time.Second << uint(failures-freeFailures)
+		if delay > loginLockout {
+			delay = loginLockout
+		}
+	}
+
+	if remaining := time.Until(latestFailure.Add(delay)); remaining > 0 {
+		return remaining
+	}
+	return 0
+}
+
+// normalizeLoginUsername normalizes a username so attempts differing only in case are counted together.
+func normalizeLoginUsername(username string) string {
+	return strings.ToLower(strings.TrimSpace(username))
+}
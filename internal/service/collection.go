@@ -0,0 +1,232 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/windoze95/saltybytes-api/internal/config"
+	"github.com/windoze95/saltybytes-api/internal/models"
+	"github.com/windoze95/saltybytes-api/internal/repository"
+	"github.com/windoze95/saltybytes-api/internal/util"
+)
+
+// CollectionService is the business logic layer for saved recipes and collections.
+type CollectionService struct {
+	Cfg  *config.Config
+	Repo *repository.CollectionRepository
+}
+
+// CollectionResponse is the response object for collection-related operations.
+type CollectionResponse struct {
+	ID          uint              `json:"ID"`
+	Name        string            `json:"name"`
+	Position    int               `json:"position"`
+	RecipeCount int               `json:"recipe_count"`
+	Shared      bool              `json:"shared"`
+	SharePath   *string           `json:"share_path"`
+	Recipes     []*RecipeResponse `json:"recipes,omitempty"`
+}
+
+// CollectionUpdate holds the fields of a collection to update, nil fields are left unchanged.
+type CollectionUpdate struct {
+	Name   *string `json:"name"`
+	Shared *bool   `json:"shared"`
+}
+
+// maxCollectionNameLength is the maximum length of a collection name.
+const maxCollectionNameLength = 60
+
+// NewCollectionService is the constructor function for initializing a new CollectionService
+func NewCollectionService(cfg *config.Config, repo *repository.CollectionRepository) *CollectionService {
+	return &CollectionService{
+		Cfg:  cfg,
+		Repo: repo,
+	}
+}
+
+// SaveRecipe saves a recipe for a user.
+func (s *CollectionService) SaveRecipe(user *models.User, recipeID uint) error {
+	return s.Repo.SaveRecipe(user.ID, recipeID, "")
+}
+
+// SaveSharedRecipe saves a recipe for a user through its share slug, the only way to save an unlisted recipe.
+func (s *CollectionService) SaveSharedRecipe(user *models.User, shareSlug string) error {
+	return s.Repo.SaveRecipe(user.ID, 0, shareSlug)
+}
+
+// UnsaveRecipe removes a saved recipe for a user, including from their collections.
+func (s *CollectionService) UnsaveRecipe(user *models.User, recipeID uint) error {
+	return s.Repo.UnsaveRecipe(user.ID, recipeID)
+}
+
+// GetCollections fetches a user's collections.
+func (s *CollectionService) GetCollections(user *models.User) ([]*CollectionResponse, error) {
+	collections, recipeCounts, err := s.Repo.GetCollectionsByUserID(user.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	collectionResponses := make([]*CollectionResponse, 0, len(collections))
+	for i := range collections {
+		collectionResponse := toCollectionResponse(&collections[i])
+		collectionResponse.RecipeCount = recipeCounts[collections[i].ID]
+		collectionResponses = append(collectionResponses, collectionResponse)
+	}
+
+	return collectionResponses, nil
+}
+
+// GetCollection fetches a user's collection with its recipes.
+func (s *CollectionService) GetCollection(user *models.User, collectionID uint) (*CollectionResponse, error) {
+	collection, err := s.Repo.GetCollectionByID(collectionID, user.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	// Recipes their creator made private are hidden from those who collected them
+	return toCollectionResponseWithRecipes(collection, func(collectionRecipe *models.CollectionRecipe) bool {
+		return isRecipeOwner(collectionRecipe.Recipe, user) || canViewCollectedRecipe(collectionRecipe)
+	}), nil
+}
+
+// GetSharedCollection fetches a shared collection by its share slug.
+func (s *CollectionService) GetSharedCollection(shareSlug string) (*CollectionResponse, error) {
+	collection, err := s.Repo.GetSharedCollectionBySlug(shareSlug)
+	if err != nil {
+		return nil, err
+	}
+
+	// Sharing a collection never exposes private or hidden recipes, not even the collection owner's
+	return toCollectionResponseWithRecipes(collection, canViewCollectedRecipe), nil
+}
+
+// CreateCollection creates a new collection for a user.
+func (s *CollectionService) CreateCollection(user *models.User, name string) (*CollectionResponse, error) {
+	name, err := validateCollectionName(name)
+	if err != nil {
+		return nil, err
+	}
+
+	shareSlug, err := util.GenerateRandomString(12)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate share slug: %v", err)
+	}
+
+	collection := &models.Collection{
+		UserID:    user.ID,
+		Name:      name,
+		ShareSlug: shareSlug,
+	}
+	if err := s.Repo.CreateCollection(collection); err != nil {
+		return nil, fmt.Errorf("failed to save collection record: %w", err)
+	}
+
+	return toCollectionResponse(collection), nil
+}
+
+// UpdateCollection renames a user's collection or turns sharing on or off.
+// Turning sharing off rotates the share slug, so previously shared links stop working.
+func (s *CollectionService) UpdateCollection(user *models.User, collectionID uint, update CollectionUpdate) (*CollectionResponse, error) {
+	updates := map[string]interface{}{}
+
+	if update.Name != nil {
+		name, err := validateCollectionName(*update.Name)
+		if err != nil {
+			return nil, err
+		}
+		updates["Name"] = name
+	}
+
+	if update.Shared != nil {
+		updates["IsShared"] = *update.Shared
+		if !*update.Shared {
+			shareSlug, err := util.GenerateRandomString(12)
+			if err != nil {
+				return nil, fmt.Errorf("failed to generate share slug: %v", err)
+			}
+			updates["ShareSlug"] = shareSlug
+		}
+	}
+
+	if len(updates) > 0 {
+		if err := s.Repo.UpdateCollection(collectionID, user.ID, updates); err != nil {
+			return nil, err
+		}
+	}
+
+	return s.GetCollection(user, collectionID)
+}
+
+// DeleteCollection deletes a user's collection.
+func (s *CollectionService) DeleteCollection(user *models.User, collectionID uint) error {
+	return s.Repo.DeleteCollection(collectionID, user.ID)
+}
+
+// ReorderCollections sets the order of a user's collections.
+func (s *CollectionService) ReorderCollections(user *models.User, collectionIDs []uint) error {
+	return s.Repo.ReorderCollections(user.ID, collectionIDs)
+}
+
+// AddRecipeToCollection adds a recipe to a user's collection, saving it for the user.
+// The recipe is given by its ID or, for an unlisted recipe, by its share slug.
+func (s *CollectionService) AddRecipeToCollection(user *models.User, collectionID, recipeID uint, shareSlug string) error {
+	return s.Repo.AddRecipeToCollection(collectionID, user.ID, recipeID, shareSlug)
+}
+
+// RemoveRecipeFromCollection removes a recipe from a user's collection.
+func (s *CollectionService) RemoveRecipeFromCollection(user *models.User, collectionID, recipeID uint) error {
+	return s.Repo.RemoveRecipeFromCollection(collectionID, user.ID, recipeID)
+}
+
+// ReorderCollectionRecipes sets the order of the recipes in a user's collection.
+func (s *CollectionService) ReorderCollectionRecipes(user *models.User, collectionID uint, recipeIDs []uint) error {
+	return s.Repo.ReorderCollectionRecipes(collectionID, user.ID, recipeIDs)
+}
+
+// validateCollectionName trims and validates a collection name.
+func validateCollectionName(name string) (string, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return "", errors.New("collection name is required")
+	}
+	if len([]rune(name)) > maxCollectionNameLength {
+		return "", fmt.Errorf("collection name must be at most %d characters", maxCollectionNameLength)
+	}
+	return name, nil
+}
+
+// toCollectionResponse converts a Collection to a CollectionResponse without its recipes.
+func toCollectionResponse(c *models.Collection) *CollectionResponse {
+	var sharePath *string
+	if c.IsShared {
+		path := "/v1/collections/shared/" + c.ShareSlug
+		sharePath = &path
+	}
+
+	return &CollectionResponse{
+		ID:        c.ID,
+		Name:      c.Name,
+		Position:  c.Position,
+		Shared:    c.IsShared,
+		SharePath: sharePath,
+	}
+}
+
+// toCollectionResponseWithRecipes converts a Collection to a CollectionResponse including the recipes
+// for which visible returns true.
+func toCollectionResponseWithRecipes(c *models.Collection, visible func(collectionRecipe *models.CollectionRecipe) bool) *CollectionResponse {
+	collectionResponse := toCollectionResponse(c)
+
+	collectionResponse.Recipes = make([]*RecipeResponse, 0, len(c.Recipes))
+	for _, collectionRecipe := range c.Recipes {
+		// Deleted recipes are not preloaded
+		if collectionRecipe.Recipe == nil || !visible(&collectionRecipe) {
+			continue
+		}
+		collectionResponse.Recipes = append(collectionResponse.Recipes, toRecipeResponse(collectionRecipe.Recipe))
+	}
+	collectionResponse.RecipeCount = len(collectionResponse.Recipes)
+
+	return collectionResponse
+}
@@ -0,0 +1,123 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/windoze95/saltybytes-api/internal/dietary"
+	"github.com/windoze95/saltybytes-api/internal/models"
+	"github.com/windoze95/saltybytes-api/internal/promptguard"
+)
+
+// PersonalizationResponse is the response object for personalization-related operations.
+type PersonalizationResponse struct {
+	UnitSystem     models.UnitSystem `json:"unit_system"`
+	UnitSystemText string            `json:"unit_system_text"`
+	Requirements   string            `json:"requirements"`
+	Diets          []string          `json:"diets"`
+	Allergens      []string          `json:"allergens"`
+	UID            uuid.UUID         `json:"uid"`
+}
+
+// GetPersonalization gets a user's personalization settings.
+func (s *UserService) GetPersonalization(user *models.User) (*PersonalizationResponse, error) {
+	if user.Personalization == nil {
+		return nil, errors.New("user's Personalization is nil")
+	}
+
+	return toPersonalizationResponse(user.Personalization), nil
+}
+
+// toPersonalizationResponse converts a Personalization to a PersonalizationResponse.
+func toPersonalizationResponse(p *models.Personalization) *PersonalizationResponse {
+	diets := []string{}
+	if p.Diets != nil {
+		diets = p.Diets
+	}
+
+	allergens := []string{}
+	if p.Allergens != nil {
+		allergens = p.Allergens
+	}
+
+	return &PersonalizationResponse{
+		UnitSystem:     p.UnitSystem,
+		UnitSystemText: p.GetUnitSystemText(),
+		Requirements:   p.Requirements,
+		Diets:          diets,
+		Allergens:      allergens,
+		UID:            p.UID,
+	}
+}
+
+// validatePersonalization validates personalization settings, trimming the requirements
+// and sorting and de-duplicating the diets and allergens.
+func validatePersonalization(p *models.Personalization) error {
+	if !p.IsValidUnitSystem() {
+		return errors.New("unit system must be 0 (US Customary) or 1 (Metric)")
+	}
+
+	p.Requirements = strings.TrimSpace(p.Requirements)
+	if len(p.Requirements) > promptguard.MaxRequirementsLength {
+		return fmt.Errorf("requirements must be at most %d characters long", promptguard.MaxRequirementsLength)
+	}
+	if len(promptguard.Detect(p.Requirements)) > 0 {
+		return errors.New("requirements can only describe your cooking preferences")
+	}
+
+	diets, err := normalizeChoices(p.Diets, dietary.IsValidDiet, "diet")
+	if err != nil {
+		return err
+	}
+	p.Diets = diets
+
+	allergens, err := normalizeChoices(p.Allergens, dietary.IsValidAllergen, "allergen")
+	if err != nil {
+		return err
+	}
+	p.Allergens = allergens
+
+	return nil
+}
+
+// normalizeChoices lowercases, validates, sorts and de-duplicates a list of choices.
+func normalizeChoices(choices []string, isValid func(string) bool, kind string) ([]string, error) {
+	seen := make(map[string]bool)
+	normalized := []string{}
+	for _, choice := range choices {
+		choice = strings.ToLower(strings.TrimSpace(choice))
+		if !isValid(choice) {
+			return nil, fmt.Errorf("unknown %s: %s", kind, choice)
+		}
+		if !seen[choice] {
+			seen[choice] = true
+			normalized = append(normalized, choice)
+		}
+	}
+	sort.Strings(normalized)
+	return normalized, nil
+}
+
+// personalizationChanged checks if any of the settings that shape generated recipes changed.
+func personalizationChanged(current, updated *models.Personalization) bool {
+	return current.UnitSystem != updated.UnitSystem ||
+		current.Requirements != updated.Requirements ||
+		!equalStrings(current.Diets, updated.Diets) ||
+		!equalStrings(current.Allergens, updated.Allergens)
+}
+
+// equalStrings checks if two slices hold the same strings in the same order.
+func equalStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,279 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/windoze95/saltybytes-api/internal/config"
+	"github.com/windoze95/saltybytes-api/internal/models"
+	"github.com/windoze95/saltybytes-api/internal/prompts"
+	"github.com/windoze95/saltybytes-api/internal/repository"
+)
+
+var (
+	// ErrInvalidPromptName is returned for prompts that can't be versioned.
+	ErrInvalidPromptName = errors.New("invalid prompt name")
+	// ErrEmptyPromptTemplate is returned when creating a prompt template version without a template.
+	ErrEmptyPromptTemplate = errors.New("prompt template cannot be empty")
+	// ErrInvalidPromptWeight is returned for negative experiment weights.
+	ErrInvalidPromptWeight = errors.New("weight cannot be negative")
+	// ErrInvalidPromptTemplate is returned for templates that don't parse or reference unknown fields.
+	ErrInvalidPromptTemplate = errors.New("invalid prompt template")
+)
+
+// PromptService is the business logic layer for versioned prompt templates and their experiments.
+type PromptService struct {
+	Cfg  *config.Config
+	Repo *repository.PromptRepository
+}
+
+// PromptTemplateResponse is the response object for a prompt template version.
+type PromptTemplateResponse struct {
+	ID        uint              `json:"ID"`
+	Name      models.PromptName `json:"name"`
+	Version   int               `json:"version"`
+	Template  string            `json:"template"`
+	Weight    int               `json:"weight"`
+	Note      string            `json:"note"`
+	CreatedAt time.Time         `json:"created_at"`
+}
+
+// PromptReportResponse is the response object for the outcomes of every version of a prompt.
+type PromptReportResponse struct {
+	Name models.PromptName   `json:"name"`
+	Arms []PromptArmResponse `json:"arms"`
+}
+
+// PromptArmResponse is the response object for the outcomes of a prompt template version,
+// or of the template from the config for the baseline arm.
+type PromptArmResponse struct {
+	PromptTemplateID   uint    `json:"prompt_template_id"`
+	Version            int     `json:"version"`
+	Weight             int     `json:"weight"`
+	Baseline           bool    `json:"baseline"`
+	Runs               int     `json:"runs"`
+	Failures           int     `json:"failures"`
+	FailureRate        float64 `json:"failure_rate"`
+	AverageTokens      float64 `json:"average_tokens"`
+	Recipes            int     `json:"recipes"`
+	Edits              int     `json:"edits"`
+	EditsPerRecipe     float64 `json:"edits_per_recipe"`
+	Favorites          int     `json:"favorites"`
+	FavoritesPerRecipe float64 `json:"favorites_per_recipe"`
+}
+
+// NewPromptService is the constructor function for initializing a new PromptService.
+func NewPromptService(cfg *config.Config, repo *repository.PromptRepository) *PromptService {
+	return &PromptService{
+		Cfg:  cfg,
+		Repo: repo,
+	}
+}
+
+// SelectPromptTemplate assigns a user to one of the weighted versions of a prompt, in proportion to
+// the weights. A user keeps their version when the weights change, unless the change moves their bucket
+// into another version's range. Returns nil when the prompt has no weighted versions, so the template
+// from the config is used.
+func (s *PromptService) SelectPromptTemplate(name models.PromptName, userID uint) (*models.PromptTemplate, error) {
+	promptTemplates, err := s.Repo.GetWeightedPromptTemplates(name)
+	if err != nil {
+		return nil, err
+	}
+
+	// Versions stored before templates were validated are left out rather than failing generation
+	validPromptTemplates := make([]models.PromptTemplate, 0, len(promptTemplates))
+	for _, promptTemplate := range promptTemplates {
+		if err := prompts.Validate(string(name), promptTemplate.Template, prompts.KindSys); err != nil {
+			log.Printf("error: skipping version %d of prompt %s: %v", promptTemplate.Version, name, err)
+			continue
+		}
+		validPromptTemplates = append(validPromptTemplates, promptTemplate)
+	}
+
+	return assignPromptTemplate(validPromptTemplates, name, userID), nil
+}
+
+// RecordPromptRun records the outcome of a recipe generation with a prompt template version, or with
+// the template from the config when promptTemplate is nil. Failing to record it is only logged.
+func (s *PromptService) RecordPromptRun(name models.PromptName, promptTemplate *models.PromptTemplate, userID, recipeID uint, totalTokens int, runErr error) {
+	run := &models.PromptRun{
+		PromptName:  name,
+		UserID:      userID,
+		RecipeID:    recipeID,
+		Succeeded:   runErr == nil,
+		TotalTokens: totalTokens,
+	}
+	if promptTemplate != nil {
+		run.PromptTemplateID = &promptTemplate.ID
+	}
+	if runErr != nil {
+		run.Error = runErr.Error()
+	}
+
+	if err := s.Repo.CreatePromptRun(run); err != nil {
+		log.Printf("error: failed to record %s prompt run of recipe %d: %v", name, recipeID, err)
+	}
+}
+
+// GetPromptTemplates fetches every version of the prompt templates, by name and version.
+// An empty name fetches the versions of every prompt.
+func (s *PromptService) GetPromptTemplates(name models.PromptName) ([]PromptTemplateResponse, error) {
+	if name != "" && !models.IsValidPromptName(name) {
+		return nil, ErrInvalidPromptName
+	}
+
+	promptTemplates, err := s.Repo.GetPromptTemplates(name)
+	if err != nil {
+		return nil, err
+	}
+
+	promptTemplateResponses := make([]PromptTemplateResponse, 0, len(promptTemplates))
+	for i := range promptTemplates {
+		promptTemplateResponses = append(promptTemplateResponses, toPromptTemplateResponse(&promptTemplates[i]))
+	}
+
+	return promptTemplateResponses, nil
+}
+
+// CreatePromptTemplate creates the next version of a prompt template. A weight above zero adds it
+// to the prompt's experiment straight away.
+func (s *PromptService) CreatePromptTemplate(admin *models.User, name models.PromptName, template string, weight int, note string) (*PromptTemplateResponse, error) {
+	if !models.IsValidPromptName(name) {
+		return nil, ErrInvalidPromptName
+	}
+	if strings.TrimSpace(template) == "" {
+		return nil, ErrEmptyPromptTemplate
+	}
+	if err := prompts.Validate(string(name), template, prompts.KindSys); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidPromptTemplate, err)
+	}
+	if weight < 0 {
+		return nil, ErrInvalidPromptWeight
+	}
+
+	promptTemplate := &models.PromptTemplate{
+		Name:     name,
+		Template: template,
+		Weight:   weight,
+		Note:     strings.TrimSpace(note),
+	}
+	if err := s.Repo.CreatePromptTemplate(promptTemplate); err != nil {
+		return nil, err
+	}
+	log.Printf("admin: user %d created version %d of prompt %s with weight %d", admin.ID, promptTemplate.Version, name, weight)
+
+	promptTemplateResponse := toPromptTemplateResponse(promptTemplate)
+
+	return &promptTemplateResponse, nil
+}
+
+// UpdatePromptTemplateWeight changes the weight of a prompt template version in its experiment.
+// A weight of 0 takes it out of the experiment.
+func (s *PromptService) UpdatePromptTemplateWeight(admin *models.User, promptTemplateID uint, weight int) (*PromptTemplateResponse, error) {
+	if weight < 0 {
+		return nil, ErrInvalidPromptWeight
+	}
+
+	promptTemplate, err := s.Repo.UpdatePromptTemplateWeight(promptTemplateID, weight)
+	if err != nil {
+		return nil, err
+	}
+	log.Printf("admin: user %d set the weight of version %d of prompt %s to %d", admin.ID, promptTemplate.Version, promptTemplate.Name, weight)
+
+	promptTemplateResponse := toPromptTemplateResponse(promptTemplate)
+
+	return &promptTemplateResponse, nil
+}
+
+// GetPromptReport fetches the outcomes of the template from the config, as the baseline arm, and of every
+// version of a prompt: how often generation failed, the tokens it used, and how much users edited and saved
+// the recipes it generated.
+func (s *PromptService) GetPromptReport(name models.PromptName) (*PromptReportResponse, error) {
+	if !models.IsValidPromptName(name) {
+		return nil, ErrInvalidPromptName
+	}
+
+	stats, err := s.Repo.GetPromptArmStats(name)
+	if err != nil {
+		return nil, err
+	}
+
+	arms := make([]PromptArmResponse, 0, len(stats))
+	for _, stat := range stats {
+		arms = append(arms, PromptArmResponse{
+			PromptTemplateID:   stat.PromptTemplateID,
+			Version:            stat.Version,
+			Weight:             stat.Weight,
+			Baseline:           stat.Baseline,
+			Runs:               stat.Runs,
+			Failures:           stat.Failures,
+			FailureRate:        ratio(stat.Failures, stat.Runs),
+			AverageTokens:      stat.AverageTokens,
+			Recipes:            stat.Recipes,
+			Edits:              stat.Edits,
+			EditsPerRecipe:     ratio(stat.Edits, stat.Recipes),
+			Favorites:          stat.Favorites,
+			FavoritesPerRecipe: ratio(stat.Favorites, stat.Recipes),
+		})
+	}
+
+	return &PromptReportResponse{
+		Name: name,
+		Arms: arms,
+	}, nil
+}
+
+// promptBuckets is how many buckets users are hashed into for assigning prompt template versions.
+const promptBuckets = 10000
+
+// assignPromptTemplate deterministically picks one of the weighted versions of a prompt for a user,
+// hashing the user ID with the prompt name so users land in independent arms for each prompt.
+// Users are hashed into a fixed number of buckets and each version takes a range of buckets in
+// proportion to its weight, so changing a weight only moves the users at the edges of the ranges.
+func assignPromptTemplate(promptTemplates []models.PromptTemplate, name models.PromptName, userID uint) *models.PromptTemplate {
+	totalWeight := 0
+	for _, promptTemplate := range promptTemplates {
+		totalWeight += promptTemplate.Weight
+	}
+	if totalWeight <= 0 {
+		return nil
+	}
+
+	h := fnv.New32a()
+	fmt.Fprintf(h, "%s:%d", name, userID)
+	bucket := int(h.Sum32() % promptBuckets)
+
+	cumulativeWeight := 0
+	for i := range promptTemplates {
+		cumulativeWeight += promptTemplates[i].Weight
+		if bucket < cumulativeWeight*promptBuckets/totalWeight {
+			return &promptTemplates[i]
+		}
+	}
+	return nil
+}
+
+// ratio divides two counts, returning 0 when there is nothing to divide by.
+func ratio(count, total int) float64 {
+	if total == 0 {
+		return 0
+	}
+	return float64(count) / float64(total)
+}
+
+// toPromptTemplateResponse converts a PromptTemplate to a PromptTemplateResponse.
+func toPromptTemplateResponse(promptTemplate *models.PromptTemplate) PromptTemplateResponse {
+	return PromptTemplateResponse{
+		ID:        promptTemplate.ID,
+		Name:      promptTemplate.Name,
+		Version:   promptTemplate.Version,
+		Template:  promptTemplate.Template,
+		Weight:    promptTemplate.Weight,
+		Note:      promptTemplate.Note,
+		CreatedAt: promptTemplate.CreatedAt,
+	}
+}
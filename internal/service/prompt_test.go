@@ -0,0 +1,76 @@
+package service
+
+import (
+	"math"
+	"testing"
+
+	"github.com/jinzhu/gorm"
+	"github.com/windoze95/saltybytes-api/internal/models"
+)
+
+// testPromptTemplates returns versions of a prompt with the given weights.
+func testPromptTemplates(weights ...int) []models.PromptTemplate {
+	promptTemplates := make([]models.PromptTemplate, len(weights))
+	for i, weight := range weights {
+		promptTemplates[i] = models.PromptTemplate{Model: gorm.Model{ID: uint(i + 1)}, Version: i + 1, Weight: weight}
+	}
+	return promptTemplates
+}
+
+// TestAssignPromptTemplateProportions checks users are split between the versions in proportion to the weights.
+func TestAssignPromptTemplateProportions(t *testing.T) {
+	promptTemplates := testPromptTemplates(1, 3, 0, 6)
+
+	const users = 20000
+	counts := make(map[uint]int)
+	for userID := uint(1); userID <= users; userID++ {
+		promptTemplate := assignPromptTemplate(promptTemplates, models.PromptGenNewRecipeSys, userID)
+		if promptTemplate == nil {
+			t.Fatalf("user %d wasn't assigned a version", userID)
+		}
+		counts[promptTemplate.ID]++
+	}
+
+	for _, promptTemplate := range promptTemplates {
+		share := float64(counts[promptTemplate.ID]) / users
+		want := float64(promptTemplate.Weight) / 10
+		if math.Abs(share-want) > 0.02 {
+			t.Errorf("version %d got %.3f of the users, want %.1f", promptTemplate.Version, share, want)
+		}
+	}
+}
+
+// TestAssignPromptTemplateStable checks changing a weight only moves users between the versions whose
+// ranges changed, rather than reshuffling everyone.
+func TestAssignPromptTemplateStable(t *testing.T) {
+	before := testPromptTemplates(50, 50)
+	// The new version takes a tenth of the users from the end of the second version's range
+	after := testPromptTemplates(50, 40, 10)
+
+	const users = 20000
+	moved := 0
+	for userID := uint(1); userID <= users; userID++ {
+		was := assignPromptTemplate(before, models.PromptGenNewRecipeSys, userID)
+		is := assignPromptTemplate(after, models.PromptGenNewRecipeSys, userID)
+		if was.ID == is.ID {
+			continue
+		}
+		moved++
+		if was.ID != 2 || is.ID != 3 {
+			t.Errorf("user %d moved from version %d to %d", userID, was.Version, is.Version)
+		}
+	}
+
+	if share := float64(moved) / users; share > 0.12 {
+		t.Errorf("%.3f of the users moved, want about 0.1", share)
+	}
+}
+
+func TestAssignPromptTemplateWithoutWeights(t *testing.T) {
+	if promptTemplate := assignPromptTemplate(testPromptTemplates(0, 0), models.PromptGenNewRecipeSys, 1); promptTemplate != nil {
+		t.Errorf("got version %d, want the template from the config", promptTemplate.Version)
+	}
+	if promptTemplate := assignPromptTemplate(nil, models.PromptGenNewRecipeSys, 1); promptTemplate != nil {
+		t.Errorf("got version %d, want the template from the config", promptTemplate.Version)
+	}
+}
@@ -5,31 +5,43 @@ import (
 	"errors"
 	"fmt"
 	"log"
-	"strings"
 	"time"
 
 	"github.com/google/uuid"
-	"github.com/jinzhu/gorm"
 	"github.com/windoze95/saltybytes-api/internal/config"
+	"github.com/windoze95/saltybytes-api/internal/dietary"
+	"github.com/windoze95/saltybytes-api/internal/embedding"
 	"github.com/windoze95/saltybytes-api/internal/models"
+	"github.com/windoze95/saltybytes-api/internal/moderation"
+	"github.com/windoze95/saltybytes-api/internal/nutrition"
 	"github.com/windoze95/saltybytes-api/internal/openai"
 	"github.com/windoze95/saltybytes-api/internal/repository"
 	"github.com/windoze95/saltybytes-api/internal/s3"
+	"github.com/windoze95/saltybytes-api/internal/util"
 )
 
 // RecipeService is the business logic layer for recipe-related operations.
 type RecipeService struct {
-	Cfg  *config.Config
-	Repo *repository.RecipeRepository
+	Cfg           *config.Config
+	Repo          *repository.RecipeRepository
+	TagService    *TagService
+	PromptService *PromptService
+	Embedder      embedding.Provider
+	Moderator     moderation.Moderator
 }
 
 // RecipeResponse is the response object for recipe-related operations.
 type RecipeResponse struct {
 	ID                     uint               `json:"ID"`
+	Version                int                `json:"version"`
 	Title                  string             `json:"title"`
 	Ingredients            models.Ingredients `json:"ingredients"`
 	Instructions           []string           `json:"instructions"`
 	CookTime               int                `json:"cook_time"`
+	Servings               int                `json:"servings"`
+	ScaledFromServings     *int               `json:"scaled_from_servings,omitempty"`
+	Nutrition              *models.Nutrition  `json:"nutrition"`
+	DietaryWarnings        []string           `json:"dietary_warnings"`
 	UnitSystem             models.UnitSystem  `json:"unit_system"`
 	LinkedRecipes          []*models.Recipe   `json:"linked_recipes"`
 	LinkedSuggestions      []string           `json:"link_suggestions"`
@@ -43,44 +55,165 @@ type RecipeResponse struct {
 	UserUnitSystem         models.UnitSystem  `json:"user_unit_system"`
 	PersonalizationUID     uuid.UUID          `json:"personalization_uid"`
 	UserPersonalizationUID uuid.UUID          `json:"user_personalization_uid"`
+	PersonalizationStale   bool               `json:"personalization_stale"` // The creator's personalization changed since the recipe was generated
+	Visibility             string             `json:"visibility"`
+	ShareSlug              *string            `json:"share_slug,omitempty"`
+	Hidden                 bool               `json:"hidden"` // A moderator hid the recipe, only its creator can still see it
 }
 
 // NewRecipeService is the constructor function for initializing a new RecipeService
-func NewRecipeService(cfg *config.Config, repo *repository.RecipeRepository) *RecipeService {
+func NewRecipeService(cfg *config.Config, repo *repository.RecipeRepository, tagService *TagService, promptService *PromptService) *RecipeService {
 	return &RecipeService{
-		Cfg:  cfg,
-		Repo: repo,
+		Cfg:           cfg,
+		Repo:          repo,
+		TagService:    tagService,
+		PromptService: promptService,
+		Embedder:      embedding.NewProvider(cfg),
+		Moderator:     moderation.NewModerator(cfg),
 	}
 }
 
-// GetRecipeByID fetches a recipe by its ID.
-func (s *RecipeService) GetRecipeByID(recipeID uint) (*RecipeResponse, error) {
+// GetRecipeByID fetches a recipe by its ID, if the viewer may see it, adjusted to the display options.
+// The viewer is nil for anonymous requests.
+func (s *RecipeService) GetRecipeByID(recipeID uint, viewer *models.User, options RecipeDisplayOptions) (*RecipeResponse, error) {
 	// Fetch the recipe by its ID from the repository
 	recipe, err := s.Repo.GetRecipeByID(recipeID)
 	if err != nil {
 		return nil, err
 	}
 
+	if !canViewRecipe(recipe, viewer) {
+		return nil, recipeNotFound
+	}
+
 	// Create a RecipeResponse from the Recipe
-	recipeResponse := toRecipeResponse(recipe)
+	recipeResponse := toRecipeResponseForViewer(recipe, viewer)
+	applyDisplayOptions(recipeResponse, options, viewer)
 
 	return recipeResponse, nil
 }
 
+// GetRecipeByShareSlug fetches a recipe by its share slug, if the viewer may see it, adjusted to the display options.
+// The viewer is nil for anonymous requests.
+func (s *RecipeService) GetRecipeByShareSlug(shareSlug string, viewer *models.User, options RecipeDisplayOptions) (*RecipeResponse, error) {
+	recipe, err := s.Repo.GetRecipeByShareSlug(shareSlug)
+	if err != nil {
+		return nil, err
+	}
+
+	if !canViewSharedRecipe(recipe, viewer) {
+		return nil, recipeNotFound
+	}
+
+	recipeResponse := toRecipeResponseForViewer(recipe, viewer)
+	if recipe.Visibility == models.RecipeVisibilityUnlisted {
+		// The slug is already known to whoever followed the link
+		recipeResponse.ShareSlug = &recipe.ShareSlug
+	}
+	applyDisplayOptions(recipeResponse, options, viewer)
+
+	return recipeResponse, nil
+}
+
+// UpdateRecipeVisibility changes who can see a recipe. Only the creator may change it.
+func (s *RecipeService) UpdateRecipeVisibility(recipeID uint, viewer *models.User, visibility models.RecipeVisibility) (*RecipeResponse, error) {
+	recipe, err := s.Repo.GetRecipeByID(recipeID)
+	if err != nil {
+		return nil, err
+	}
+
+	if !canEditRecipe(recipe, viewer) {
+		return nil, recipeNotFound
+	}
+
+	recipe.Visibility = visibility
+	if !recipe.IsValidVisibility() {
+		return nil, fmt.Errorf("invalid visibility: %s", visibility)
+	}
+
+	// Recipes created before share slugs get one the first time their visibility changes
+	shareSlug, err := util.GenerateRandomString(12)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate share slug: %v", err)
+	}
+
+	recipe.ShareSlug, err = s.Repo.UpdateRecipeVisibility(recipe.ID, visibility, shareSlug)
+	if err != nil {
+		return nil, fmt.Errorf("failed to update recipe visibility: %w", err)
+	}
+
+	return toRecipeResponseForViewer(recipe, viewer), nil
+}
+
+// RecipePageResponse is the response object for a page of recipes.
+type RecipePageResponse struct {
+	Recipes  []*RecipeResponse `json:"recipes"`
+	Page     int               `json:"page"`
+	PageSize int               `json:"page_size"`
+	Total    int               `json:"total"`
+}
+
+// GetUserRecipes fetches a page of the recipes created or collected by a user.
+func (s *RecipeService) GetUserRecipes(user *models.User, filter repository.UserRecipesFilter, page, pageSize int) (*RecipePageResponse, error) {
+	if filter.Scope == "" {
+		filter.Scope = repository.UserRecipesAll
+	}
+
+	if filter.Hashtag != "" {
+		hashtags, err := s.TagService.NormalizeHashtags([]string{filter.Hashtag})
+		if err != nil {
+			return nil, err
+		}
+		if len(hashtags) > 0 {
+			filter.Hashtag = hashtags[0]
+		}
+	}
+
+	recipes, total, err := s.Repo.GetUserRecipes(user.ID, filter, (page-1)*pageSize, pageSize)
+	if err != nil {
+		return nil, err
+	}
+
+	recipeResponses := make([]*RecipeResponse, 0, len(recipes))
+	for i := range recipes {
+		recipeResponses = append(recipeResponses, toRecipeResponse(&recipes[i]))
+	}
+
+	return &RecipePageResponse{
+		Recipes:  recipeResponses,
+		Page:     page,
+		PageSize: pageSize,
+		Total:    total,
+	}, nil
+}
+
 // HistoryResponse is the response object for recipe history-related operations.
 type HistoryResponse struct {
-	Entries []models.RecipeHistoryEntry `json:"entries"`
+	Entries       []models.RecipeHistoryEntry `json:"entries"`
+	ActiveEntryID *uint                       `json:"active_entry_id"`
 }
 
-// GetRecipeHistoryByID fetches a recipe history by its ID.
-func (s *RecipeService) GetRecipeHistoryByID(historyID uint) (*HistoryResponse, error) {
+// GetRecipeHistoryByID fetches a recipe history by its ID, if the viewer may see it.
+func (s *RecipeService) GetRecipeHistoryByID(historyID uint, viewer *models.User) (*HistoryResponse, error) {
+	recipe, err := s.Repo.GetRecipeByHistoryID(historyID)
+	if err != nil {
+		return nil, err
+	}
+
+	if !canViewRecipeHistory(recipe, viewer) {
+		return nil, repository.NewNotFoundError("Recipe history not found")
+	}
+
 	// Fetch the recipe by its ID from the repository
 	history, err := s.Repo.GetHistoryByID(historyID)
 	if err != nil {
 		return nil, err
 	}
 
-	historyResponse := &HistoryResponse{Entries: history.Entries}
+	historyResponse := &HistoryResponse{
+		Entries:       history.Entries,
+		ActiveEntryID: history.ActiveEntryID,
+	}
 
 	return historyResponse, nil
 }
@@ -92,8 +225,20 @@ func (s *RecipeService) InitGenerateRecipeWithChat(user *models.User, userPrompt
 		return nil, errors.New("user's Personalization is nil")
 	}
 
+	if err := s.checkPrompt(userPrompt); err != nil {
+		return nil, err
+	}
+
+	shareSlug, err := util.GenerateRandomString(12)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate share slug: %v", err)
+	}
+
 	// Populate initial fields of the Recipe struct
 	recipe := &models.Recipe{
+		Visibility:         models.RecipeVisibilityPrivate,
+		ShareSlug:          shareSlug,
+		UnitSystem:         user.Personalization.UnitSystem, // The recipe is generated in the user's unit system
 		CreatedBy:          user,
 		PersonalizationUID: user.Personalization.UID, // Set from user's existing Personalization
 		History: &models.RecipeHistory{
@@ -106,7 +251,7 @@ func (s *RecipeService) InitGenerateRecipeWithChat(user *models.User, userPrompt
 		return nil, fmt.Errorf("failed to save recipe record: %w", err)
 	}
 
-	recipeResponse := toRecipeResponse(recipe)
+	recipeResponse := toRecipeResponseForViewer(recipe, user)
 
 	go s.FinishGenerateRecipeWithChat(recipe, user, userPrompt)
 
@@ -122,22 +267,38 @@ func (s *RecipeService) FinishGenerateRecipeWithChat(recipe *models.Recipe, user
 	recipeErrChan := make(chan error)
 	imageErrChan := make(chan error)
 
+	restrictions := dietary.FromPersonalization(user.Personalization)
+
 	recipeManager := &openai.RecipeManager{
-		UserPrompt:   userPrompt,
-		UnitSystem:   user.Personalization.GetUnitSystemText(),
-		Requirements: user.Personalization.Requirements,
-		Cfg:          s.Cfg,
+		UserPrompt:          userPrompt,
+		UnitSystem:          user.Personalization.GetUnitSystemText(),
+		Requirements:        user.Personalization.Requirements,
+		DietaryRestrictions: restrictions.PromptText(),
+		SysPromptTemplate:   s.selectSysPrompt(models.PromptGenNewRecipeSys, user),
+		Cfg:                 s.Cfg,
 	}
 
 	// Goroutine to handle recipe generation
 	go func(ctx context.Context, recipeErrChan chan<- error, imageErrChan chan<- error) {
-		if err := recipeManager.GenerateRecipeWithChat(); err != nil {
+		violations, err := generateWithinRestrictions(recipeManager, recipeManager.GenerateRecipeWithChat, restrictions)
+		if err != nil {
 			recipeErrChan <- err
 			return
 		}
 
+		// The entry is generated in the user's current unit system, which the recipe takes on
+		unitSystem := user.Personalization.UnitSystem
+		recipeManager.NextRecipeHistoryEntry.UnitSystem = &unitSystem
+
+		verdict := s.moderateRecipeDef(recipeManager.RecipeDef)
+
 		// Goroutine to handle image generation and upload
 		go func(ctx context.Context, imageErrChan chan<- error) {
+			if verdict.ImageFlagged {
+				imageErrChan <- fmt.Errorf("skipped image of recipe %d: image prompt flagged by moderation", recipe.ID)
+				return
+			}
+
 			if err := recipeManager.GenerateRecipeImage(); err != nil {
 				imageErrChan <- err
 				return
@@ -150,13 +311,22 @@ func (s *RecipeService) FinishGenerateRecipeWithChat(recipe *models.Recipe, user
 			recipeErrChan <- err
 			return
 		}
+		recipe.DietaryWarnings = dietary.Warnings(violations)
+
+		hashtags, err := s.TagService.NormalizeHashtags(recipeManager.RecipeDef.Hashtags)
+		if err != nil {
+			recipeErrChan <- err
+			return
+		}
 
-		if err := s.Repo.UpdateRecipeDef(recipe, recipeManager.NextRecipeHistoryEntry); err != nil {
+		// Flagged content is hidden in the same transaction that saves it, and isn't saved if it can't be hidden
+		flag := s.moderationFlag(recipe, user, verdict)
+		if err := s.Repo.UpdateRecipeDef(recipe, recipeManager.NextRecipeHistoryEntry, hashtags, flag); err != nil {
 			recipeErrChan <- err
 			return
 		}
 
-		if err := s.AssociateTagsWithRecipe(recipe, recipeManager.RecipeDef.Hashtags); err != nil {
+		if err := s.UpdateRecipeEmbedding(recipe); err != nil {
 			log.Println(err)
 		}
 
@@ -166,10 +336,11 @@ func (s *RecipeService) FinishGenerateRecipeWithChat(recipe *models.Recipe, user
 	// Wait for the recipe generation goroutine to finish or timeout
 	select {
 	case err := <-recipeErrChan:
+		s.PromptService.RecordPromptRun(models.PromptGenNewRecipeSys, recipeManager.SysPromptTemplate, user.ID, recipe.ID, recipeManager.TotalTokens, err)
 		if err != nil {
 			recipeID := recipe.ID
 			log.Printf("Error finishing recipe %d generation: %v", recipeID, err)
-			e := s.DeleteRecipe(recipeID)
+			e := s.PurgeRecipe(recipeID)
 			if e != nil {
 				log.Printf("error: failed to delete recipe %d: %v", recipeID, e)
 				return
@@ -184,9 +355,11 @@ func (s *RecipeService) FinishGenerateRecipeWithChat(recipe *models.Recipe, user
 		// }
 	case <-ctx.Done():
 		err := errors.New("incomplete recipe generation: timed out after 5 minutes")
+		// The generation is still running, so its token count can't be read
+		s.PromptService.RecordPromptRun(models.PromptGenNewRecipeSys, recipeManager.SysPromptTemplate, user.ID, recipe.ID, 0, err)
 		recipeID := recipe.ID
 		log.Printf("Error finishing recipe %d generation: %v", recipeID, err)
-		e := s.DeleteRecipe(recipeID)
+		e := s.PurgeRecipe(recipeID)
 		if e != nil {
 			log.Printf("error: failed to delete recipe %d: %v", recipeID, e)
 			return
@@ -222,19 +395,153 @@ func (s *RecipeService) FinishGenerateRecipeWithChat(recipe *models.Recipe, user
 	}
 }
 
-// DeleteRecipe deletes a recipe by its ID.
-func (s *RecipeService) DeleteRecipe(recipeID uint) error {
-	// Delete the recipe from the database
-	if err := s.Repo.DeleteRecipe(recipeID); err != nil {
-		return fmt.Errorf("failed to delete recipe: %w", err)
+// InitRegenerateRecipeWithChat starts regenerating a recipe with chat from one of its versions.
+// A fromVersion of 0 regenerates from the active version. Only the creator may regenerate a recipe.
+func (s *RecipeService) InitRegenerateRecipeWithChat(recipeID uint, user *models.User, userPrompt string, fromVersion int) (*RecipeResponse, error) {
+	recipe, err := s.Repo.GetRecipeByID(recipeID)
+	if err != nil {
+		return nil, err
+	}
+
+	if !canEditRecipe(recipe, user) {
+		return nil, recipeNotFound
 	}
 
-	// Delete the recipe image from S3
+	if err := s.checkPrompt(userPrompt); err != nil {
+		return nil, err
+	}
+
+	history, err := s.Repo.GetHistoryByID(recipe.HistoryID)
+	if err != nil {
+		return nil, err
+	}
+
+	var fromEntryID uint
+	if fromVersion == 0 {
+		if history.ActiveEntryID == nil {
+			return nil, errors.New("recipe has no active version to regenerate from")
+		}
+		fromEntryID = *history.ActiveEntryID
+	} else {
+		fromEntry, err := s.Repo.GetHistoryEntryByVersion(recipe.HistoryID, fromVersion)
+		if err != nil {
+			return nil, err
+		}
+		fromEntryID = fromEntry.ID
+	}
+
+	// Only the entries leading to the version being regenerated are replayed,
+	// so sibling variations don't leak into the conversation
+	ancestry, err := entryAncestry(history.Entries, fromEntryID)
+	if err != nil {
+		return nil, err
+	}
+
+	recipeResponse := toRecipeResponseForViewer(recipe, user)
+
+	go s.FinishRegenerateRecipeWithChat(recipe, user, userPrompt, ancestry)
+
+	return recipeResponse, nil
+}
+
+// FinishRegenerateRecipeWithChat finishes regenerating a recipe with chat, adding the result to the history
+// as a new active version branching from the last of the given entries. The recipe's image is kept.
+func (s *RecipeService) FinishRegenerateRecipeWithChat(recipe *models.Recipe, user *models.User, userPrompt string, entries []models.RecipeHistoryEntry) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+	defer cancel()
+
+	recipeErrChan := make(chan error, 1)
+
+	restrictions := dietary.FromPersonalization(user.Personalization)
+
+	recipeManager := &openai.RecipeManager{
+		UserPrompt:           userPrompt,
+		UnitSystem:           user.Personalization.GetUnitSystemText(),
+		Requirements:         user.Personalization.Requirements,
+		DietaryRestrictions:  restrictions.PromptText(),
+		RecipeHistoryEntries: entries,
+		SysPromptTemplate:    s.selectSysPrompt(models.PromptRegenRecipeSys, user),
+		Cfg:                  s.Cfg,
+	}
+
+	go func(recipeErrChan chan<- error) {
+		violations, err := generateWithinRestrictions(recipeManager, recipeManager.RegenerateRecipeWithChat, restrictions)
+		if err != nil {
+			recipeErrChan <- err
+			return
+		}
+
+		// The entry is generated in the user's current unit system, which the recipe takes on
+		unitSystem := user.Personalization.UnitSystem
+		recipeManager.NextRecipeHistoryEntry.UnitSystem = &unitSystem
+
+		verdict := s.moderateRecipeDef(recipeManager.RecipeDef)
+
+		recipe.RecipeDef = *recipeManager.RecipeDef
+		recipe.DietaryWarnings = dietary.Warnings(violations)
+		if user.Personalization != nil {
+			// The recipe is now personalized for the user's current settings
+			recipe.PersonalizationUID = user.Personalization.UID
+		}
+
+		hashtags, err := s.TagService.NormalizeHashtags(recipeManager.RecipeDef.Hashtags)
+		if err != nil {
+			recipeErrChan <- err
+			return
+		}
+
+		// Flagged content is hidden in the same transaction that saves it, and isn't saved if it can't be hidden
+		flag := s.moderationFlag(recipe, user, verdict)
+		if err := s.Repo.UpdateRecipeDef(recipe, recipeManager.NextRecipeHistoryEntry, hashtags, flag); err != nil {
+			recipeErrChan <- err
+			return
+		}
+
+		if err := s.UpdateRecipeEmbedding(recipe); err != nil {
+			log.Println(err)
+		}
+
+		recipeErrChan <- nil
+	}(recipeErrChan)
+
+	// The recipe keeps its current version if regeneration fails
+	select {
+	case err := <-recipeErrChan:
+		s.PromptService.RecordPromptRun(models.PromptRegenRecipeSys, recipeManager.SysPromptTemplate, user.ID, recipe.ID, recipeManager.TotalTokens, err)
+		if err != nil {
+			log.Printf("Error regenerating recipe %d: %v", recipe.ID, err)
+		}
+	case <-ctx.Done():
+		err := errors.New("incomplete recipe regeneration: timed out after 5 minutes")
+		s.PromptService.RecordPromptRun(models.PromptRegenRecipeSys, recipeManager.SysPromptTemplate, user.ID, recipe.ID, 0, err)
+		log.Printf("Error regenerating recipe %d: %v", recipe.ID, err)
+	}
+}
+
+// selectSysPrompt picks the version of a system prompt the user is assigned to,
+// or nil to use the template from the config.
+func (s *RecipeService) selectSysPrompt(name models.PromptName, user *models.User) *models.PromptTemplate {
+	promptTemplate, err := s.PromptService.SelectPromptTemplate(name, user.ID)
+	if err != nil {
+		log.Printf("error: failed to select %s prompt, using the config: %v", name, err)
+		return nil
+	}
+	return promptTemplate
+}
+
+// PurgeRecipe permanently deletes a recipe by its ID, along with its stored image.
+func (s *RecipeService) PurgeRecipe(recipeID uint) error {
+	// The image is deleted first, so a failure leaves the recipe in place for the purge to be retried
 	s3Key := s3.GenerateS3Key(recipeID)
 	if err := s3.DeleteRecipeImageFromS3(s.Cfg, s3Key); err != nil {
 		return fmt.Errorf("failed to delete recipe image from S3: %w", err)
 	}
 
+	// Delete the recipe from the database
+	if err := s.Repo.PurgeRecipe(recipeID); err != nil {
+		return fmt.Errorf("failed to delete recipe: %w", err)
+	}
+
 	return nil
 }
 
@@ -288,37 +595,6 @@ func uploadRecipeImage(recipeId uint, recipeManager *openai.RecipeManager, cfg *
 	return imageURL, nil
 }
 
-// AssociateTagsWithRecipe checks if each hashtag exists as a Tag in the database.
-// If it does, it uses the existing Tag's ID and Name.
-func (s *RecipeService) AssociateTagsWithRecipe(recipe *models.Recipe, tags []string) error {
-	var associatedTags []models.Tag
-
-	for _, hashtag := range tags {
-		cleanedHashtag := cleanHashtag(hashtag)
-
-		// Search for the tag by the cleaned name
-		existingTag, err := s.Repo.FindTagByName(cleanedHashtag)
-		if err == nil {
-			associatedTags = append(associatedTags, *existingTag)
-		} else if gorm.IsRecordNotFoundError(err) {
-			newTag := models.Tag{Hashtag: cleanedHashtag}
-			if err := s.Repo.CreateTag(&newTag); err != nil {
-				return fmt.Errorf("failed to create new tag: %v", err)
-			}
-			associatedTags = append(associatedTags, newTag)
-		} else {
-			return fmt.Errorf("database error while searching for tag: %v", err)
-		}
-	}
-
-	if err := s.Repo.UpdateRecipeTagsAssociation(recipe.ID, associatedTags); err != nil {
-		return fmt.Errorf("failed to update recipe with tags: %v", err)
-	}
-	// recipe.Hashtags = associatedTags
-
-	return nil
-}
-
 // toRecipeResponse converts a Recipe to a RecipeResponse
 func toRecipeResponse(r *models.Recipe) *RecipeResponse {
 	var forkedFromID *uint
@@ -331,36 +607,63 @@ func toRecipeResponse(r *models.Recipe) *RecipeResponse {
 		forkedFromName = &r.ForkedFrom.Title
 	}
 
+	// Recipes of deleted accounts that were kept anonymously have no creator
+	var createdByUsername string
+	if r.CreatedBy != nil {
+		createdByUsername = r.CreatedBy.Username
+	}
+
+	// Recipes saved before nutrition was tracked are estimated on the fly
+	recipeNutrition := r.Nutrition
+	if recipeNutrition == nil && len(r.Ingredients) > 0 {
+		recipeNutrition = nutrition.Estimate(r.Ingredients, r.Servings)
+	}
+
 	return &RecipeResponse{
 		ID:                 r.ID,
+		Version:            r.Version,
 		Title:              r.Title,
-		Ingredients:        r.Ingredients,
+		Ingredients:        formatIngredients(r.Ingredients),
 		Instructions:       r.Instructions,
 		CookTime:           r.CookTime,
+		Servings:           r.Servings,
+		Nutrition:          recipeNutrition,
+		DietaryWarnings:    r.DietaryWarnings,
 		UnitSystem:         r.UnitSystem,
 		LinkedRecipes:      r.LinkedRecipes,
 		LinkedSuggestions:  r.LinkedSuggestions,
 		Hashtags:           r.Hashtags,
 		ImageURL:           r.ImageURL,
 		CreatedByID:        r.CreatedByID,
-		CreatedByUsername:  r.CreatedBy.Username,
+		CreatedByUsername:  createdByUsername,
 		HistoryID:          r.HistoryID,
 		ForkedFromID:       forkedFromID,
 		ForkedFromName:     forkedFromName,
 		PersonalizationUID: r.PersonalizationUID,
+		Visibility:         string(r.Visibility),
+		Hidden:             isRecipeHidden(r),
 	}
 }
 
-// cleanHashtag formats a hashtag string.
-func cleanHashtag(hashtag string) string {
-	// Convert to lowercase
-	hashtag = strings.ToLower(hashtag)
+// toRecipeResponseForViewer converts a Recipe to a RecipeResponse,
+// including the fields only the creator may see when the viewer created the recipe.
+func toRecipeResponseForViewer(r *models.Recipe, viewer *models.User) *RecipeResponse {
+	recipeResponse := toRecipeResponse(r)
+
+	if isRecipeOwner(r, viewer) && r.ShareSlug != "" {
+		shareSlug := r.ShareSlug
+		recipeResponse.ShareSlug = &shareSlug
+	}
 
-	// Remove spaces
-	hashtag = strings.ReplaceAll(hashtag, " ", "")
+	if viewer != nil && viewer.Personalization != nil {
+		recipeResponse.UserUnitSystem = viewer.Personalization.UnitSystem
+		recipeResponse.UserPersonalizationUID = viewer.Personalization.UID
 
-	// Remove '#' if present
-	hashtag = strings.TrimPrefix(hashtag, "#")
+		// Recipes generated before personalizations had UIDs are never stale
+		if isRecipeOwner(r, viewer) && r.PersonalizationUID != uuid.Nil {
+			recipeResponse.PersonalizationStale = r.PersonalizationUID != viewer.Personalization.UID
+		}
+	}
 
-	return hashtag
+	return recipeResponse
 }
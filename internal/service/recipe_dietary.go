@@ -0,0 +1,36 @@
+package service
+
+import (
+	"log"
+	"strings"
+
+	"github.com/windoze95/saltybytes-api/internal/dietary"
+	"github.com/windoze95/saltybytes-api/internal/openai"
+)
+
+// maxDietaryAttempts is how many times a recipe is generated before it is kept with dietary warnings.
+const maxDietaryAttempts = 2
+
+// generateWithinRestrictions runs generate, checking the generated ingredients against the dietary restrictions
+// and retrying with feedback about what was wrong when they break them.
+// It returns the violations of the last attempt, which are kept on the recipe as warnings.
+// The feedback goes with the dietary restrictions rather than the user's requirements,
+// so it isn't wrapped as user text or cut off by the requirements length limit.
+func generateWithinRestrictions(recipeManager *openai.RecipeManager, generate func() error, restrictions dietary.Restrictions) ([]dietary.Violation, error) {
+	dietaryRestrictions := recipeManager.DietaryRestrictions
+
+	for attempt := 1; ; attempt++ {
+		if err := generate(); err != nil {
+			return nil, err
+		}
+
+		violations := restrictions.Check(recipeManager.RecipeDef.Ingredients)
+		if len(violations) == 0 || attempt == maxDietaryAttempts {
+			recipeManager.DietaryRestrictions = dietaryRestrictions
+			return violations, nil
+		}
+
+		log.Printf("Generated recipe broke %d dietary restrictions, retrying", len(violations))
+		recipeManager.DietaryRestrictions = strings.TrimSpace(dietaryRestrictions + "\n" + dietary.Feedback(violations))
+	}
+}
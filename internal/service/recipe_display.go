@@ -0,0 +1,93 @@
+package service
+
+import (
+	"github.com/windoze95/saltybytes-api/internal/models"
+	"github.com/windoze95/saltybytes-api/internal/nutrition"
+	"github.com/windoze95/saltybytes-api/internal/units"
+)
+
+// RecipeDisplayOptions are the adjustments a viewer asked for when fetching a recipe.
+type RecipeDisplayOptions struct {
+	// Servings scales the ingredients to the given number of servings, 0 uses the viewer's default.
+	Servings int
+	// UnitSystem converts the ingredients to the given unit system, nil uses the viewer's.
+	UnitSystem *models.UnitSystem
+}
+
+// applyDisplayOptions adjusts a recipe response to the display options.
+// Viewers' settings and personalization fill in the servings and unit system they didn't ask for.
+// Recipes that don't know how many servings they make are not scaled, and anonymous viewers
+// see the recipe in its own units unless they ask for a unit system. Ingredients that need neither
+// scaling nor converting are returned as stored.
+func applyDisplayOptions(recipeResponse *RecipeResponse, options RecipeDisplayOptions, viewer *models.User) {
+	if options.Servings == 0 && viewer != nil && viewer.Settings != nil {
+		options.Servings = viewer.Settings.DefaultServings
+	}
+
+	factor := 1.0
+	if options.Servings > 0 && recipeResponse.Servings > 0 && options.Servings != recipeResponse.Servings {
+		factor = float64(options.Servings) / float64(recipeResponse.Servings)
+		scaledFrom := recipeResponse.Servings
+		recipeResponse.ScaledFromServings = &scaledFrom
+		recipeResponse.Servings = options.Servings
+		recipeResponse.Nutrition = nutrition.Scale(recipeResponse.Nutrition, options.Servings)
+	}
+
+	unitSystem := options.UnitSystem
+	if unitSystem == nil && viewer != nil && viewer.Personalization != nil {
+		unitSystem = &recipeResponse.UserUnitSystem
+	}
+
+	// Ingredients are only rewritten when they have to change, rounding would alter the stored amounts
+	switch {
+	case unitSystem != nil && *unitSystem != recipeResponse.UnitSystem:
+		recipeResponse.Ingredients = convertIngredients(recipeResponse.Ingredients, factor, toUnitsSystem(*unitSystem))
+		recipeResponse.UnitSystem = *unitSystem
+	case factor != 1:
+		recipeResponse.Ingredients = scaleIngredients(recipeResponse.Ingredients, factor)
+	}
+}
+
+// scaleIngredients returns a copy of the ingredients scaled by factor, with the amounts
+// rounded and the units promoted or demoted so they read well.
+func scaleIngredients(ingredients models.Ingredients, factor float64) models.Ingredients {
+	scaled := make(models.Ingredients, len(ingredients))
+	for i, ingredient := range ingredients {
+		ingredient.Amount, ingredient.Unit = units.Scale(ingredient.Amount, ingredient.Unit, factor)
+		ingredient.AmountText = units.Format(ingredient.Amount, ingredient.Unit)
+		scaled[i] = ingredient
+	}
+	return scaled
+}
+
+// convertIngredients returns a copy of the ingredients scaled by factor and converted to the unit system.
+func convertIngredients(ingredients models.Ingredients, factor float64, system units.System) models.Ingredients {
+	converted := make(models.Ingredients, len(ingredients))
+	for i, ingredient := range ingredients {
+		ingredient.Amount, ingredient.Unit = units.Convert(ingredient.Amount*factor, ingredient.Unit, system, ingredient.Name)
+		ingredient.AmountText = units.Format(ingredient.Amount, ingredient.Unit)
+		converted[i] = ingredient
+	}
+	return converted
+}
+
+// toUnitsSystem maps a personalization unit system to its units package system.
+func toUnitsSystem(unitSystem models.UnitSystem) units.System {
+	if unitSystem == models.Metric {
+		return units.Metric
+	}
+	return units.USCustomary
+}
+
+// formatIngredients returns a copy of the ingredients with their amounts formatted for display.
+func formatIngredients(ingredients models.Ingredients) models.Ingredients {
+	if ingredients == nil {
+		return nil
+	}
+	formatted := make(models.Ingredients, len(ingredients))
+	for i, ingredient := range ingredients {
+		ingredient.AmountText = units.Format(ingredient.Amount, ingredient.Unit)
+		formatted[i] = ingredient
+	}
+	return formatted
+}
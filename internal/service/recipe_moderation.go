@@ -0,0 +1,140 @@
+package service
+
+import (
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/windoze95/saltybytes-api/internal/models"
+	"github.com/windoze95/saltybytes-api/internal/moderation"
+	"github.com/windoze95/saltybytes-api/internal/promptguard"
+)
+
+// moderationUnavailableCategory is recorded when a generated recipe couldn't be moderated,
+// so it is hidden and reviewed rather than published unchecked.
+const moderationUnavailableCategory = "moderation-unavailable"
+
+// ErrPromptTooLong is returned for prompts longer than promptguard.MaxUserPromptLength.
+var ErrPromptTooLong = fmt.Errorf("prompt must be at most %d characters long", promptguard.MaxUserPromptLength)
+
+// ContentRejectedError is returned when a prompt is rejected before generation, by moderation
+// or because it tries to override the system prompt.
+type ContentRejectedError struct {
+	Categories []string
+}
+
+// Error returns the error message.
+func (e ContentRejectedError) Error() string {
+	return "your request was rejected by content moderation"
+}
+
+// recipeModeration is the verdict of moderating a generated recipe.
+type recipeModeration struct {
+	Categories   []string
+	Content      string // The text that was flagged
+	ImageFlagged bool   // The image prompt was flagged, so no image is generated
+}
+
+// Flagged reports whether any part of the recipe was flagged.
+func (m *recipeModeration) Flagged() bool {
+	return m.Content != ""
+}
+
+// checkPrompt checks a user's prompt before anything is generated from it:
+// its length, prompt injection and moderation.
+func (s *RecipeService) checkPrompt(userPrompt string) error {
+	if len([]rune(userPrompt)) > promptguard.MaxUserPromptLength {
+		return ErrPromptTooLong
+	}
+
+	if patterns := promptguard.Detect(userPrompt); len(patterns) > 0 {
+		log.Printf("promptguard: rejected a prompt: %v", patterns)
+		return ContentRejectedError{Categories: patterns}
+	}
+
+	return s.moderatePrompt(userPrompt)
+}
+
+// moderatePrompt checks a user's prompt with the moderator.
+func (s *RecipeService) moderatePrompt(userPrompt string) error {
+	result, err := s.Moderator.Moderate(userPrompt)
+	if err != nil {
+		return fmt.Errorf("failed to moderate prompt: %w", err)
+	}
+	if result.Flagged {
+		log.Printf("moderation: %s rejected a prompt: %v", s.Moderator.Name(), result.Categories)
+		return ContentRejectedError{Categories: result.Categories}
+	}
+
+	return nil
+}
+
+// moderateRecipeDef checks the title, instructions and image prompt of a generated recipe.
+// A recipe that can't be moderated is treated as flagged.
+func (s *RecipeService) moderateRecipeDef(recipeDef *models.RecipeDef) *recipeModeration {
+	verdict := &recipeModeration{}
+
+	text := recipeDef.Title + "\n" + strings.Join(recipeDef.Instructions, "\n")
+	s.moderateText(verdict, text)
+
+	if recipeDef.ImagePrompt != "" {
+		before := verdict.Content
+		s.moderateText(verdict, recipeDef.ImagePrompt)
+		verdict.ImageFlagged = verdict.Content != before
+	}
+
+	return verdict
+}
+
+// moderateText checks a piece of a generated recipe, adding it to the verdict if it is flagged.
+func (s *RecipeService) moderateText(verdict *recipeModeration, text string) {
+	result, err := s.Moderator.Moderate(text)
+	if err != nil {
+		log.Printf("error: failed to moderate generated recipe: %v", err)
+		result = &moderation.Result{Flagged: true, Categories: []string{moderationUnavailableCategory}}
+	}
+	if !result.Flagged {
+		return
+	}
+
+	verdict.Categories = appendUnique(verdict.Categories, result.Categories...)
+	if verdict.Content != "" {
+		verdict.Content += "\n\n"
+	}
+	verdict.Content += text
+}
+
+// moderationFlag returns the flag queueing a generated recipe that moderation flagged for a moderator to review,
+// or nil when nothing was flagged. The recipe is hidden when it is saved with the flag, see RecipeRepository.UpdateRecipeDef.
+func (s *RecipeService) moderationFlag(recipe *models.Recipe, user *models.User, verdict *recipeModeration) *models.ModerationFlag {
+	if !verdict.Flagged() {
+		return nil
+	}
+
+	log.Printf("moderation: %s flagged recipe %d: %v", s.Moderator.Name(), recipe.ID, verdict.Categories)
+	return &models.ModerationFlag{
+		RecipeID:   recipe.ID,
+		UserID:     user.ID,
+		Moderator:  s.Moderator.Name(),
+		Categories: verdict.Categories,
+		Content:    verdict.Content,
+		Status:     models.ModerationFlagPending,
+	}
+}
+
+// appendUnique appends the values that aren't in the slice yet.
+func appendUnique(slice []string, values ...string) []string {
+	for _, value := range values {
+		found := false
+		for _, existing := range slice {
+			if existing == value {
+				found = true
+				break
+			}
+		}
+		if !found {
+			slice = append(slice, value)
+		}
+	}
+	return slice
+}
@@ -0,0 +1,59 @@
+package service
+
+import (
+	"github.com/windoze95/saltybytes-api/internal/models"
+	"github.com/windoze95/saltybytes-api/internal/repository"
+)
+
+// recipeNotFound is returned in place of a permission error, so recipes that can't be seen
+// are indistinguishable from recipes that don't exist.
+var recipeNotFound = repository.NewNotFoundError("Recipe not found")
+
+// isRecipeOwner reports whether the viewer created the recipe. An anonymous viewer is nil.
+func isRecipeOwner(recipe *models.Recipe, viewer *models.User) bool {
+	return viewer != nil && viewer.ID != 0 && recipe.CreatedByID == viewer.ID
+}
+
+// isRecipeHidden reports whether a moderator hid the recipe from everyone but its creator.
+func isRecipeHidden(recipe *models.Recipe) bool {
+	return recipe.HiddenAt != nil
+}
+
+// canViewRecipe reports whether the viewer may see the recipe by its ID.
+// Unlisted recipes are only reachable through their share slug, see canViewSharedRecipe.
+func canViewRecipe(recipe *models.Recipe, viewer *models.User) bool {
+	return isRecipeOwner(recipe, viewer) || (recipe.Visibility == models.RecipeVisibilityPublic && !isRecipeHidden(recipe))
+}
+
+// canViewSharedRecipe reports whether the viewer may see the recipe through its share slug.
+func canViewSharedRecipe(recipe *models.Recipe, viewer *models.User) bool {
+	return isRecipeOwner(recipe, viewer) || (recipe.Visibility != models.RecipeVisibilityPrivate && !isRecipeHidden(recipe))
+}
+
+// canViewCollectedRecipe reports whether a recipe in a collection may be seen by anyone the collection is shown to.
+// Unlisted recipes are only shown when they were added through their current share slug.
+func canViewCollectedRecipe(collectionRecipe *models.CollectionRecipe) bool {
+	recipe := collectionRecipe.Recipe
+	if isRecipeHidden(recipe) {
+		return false
+	}
+	switch recipe.Visibility {
+	case models.RecipeVisibilityPublic:
+		return true
+	case models.RecipeVisibilityUnlisted:
+		return collectionRecipe.ShareSlug != nil && *collectionRecipe.ShareSlug == recipe.ShareSlug
+	default:
+		return false
+	}
+}
+
+// canViewRecipeHistory reports whether the viewer may see the prompt history of the recipe.
+// Prompts are personal, so only the creator may see them.
+func canViewRecipeHistory(recipe *models.Recipe, viewer *models.User) bool {
+	return isRecipeOwner(recipe, viewer)
+}
+
+// canEditRecipe reports whether the viewer may change the recipe.
+func canEditRecipe(recipe *models.Recipe, viewer *models.User) bool {
+	return isRecipeOwner(recipe, viewer)
+}
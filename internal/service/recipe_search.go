@@ -0,0 +1,173 @@
+package service
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"time"
+
+	"github.com/windoze95/saltybytes-api/internal/embedding"
+	"github.com/windoze95/saltybytes-api/internal/models"
+	"github.com/windoze95/saltybytes-api/internal/repository"
+)
+
+// UpdateRecipeEmbedding computes and stores the embedding of a recipe from its current RecipeDef.
+func (s *RecipeService) UpdateRecipeEmbedding(recipe *models.Recipe) error {
+	_, err := s.updateRecipeEmbedding(recipe)
+	return err
+}
+
+// updateRecipeEmbedding computes and stores the embedding of a recipe and returns it.
+func (s *RecipeService) updateRecipeEmbedding(recipe *models.Recipe) (*models.RecipeEmbedding, error) {
+	vector, err := s.Embedder.Embed(embedding.RecipeText(&recipe.RecipeDef))
+	if err != nil {
+		return nil, fmt.Errorf("failed to compute embedding for recipe %d: %v", recipe.ID, err)
+	}
+
+	recipeEmbedding := &models.RecipeEmbedding{
+		RecipeID: recipe.ID,
+		Provider: s.Embedder.Name(),
+		Vector:   vector,
+	}
+	if err := s.Repo.UpsertRecipeEmbedding(recipeEmbedding); err != nil {
+		return nil, fmt.Errorf("failed to save embedding for recipe %d: %v", recipe.ID, err)
+	}
+
+	return recipeEmbedding, nil
+}
+
+// embeddingBatchSize is how many recipes StartEmbeddingJob embeds at a time.
+const embeddingBatchSize = 100
+
+// StartEmbeddingJob embeds the recipes whose embeddings are missing, stale or computed by another provider
+// in the background at the given interval, so recipes whose embedding failed to update when they changed
+// become searchable again.
+func (s *RecipeService) StartEmbeddingJob(interval time.Duration) {
+	go func() {
+		for range time.Tick(interval) {
+			embedded, err := s.EmbedStaleRecipes(embeddingBatchSize)
+			if err != nil {
+				log.Printf("error: failed to embed stale recipes: %v", err)
+				continue
+			}
+			if embedded > 0 {
+				log.Printf("embedded %d recipes", embedded)
+			}
+		}
+	}()
+}
+
+// EmbedStaleRecipes embeds up to limit recipes whose embeddings are missing, stale or computed by another
+// provider. It returns the number of recipes embedded; a recipe that fails is logged and tried again next time.
+func (s *RecipeService) EmbedStaleRecipes(limit int) (int, error) {
+	recipes, err := s.Repo.GetRecipesToEmbed(s.Embedder.Name(), limit)
+	if err != nil {
+		return 0, err
+	}
+
+	embedded := 0
+	for i := range recipes {
+		recipes[i].RecipeDef.Hashtags = tagNames(recipes[i].Hashtags)
+		if _, err := s.updateRecipeEmbedding(&recipes[i]); err != nil {
+			log.Printf("error: %v", err)
+			continue
+		}
+		embedded++
+	}
+
+	return embedded, nil
+}
+
+// GetSimilarRecipes finds the public recipes closest in meaning to a recipe the viewer may see.
+func (s *RecipeService) GetSimilarRecipes(recipeID uint, viewer *models.User, limit int) ([]*RecipeResponse, error) {
+	recipe, err := s.Repo.GetRecipeByID(recipeID)
+	if err != nil {
+		return nil, err
+	}
+
+	if !canViewRecipe(recipe, viewer) {
+		return nil, recipeNotFound
+	}
+
+	// Recipes created before embeddings existed, changed since they were embedded or embedded
+	// with another provider are embedded on demand
+	recipeEmbedding, err := s.Repo.GetRecipeEmbedding(recipeID)
+	if _, ok := err.(repository.NotFoundError); ok || (err == nil && (recipeEmbedding.Stale || recipeEmbedding.Provider != s.Embedder.Name())) {
+		recipe.RecipeDef.Hashtags = tagNames(recipe.Hashtags)
+		recipeEmbedding, err = s.updateRecipeEmbedding(recipe)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var similarIDs []uint
+	if s.Repo.VectorSearch {
+		similarIDs, err = s.Repo.FindNearestRecipeIDs(recipeEmbedding.Vector, recipeEmbedding.Provider, recipeID, limit)
+	} else {
+		similarIDs, err = s.findNearestRecipeIDsInProcess(recipeEmbedding, limit)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to search similar recipes: %w", err)
+	}
+
+	recipes, err := s.Repo.GetRecipesByIDs(similarIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	recipeResponses := make([]*RecipeResponse, 0, len(recipes))
+	for i := range recipes {
+		recipeResponses = append(recipeResponses, toRecipeResponse(&recipes[i]))
+	}
+
+	return recipeResponses, nil
+}
+
+// findNearestRecipeIDsInProcess is the fallback nearest-neighbour search when pgvector is unavailable.
+// It loads every embedding of the same provider and ranks them by cosine similarity.
+func (s *RecipeService) findNearestRecipeIDsInProcess(target *models.RecipeEmbedding, limit int) ([]uint, error) {
+	candidates, err := s.Repo.GetRecipeEmbeddingsByProvider(target.Provider)
+	if err != nil {
+		return nil, err
+	}
+
+	type scoredRecipe struct {
+		recipeID uint
+		score    float64
+	}
+
+	scored := make([]scoredRecipe, 0, len(candidates))
+	for _, candidate := range candidates {
+		if candidate.RecipeID == target.RecipeID {
+			continue
+		}
+		scored = append(scored, scoredRecipe{
+			recipeID: candidate.RecipeID,
+			score:    embedding.CosineSimilarity(target.Vector, candidate.Vector),
+		})
+	}
+
+	sort.Slice(scored, func(i, j int) bool {
+		return scored[i].score > scored[j].score
+	})
+
+	if len(scored) > limit {
+		scored = scored[:limit]
+	}
+
+	recipeIDs := make([]uint, len(scored))
+	for i, sr := range scored {
+		recipeIDs[i] = sr.recipeID
+	}
+
+	return recipeIDs, nil
+}
+
+// tagNames returns the hashtag names of tags.
+func tagNames(tags []*models.Tag) []string {
+	names := make([]string, 0, len(tags))
+	for _, tag := range tags {
+		names = append(names, tag.Hashtag)
+	}
+	return names
+}
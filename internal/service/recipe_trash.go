@@ -0,0 +1,107 @@
+package service
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/windoze95/saltybytes-api/internal/models"
+)
+
+// TrashRetention is how long a deleted recipe can be restored before it is purged.
+const TrashRetention = 30 * 24 * time.Hour
+
+// TrashedRecipeResponse is the response object for a deleted recipe in the trash.
+type TrashedRecipeResponse struct {
+	*RecipeResponse
+	DeletedAt time.Time `json:"deleted_at"`
+	PurgeAt   time.Time `json:"purge_at"`
+}
+
+// DeleteRecipe moves a recipe to the trash. Only the creator may delete it.
+func (s *RecipeService) DeleteRecipe(recipeID uint, viewer *models.User) error {
+	recipe, err := s.Repo.GetRecipeByID(recipeID)
+	if err != nil {
+		return err
+	}
+
+	if !canEditRecipe(recipe, viewer) {
+		return recipeNotFound
+	}
+
+	return s.Repo.DeleteRecipe(recipe.ID)
+}
+
+// GetTrash fetches the viewer's deleted recipes that can still be restored.
+func (s *RecipeService) GetTrash(viewer *models.User) ([]*TrashedRecipeResponse, error) {
+	recipes, err := s.Repo.GetDeletedRecipesByUserID(viewer.ID, time.Now().Add(-TrashRetention))
+	if err != nil {
+		return nil, err
+	}
+
+	trashedRecipeResponses := make([]*TrashedRecipeResponse, 0, len(recipes))
+	for i := range recipes {
+		recipe := &recipes[i]
+		trashedRecipeResponses = append(trashedRecipeResponses, &TrashedRecipeResponse{
+			RecipeResponse: toRecipeResponseForViewer(recipe, viewer),
+			DeletedAt:      *recipe.DeletedAt,
+			PurgeAt:        recipe.DeletedAt.Add(TrashRetention),
+		})
+	}
+
+	return trashedRecipeResponses, nil
+}
+
+// RestoreRecipe restores a recipe from the trash. Only the creator may restore it.
+func (s *RecipeService) RestoreRecipe(recipeID uint, viewer *models.User) (*RecipeResponse, error) {
+	recipe, err := s.Repo.GetDeletedRecipeByID(recipeID)
+	if err != nil {
+		return nil, err
+	}
+
+	if !canEditRecipe(recipe, viewer) || recipe.DeletedAt.Before(time.Now().Add(-TrashRetention)) {
+		return nil, recipeNotFound
+	}
+
+	if err := s.Repo.RestoreRecipe(recipe); err != nil {
+		return nil, fmt.Errorf("failed to restore recipe: %w", err)
+	}
+
+	return s.GetRecipeByID(recipe.ID, viewer, RecipeDisplayOptions{})
+}
+
+// PurgeExpiredTrash permanently deletes the recipes that have been in the trash longer than TrashRetention,
+// along with their stored images. Returns the number of purged recipes.
+func (s *RecipeService) PurgeExpiredTrash() (int, error) {
+	recipeIDs, err := s.Repo.GetRecipeIDsDeletedBefore(time.Now().Add(-TrashRetention))
+	if err != nil {
+		return 0, err
+	}
+
+	purged := 0
+	for _, recipeID := range recipeIDs {
+		if err := s.PurgeRecipe(recipeID); err != nil {
+			log.Printf("error: failed to purge recipe %d: %v", recipeID, err)
+			continue
+		}
+		purged++
+	}
+
+	return purged, nil
+}
+
+// StartTrashPurgeJob runs PurgeExpiredTrash in the background at the given interval.
+func (s *RecipeService) StartTrashPurgeJob(interval time.Duration) {
+	go func() {
+		for range time.Tick(interval) {
+			purged, err := s.PurgeExpiredTrash()
+			if err != nil {
+				log.Printf("error: failed to purge expired trash: %v", err)
+				continue
+			}
+			if purged > 0 {
+				log.Printf("purged %d expired recipes from the trash", purged)
+			}
+		}
+	}()
+}
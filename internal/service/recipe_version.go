@@ -0,0 +1,414 @@
+package service
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/windoze95/saltybytes-api/internal/dietary"
+	"github.com/windoze95/saltybytes-api/internal/models"
+)
+
+// RecipeVersionResponse is the response object for a version in a recipe's history.
+type RecipeVersionResponse struct {
+	Version       int               `json:"version"`
+	EntryID       uint              `json:"entry_id"`
+	ParentEntryID *uint             `json:"parent_entry_id"`
+	Type          models.RecipeType `json:"type"`
+	UserPrompt    string            `json:"user_prompt"`
+	Title         string            `json:"title"`
+	Active        bool              `json:"active"`
+	CreatedAt     time.Time         `json:"created_at"`
+}
+
+// RecipeVersionNode is a version in the tree of a recipe's variations.
+type RecipeVersionNode struct {
+	RecipeVersionResponse
+	Children []*RecipeVersionNode `json:"children"`
+}
+
+// RecipeDiff is a structured diff between two versions of a recipe.
+type RecipeDiff struct {
+	FromVersion  int              `json:"from_version"`
+	ToVersion    int              `json:"to_version"`
+	Title        *StringChange    `json:"title,omitempty"`
+	CookTime     *IntChange       `json:"cook_time,omitempty"`
+	Servings     *IntChange       `json:"servings,omitempty"`
+	Ingredients  IngredientsDiff  `json:"ingredients"`
+	Instructions InstructionsDiff `json:"instructions"`
+}
+
+// StringChange is a changed string field.
+type StringChange struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+}
+
+// IntChange is a changed integer field.
+type IntChange struct {
+	From int `json:"from"`
+	To   int `json:"to"`
+}
+
+// IngredientsDiff lists the ingredients added, removed and changed between two versions.
+// Ingredients are matched by name.
+type IngredientsDiff struct {
+	Added   []models.Ingredient `json:"added"`
+	Removed []models.Ingredient `json:"removed"`
+	Changed []IngredientChange  `json:"changed"`
+}
+
+// IngredientChange is an ingredient whose unit or amount changed.
+type IngredientChange struct {
+	Name string            `json:"name"`
+	From models.Ingredient `json:"from"`
+	To   models.Ingredient `json:"to"`
+}
+
+// InstructionsDiff lists the instruction steps added, removed and changed between two versions.
+type InstructionsDiff struct {
+	Added   []InstructionStep   `json:"added"`
+	Removed []InstructionStep   `json:"removed"`
+	Changed []InstructionChange `json:"changed"`
+}
+
+// InstructionStep is an instruction with its 1-based step number in the version it belongs to.
+type InstructionStep struct {
+	Step int    `json:"step"`
+	Text string `json:"text"`
+}
+
+// InstructionChange is an instruction step that was reworded.
+type InstructionChange struct {
+	FromStep int    `json:"from_step"`
+	ToStep   int    `json:"to_step"`
+	From     string `json:"from"`
+	To       string `json:"to"`
+}
+
+// GetRecipeVersions fetches the versions of a recipe, oldest first.
+// Versions carry the prompts they were generated with, so only the creator may see them.
+func (s *RecipeService) GetRecipeVersions(recipeID uint, viewer *models.User) ([]RecipeVersionResponse, error) {
+	recipe, err := s.Repo.GetRecipeByID(recipeID)
+	if err != nil {
+		return nil, err
+	}
+
+	if !canViewRecipeHistory(recipe, viewer) {
+		return nil, recipeNotFound
+	}
+
+	history, err := s.Repo.GetHistoryByID(recipe.HistoryID)
+	if err != nil {
+		return nil, err
+	}
+
+	versions := make([]RecipeVersionResponse, 0, len(history.Entries))
+	for _, entry := range history.Entries {
+		versions = append(versions, toRecipeVersionResponse(&entry, history.ActiveEntryID))
+	}
+
+	return versions, nil
+}
+
+// GetRecipeVersionTree fetches the versions of a recipe as a tree, where each version's children
+// are the variations generated from it. Only the creator may see its versions.
+func (s *RecipeService) GetRecipeVersionTree(recipeID uint, viewer *models.User) ([]*RecipeVersionNode, error) {
+	recipe, err := s.Repo.GetRecipeByID(recipeID)
+	if err != nil {
+		return nil, err
+	}
+
+	if !canViewRecipeHistory(recipe, viewer) {
+		return nil, recipeNotFound
+	}
+
+	history, err := s.Repo.GetHistoryByID(recipe.HistoryID)
+	if err != nil {
+		return nil, err
+	}
+
+	nodes := make(map[uint]*RecipeVersionNode, len(history.Entries))
+	for _, entry := range history.Entries {
+		nodes[entry.ID] = &RecipeVersionNode{
+			RecipeVersionResponse: toRecipeVersionResponse(&entry, history.ActiveEntryID),
+			Children:              []*RecipeVersionNode{},
+		}
+	}
+
+	// Entries are ordered by version, so children stay in the order they were created
+	roots := []*RecipeVersionNode{}
+	for _, entry := range history.Entries {
+		node := nodes[entry.ID]
+		if entry.ParentEntryID != nil {
+			if parent, ok := nodes[*entry.ParentEntryID]; ok {
+				parent.Children = append(parent.Children, node)
+				continue
+			}
+		}
+		roots = append(roots, node)
+	}
+
+	return roots, nil
+}
+
+// toRecipeVersionResponse converts a recipe history entry to a version response.
+func toRecipeVersionResponse(entry *models.RecipeHistoryEntry, activeEntryID *uint) RecipeVersionResponse {
+	version := RecipeVersionResponse{
+		Version:       entry.Version,
+		EntryID:       entry.ID,
+		ParentEntryID: entry.ParentEntryID,
+		Type:          entry.Type,
+		UserPrompt:    entry.UserPrompt,
+		Active:        activeEntryID != nil && *activeEntryID == entry.ID,
+		CreatedAt:     entry.CreatedAt,
+	}
+	if entry.RecipeResponse != nil {
+		version.Title = entry.RecipeResponse.Title
+	}
+	return version
+}
+
+// entryAncestry returns the entry with the given ID and its ancestors, oldest first.
+func entryAncestry(entries []models.RecipeHistoryEntry, entryID uint) ([]models.RecipeHistoryEntry, error) {
+	byID := make(map[uint]models.RecipeHistoryEntry, len(entries))
+	for _, entry := range entries {
+		byID[entry.ID] = entry
+	}
+
+	var ancestry []models.RecipeHistoryEntry
+	id := &entryID
+	for id != nil {
+		entry, ok := byID[*id]
+		if !ok {
+			return nil, fmt.Errorf("recipe history entry %d not found", *id)
+		}
+		if len(ancestry) > len(entries) {
+			return nil, fmt.Errorf("recipe history entry %d has a cyclic ancestry", entryID)
+		}
+		ancestry = append(ancestry, entry)
+		id = entry.ParentEntryID
+	}
+
+	// Reverse so the root comes first
+	for i, j := 0, len(ancestry)-1; i < j; i, j = i+1, j-1 {
+		ancestry[i], ancestry[j] = ancestry[j], ancestry[i]
+	}
+
+	return ancestry, nil
+}
+
+// DiffRecipeVersions compares two versions of a recipe. Only the creator may see its versions.
+func (s *RecipeService) DiffRecipeVersions(recipeID uint, fromVersion, toVersion int, viewer *models.User) (*RecipeDiff, error) {
+	recipe, err := s.Repo.GetRecipeByID(recipeID)
+	if err != nil {
+		return nil, err
+	}
+
+	if !canViewRecipeHistory(recipe, viewer) {
+		return nil, recipeNotFound
+	}
+
+	fromEntry, err := s.Repo.GetHistoryEntryByVersion(recipe.HistoryID, fromVersion)
+	if err != nil {
+		return nil, err
+	}
+
+	toEntry, err := s.Repo.GetHistoryEntryByVersion(recipe.HistoryID, toVersion)
+	if err != nil {
+		return nil, err
+	}
+
+	from := models.RecipeDef{}
+	if fromEntry.RecipeResponse != nil {
+		from = *fromEntry.RecipeResponse
+	}
+	to := models.RecipeDef{}
+	if toEntry.RecipeResponse != nil {
+		to = *toEntry.RecipeResponse
+	}
+
+	recipeDiff := diffRecipeDefs(&from, &to)
+	recipeDiff.FromVersion = fromVersion
+	recipeDiff.ToVersion = toVersion
+
+	return recipeDiff, nil
+}
+
+// ActivateRecipeVersion restores an older version of a recipe as the active version.
+// Only the creator may activate a version.
+func (s *RecipeService) ActivateRecipeVersion(recipeID uint, version int, viewer *models.User) (*RecipeResponse, error) {
+	recipe, err := s.Repo.GetRecipeByID(recipeID)
+	if err != nil {
+		return nil, err
+	}
+
+	if !canEditRecipe(recipe, viewer) {
+		return nil, recipeNotFound
+	}
+
+	entry, err := s.Repo.GetHistoryEntryByVersion(recipe.HistoryID, version)
+	if err != nil {
+		return nil, err
+	}
+
+	if entry.RecipeResponse == nil {
+		return nil, fmt.Errorf("version %d has no recipe", version)
+	}
+
+	hashtags, err := s.TagService.NormalizeHashtags(entry.RecipeResponse.Hashtags)
+	if err != nil {
+		return nil, err
+	}
+
+	// The restored version is checked against the creator's current restrictions
+	restrictions := dietary.FromPersonalization(viewer.Personalization)
+	recipe.DietaryWarnings = dietary.Warnings(restrictions.Check(entry.RecipeResponse.Ingredients))
+
+	if err := s.Repo.ActivateHistoryEntry(recipe, entry, hashtags); err != nil {
+		return nil, fmt.Errorf("failed to activate version %d: %w", version, err)
+	}
+
+	if err := s.UpdateRecipeEmbedding(recipe); err != nil {
+		log.Println(err)
+	}
+
+	return toRecipeResponseForViewer(recipe, viewer), nil
+}
+
+// diffRecipeDefs compares two recipe definitions.
+func diffRecipeDefs(from, to *models.RecipeDef) *RecipeDiff {
+	recipeDiff := &RecipeDiff{
+		Ingredients:  diffIngredients(from.Ingredients, to.Ingredients),
+		Instructions: diffInstructions(from.Instructions, to.Instructions),
+	}
+
+	if from.Title != to.Title {
+		recipeDiff.Title = &StringChange{From: from.Title, To: to.Title}
+	}
+
+	if from.CookTime != to.CookTime {
+		recipeDiff.CookTime = &IntChange{From: from.CookTime, To: to.CookTime}
+	}
+
+	if from.Servings != to.Servings {
+		recipeDiff.Servings = &IntChange{From: from.Servings, To: to.Servings}
+	}
+
+	return recipeDiff
+}
+
+// diffIngredients compares two ingredient lists, matching ingredients by name.
+func diffIngredients(from, to models.Ingredients) IngredientsDiff {
+	ingredientsDiff := IngredientsDiff{
+		Added:   []models.Ingredient{},
+		Removed: []models.Ingredient{},
+		Changed: []IngredientChange{},
+	}
+
+	fromByName := make(map[string]models.Ingredient, len(from))
+	for _, ingredient := range from {
+		fromByName[ingredientKey(ingredient)] = ingredient
+	}
+
+	toByName := make(map[string]bool, len(to))
+	for _, ingredient := range to {
+		key := ingredientKey(ingredient)
+		toByName[key] = true
+
+		previous, ok := fromByName[key]
+		switch {
+		case !ok:
+			ingredientsDiff.Added = append(ingredientsDiff.Added, ingredient)
+		case previous.Unit != ingredient.Unit || previous.Amount != ingredient.Amount:
+			ingredientsDiff.Changed = append(ingredientsDiff.Changed, IngredientChange{
+				Name: ingredient.Name,
+				From: previous,
+				To:   ingredient,
+			})
+		}
+	}
+
+	for _, ingredient := range from {
+		if !toByName[ingredientKey(ingredient)] {
+			ingredientsDiff.Removed = append(ingredientsDiff.Removed, ingredient)
+		}
+	}
+
+	return ingredientsDiff
+}
+
+// ingredientKey is the key used to match the same ingredient across versions.
+func ingredientKey(ingredient models.Ingredient) string {
+	return strings.ToLower(strings.TrimSpace(ingredient.Name))
+}
+
+// diffInstructions compares two instruction lists with a longest common subsequence,
+// pairing a removed step directly followed by an added step as a changed step.
+func diffInstructions(from, to []string) InstructionsDiff {
+	instructionsDiff := InstructionsDiff{
+		Added:   []InstructionStep{},
+		Removed: []InstructionStep{},
+		Changed: []InstructionChange{},
+	}
+
+	// lcs[i][j] is the length of the longest common subsequence of from[i:] and to[j:]
+	lcs := make([][]int, len(from)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(to)+1)
+	}
+	for i := len(from) - 1; i >= 0; i-- {
+		for j := len(to) - 1; j >= 0; j-- {
+			if from[i] == to[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else if lcs[i+1][j] >= lcs[i][j+1] {
+				lcs[i][j] = lcs[i+1][j]
+			} else {
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+
+	var removed []InstructionStep
+	var added []InstructionStep
+
+	// flush pairs up the pending removed and added steps between two unchanged steps
+	flush := func() {
+		n := len(removed)
+		if len(added) < n {
+			n = len(added)
+		}
+		for k := 0; k < n; k++ {
+			instructionsDiff.Changed = append(instructionsDiff.Changed, InstructionChange{
+				FromStep: removed[k].Step,
+				ToStep:   added[k].Step,
+				From:     removed[k].Text,
+				To:       added[k].Text,
+			})
+		}
+		instructionsDiff.Removed = append(instructionsDiff.Removed, removed[n:]...)
+		instructionsDiff.Added = append(instructionsDiff.Added, added[n:]...)
+		removed = nil
+		added = nil
+	}
+
+	i, j := 0, 0
+	for i < len(from) || j < len(to) {
+		switch {
+		case i < len(from) && j < len(to) && from[i] == to[j]:
+			flush()
+			i++
+			j++
+		case j >= len(to) || (i < len(from) && lcs[i+1][j] >= lcs[i][j+1]):
+			removed = append(removed, InstructionStep{Step: i + 1, Text: from[i]})
+			i++
+		default:
+			added = append(added, InstructionStep{Step: j + 1, Text: to[j]})
+			j++
+		}
+	}
+	flush()
+
+	return instructionsDiff
+}
@@ -0,0 +1,335 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/jinzhu/inflection"
+	"github.com/windoze95/saltybytes-api/internal/config"
+	"github.com/windoze95/saltybytes-api/internal/models"
+	"github.com/windoze95/saltybytes-api/internal/repository"
+)
+
+var (
+	// ErrInvalidHashtag is returned for hashtags that are empty once normalized, e.g. "#!".
+	ErrInvalidHashtag = errors.New("invalid hashtag")
+	// ErrInvalidTagAlias is returned for tag aliases without an alias or hashtag, or that alias a hashtag to itself.
+	ErrInvalidTagAlias = errors.New("alias and hashtag are required and must differ")
+)
+
+// TagService is the business logic layer for tag-related operations.
+type TagService struct {
+	Cfg  *config.Config
+	Repo *repository.TagRepository
+}
+
+// TagResponse is the response object for tag-related operations.
+type TagResponse struct {
+	ID         uint   `json:"ID"`
+	Hashtag    string `json:"hashtag"`
+	UsageCount int    `json:"usage_count"`
+}
+
+// TagRecipesResponse is the response object for a page of recipes associated with a tag.
+type TagRecipesResponse struct {
+	Tag      string            `json:"tag"`
+	Recipes  []*RecipeResponse `json:"recipes"`
+	Page     int               `json:"page"`
+	PageSize int               `json:"page_size"`
+	Total    int               `json:"total"`
+}
+
+// TagAliasResponse is the response object for a tag alias.
+type TagAliasResponse struct {
+	ID      uint   `json:"ID"`
+	Alias   string `json:"alias"`
+	Hashtag string `json:"hashtag"`
+}
+
+// NewTagService is the constructor function for initializing a new TagService
+func NewTagService(cfg *config.Config, repo *repository.TagRepository) *TagService {
+	return &TagService{
+		Cfg:  cfg,
+		Repo: repo,
+	}
+}
+
+// SearchTags fetches tags starting with a prefix, for autocomplete.
+func (s *TagService) SearchTags(prefix string, limit int) ([]TagResponse, error) {
+	tagUsages, err := s.Repo.SearchTagsByPrefix(cleanHashtag(prefix), limit)
+	if err != nil {
+		return nil, err
+	}
+
+	return toTagResponses(tagUsages), nil
+}
+
+// GetTrendingTags fetches the tags most used by recipes created in the last number of days.
+func (s *TagService) GetTrendingTags(days int, limit int) ([]TagResponse, error) {
+	since := time.Now().AddDate(0, 0, -days)
+
+	tagUsages, err := s.Repo.GetTrendingTags(since, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	return toTagResponses(tagUsages), nil
+}
+
+// GetRecipesByTag fetches a page of recipes associated with a hashtag.
+// The hashtag is normalized first, so "#Burgers" finds recipes tagged "burger".
+func (s *TagService) GetRecipesByTag(hashtag string, page, pageSize int) (*TagRecipesResponse, error) {
+	normalized, err := s.NormalizeHashtags([]string{hashtag})
+	if err != nil {
+		return nil, err
+	}
+	if len(normalized) == 0 {
+		return nil, ErrInvalidHashtag
+	}
+
+	tag, err := s.Repo.GetTagByHashtag(normalized[0])
+	if err != nil {
+		return nil, err
+	}
+
+	recipes, total, err := s.Repo.GetRecipesByTagID(tag.ID, (page-1)*pageSize, pageSize)
+	if err != nil {
+		return nil, err
+	}
+
+	recipeResponses := make([]*RecipeResponse, 0, len(recipes))
+	for i := range recipes {
+		recipeResponses = append(recipeResponses, toRecipeResponse(&recipes[i]))
+	}
+
+	return &TagRecipesResponse{
+		Tag:      tag.Hashtag,
+		Recipes:  recipeResponses,
+		Page:     page,
+		PageSize: pageSize,
+		Total:    total,
+	}, nil
+}
+
+// NormalizeHashtags converts raw hashtags into their canonical form.
+// Each hashtag is cleaned, singularized and resolved through the alias table,
+// duplicates are dropped and the original order is kept.
+func (s *TagService) NormalizeHashtags(hashtags []string) ([]string, error) {
+	var normalized []string
+	for _, hashtag := range hashtags {
+		if n := normalizeHashtag(hashtag); n != "" {
+			normalized = append(normalized, n)
+		}
+	}
+
+	if len(normalized) == 0 {
+		return normalized, nil
+	}
+
+	resolved, err := s.Repo.ResolveTagAliases(normalized)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve tag aliases: %v", err)
+	}
+
+	seen := make(map[string]bool, len(normalized))
+	canonical := make([]string, 0, len(normalized))
+	for _, hashtag := range normalized {
+		if c, ok := resolved[hashtag]; ok {
+			hashtag = c
+		}
+		if !seen[hashtag] {
+			seen[hashtag] = true
+			canonical = append(canonical, hashtag)
+		}
+	}
+
+	return canonical, nil
+}
+
+// GetTagAliases fetches every tag alias.
+func (s *TagService) GetTagAliases() ([]TagAliasResponse, error) {
+	tagAliases, err := s.Repo.GetTagAliases()
+	if err != nil {
+		return nil, err
+	}
+
+	tagAliasResponses := make([]TagAliasResponse, 0, len(tagAliases))
+	for _, tagAlias := range tagAliases {
+		tagAliasResponses = append(tagAliasResponses, toTagAliasResponse(&tagAlias))
+	}
+
+	return tagAliasResponses, nil
+}
+
+// CreateTagAlias makes an alias resolve to a canonical hashtag, replacing the hashtag of an existing alias.
+// Recipes already tagged with the alias are moved to the canonical tag.
+func (s *TagService) CreateTagAlias(alias, hashtag string) (*TagAliasResponse, error) {
+	// Hashtags are normalized before they are resolved, so the alias must be too
+	alias = normalizeHashtag(alias)
+	hashtag = normalizeHashtag(hashtag)
+	if alias == "" || hashtag == "" || alias == hashtag {
+		return nil, ErrInvalidTagAlias
+	}
+
+	tag, err := s.Repo.FindOrCreateTag(hashtag)
+	if err != nil {
+		return nil, err
+	}
+
+	tagAlias := &models.TagAlias{Alias: alias, TagID: tag.ID, Tag: tag}
+	if err := s.Repo.CreateTagAlias(tagAlias); err != nil {
+		return nil, fmt.Errorf("failed to create tag alias: %w", err)
+	}
+
+	tagAliasResponse := toTagAliasResponse(tagAlias)
+
+	return &tagAliasResponse, nil
+}
+
+// DeleteTagAlias deletes a tag alias.
+func (s *TagService) DeleteTagAlias(tagAliasID uint) error {
+	return s.Repo.DeleteTagAlias(tagAliasID)
+}
+
+// MergeDuplicateTags merges every existing tag whose normalized form differs from its hashtag into the tag
+// of the normalized form, e.g. "burgers" created before normalization is merged into "burger", and normalizes
+// the existing aliases the same way. It is safe to run again. Returns the number of merged tags.
+func (s *TagService) MergeDuplicateTags() (int, error) {
+	tags, err := s.Repo.GetAllTags()
+	if err != nil {
+		return 0, err
+	}
+
+	merged := 0
+	for _, tag := range tags {
+		normalized := normalizeHashtag(tag.Hashtag)
+		if normalized == "" || normalized == tag.Hashtag {
+			continue
+		}
+
+		// The normalized form may itself be an alias of another tag
+		resolved, err := s.Repo.ResolveTagAliases([]string{normalized})
+		if err != nil {
+			return merged, err
+		}
+		if canonical, ok := resolved[normalized]; ok {
+			normalized = canonical
+		}
+
+		into, err := s.Repo.FindOrCreateTag(normalized)
+		if err != nil {
+			return merged, err
+		}
+		if err := s.Repo.MergeTags(tag.ID, into.ID); err != nil {
+			return merged, fmt.Errorf("failed to merge tag %s: %w", tag.Hashtag, err)
+		}
+		merged++
+	}
+
+	tagAliases, err := s.Repo.GetTagAliases()
+	if err != nil {
+		return merged, err
+	}
+	for _, tagAlias := range tagAliases {
+		normalized := normalizeHashtag(tagAlias.Alias)
+		if normalized == tagAlias.Alias || tagAlias.Tag == nil {
+			continue
+		}
+		if normalized != tagAlias.Tag.Hashtag {
+			if _, err := s.CreateTagAlias(normalized, tagAlias.Tag.Hashtag); err != nil {
+				return merged, err
+			}
+		}
+		if err := s.Repo.DeleteTagAlias(tagAlias.ID); err != nil {
+			return merged, err
+		}
+	}
+
+	return merged, nil
+}
+
+// toTagResponses converts TagUsages to TagResponses.
+func toTagResponses(tagUsages []repository.TagUsage) []TagResponse {
+	tagResponses := make([]TagResponse, 0, len(tagUsages))
+	for _, tagUsage := range tagUsages {
+		tagResponses = append(tagResponses, TagResponse{
+			ID:         tagUsage.ID,
+			Hashtag:    tagUsage.Hashtag,
+			UsageCount: tagUsage.UsageCount,
+		})
+	}
+	return tagResponses
+}
+
+// toTagAliasResponse converts a TagAlias to a TagAliasResponse.
+func toTagAliasResponse(tagAlias *models.TagAlias) TagAliasResponse {
+	tagAliasResponse := TagAliasResponse{
+		ID:    tagAlias.ID,
+		Alias: tagAlias.Alias,
+	}
+	if tagAlias.Tag != nil {
+		tagAliasResponse.Hashtag = tagAlias.Tag.Hashtag
+	}
+	return tagAliasResponse
+}
+
+// cleanHashtag formats a hashtag string.
+func cleanHashtag(hashtag string) string {
+	// Convert to lowercase
+	hashtag = strings.ToLower(hashtag)
+
+	// Remove spaces
+	hashtag = strings.ReplaceAll(hashtag, " ", "")
+
+	// Remove '#' if present
+	hashtag = strings.TrimPrefix(hashtag, "#")
+
+	// Keep alphanumeric characters only
+	hashtag = strings.Map(func(r rune) rune {
+		if unicode.IsLetter(r) || unicode.IsNumber(r) {
+			return r
+		}
+		return -1
+	}, hashtag)
+
+	return hashtag
+}
+
+// normalizeHashtag cleans a hashtag and converts it to its singular form,
+// so "grassFed" and "grassfed", or "burgers" and "burger", are the same tag.
+func normalizeHashtag(hashtag string) string {
+	return singularizeHashtag(cleanHashtag(hashtag))
+}
+
+// invariantHashtags are plural-looking hashtags that must not be singularized,
+// or whose singular form inflection gets wrong.
+var invariantHashtags = map[string]string{
+	"brussels": "brussels",
+	"grits":    "grits",
+	"molasses": "molasses",
+	"leaves":   "leaf",
+	"loaves":   "loaf",
+	"halves":   "half",
+	"series":   "series",
+	"species":  "species",
+}
+
+// singularizeHashtag converts a cleaned hashtag to its singular form.
+// Words like "hummus", "citrus" or "swiss" are left alone.
+func singularizeHashtag(hashtag string) string {
+	if len(hashtag) < 4 || !strings.HasSuffix(hashtag, "s") {
+		return hashtag
+	}
+	if singular, ok := invariantHashtags[hashtag]; ok {
+		return singular
+	}
+	for _, suffix := range []string{"ss", "us", "is", "as"} {
+		if strings.HasSuffix(hashtag, suffix) {
+			return hashtag
+		}
+	}
+	return inflection.Singular(hashtag)
+}
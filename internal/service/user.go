@@ -3,22 +3,31 @@ package service
 import (
 	"errors"
 	"fmt"
+	"log"
 	"regexp"
-	"strings"
 	"time"
 
 	goaway "github.com/TwiN/go-away"
 	"github.com/asaskevich/govalidator"
+	"github.com/google/uuid"
 	"github.com/windoze95/saltybytes-api/internal/config"
+	"github.com/windoze95/saltybytes-api/internal/mailer"
 	"github.com/windoze95/saltybytes-api/internal/models"
+	"github.com/windoze95/saltybytes-api/internal/oidc"
 	"github.com/windoze95/saltybytes-api/internal/repository"
 	"golang.org/x/crypto/bcrypt"
 )
 
 // UserService is the business logic layer for user-related operations.
 type UserService struct {
-	Cfg  *config.Config
-	Repo *repository.UserRepository
+	Cfg         *config.Config
+	Repo        *repository.UserRepository
+	Mailer      mailer.Mailer
+	AuthService *AuthService
+	// IdentityProviders are the configured identity providers users can sign in with, by auth type.
+	IdentityProviders map[string]*oidc.Provider
+
+	emailLimiter emailRateLimiter
 }
 
 // UserResponse is the response object for user-related operations.
@@ -27,13 +36,19 @@ type UserResponse struct {
 	Username  string `json:"username"`
 	FirstName string `json:"first_name"`
 	Email     string `json:"email"`
+	// EmailVerified is whether the user has confirmed they own their email address.
+	EmailVerified bool            `json:"email_verified"`
+	Role          models.UserRole `json:"role"`
 }
 
 // NewUserService is the constructor function for initializing a new UserService
-func NewUserService(cfg *config.Config, repo *repository.UserRepository) *UserService {
+func NewUserService(cfg *config.Config, repo *repository.UserRepository, mailer mailer.Mailer, authService *AuthService, identityProviders map[string]*oidc.Provider) *UserService {
 	return &UserService{
-		Cfg:  cfg,
-		Repo: repo,
+		Cfg:               cfg,
+		Repo:              repo,
+		Mailer:            mailer,
+		AuthService:       authService,
+		IdentityProviders: identityProviders,
 	}
 }
 
@@ -45,17 +60,32 @@ func (s *UserService) CreateUser(username, firstName, email, password string) (*
 		return nil, fmt.Errorf("error hashing password: %v", err)
 	}
 
-	hashedPasswordStr := string(hashedPassword)
+	user := newUser(username, firstName, email, &models.UserAuth{
+		HashedPassword: string(hashedPassword),
+		AuthType:       models.Standard,
+	})
+
+	user, err = s.Repo.CreateUser(user)
+	if err != nil {
+		return nil, err
+	}
+
+	// Signing up shouldn't fail because the verification email couldn't be sent, it can be requested again
+	if err := s.SendEmailVerification(user); err != nil {
+		log.Printf("error: failed to send email verification for new user %d: %v", user.ID, err)
+	}
 
-	// Create User and UserSettings
-	user := &models.User{
+	return user, nil
+}
+
+// newUser builds a new user with the default subscription, settings and personalization.
+func newUser(username, firstName, email string, auth *models.UserAuth) *models.User {
+	return &models.User{
 		Username:  username,
 		FirstName: firstName,
 		Email:     email,
-		Auth: &models.UserAuth{
-			HashedPassword: hashedPasswordStr,
-			AuthType:       models.Standard,
-		},
+		Role:      models.RoleUser,
+		Auth:      auth,
 		Subscription: &models.Subscription{
 			SubscriptionTier: models.Free,
 			ExpiresAt:        time.Now().AddDate(0, 1, 0), // One month from now
@@ -65,33 +95,45 @@ func (s *UserService) CreateUser(username, firstName, email, password string) (*
 		},
 		Personalization: &models.Personalization{
 			UnitSystem: models.USCustomary, // Default value
-			// UID:        uuid.New(),
+			UID:        uuid.New(),
 		},
 		// CollectedRecipes: []*models.Recipe{},
 	}
+}
 
-	user, err = s.Repo.CreateUser(user)
+// LoginUser logs in a user with their username and password. Attempts are throttled per username and
+// IP address after repeated failures, and failures look the same whether or not the username exists.
+func (s *UserService) LoginUser(username, password, ip string) (*UserResponse, error) {
+	attempt, err := s.AuthService.ReserveLoginAttempt(username, ip)
 	if err != nil {
 		return nil, err
 	}
 
-	return user, nil
-}
-
-// LoginUser logs in a user.
-func (s *UserService) LoginUser(username, password string) (*UserResponse, error) {
 	user, err := s.Repo.GetUserAuthByUsername(username)
 	if err != nil {
-		return nil, err
+		if _, ok := err.(repository.NotFoundError); !ok {
+			return nil, err
+		}
+
+		bcrypt.CompareHashAndPassword(dummyPasswordHash, []byte(password))
+		return nil, ErrInvalidCredentials
+	}
+
+	// Users who signed up with an identity provider may not have a password
+	hasPassword := user.Auth != nil && user.Auth.HashedPassword != ""
+	hashedPassword := dummyPasswordHash
+	if hasPassword {
+		hashedPassword = []byte(user.Auth.HashedPassword)
 	}
 
-	if err := bcrypt.CompareHashAndPassword([]byte(user.Auth.HashedPassword), []byte(password)); err != nil {
-		return nil, errors.New("invalid username or password")
+	if err := bcrypt.CompareHashAndPassword(hashedPassword, []byte(password)); err != nil || !hasPassword {
+		s.AuthService.FinishLoginAttempt(attempt, &user.ID, models.LoginFailed)
+		return nil, ErrInvalidCredentials
 	}
 
-	userResponse := toUserResponse(user)
+	s.AuthService.FinishLoginAttempt(attempt, &user.ID, models.LoginSucceeded)
 
-	return userResponse, nil
+	return toUserResponse(user), nil
 }
 
 // toUserResponse converts a User to a UserResponse.
@@ -101,6 +143,9 @@ func toUserResponse(user *models.User) *UserResponse {
 		Username:  user.Username,
 		FirstName: user.FirstName,
 		Email:     user.Email,
+
+		EmailVerified: user.EmailVerified,
+		Role:          user.Role,
 	}
 }
 
@@ -109,9 +154,34 @@ func (s *UserService) GetUserByID(userID uint) (*models.User, error) {
 	return s.Repo.GetUserByID(userID)
 }
 
-// UpdatePersonalization updates a user's personalization settings.
-func (s *UserService) UpdatePersonalization(user *models.User, updatedPersonalization *models.Personalization) error {
-	return s.Repo.UpdatePersonalization(user.ID, updatedPersonalization)
+// UpdatePersonalization validates and updates a user's personalization settings.
+// A new UID is minted whenever the personalization changes, so recipes generated
+// under the previous personalization can be told apart.
+func (s *UserService) UpdatePersonalization(user *models.User, updatedPersonalization *models.Personalization) (*PersonalizationResponse, error) {
+	if err := validatePersonalization(updatedPersonalization); err != nil {
+		return nil, err
+	}
+
+	if user.Personalization == nil {
+		return nil, errors.New("user's Personalization is nil")
+	}
+
+	updatedPersonalization.UID = user.Personalization.UID
+	if personalizationChanged(user.Personalization, updatedPersonalization) || updatedPersonalization.UID == uuid.Nil {
+		updatedPersonalization.UID = uuid.New()
+	}
+
+	if err := s.Repo.UpdatePersonalization(user.ID, updatedPersonalization); err != nil {
+		return nil, err
+	}
+
+	user.Personalization.UnitSystem = updatedPersonalization.UnitSystem
+	user.Personalization.Requirements = updatedPersonalization.Requirements
+	user.Personalization.Diets = updatedPersonalization.Diets
+	user.Personalization.Allergens = updatedPersonalization.Allergens
+	user.Personalization.UID = updatedPersonalization.UID
+
+	return toPersonalizationResponse(user.Personalization), nil
 }
 
 // ValidateUsername validates a username against a set of rules.
@@ -137,53 +207,13 @@ func (s *UserService) ValidateUsername(username string) error {
 		return fmt.Errorf("username can only contain alphanumeric characters")
 	}
 
-	// Define a list of forbidden usernames
-	var forbiddenUsernames = []string{
-		"admin",
-		"administrator",
-		"root",
-		"julian",
-		"awfulbits",
-		// "windoze95",
-		"yana",
-		"russianminx",
-		"russianminxx",
-		"sys",
-		"sysadmin",
-		"system",
-		"test",
-		"testuser",
-		"test-user",
-		"test_user",
-		"login",
-		"logout",
-		"register",
-		"password",
-		"user",
-		"newuser",
-		"yourapp",
-		"yourcompany",
-		"yourbrand",
-		"support",
-		"help",
-		"faq",
-		"saltybytes",
-		"saltybytes_ai",
-		"saltybytes-ai",
-		"saltybytesadmin",
-		"saltybytes_admin",
-		"saltybytes-admin",
-		"saltybytesroot",
-		"saltybytes_root",
-		"saltybytes-root",
-	}
-
-	// Check if the username is in the forbidden list
-	lowercaseUsername := strings.ToLower(username)
-	for _, forbiddenUsername := range forbiddenUsernames {
-		if strings.EqualFold(lowercaseUsername, forbiddenUsername) {
-			return fmt.Errorf("username '%s' is not allowed", username)
-		}
+	// Check if the username is on the forbidden list
+	forbidden, err := s.Repo.IsUsernameForbidden(username)
+	if err != nil {
+		return fmt.Errorf("error checking username: %v", err)
+	}
+	if forbidden {
+		return fmt.Errorf("username '%s' is not allowed", username)
 	}
 
 	// Profanity check
@@ -0,0 +1,233 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/windoze95/saltybytes-api/internal/mailer"
+	"github.com/windoze95/saltybytes-api/internal/models"
+	"github.com/windoze95/saltybytes-api/internal/repository"
+	"github.com/windoze95/saltybytes-api/internal/util"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	// EmailVerificationTTL is how long an email verification link is valid for.
+	EmailVerificationTTL = 24 * time.Hour
+	// PasswordResetTTL is how long a password reset link is valid for.
+	PasswordResetTTL = 1 * time.Hour
+	// maxEmailsPerWindow is how many emails of one kind may be sent to an address per emailRateWindow.
+	maxEmailsPerWindow = 3
+	emailRateWindow    = 1 * time.Hour
+)
+
+var (
+	// ErrInvalidUserToken is returned when an emailed token is unknown, expired or already used.
+	ErrInvalidUserToken = errors.New("invalid or expired token")
+	// ErrEmailAlreadyVerified is returned when verification is requested for a verified email address.
+	ErrEmailAlreadyVerified = errors.New("email is already verified")
+	// ErrTooManyEmails is returned when too many emails were requested for an address.
+	ErrTooManyEmails = errors.New("too many emails requested, try again later")
+)
+
+// emailRateLimiter limits how many emails of each kind are sent to an address.
+// Limits are kept per instance of the API.
+type emailRateLimiter struct {
+	mu   sync.Mutex
+	sent map[string][]time.Time
+}
+
+// allow records an email of the given purpose to an address, unless the address has reached its limit.
+// Addresses are counted whether or not they belong to a user, so the limit does not reveal which do.
+func (l *emailRateLimiter) allow(email string, purpose models.TokenPurpose) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.sent == nil {
+		l.sent = make(map[string][]time.Time)
+	}
+
+	now := time.Now()
+	for key, times := range l.sent {
+		l.sent[key] = recentTimes(times, now)
+		if len(l.sent[key]) == 0 {
+			delete(l.sent, key)
+		}
+	}
+
+	key := string(purpose) + ":" + strings.ToLower(strings.TrimSpace(email))
+	if len(l.sent[key]) >= maxEmailsPerWindow {
+		return false
+	}
+	l.sent[key] = append(l.sent[key], now)
+
+	return true
+}
+
+// recentTimes returns the times that are still within the rate limit window.
+func recentTimes(times []time.Time, now time.Time) []time.Time {
+	recent := times[:0]
+	for _, t := range times {
+		if now.Sub(t) < emailRateWindow {
+			recent = append(recent, t)
+		}
+	}
+	return recent
+}
+
+// SendEmailVerification emails a user a link to verify their email address.
+func (s *UserService) SendEmailVerification(user *models.User) error {
+	if user.EmailVerified {
+		return ErrEmailAlreadyVerified
+	}
+
+	if !s.emailLimiter.allow(user.Email, models.EmailVerificationToken) {
+		return ErrTooManyEmails
+	}
+
+	token, err := s.createUserToken(user, models.EmailVerificationToken, EmailVerificationTTL)
+	if err != nil {
+		return err
+	}
+
+	s.sendEmail(mailer.Message{
+		To:      user.Email,
+		Subject: "Verify your SaltyBytes email address",
+		Body: fmt.Sprintf("Hi %s,\n\nConfirm your email address by opening this link:\n\n%s/verify-email?token=%s\n\n"+
+			"The link expires in 24 hours. If you didn't create a SaltyBytes account, you can ignore this email.\n",
+			user.Username, s.appURL(), token),
+	})
+
+	return nil
+}
+
+// ConfirmEmailVerification verifies the email address an email verification token was sent to.
+func (s *UserService) ConfirmEmailVerification(tokenString string) error {
+	token, err := s.getUserToken(tokenString, models.EmailVerificationToken)
+	if err != nil {
+		return err
+	}
+
+	if err := s.Repo.VerifyUserEmail(token); err != nil {
+		if _, ok := err.(repository.NotFoundError); ok {
+			return ErrInvalidUserToken
+		}
+		return err
+	}
+
+	return nil
+}
+
+// RequestPasswordReset emails a link to reset their password to the user with the given email address.
+// Nothing is sent when no user has the address, and no error says so, to avoid revealing which addresses have accounts.
+func (s *UserService) RequestPasswordReset(email string) error {
+	if !s.emailLimiter.allow(email, models.PasswordResetToken) {
+		return ErrTooManyEmails
+	}
+
+	user, err := s.Repo.GetUserByEmail(email)
+	if err != nil {
+		if _, ok := err.(repository.NotFoundError); ok {
+			return nil
+		}
+		return err
+	}
+
+	token, err := s.createUserToken(user, models.PasswordResetToken, PasswordResetTTL)
+	if err != nil {
+		return err
+	}
+
+	s.sendEmail(mailer.Message{
+		To:      user.Email,
+		Subject: "Reset your SaltyBytes password",
+		Body: fmt.Sprintf("Hi %s,\n\nReset your password by opening this link:\n\n%s/reset-password?token=%s\n\n"+
+			"The link expires in 1 hour. If you didn't ask to reset your password, you can ignore this email.\n",
+			user.Username, s.appURL(), token),
+	})
+
+	return nil
+}
+
+// ResetPassword sets a new password for the user a password reset token was sent to,
+// and logs them out everywhere. The new password should be validated with ValidatePassword first.
+func (s *UserService) ResetPassword(tokenString, newPassword string) error {
+	token, err := s.getUserToken(tokenString, models.PasswordResetToken)
+	if err != nil {
+		return err
+	}
+
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(newPassword), 10)
+	if err != nil {
+		return fmt.Errorf("error hashing password: %v", err)
+	}
+
+	if err := s.Repo.ResetUserPassword(token, string(hashedPassword)); err != nil {
+		if _, ok := err.(repository.NotFoundError); ok {
+			return ErrInvalidUserToken
+		}
+		return err
+	}
+
+	return s.AuthService.RevokeUserSessions(token.UserID)
+}
+
+// createUserToken creates a single-use token for a user and returns the token to email them.
+func (s *UserService) createUserToken(user *models.User, purpose models.TokenPurpose, ttl time.Duration) (string, error) {
+	tokenString, err := util.GenerateRandomString(32)
+	if err != nil {
+		return "", fmt.Errorf("error generating token: %v", err)
+	}
+
+	token := &models.UserToken{
+		UserID:    user.ID,
+		Purpose:   purpose,
+		Email:     user.Email,
+		TokenHash: hashToken(tokenString),
+		ExpiresAt: time.Now().Add(ttl),
+	}
+	if err := s.Repo.CreateUserToken(token); err != nil {
+		return "", err
+	}
+
+	return tokenString, nil
+}
+
+// getUserToken retrieves a user token that can still be used.
+func (s *UserService) getUserToken(tokenString string, purpose models.TokenPurpose) (*models.UserToken, error) {
+	token, err := s.Repo.GetUserTokenByHash(hashToken(tokenString), purpose)
+	if err != nil {
+		if _, ok := err.(repository.NotFoundError); ok {
+			return nil, ErrInvalidUserToken
+		}
+		return nil, err
+	}
+
+	if token.UsedAt != nil || time.Now().After(token.ExpiresAt) {
+		return nil, ErrInvalidUserToken
+	}
+
+	return token, nil
+}
+
+// sendEmail sends an email in the background, so slow mail servers don't hold up requests
+// and response times don't reveal whether an email was sent.
+func (s *UserService) sendEmail(msg mailer.Message) {
+	go func() {
+		if err := s.Mailer.Send(msg); err != nil {
+			log.Printf("error: failed to send email %q: %v", msg.Subject, err)
+		}
+	}()
+}
+
+// appURL returns the base URL of the app that email links open, set by the AppURL environment variable.
+func (s *UserService) appURL() string {
+	if url := s.Cfg.Env.AppURL.Value(); url != "" {
+		return strings.TrimRight(url, "/")
+	}
+	return "https://saltybytes.ai"
+}
@@ -0,0 +1,239 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"math/rand"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/windoze95/saltybytes-api/internal/models"
+	"github.com/windoze95/saltybytes-api/internal/oidc"
+	"github.com/windoze95/saltybytes-api/internal/repository"
+)
+
+var (
+	// ErrUnknownIdentityProvider is returned for identity providers that aren't supported or configured.
+	ErrUnknownIdentityProvider = errors.New("unknown identity provider")
+	// ErrIdentityEmailInUse is returned when signing in with an identity whose email belongs to an account
+	// it can't be linked to automatically.
+	ErrIdentityEmailInUse = errors.New("an account already uses this email, log in to it to link this identity")
+	// ErrLastLoginMethod is returned when unlinking the only way a user has to log in.
+	ErrLastLoginMethod = errors.New("cannot unlink the only way to log in, set a password or link another identity first")
+)
+
+// IdentityResponse is the response object for an identity linked to a user.
+type IdentityResponse struct {
+	ID       uint                `json:"ID"`
+	Provider models.UserAuthType `json:"provider"`
+	Email    string              `json:"email"`
+	LinkedAt time.Time           `json:"linked_at"`
+}
+
+// LoginWithIdentity logs in the user linked to the identity an ID token was issued for.
+// Identities not linked yet are linked to the user with the same email when both sides have verified it,
+// otherwise a new user is signed up with the identity. It also reports whether a user was signed up.
+func (s *UserService) LoginWithIdentity(provider models.UserAuthType, idToken, nonce string) (*UserResponse, bool, error) {
+	claims, err := s.verifyIDToken(provider, idToken, nonce)
+	if err != nil {
+		return nil, false, err
+	}
+
+	identity, err := s.Repo.GetUserIdentity(provider, claims.Subject)
+	if err == nil {
+		user, err := s.Repo.GetUserByID(identity.UserID)
+		if err != nil {
+			return nil, false, err
+		}
+		return toUserResponse(user), false, nil
+	}
+	if _, ok := err.(repository.NotFoundError); !ok {
+		return nil, false, err
+	}
+
+	if claims.Email != "" {
+		user, err := s.Repo.GetUserByEmail(claims.Email)
+		if err == nil {
+			// Linking on an unverified email would let anyone claim an account by its address
+			if !claims.EmailVerified || !user.EmailVerified {
+				return nil, false, ErrIdentityEmailInUse
+			}
+			if err := s.Repo.CreateUserIdentity(toUserIdentity(user.ID, provider, claims)); err != nil {
+				return nil, false, err
+			}
+			return toUserResponse(user), false, nil
+		}
+		if _, ok := err.(repository.NotFoundError); !ok {
+			return nil, false, err
+		}
+	}
+
+	user, err := s.createUserWithIdentity(provider, claims)
+	if err != nil {
+		return nil, false, err
+	}
+
+	return toUserResponse(user), true, nil
+}
+
+// LinkIdentity links the identity an ID token was issued for to a user.
+// Linking an identity the user already has is not an error.
+func (s *UserService) LinkIdentity(user *models.User, provider models.UserAuthType, idToken, nonce string) (*IdentityResponse, error) {
+	claims, err := s.verifyIDToken(provider, idToken, nonce)
+	if err != nil {
+		return nil, err
+	}
+
+	identity, err := s.Repo.GetUserIdentity(provider, claims.Subject)
+	if err == nil {
+		if identity.UserID != user.ID {
+			return nil, repository.NewConflictError("identity already linked to another user")
+		}
+		return toIdentityResponse(identity), nil
+	}
+	if _, ok := err.(repository.NotFoundError); !ok {
+		return nil, err
+	}
+
+	identity = toUserIdentity(user.ID, provider, claims)
+	if err := s.Repo.CreateUserIdentity(identity); err != nil {
+		return nil, err
+	}
+
+	return toIdentityResponse(identity), nil
+}
+
+// GetIdentities fetches the identities linked to a user.
+func (s *UserService) GetIdentities(user *models.User) ([]*IdentityResponse, error) {
+	identities, err := s.Repo.GetUserIdentities(user.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	identityResponses := make([]*IdentityResponse, 0, len(identities))
+	for i := range identities {
+		identityResponses = append(identityResponses, toIdentityResponse(&identities[i]))
+	}
+
+	return identityResponses, nil
+}
+
+// UnlinkIdentity unlinks an identity from a user, as long as the user has another way to log in.
+func (s *UserService) UnlinkIdentity(user *models.User, identityID uint) error {
+	identities, err := s.Repo.GetUserIdentities(user.ID)
+	if err != nil {
+		return err
+	}
+
+	auth, err := s.Repo.GetUserAuthByUserID(user.ID)
+	if err != nil {
+		return err
+	}
+
+	if auth.HashedPassword == "" && len(identities) <= 1 {
+		for _, identity := range identities {
+			if identity.ID == identityID {
+				return ErrLastLoginMethod
+			}
+		}
+	}
+
+	return s.Repo.DeleteUserIdentity(user.ID, identityID)
+}
+
+// verifyIDToken verifies an ID token with the given identity provider.
+func (s *UserService) verifyIDToken(provider models.UserAuthType, idToken, nonce string) (*oidc.Claims, error) {
+	p, ok := s.IdentityProviders[string(provider)]
+	if !ok || !models.IsValidIdentityProvider(provider) {
+		return nil, ErrUnknownIdentityProvider
+	}
+
+	return p.Verify(idToken, nonce)
+}
+
+// createUserWithIdentity signs up a new user with an identity. The user has no password until they reset it.
+func (s *UserService) createUserWithIdentity(provider models.UserAuthType, claims *oidc.Claims) (*models.User, error) {
+	username, err := s.generateUsername(claims)
+	if err != nil {
+		return nil, err
+	}
+
+	firstName := ""
+	if fields := strings.Fields(claims.Name); len(fields) > 0 {
+		firstName = fields[0]
+	}
+
+	user := newUser(username, firstName, claims.Email, &models.UserAuth{AuthType: provider})
+	user.EmailVerified = claims.EmailVerified
+
+	user, err = s.Repo.CreateUserWithIdentity(user, toUserIdentity(0, provider, claims))
+	if err != nil {
+		return nil, err
+	}
+
+	if user.Email != "" && !user.EmailVerified {
+		if err := s.SendEmailVerification(user); err != nil {
+			log.Printf("error: failed to send email verification for new user %d: %v", user.ID, err)
+		}
+	}
+
+	return user, nil
+}
+
+// generateUsername picks an available username for a user signing up with an identity,
+// based on their email or name. The user can change it afterwards.
+func (s *UserService) generateUsername(claims *oidc.Claims) (string, error) {
+	base := alphanumeric(strings.Split(claims.Email, "@")[0])
+	if len(base) < 3 {
+		base = alphanumeric(claims.Name)
+	}
+	if len(base) < 3 {
+		base = "cook"
+	}
+	if len(base) > 20 {
+		base = base[:20]
+	}
+
+	candidate := base
+	for attempt := 0; attempt < 10; attempt++ {
+		if err := s.ValidateUsername(candidate); err == nil {
+			return candidate, nil
+		}
+		candidate = fmt.Sprintf("%s%d", base, 1000+rand.Intn(9000))
+	}
+
+	return "", errors.New("could not find an available username")
+}
+
+// alphanumeric lowercases a string and drops everything but letters and digits.
+func alphanumeric(s string) string {
+	var b strings.Builder
+	for _, r := range strings.ToLower(s) {
+		if r < unicode.MaxASCII && (unicode.IsLetter(r) || unicode.IsDigit(r)) {
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+// toUserIdentity builds the identity linking a user to the account an ID token was issued for.
+func toUserIdentity(userID uint, provider models.UserAuthType, claims *oidc.Claims) *models.UserIdentity {
+	return &models.UserIdentity{
+		UserID:   userID,
+		Provider: provider,
+		Subject:  claims.Subject,
+		Email:    claims.Email,
+	}
+}
+
+// toIdentityResponse converts a UserIdentity to an IdentityResponse.
+func toIdentityResponse(identity *models.UserIdentity) *IdentityResponse {
+	return &IdentityResponse{
+		ID:       identity.ID,
+		Provider: identity.Provider,
+		Email:    identity.Email,
+		LinkedAt: identity.CreatedAt,
+	}
+}
@@ -0,0 +1,288 @@
+package service
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/windoze95/saltybytes-api/internal/models"
+	"github.com/windoze95/saltybytes-api/internal/repository"
+	"github.com/windoze95/saltybytes-api/internal/totp"
+	"github.com/windoze95/saltybytes-api/internal/util"
+)
+
+const (
+	// mfaIssuer is the name authenticator apps show next to SaltyBytes codes.
+	mfaIssuer = "SaltyBytes"
+	// recoveryCodeCount is how many recovery codes a user gets at a time.
+	recoveryCodeCount = 10
+	// maxMFAFailures is how many wrong codes in a row lock two-factor authentication for mfaLockout.
+	maxMFAFailures = 5
+	mfaLockout     = 15 * time.Minute
+)
+
+var (
+	// ErrMFAAlreadyEnabled is returned when enrolling a user who already has two-factor authentication.
+	ErrMFAAlreadyEnabled = errors.New("two-factor authentication is already enabled")
+	// ErrMFANotEnabled is returned when a user without two-factor authentication is asked for a code.
+	ErrMFANotEnabled = errors.New("two-factor authentication is not enabled")
+	// ErrMFAEnrollmentNotStarted is returned when confirming an enrollment that was never started.
+	ErrMFAEnrollmentNotStarted = errors.New("two-factor authentication enrollment has not been started")
+	// ErrInvalidMFACode is returned for wrong, reused or already used codes.
+	ErrInvalidMFACode = errors.New("invalid two-factor authentication code")
+	// ErrMFALocked is returned while two-factor authentication is locked after too many wrong codes.
+	ErrMFALocked = errors.New("too many invalid two-factor authentication codes, try again later")
+)
+
+// MFAStatusResponse is the response object for a user's two-factor authentication status.
+type MFAStatusResponse struct {
+	Enabled                bool       `json:"enabled"`
+	EnabledAt              *time.Time `json:"enabled_at"`
+	RecoveryCodesRemaining int        `json:"recovery_codes_remaining"`
+}
+
+// TOTPEnrollmentResponse is the response object for a started TOTP enrollment.
+type TOTPEnrollmentResponse struct {
+	Secret     string `json:"secret"`
+	OTPAuthURI string `json:"otpauth_uri"`
+}
+
+// GetMFAStatus fetches whether a user has two-factor authentication and how many recovery codes they have left.
+func (s *UserService) GetMFAStatus(user *models.User) (*MFAStatusResponse, error) {
+	mfa, err := s.getEnabledMFA(user.ID)
+	if err != nil {
+		if errors.Is(err, ErrMFANotEnabled) {
+			return &MFAStatusResponse{}, nil
+		}
+		return nil, err
+	}
+
+	remaining, err := s.Repo.CountUnusedMFARecoveryCodes(user.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	return &MFAStatusResponse{
+		Enabled:                true,
+		EnabledAt:              mfa.EnabledAt,
+		RecoveryCodesRemaining: remaining,
+	}, nil
+}
+
+// IsMFAEnabled reports whether a user has to pass two-factor authentication to log in.
+func (s *UserService) IsMFAEnabled(userID uint) (bool, error) {
+	_, err := s.getEnabledMFA(userID)
+	if errors.Is(err, ErrMFANotEnabled) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// StartTOTPEnrollment generates a new TOTP secret for a user. Two-factor authentication isn't enabled
+// until the user confirms a code from their authenticator app; starting again replaces the secret.
+func (s *UserService) StartTOTPEnrollment(user *models.User) (*TOTPEnrollmentResponse, error) {
+	if _, err := s.getEnabledMFA(user.ID); err == nil {
+		return nil, ErrMFAAlreadyEnabled
+	} else if !errors.Is(err, ErrMFANotEnabled) {
+		return nil, err
+	}
+
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		return nil, err
+	}
+
+	encryptedSecret, err := util.EncryptMFASecret(s.Cfg.Env.MFAEncryptionKey.Value(), secret)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.Repo.SaveUserMFASecret(user.ID, encryptedSecret); err != nil {
+		return nil, err
+	}
+
+	return &TOTPEnrollmentResponse{
+		Secret:     secret,
+		OTPAuthURI: totp.ProvisioningURI(secret, mfaIssuer, user.Username),
+	}, nil
+}
+
+// ConfirmTOTPEnrollment enables two-factor authentication for a user once they enter a code
+// from their authenticator app, and returns their recovery codes. They are only shown this once.
+func (s *UserService) ConfirmTOTPEnrollment(user *models.User, code string) ([]string, error) {
+	mfa, err := s.Repo.GetUserMFA(user.ID)
+	if err != nil {
+		if _, ok := err.(repository.NotFoundError); ok {
+			return nil, ErrMFAEnrollmentNotStarted
+		}
+		return nil, err
+	}
+	if mfa.EnabledAt != nil {
+		return nil, ErrMFAAlreadyEnabled
+	}
+
+	secret, err := s.decryptMFASecret(mfa)
+	if err != nil {
+		return nil, err
+	}
+
+	step, ok := totp.Validate(secret, code, time.Now())
+	if !ok {
+		return nil, ErrInvalidMFACode
+	}
+
+	codes, hashes, err := generateRecoveryCodes()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.Repo.EnableUserMFA(mfa, step, hashes); err != nil {
+		return nil, err
+	}
+
+	return codes, nil
+}
+
+// DisableTOTP turns off two-factor authentication for a user once they prove they still have
+// their authenticator app or a recovery code.
+func (s *UserService) DisableTOTP(user *models.User, code, recoveryCode string) error {
+	if err := s.VerifyMFA(user.ID, code, recoveryCode); err != nil {
+		return err
+	}
+
+	return s.Repo.DeleteUserMFA(user.ID)
+}
+
+// RegenerateRecoveryCodes replaces a user's recovery codes once they prove they still have
+// their authenticator app or a recovery code, and returns the new codes.
+func (s *UserService) RegenerateRecoveryCodes(user *models.User, code, recoveryCode string) ([]string, error) {
+	if err := s.VerifyMFA(user.ID, code, recoveryCode); err != nil {
+		return nil, err
+	}
+
+	codes, hashes, err := generateRecoveryCodes()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.Repo.ReplaceMFARecoveryCodes(user.ID, hashes); err != nil {
+		return nil, err
+	}
+
+	return codes, nil
+}
+
+// CompleteMFALogin finishes logging in the user an MFA challenge token was issued to,
+// once they enter a code from their authenticator app or a recovery code.
+func (s *UserService) CompleteMFALogin(challengeToken, code, recoveryCode string) (*UserResponse, error) {
+	userID, err := s.AuthService.VerifyMFAChallenge(challengeToken)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.VerifyMFA(userID, code, recoveryCode); err != nil {
+		return nil, err
+	}
+
+	user, err := s.Repo.GetUserByID(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	return toUserResponse(user), nil
+}
+
+// VerifyMFA checks a code from a user's authenticator app, or uses up one of their recovery codes.
+// A TOTP code is only accepted once, and too many wrong codes in a row lock it for a while.
+func (s *UserService) VerifyMFA(userID uint, code, recoveryCode string) error {
+	mfa, err := s.getEnabledMFA(userID)
+	if err != nil {
+		return err
+	}
+
+	if mfa.LockedUntil != nil && time.Now().Before(*mfa.LockedUntil) {
+		return ErrMFALocked
+	}
+
+	var ok bool
+	if recoveryCode != "" {
+		ok, err = s.Repo.UseMFARecoveryCode(mfa, hashToken(normalizeRecoveryCode(recoveryCode)))
+		if err != nil {
+			return err
+		}
+	} else {
+		secret, err := s.decryptMFASecret(mfa)
+		if err != nil {
+			return err
+		}
+
+		if step, valid := totp.Validate(secret, code, time.Now()); valid {
+			// Fails when the code, or a later one, was already used
+			ok, err = s.Repo.RecordMFASuccess(mfa, step)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	if !ok {
+		var lockedUntil *time.Time
+		if mfa.FailedAttempts+1 >= maxMFAFailures {
+			until := time.Now().Add(mfaLockout)
+			lockedUntil = &until
+		}
+		if err := s.Repo.RecordMFAFailure(mfa, lockedUntil); err != nil {
+			return err
+		}
+		return ErrInvalidMFACode
+	}
+
+	return nil
+}
+
+// getEnabledMFA retrieves a user's two-factor authentication, if it is enabled.
+func (s *UserService) getEnabledMFA(userID uint) (*models.UserMFA, error) {
+	mfa, err := s.Repo.GetUserMFA(userID)
+	if err != nil {
+		if _, ok := err.(repository.NotFoundError); ok {
+			return nil, ErrMFANotEnabled
+		}
+		return nil, err
+	}
+	if mfa.EnabledAt == nil {
+		return nil, ErrMFANotEnabled
+	}
+
+	return mfa, nil
+}
+
+// decryptMFASecret decrypts the TOTP secret of a user's two-factor authentication.
+func (s *UserService) decryptMFASecret(mfa *models.UserMFA) (string, error) {
+	return util.DecryptMFASecret(s.Cfg.Env.MFAEncryptionKey.Value(), mfa.EncryptedSecret)
+}
+
+// generateRecoveryCodes generates a set of recovery codes, formatted for reading out, and their hashes.
+func generateRecoveryCodes() ([]string, []string, error) {
+	codes := make([]string, 0, recoveryCodeCount)
+	hashes := make([]string, 0, recoveryCodeCount)
+
+	for i := 0; i < recoveryCodeCount; i++ {
+		b := make([]byte, 8)
+		if _, err := rand.Read(b); err != nil {
+			return nil, nil, err
+		}
+		raw := hex.EncodeToString(b)
+
+		codes = append(codes, raw[0:4]+"-"+raw[4:8]+"-"+raw[8:12]+"-"+raw[12:16])
+		hashes = append(hashes, hashToken(raw))
+	}
+
+	return codes, hashes, nil
+}
+
+// normalizeRecoveryCode strips the formatting from a recovery code the way it was typed in.
+func normalizeRecoveryCode(code string) string {
+	return strings.ToLower(strings.NewReplacer("-", "", " ", "").Replace(strings.TrimSpace(code)))
+}
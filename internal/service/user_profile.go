@@ -0,0 +1,165 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/windoze95/saltybytes-api/internal/models"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// ErrIncorrectPassword is returned when the current password given to change a password is wrong.
+var ErrIncorrectPassword = errors.New("current password is incorrect")
+
+// ProfileUpdate holds the profile fields to change, nil fields are left as they are.
+type ProfileUpdate struct {
+	FirstName *string
+	Email     *string
+	Username  *string
+}
+
+// SettingsUpdate holds the settings to change, nil fields are left as they are.
+type SettingsUpdate struct {
+	KeepScreenAwake *bool
+	Theme           *models.Theme
+	DefaultServings *int
+	TimerSound      *models.TimerSound
+}
+
+// ValidateProfileUpdate validates the changed profile fields.
+// A username only changing case is not checked against existing usernames.
+func (s *UserService) ValidateProfileUpdate(user *models.User, update *ProfileUpdate) error {
+	if update.Username != nil && !strings.EqualFold(*update.Username, user.Username) {
+		if err := s.ValidateUsername(*update.Username); err != nil {
+			return err
+		}
+	}
+
+	if update.Email != nil && *update.Email != user.Email {
+		if err := s.ValidateEmail(*update.Email); err != nil {
+			return err
+		}
+	}
+
+	if update.FirstName != nil && len(*update.FirstName) > 50 {
+		return errors.New("first name must be at most 50 characters long")
+	}
+
+	return nil
+}
+
+// UpdateProfile updates a user's profile. The update should be validated with ValidateProfileUpdate first.
+func (s *UserService) UpdateProfile(user *models.User, update *ProfileUpdate) (*UserResponse, error) {
+	updates := make(map[string]interface{})
+	if update.FirstName != nil {
+		updates["FirstName"] = strings.TrimSpace(*update.FirstName)
+	}
+	if update.Email != nil && *update.Email != user.Email {
+		updates["Email"] = *update.Email
+		updates["EmailVerified"] = false
+	}
+	if update.Username != nil && *update.Username != user.Username {
+		updates["Username"] = *update.Username
+	}
+
+	if len(updates) > 0 {
+		if err := s.Repo.UpdateUserProfile(user.ID, updates); err != nil {
+			return nil, err
+		}
+	}
+
+	if firstName, ok := updates["FirstName"].(string); ok {
+		user.FirstName = firstName
+	}
+	if email, ok := updates["Email"].(string); ok {
+		user.Email = email
+		user.EmailVerified = false
+
+		// The new address needs verifying, the change is kept even if the email can't be sent
+		if err := s.SendEmailVerification(user); err != nil {
+			log.Printf("error: failed to send email verification for user %d: %v", user.ID, err)
+		}
+	}
+	if username, ok := updates["Username"].(string); ok {
+		user.Username = username
+	}
+
+	return toUserResponse(user), nil
+}
+
+// ValidateSettingsUpdate validates the changed settings.
+func (s *UserService) ValidateSettingsUpdate(update *SettingsUpdate) error {
+	if update.Theme != nil && !models.IsValidTheme(*update.Theme) {
+		return fmt.Errorf("unknown theme: %s", *update.Theme)
+	}
+
+	if update.DefaultServings != nil && (*update.DefaultServings < 0 || *update.DefaultServings > 100) {
+		return errors.New("default servings must be between 0 and 100")
+	}
+
+	if update.TimerSound != nil && !models.IsValidTimerSound(*update.TimerSound) {
+		return fmt.Errorf("unknown timer sound: %s", *update.TimerSound)
+	}
+
+	return nil
+}
+
+// UpdateSettings updates a user's settings. The update should be validated with ValidateSettingsUpdate first.
+func (s *UserService) UpdateSettings(user *models.User, update *SettingsUpdate) (*models.UserSettings, error) {
+	if user.Settings == nil {
+		return nil, errors.New("user's Settings is nil")
+	}
+
+	updates := make(map[string]interface{})
+	if update.KeepScreenAwake != nil {
+		updates["KeepScreenAwake"] = *update.KeepScreenAwake
+		user.Settings.KeepScreenAwake = *update.KeepScreenAwake
+	}
+	if update.Theme != nil {
+		updates["Theme"] = *update.Theme
+		user.Settings.Theme = *update.Theme
+	}
+	if update.DefaultServings != nil {
+		updates["DefaultServings"] = *update.DefaultServings
+		user.Settings.DefaultServings = *update.DefaultServings
+	}
+	if update.TimerSound != nil {
+		updates["TimerSound"] = *update.TimerSound
+		user.Settings.TimerSound = *update.TimerSound
+	}
+
+	if len(updates) > 0 {
+		if err := s.Repo.UpdateUserSettings(user.ID, updates); err != nil {
+			return nil, err
+		}
+	}
+
+	return user.Settings, nil
+}
+
+// ChangePassword changes a user's password after checking their current password, and revokes
+// every other session of the user. The session the password was changed in, sessionID, stays signed in.
+// The new password should be validated with ValidatePassword first.
+func (s *UserService) ChangePassword(user *models.User, sessionID, currentPassword, newPassword string) error {
+	auth, err := s.Repo.GetUserAuthByUserID(user.ID)
+	if err != nil {
+		return err
+	}
+
+	if err := bcrypt.CompareHashAndPassword([]byte(auth.HashedPassword), []byte(currentPassword)); err != nil {
+		return ErrIncorrectPassword
+	}
+
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(newPassword), 10)
+	if err != nil {
+		return fmt.Errorf("error hashing password: %v", err)
+	}
+
+	if err := s.Repo.UpdateUserPassword(user.ID, string(hashedPassword)); err != nil {
+		return err
+	}
+
+	return s.AuthService.RevokeOtherUserSessions(user.ID, sessionID)
+}
@@ -0,0 +1,27 @@
+package units
+
+// Convert converts an amount of a unit to the given system of measurement, then promotes or demotes
+// and rounds it like Normalize. Volumes of ingredients with a known Density are converted to weights
+// for Metric and weights back to volumes for US Customary, e.g. 1 cup of flour is 125 g.
+// Units of the Neutral system, units already in the target system and unknown units are only normalized.
+func Convert(amount float64, unit string, system System, ingredient string) (float64, string) {
+	u, ok := Lookup(unit)
+	if !ok || u.System == Neutral || u.System == system || system == Neutral {
+		return Normalize(amount, unit)
+	}
+
+	baseAmount := amount * u.Base
+	dimension := u.Dimension
+
+	if density, ok := Density(ingredient); ok {
+		switch {
+		case system == Metric && dimension == Volume:
+			baseAmount, dimension = baseAmount*density, Mass
+		case system == USCustomary && dimension == Mass:
+			baseAmount, dimension = baseAmount/density, Volume
+		}
+	}
+
+	converted, target := roundToBestUnit(baseAmount, dimension, system)
+	return converted, target.Name
+}
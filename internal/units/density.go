@@ -0,0 +1,73 @@
+package units
+
+import (
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// densities are the densities, in grams per milliliter, of ingredients that metric recipes
+// measure by weight and US Customary recipes measure by volume.
+// Liquids are left out, both systems measure them by volume.
+var densities = map[string]float64{
+	"all-purpose flour": 0.53,
+	"flour":             0.53,
+	"bread flour":       0.55,
+	"whole wheat flour": 0.51,
+	"almond flour":      0.4,
+	"cornstarch":        0.54,
+	"sugar":             0.85,
+	"granulated sugar":  0.85,
+	"brown sugar":       0.93,
+	"powdered sugar":    0.53,
+	"icing sugar":       0.53,
+	"cocoa powder":      0.42,
+	"butter":            0.96,
+	"rice":              0.78,
+	"rolled oats":       0.38,
+	"oats":              0.38,
+	"cornmeal":          0.64,
+	"breadcrumbs":       0.45,
+	"panko":             0.21,
+	"grated parmesan":   0.42,
+	"shredded cheese":   0.47,
+	"chocolate chips":   0.72,
+	"honey":             1.42,
+	"maple syrup":       1.32,
+	"peanut butter":     1.08,
+	"chopped nuts":      0.5,
+	"walnuts":           0.5,
+	"pecans":            0.45,
+	"almonds":           0.6,
+	"raisins":           0.64,
+}
+
+// densityKeys are the keys of densities, longest first, so "brown sugar" matches before "sugar".
+var densityKeys = func() []string {
+	keys := make([]string, 0, len(densities))
+	for key := range densities {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if len(keys[i]) != len(keys[j]) {
+			return len(keys[i]) > len(keys[j])
+		}
+		return keys[i] < keys[j]
+	})
+	return keys
+}()
+
+// Density returns the density of an ingredient in grams per milliliter, if it is known.
+// The ingredient name is matched on whole words, so "packed light brown sugar" is brown sugar.
+func Density(ingredient string) (float64, bool) {
+	words := strings.FieldsFunc(strings.ToLower(ingredient), func(r rune) bool {
+		return !unicode.IsLetter(r) && r != '-'
+	})
+	name := " " + strings.Join(words, " ") + " "
+	for _, key := range densityKeys {
+		if strings.Contains(name, " "+key+" ") {
+			return densities[key], true
+		}
+	}
+	return 0, false
+}
@@ -0,0 +1,130 @@
+package units
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+)
+
+// fractions are the fractional parts of an amount a cook can measure.
+var fractions = []struct {
+	value float64
+	text  string
+}{
+	{0, ""},
+	{1.0 / 8, "1/8"},
+	{1.0 / 4, "1/4"},
+	{1.0 / 3, "1/3"},
+	{3.0 / 8, "3/8"},
+	{1.0 / 2, "1/2"},
+	{5.0 / 8, "5/8"},
+	{2.0 / 3, "2/3"},
+	{3.0 / 4, "3/4"},
+	{7.0 / 8, "7/8"},
+	{1, ""},
+}
+
+// maxRoundingError is how far rounding may move an amount, relative to the amount, before a smaller
+// unit is used instead, e.g. 7 tbsp stays 7 tbsp rather than becoming 1/2 cup.
+const maxRoundingError = 0.06
+
+// round rounds an amount of a unit so it can be measured in a kitchen.
+func round(amount float64, u Unit) float64 {
+	if amount <= 0 {
+		return 0
+	}
+
+	switch u.rounding {
+	case roundFraction:
+		if amount >= 20 {
+			return math.Round(amount)
+		}
+		if amount >= 10 {
+			return roundTo(amount, 0.5)
+		}
+		whole, frac := math.Modf(amount)
+		rounded := whole + nearestFraction(frac)
+		if rounded == 0 {
+			return fractions[1].value
+		}
+		return rounded
+	case roundDecimal:
+		var rounded float64
+		switch {
+		case amount < 1:
+			rounded = roundTo(amount, 0.05)
+		case amount < 10:
+			rounded = roundTo(amount, 0.25)
+		case amount < 100:
+			rounded = roundTo(amount, 1)
+		case amount < 1000:
+			rounded = roundTo(amount, 5)
+		default:
+			rounded = roundTo(amount, 10)
+		}
+		if rounded == 0 {
+			return 0.05
+		}
+		return rounded
+	case roundHalf:
+		if amount >= 10 {
+			return math.Round(amount)
+		}
+		return math.Max(roundTo(amount, 0.5), 0.5)
+	default:
+		return math.Max(math.Round(amount), 1)
+	}
+}
+
+// nearestFraction rounds a fractional part to the nearest measurable fraction.
+func nearestFraction(frac float64) float64 {
+	nearest := fractions[0].value
+	for _, f := range fractions {
+		if math.Abs(frac-f.value) < math.Abs(frac-nearest) {
+			nearest = f.value
+		}
+	}
+	return nearest
+}
+
+// roundingError returns how far rounding moved an amount, relative to the amount.
+func roundingError(rounded, amount float64) float64 {
+	if amount == 0 {
+		return 0
+	}
+	return math.Abs(rounded-amount) / amount
+}
+
+// roundTo rounds an amount to the nearest multiple of step.
+func roundTo(amount, step float64) float64 {
+	return math.Round(amount/step) * step
+}
+
+// Format formats an amount of a unit for display, using fractions for US Customary units,
+// e.g. 1.3333 cup is "1 1/3".
+func Format(amount float64, unit string) string {
+	u, ok := Lookup(unit)
+	if !ok || u.rounding != roundFraction {
+		return strconv.FormatFloat(roundTo(amount, 0.01), 'f', -1, 64)
+	}
+
+	whole, frac := math.Modf(amount)
+	for _, f := range fractions {
+		if math.Abs(frac-f.value) > 0.01 {
+			continue
+		}
+		if f.value == 1 {
+			whole++
+		}
+		switch {
+		case f.text == "":
+			return strconv.FormatFloat(whole, 'f', 0, 64)
+		case whole == 0:
+			return f.text
+		default:
+			return fmt.Sprintf("%.0f %s", whole, f.text)
+		}
+	}
+
+	return strconv.FormatFloat(roundTo(amount, 0.01), 'f', -1, 64)
+}
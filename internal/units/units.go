@@ -0,0 +1,162 @@
+package units
+
+import (
+	"math"
+	"sort"
+	"strings"
+)
+
+// Dimension is the quantity a unit measures.
+type Dimension int
+
+// Dimension enum values.
+const (
+	Count  Dimension = iota // Whole things, like eggs
+	Volume                  // Base unit is the milliliter
+	Mass                    // Base unit is the gram
+	Pinch                   // Tiny, imprecise amounts that are only ever scaled
+)
+
+// System is the system of measurement a unit belongs to.
+type System int
+
+// System enum values.
+const (
+	Neutral     System = iota // Used by both systems
+	USCustomary               // US Customary
+	Metric                    // Metric
+)
+
+// rounding is how an amount of a unit is rounded for the cook.
+type rounding int
+
+const (
+	roundFraction rounding = iota // To the nearest 1/8, 1/4 or 1/3
+	roundDecimal                  // To a precision that shrinks as the amount grows
+	roundHalf                     // To the nearest half
+	roundWhole                    // To the nearest whole, at least 1
+)
+
+// Unit is a unit an ingredient can be measured in.
+type Unit struct {
+	Name      string
+	Dimension Dimension
+	System    System
+	// Base is the size of the unit in the base unit of its dimension.
+	Base float64
+	// Min is the smallest amount of the unit that reads well, e.g. 1/4 cup.
+	// Units with a Min of zero are not used when promoting or demoting amounts.
+	Min      float64
+	rounding rounding
+}
+
+// table is the unit table, in the order the units are offered to the model.
+var table = []Unit{
+	{Name: "pieces", Dimension: Count, System: Neutral, Base: 1, rounding: roundHalf},
+	{Name: "tsp", Dimension: Volume, System: USCustomary, Base: 4.92892, Min: 1.0 / 8, rounding: roundFraction},
+	{Name: "tbsp", Dimension: Volume, System: USCustomary, Base: 14.7868, Min: 1, rounding: roundFraction},
+	{Name: "fl oz", Dimension: Volume, System: USCustomary, Base: 29.5735, rounding: roundFraction},
+	{Name: "cup", Dimension: Volume, System: USCustomary, Base: 236.588, Min: 1.0 / 4, rounding: roundFraction},
+	{Name: "pt", Dimension: Volume, System: USCustomary, Base: 473.176, rounding: roundFraction},
+	{Name: "qt", Dimension: Volume, System: USCustomary, Base: 946.353, Min: 2, rounding: roundFraction},
+	{Name: "gal", Dimension: Volume, System: USCustomary, Base: 3785.41, Min: 1, rounding: roundFraction},
+	{Name: "oz", Dimension: Mass, System: USCustomary, Base: 28.3495, Min: 1.0 / 8, rounding: roundFraction},
+	{Name: "lb", Dimension: Mass, System: USCustomary, Base: 453.592, Min: 1, rounding: roundFraction},
+	{Name: "mL", Dimension: Volume, System: Metric, Base: 1, Min: 0.5, rounding: roundDecimal},
+	{Name: "L", Dimension: Volume, System: Metric, Base: 1000, Min: 1, rounding: roundDecimal},
+	{Name: "mg", Dimension: Mass, System: Metric, Base: 0.001, Min: 1, rounding: roundDecimal},
+	{Name: "g", Dimension: Mass, System: Metric, Base: 1, Min: 1, rounding: roundDecimal},
+	{Name: "kg", Dimension: Mass, System: Metric, Base: 1000, Min: 1, rounding: roundDecimal},
+	{Name: "pinch", Dimension: Pinch, System: Neutral, Base: 1, rounding: roundWhole},
+	{Name: "dash", Dimension: Pinch, System: Neutral, Base: 1, rounding: roundWhole},
+	{Name: "drop", Dimension: Pinch, System: Neutral, Base: 1, rounding: roundWhole},
+	{Name: "bushel", Dimension: Volume, System: USCustomary, Base: 35239.1, rounding: roundFraction},
+}
+
+// byName indexes the unit table by lowercase name.
+var byName = func() map[string]Unit {
+	m := make(map[string]Unit, len(table))
+	for _, u := range table {
+		m[strings.ToLower(u.Name)] = u
+	}
+	return m
+}()
+
+// Names returns the names of all known units, for use as the unit enum in the recipe schema.
+func Names() []string {
+	names := make([]string, 0, len(table))
+	for _, u := range table {
+		names = append(names, u.Name)
+	}
+	return names
+}
+
+// Lookup finds a unit by name, ignoring case.
+func Lookup(name string) (Unit, bool) {
+	u, ok := byName[strings.ToLower(strings.TrimSpace(name))]
+	return u, ok
+}
+
+// ladder returns the units amounts of the given dimension and system may be promoted
+// or demoted to, largest first.
+func ladder(dimension Dimension, system System) []Unit {
+	var units []Unit
+	for _, u := range table {
+		if u.Dimension == dimension && u.System == system && u.Min > 0 {
+			units = append(units, u)
+		}
+	}
+	sort.Slice(units, func(i, j int) bool { return units[i].Base > units[j].Base })
+	return units
+}
+
+// Scale multiplies an amount by factor, then promotes or demotes it to the unit that reads best
+// and rounds it for the cook, e.g. 16 tsp doubled becomes 2/3 cup.
+// Unknown units are scaled and rounded to two decimals.
+func Scale(amount float64, unit string, factor float64) (float64, string) {
+	return Normalize(amount*factor, unit)
+}
+
+// Normalize promotes or demotes an amount to the unit that reads best and rounds it for the cook.
+// Units outside the promotion ladder, like fl oz or pt, are kept and only rounded.
+func Normalize(amount float64, unit string) (float64, string) {
+	u, ok := Lookup(unit)
+	if !ok {
+		return roundTo(amount, 0.01), unit
+	}
+
+	if u.Min > 0 {
+		amount, u = roundToBestUnit(amount*u.Base, u.Dimension, u.System)
+		return amount, u.Name
+	}
+
+	return round(amount, u), u.Name
+}
+
+// roundToBestUnit picks the largest unit on the ladder the base amount is at least the Min of
+// and rounding to it keeps the amount within maxRoundingError, then returns the rounded amount.
+// When no unit keeps it that close the unit that rounds it closest is used.
+func roundToBestUnit(baseAmount float64, dimension Dimension, system System) (float64, Unit) {
+	units := ladder(dimension, system)
+
+	var best Unit
+	bestAmount, bestError := 0.0, math.Inf(1)
+	for i, u := range units {
+		// Allow for the rounding that will follow, so 47.9 tsp still becomes 1 cup.
+		// The smallest unit takes any amount.
+		if baseAmount/u.Base < u.Min*0.98 && i < len(units)-1 {
+			continue
+		}
+
+		rounded := round(baseAmount/u.Base, u)
+		e := roundingError(rounded*u.Base, baseAmount)
+		if e <= maxRoundingError {
+			return rounded, u
+		}
+		if e < bestError {
+			best, bestAmount, bestError = u, rounded, e
+		}
+	}
+
+	return bestAmount, best
+}
@@ -0,0 +1,157 @@
+package units
+
+import (
+	"math"
+	"testing"
+)
+
+func TestNormalize(t *testing.T) {
+	tests := []struct {
+		amount     float64
+		unit       string
+		wantAmount float64
+		wantUnit   string
+	}{
+		{3, "tsp", 1, "tbsp"},
+		{48, "tsp", 1, "cup"},
+		{47.9, "tsp", 1, "cup"},
+		{6, "tbsp", 3.0 / 8, "cup"},
+		// 1/2 cup would be 14% more, so the amount stays in tablespoons
+		{7, "tbsp", 7, "tbsp"},
+		{1.1, "cup", 9.0 / 8, "cup"},
+		// Cooks measure up to 8 cups in cups
+		{5, "cup", 5, "cup"},
+		{8, "cup", 2, "qt"},
+		{16, "cup", 1, "gal"},
+		{0.3, "tsp", 1.0 / 3, "tsp"},
+		// Too little for the smallest unit, rounded up rather than dropped
+		{0.05, "tsp", 1.0 / 8, "tsp"},
+		{16, "oz", 1, "lb"},
+		{20, "oz", 1.25, "lb"},
+		{1500, "mL", 1.5, "L"},
+		{999, "g", 1, "kg"},
+		{1234, "g", 1.25, "kg"},
+		{2.5, "pieces", 2.5, "pieces"},
+		{3, "pinch", 3, "pinch"},
+		// Units outside the ladder are kept
+		{2, "fl oz", 2, "fl oz"},
+		{1.234, "handful", 1.23, "handful"},
+		{2, "TBSP", 2, "tbsp"},
+	}
+
+	for _, tt := range tests {
+		amount, unit := Normalize(tt.amount, tt.unit)
+		if !approxEqual(amount, tt.wantAmount) || unit != tt.wantUnit {
+			t.Errorf("Normalize(%v, %q) = %v %s, want %v %s", tt.amount, tt.unit, amount, unit, tt.wantAmount, tt.wantUnit)
+		}
+	}
+}
+
+// TestNormalizeRoundingError checks that normalizing any amount a cook can measure, in eighths,
+// changes it by no more than maxRoundingError.
+func TestNormalizeRoundingError(t *testing.T) {
+	for _, u := range table {
+		if u.rounding != roundFraction || u.Min == 0 {
+			continue
+		}
+		for amount := u.Min; amount <= 20; amount += 1.0 / 8 {
+			normalized, unit := Normalize(amount, u.Name)
+			n, _ := Lookup(unit)
+			if e := roundingError(normalized*n.Base, amount*u.Base); e > maxRoundingError {
+				t.Errorf("Normalize(%v, %q) = %v %s is %.0f%% off", amount, u.Name, normalized, unit, e*100)
+			}
+		}
+	}
+}
+
+func TestScale(t *testing.T) {
+	tests := []struct {
+		amount     float64
+		unit       string
+		factor     float64
+		wantAmount float64
+		wantUnit   string
+	}{
+		{16, "tsp", 2, 2.0 / 3, "cup"},
+		{1, "cup", 0.5, 0.5, "cup"},
+		{1, "tbsp", 0.25, 0.75, "tsp"},
+		{2, "pieces", 1.5, 3, "pieces"},
+		{1, "pinch", 3, 3, "pinch"},
+		{250, "g", 4, 1, "kg"},
+	}
+
+	for _, tt := range tests {
+		amount, unit := Scale(tt.amount, tt.unit, tt.factor)
+		if !approxEqual(amount, tt.wantAmount) || unit != tt.wantUnit {
+			t.Errorf("Scale(%v, %q, %v) = %v %s, want %v %s", tt.amount, tt.unit, tt.factor, amount, unit, tt.wantAmount, tt.wantUnit)
+		}
+	}
+}
+
+func TestConvert(t *testing.T) {
+	tests := []struct {
+		amount     float64
+		unit       string
+		system     System
+		ingredient string
+		wantAmount float64
+		wantUnit   string
+	}{
+		// Dry ingredients with a density change dimension
+		{1, "cup", Metric, "flour", 125, "g"},
+		{125, "g", USCustomary, "all-purpose flour", 1, "cup"},
+		{6, "tbsp", USCustomary, "butter", 3.0 / 8, "cup"},
+		// Liquids keep their dimension
+		{1, "cup", Metric, "milk", 235, "mL"},
+		{250, "mL", USCustomary, "milk", 1, "cup"},
+		{2, "tbsp", Metric, "olive oil", 30, "mL"},
+		{1, "lb", Metric, "ground beef", 455, "g"},
+		{500, "g", USCustomary, "chicken thighs", 9.0 / 8, "lb"},
+		// Neutral units and units already in the system are only normalized
+		{2, "pieces", Metric, "eggs", 2, "pieces"},
+		{3, "tsp", USCustomary, "salt", 1, "tbsp"},
+		{1, "pinch", Metric, "salt", 1, "pinch"},
+	}
+
+	for _, tt := range tests {
+		amount, unit := Convert(tt.amount, tt.unit, tt.system, tt.ingredient)
+		if !approxEqual(amount, tt.wantAmount) || unit != tt.wantUnit {
+			t.Errorf("Convert(%v, %q, %v, %q) = %v %s, want %v %s", tt.amount, tt.unit, tt.system, tt.ingredient, amount, unit, tt.wantAmount, tt.wantUnit)
+		}
+	}
+}
+
+func TestFormat(t *testing.T) {
+	tests := []struct {
+		amount float64
+		unit   string
+		want   string
+	}{
+		{1, "cup", "1"},
+		{0.5, "cup", "1/2"},
+		{1.0 / 3, "cup", "1/3"},
+		{3.0 / 8, "cup", "3/8"},
+		{5.0 / 8, "tsp", "5/8"},
+		{1 + 7.0/8, "cup", "1 7/8"},
+		{2.0 / 3, "tbsp", "2/3"},
+		{1.25, "lb", "1 1/4"},
+		{0.999, "cup", "1"},
+		{1.1, "cup", "1.1"},
+		{1.5, "L", "1.5"},
+		{235, "mL", "235"},
+		{0.6000000000000001, "mL", "0.6"},
+		{2.5, "pieces", "2.5"},
+		{1.234, "handful", "1.23"},
+	}
+
+	for _, tt := range tests {
+		if got := Format(tt.amount, tt.unit); got != tt.want {
+			t.Errorf("Format(%v, %q) = %q, want %q", tt.amount, tt.unit, got, tt.want)
+		}
+	}
+}
+
+// approxEqual compares amounts, allowing for floating point error.
+func approxEqual(a, b float64) bool {
+	return math.Abs(a-b) < 1e-9
+}
@@ -36,3 +36,18 @@ func GetUserIDFromContext(c *gin.Context) (uint, error) {
 
 	return userID, nil
 }
+
+// GetSessionIDFromContext retrieves the ID of the session the request's access token was issued in.
+func GetSessionIDFromContext(c *gin.Context) (string, error) {
+	val, ok := c.Get("session_id")
+	if !ok {
+		return "", errors.New("no session ID information")
+	}
+
+	sessionID, ok := val.(string)
+	if !ok {
+		return "", errors.New("session ID information is of the wrong type")
+	}
+
+	return sessionID, nil
+}
@@ -48,6 +48,41 @@ func DecryptOpenAIKey(encryptionKeyHex string, ciphertext string) (string, error
 	return decrypt(config, ciphertext)
 }
 
+// GetMFASecretCipherConfig gets the cipher config for two-factor authentication secrets.
+func GetMFASecretCipherConfig(encryptionKeyHex string) (*CipherConfig, error) {
+	if encryptionKeyHex == "" {
+		return nil, errors.New("mfa secret encryption key must be set")
+	}
+	encryptionKey, err := hex.DecodeString(encryptionKeyHex)
+	if err != nil {
+		return nil, fmt.Errorf("unable to decode mfa secret encryption key hex: %v", err)
+	}
+	if _, err := aes.NewCipher(encryptionKey); err != nil {
+		return nil, fmt.Errorf("mfa secret encryption key must be 16, 24 or 32 bytes: %v", err)
+	}
+	return &CipherConfig{
+		EncryptionKey: encryptionKey,
+	}, nil
+}
+
+// EncryptMFASecret encrypts a two-factor authentication secret with the secret key.
+func EncryptMFASecret(encryptionKeyHex string, plaintext string) (string, error) {
+	config, err := GetMFASecretCipherConfig(encryptionKeyHex)
+	if err != nil {
+		return "", err
+	}
+	return encrypt(config, plaintext)
+}
+
+// DecryptMFASecret decrypts a two-factor authentication secret with the secret key.
+func DecryptMFASecret(encryptionKeyHex string, ciphertext string) (string, error) {
+	config, err := GetMFASecretCipherConfig(encryptionKeyHex)
+	if err != nil {
+		return "", err
+	}
+	return decrypt(config, ciphertext)
+}
+
 // encrypt encrypts the plaintext with the secret key.
 func encrypt(config *CipherConfig, plaintext string) (string, error) {
 	block, err := aes.NewCipher(config.EncryptionKey)